@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"code-editing-agent/internal/audit"
+	"code-editing-agent/internal/tools"
+)
+
+// diffSession runs `agent diff [session]`, which shows what the tools
+// changed in a session, the latest by default, against the checkpoints of
+// the files from before its first change. Unlike git diff it shows only
+// the agent's changes, including new files and files outside git. It
+// returns the exit code.
+func diffSession(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	dir := flags.String("dir", audit.DefaultDir, "Directory of the audit logs, which name the sessions")
+	format := flags.String("format", "unified", "Diff format: unified or side-by-side")
+	vscode := flags.Bool("vscode", false, "Open each changed file in a VS Code diff editor instead of printing the diffs")
+	flags.Parse(args)
+	if flags.NArg() > 1 || (*format != "unified" && *format != "side-by-side") {
+		fmt.Println("usage: agent diff [--dir DIR] [--format unified|side-by-side] [--vscode] [session]")
+		return 2
+	}
+
+	// Sessions are named after when they started, and end when the next
+	// one starts.
+	sessions, err := audit.Sessions(*dir)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	if len(sessions) == 0 {
+		fmt.Printf("No sessions are recorded in %s; sessions are recorded in trusted workspaces.\n", *dir)
+		return 1
+	}
+	i := len(sessions) - 1
+	if flags.NArg() == 1 {
+		name := strings.TrimSuffix(filepath.Base(flags.Arg(0)), ".jsonl")
+		i = -1
+		for j, s := range sessions {
+			if s == name {
+				i = j
+			}
+		}
+		if i < 0 {
+			fmt.Printf("No session %s in %s. Sessions:\n  %s\n", name, *dir, strings.Join(sessions, "\n  "))
+			return 1
+		}
+	}
+	session := sessions[i]
+	start, err := audit.SessionStart(session)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	var end time.Time
+	if i+1 < len(sessions) {
+		if end, err = audit.SessionStart(sessions[i+1]); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
+	}
+	changes, err := tools.ChangesBetween(start, end)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	if len(changes) == 0 {
+		fmt.Printf("Session %s left no changes to files.\n", session)
+		return 0
+	}
+
+	added, removed := 0, 0
+	for _, change := range changes {
+		added += change.Added
+		removed += change.Removed
+	}
+	fmt.Printf("Session %s changed %d file(s) (+%d -%d):\n", session, len(changes), added, removed)
+	for _, change := range changes {
+		fmt.Printf("  %-8s %s (+%d -%d)\n", change.Status, change.Path, change.Added, change.Removed)
+	}
+	if *vscode {
+		if err := openDiffsInVSCode(session, changes); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
+		return 0
+	}
+
+	color := term.IsTerminal(int(os.Stdout.Fd()))
+	width := 160
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		width = w
+	}
+	for _, change := range changes {
+		fmt.Println()
+		diff := change.Diff
+		binary := bytes.IndexByte(change.Before, 0) >= 0 || bytes.IndexByte(change.After, 0) >= 0
+		if *format == "side-by-side" && !binary {
+			diff = tools.SideBySideDiff(change.Path, string(change.Before), string(change.After), width)
+		}
+		if color {
+			diff = tools.ColorizeDiff(diff)
+		}
+		fmt.Print(diff)
+	}
+	return 0
+}
+
+// openDiffsInVSCode opens a diff editor for each change with `code
+// --diff`. The old contents are written to a temporary directory; files
+// that are still as the session left them are opened in place, so they can
+// be edited there.
+func openDiffsInVSCode(session string, changes []tools.FileChange) error {
+	code, err := exec.LookPath("code")
+	if err != nil {
+		return errors.New("the code command is not on the PATH; in VS Code, run \"Shell Command: Install 'code' command in PATH\"")
+	}
+	dir := filepath.Join(os.TempDir(), "agent-diff-"+session)
+	write := func(side, path string, content []byte) (string, error) {
+		file := filepath.Join(dir, side, path)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return "", err
+		}
+		return file, os.WriteFile(file, content, 0600)
+	}
+	for _, change := range changes {
+		before, err := write("before", change.Path, change.Before)
+		if err != nil {
+			return err
+		}
+		after := change.Path
+		if current, err := os.ReadFile(change.Path); err != nil || !bytes.Equal(current, change.After) {
+			if after, err = write("after", change.Path, change.After); err != nil {
+				return err
+			}
+		}
+		if err := exec.Command(code, "--diff", before, after).Run(); err != nil {
+			return fmt.Errorf("code --diff %s: %w", change.Path, err)
+		}
+	}
+	fmt.Printf("Opened %d diff(s) in VS Code.\n", len(changes))
+	return nil
+}
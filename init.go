@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"code-editing-agent/internal/config"
+	"code-editing-agent/internal/project"
+	"code-editing-agent/internal/tools"
+)
+
+// initNotes runs `agent init`, which scans the workspace and writes an
+// AGENT.md describing it for the system prompt, and returns the exit code.
+func initNotes(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	force := flags.Bool("force", false, "Replace an existing AGENT.md")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fmt.Println("usage: agent init [--force]")
+		return 2
+	}
+
+	const path = "AGENT.md"
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Printf("%s already exists; edit it, or run agent init --force to replace it.\n", path)
+		return 1
+	}
+	files, err := tools.ProjectFiles(".")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	cwd, _ := os.Getwd()
+	notes := project.Notes(cwd, files)
+	if err := os.WriteFile(path, []byte(notes), 0644); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	fmt.Printf("Wrote %s from %d files. Review it: it is added to the system prompt of every session here.\n", path, len(files))
+
+	// The notes are only read if the config still lists them.
+	workspace := cwd
+	if trusted, _ := config.IsTrusted(cwd); !trusted {
+		workspace = ""
+	}
+	if cfg, err := config.Load(workspace); err == nil && cfg.ContextFiles != nil {
+		for _, name := range cfg.ContextFiles {
+			if filepath.Clean(name) == path {
+				return 0
+			}
+		}
+		fmt.Printf("\u001b[93mWarning\u001b[0m: context_files in your config does not list %s, so it is not read.\n", path)
+	}
+	return 0
+}
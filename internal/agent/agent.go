@@ -2,141 +2,581 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"code-editing-agent/internal/audit"
+	"code-editing-agent/internal/commands"
+	"code-editing-agent/internal/hooks"
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/policy"
+	"code-editing-agent/internal/redact"
+	"code-editing-agent/internal/sessions"
 	"code-editing-agent/internal/tools"
-
-	openai "github.com/sashabaranov/go-openai"
 )
 
+const defaultMaxTokens = 1024
+
 type Agent struct {
-	client         *openai.Client
+	provider       llm.Provider
+	model          string
+	maxTokens      int
+	temperature    *float64
+	systemPrompt   string
+	display        Display
+	progress       Progress
 	getUserMessage func() (string, bool)
-	tools          []tools.ToolDefinition
+	tools          *tools.Registry
+	conversation   []llm.Message
+	contextManager *ContextManager
+	commands       []commands.CommandDefinition
+	usage          llm.UsageTracker
+	watcher        ChangeWatcher
+	// tokenBudget, when positive, ends a turn once the session has used
+	// that many tokens; sub-tasks have one.
+	tokenBudget int
+	// maxTurnSteps pauses an interactive turn; see SetMaxTurnSteps.
+	maxTurnSteps int
+	// autoVerify checks the build after edits; see SetAutoVerify.
+	autoVerify bool
+	// auditLog records every tool call; see SetAudit.
+	auditLog *audit.Log
+	// workspace is held while the agent works on the workspace; see
+	// SetWorkspaceLock.
+	workspace sync.Locker
+	// hooks run on tool calls and session events; see SetHooks. endSession
+	// runs the session_end hooks once.
+	hooks      *hooks.Runner
+	endSession sync.Once
+	// budget caps the session's requests; budgetStart is the usage when the
+	// current allowance was granted.
+	budget      Budget
+	budgetStart llm.UsageTotal
+	// cancelTurn stops the turn in progress; see Interrupt.
+	cancelTurn context.CancelFunc
+	turnMu     sync.Mutex
+	// interrupted is set when the user stopped the last turn, so the model
+	// can be told with the next message.
+	interrupted bool
+	// resend is set by /retry to send the conversation again, and
+	// turnTemperature to the temperature /retry set for that turn.
+	resend          bool
+	turnTemperature *float64
+	// composed is a message a command, such as /editor, sends in place of
+	// the command.
+	composed string
+	// images are attached with /image to the user's next message.
+	images []llm.Image
+	// branches are the lines of the conversation made with /fork; branch
+	// is the index of the current one, whose messages are conversation.
+	branches []*branch
+	branch   int
+	// switchedFrom is the branch the user last switched away from, so the
+	// model can be told with the next message.
+	switchedFrom string
+	lastToolCall *toolCall
+	// router picks the model of each turn while routing is on; see
+	// SetRouter. turnModel is the model of the turn in progress, when not
+	// the agent's model, nextTurnModel the one /model set for the next
+	// turn, and failedCalls counts the tool calls that failed since a turn
+	// last finished cleanly.
+	router        *Router
+	routing       bool
+	turnModel     string
+	nextTurnModel string
+	failedCalls   int
+	// session describes the session in the index at sessionIndex; see
+	// SetSessionIndex. sessionMu guards it while the title is made.
+	sessionIndex string
+	session      sessions.Entry
+	sessionMu    sync.Mutex
+	// lastToolCallMu guards lastToolCall while tools run in parallel.
+	lastToolCallMu sync.Mutex
 }
 
 func NewAgent(
-	client *openai.Client,
+	provider llm.Provider,
+	config llm.Config,
+	systemPrompt string,
 	getUserMessage func() (string, bool),
-	toolsList []tools.ToolDefinition,
+	registry *tools.Registry,
 ) *Agent {
-	return &Agent{
-		client:         client,
+	a := &Agent{
+		provider:       provider,
+		model:          config.Model,
+		maxTokens:      config.MaxTokens,
+		temperature:    config.Temperature,
+		systemPrompt:   systemPrompt,
+		display:        &consoleDisplay{},
 		getUserMessage: getUserMessage,
-		tools:          toolsList,
+		tools:          registry,
 	}
+	if a.maxTokens <= 0 {
+		a.maxTokens = defaultMaxTokens
+	}
+	a.resetContextManager()
+	return a
 }
 
-func (a *Agent) Run(ctx context.Context) error {
-	conversation := []openai.ChatCompletionMessage{}
-	fmt.Println("Chat with OpenAI (use 'ctrl-c' to quit)")
+// ChangeWatcher reports changes to the workspace made outside the agent.
+type ChangeWatcher interface {
+	// Changes returns the files changed since the last call.
+	Changes() []string
+	// Pause attributes changes to the agent, while its tools run, until
+	// Resume.
+	Pause()
+	Resume()
+}
+
+// SetWatcher makes the agent tell the model about files changed outside
+// the agent, so it does not edit them from a stale view.
+func (a *Agent) SetWatcher(watcher ChangeWatcher) {
+	a.watcher = watcher
+}
+
+// SetDisplay replaces the plain terminal output of the conversation.
+func (a *Agent) SetDisplay(display Display) {
+	a.display = display
+}
+
+// Progress shows what the agent is waiting on, such as the model or a tool,
+// and for how long.
+type Progress interface {
+	// Show shows label until the returned function is called.
+	Show(label string) (done func())
+}
+
+// SetProgress makes the agent show what it waits on while the model
+// replies and tools run.
+func (a *Agent) SetProgress(progress Progress) {
+	a.progress = progress
+}
+
+// showProgress shows label with the agent's Progress, if it has one, until
+// the returned function is called.
+func (a *Agent) showProgress(label string) func() {
+	if a.progress == nil {
+		return func() {}
+	}
+	return a.progress.Show(label)
+}
+
+// SetWorkspaceLock makes the agent give up lock while it waits for the
+// model and take it again before going on, for agents that share the
+// process, and with it the working directory, with others. The caller
+// holds lock while the agent runs, so that the agents take turns at the
+// workspace but wait for their models at the same time.
+func (a *Agent) SetWorkspaceLock(lock sync.Locker) {
+	a.workspace = lock
+}
+
+func (a *Agent) Run(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("agent crashed: %w", a.recoverCrash(r))
+		}
+	}()
+
+	a.ClearConversation()
+	a.startSession()
+	defer a.EndSession()
+	fmt.Printf("Chat with %s (type /help for commands, ctrl-c to interrupt or quit)\n", a.model)
 
 	for {
-		fmt.Print("\u001b[94mYou\u001b[0m: ")
 		userInput, ok := a.getUserMessage()
 		if !ok {
 			break
 		}
 
-		if len(conversation) > 20 {
-			conversation = conversation[len(conversation)-10:]
+		if name, args, isCommand := commands.Parse(userInput); isCommand {
+			err := a.runCommand(name, args)
+			if errors.Is(err, commands.ErrExit) {
+				return nil
+			}
+			if a.composed == "" && !a.resend {
+				continue
+			}
+			userInput, a.composed = a.composed, ""
+		}
+		if a.resend {
+			a.resend = false
+			a.interrupted = false
+		} else {
+			files, images := a.mentionedFiles(userInput)
+			userMessage := llm.Message{
+				Role:    llm.RoleUser,
+				Content: userInput + files + a.interruptionNote() + a.branchNote() + a.externalChanges(),
+				Images:  append(a.images, images...),
+			}
+			a.images = nil
+			a.conversation = append(a.conversation, userMessage)
+			a.showUserMessage(userMessage.Content)
+			a.nameSession(userInput)
 		}
 
-		userMessage := openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: userInput,
+		a.routeTurn(userInput)
+		turnCtx, endTurn := a.startTurn(ctx)
+		_, err := a.runTurn(turnCtx, 0, false)
+		a.turnModel = ""
+		a.turnTemperature = nil
+		interrupted := turnCtx.Err() != nil && ctx.Err() == nil
+		endTurn()
+		if interrupted {
+			// The conversation keeps what was done before the interruption.
+			a.interrupted = true
+			fmt.Println("\u001b[93mInterrupted\u001b[0m. Press Ctrl+C again at the prompt to quit.")
+		} else if errors.Is(err, ErrBudgetExhausted) {
+			fmt.Println("\u001b[93mStopped\u001b[0m: the session budget is used up. Your next message will ask again whether to continue.")
+		} else if err != nil && llm.IsRetryable(err) {
+			// Retries ran out, but the API may recover; the user can try
+			// again later with /retry.
+			fmt.Printf("\u001b[91mError\u001b[0m: %v\nType /retry to send your message again.\n", err)
+		} else if err != nil {
+			return err
 		}
-		conversation = append(conversation, userMessage)
+		a.printTurnUsage()
+		a.recordTurn()
+	}
+	return nil
+}
+
+// turnResult describes how a turn went.
+type turnResult struct {
+	// Finished is set when the model ended the turn with a reply instead of
+	// more tool calls.
+	Finished bool
+	// Reply is the text of the model's last message.
+	Reply           string
+	Steps           int
+	ToolCalls       int
+	FailedToolCalls int
+}
 
-		for {
-			resp, err := a.runInference(ctx, conversation)
-			if err != nil {
-				return err
+// runTurn sends the conversation to the model and runs the tools it calls
+// until it replies without calling any. A failed tool call ends the turn so
+// the user can step in, unless keepGoing is set, in which case the model is
+// left to deal with the failure. maxSteps, when positive, bounds the number
+// of requests, as tokenBudget bounds the tokens they use. Without it, the
+// user is asked every few requests whether the model should go on.
+func (a *Agent) runTurn(ctx context.Context, maxSteps int, keepGoing bool) (turnResult, error) {
+	var result turnResult
+	var calls turnCalls
+	pauseAt := a.turnStepLimit()
+	for maxSteps <= 0 || result.Steps < maxSteps {
+		if a.tokenBudget > 0 && a.usage.Session().Tokens() >= a.tokenBudget {
+			return result, nil
+		}
+		if maxSteps <= 0 && result.Steps >= pauseAt {
+			if !a.escalate(result, &calls) {
+				return result, nil
 			}
+			pauseAt = result.Steps + a.turnStepLimit()
+		}
+		if err := a.checkBudget(); err != nil {
+			return result, err
+		}
+		resp, err := a.inferWithCompaction(ctx)
+		if err != nil {
+			return result, err
+		}
+		result.Steps++
+		result.Reply = resp.Content
+		a.conversation = append(a.conversation, *resp)
 
-			if len(resp.ToolCalls) == 0 {
-				fmt.Printf("\u001b[93mAssistant\u001b[0m: %s\n", resp.Content)
-				conversation = append(conversation, *resp)
-				break
+		// The reply text has already been streamed to the terminal.
+		if len(resp.ToolCalls) == 0 {
+			result.Finished = true
+			if result.FailedToolCalls == 0 {
+				a.failedCalls = 0
 			}
+			return result, nil
+		}
 
-			conversation = append(conversation, *resp)
-
-			allToolsSuccessful := true
-			for _, toolCall := range resp.ToolCalls {
-				result := a.executeTool(toolCall.ID, toolCall.Function.Name, []byte(toolCall.Function.Arguments))
-				toolMessage := openai.ChatCompletionMessage{
-					Role:       openai.ChatMessageRoleTool,
-					Content:    result,
-					ToolCallID: toolCall.ID,
-				}
-				conversation = append(conversation, toolMessage)
-
-				// Mark the entire tool execution as failed if any tool fails
-				if strings.Contains(result, "error") || strings.Contains(result, "failed") {
-					allToolsSuccessful = false
-				}
+		allToolsSuccessful := true
+		failedBefore := result.FailedToolCalls
+		if a.watcher != nil {
+			a.watcher.Pause()
+		}
+		repairArguments(resp.ToolCalls)
+		results := a.executeTools(ctx, resp.ToolCalls)
+		if ctx.Err() == nil {
+			a.verifyEdits(ctx, resp.ToolCalls, results)
+		}
+		if a.watcher != nil {
+			a.watcher.Resume()
+		}
+		for i, toolCall := range resp.ToolCalls {
+			toolMessage := llm.Message{
+				Role:       llm.RoleTool,
+				Content:    results[i].JSON(),
+				ToolCallID: toolCall.ID,
 			}
+			a.conversation = append(a.conversation, toolMessage)
+
+			result.ToolCalls++
+			calls.record(toolCall)
 
-			if !allToolsSuccessful {
-				break
+			// Mark the entire tool execution as failed if any tool fails
+			if !results[i].Success {
+				result.FailedToolCalls++
+				allToolsSuccessful = false
 			}
 		}
+
+		if !allToolsSuccessful {
+			a.routeFailures(result.FailedToolCalls - failedBefore)
+		}
+
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if !allToolsSuccessful && !keepGoing {
+			return result, nil
+		}
 	}
-	return nil
+	return result, nil
 }
 
-func (a *Agent) executeTool(id string, name string, input []byte) string {
-	var toolDef tools.ToolDefinition
-	var found bool
-	for _, tool := range a.tools {
-		if tool.Name == name {
-			toolDef = tool
-			found = true
-			break
+// maxChangesListed bounds how many externally changed files are named to
+// the model.
+const maxChangesListed = 20
+
+// externalChanges describes the files changed outside the agent since the
+// last turn, as a note to append to the user's message.
+func (a *Agent) externalChanges() string {
+	if a.watcher == nil {
+		return ""
+	}
+	changes := a.watcher.Changes()
+	if len(changes) == 0 {
+		return ""
+	}
+	listed := changes
+	if len(listed) > maxChangesListed {
+		listed = listed[:maxChangesListed]
+	}
+	fmt.Printf("\u001b[90mChanged outside the agent: %s\u001b[0m\n", strings.Join(listed, ", "))
+	note := "\n\n(Note: these files were modified outside the agent since your last turn; re-read them before editing: " + strings.Join(listed, ", ")
+	if len(changes) > len(listed) {
+		note += fmt.Sprintf(" and %d more", len(changes)-len(listed))
+	}
+	return note + ")"
+}
+
+// printTurnUsage shows what the turn that just ended cost, next to the
+// session total.
+func (a *Agent) printTurnUsage() {
+	turn := a.usage.EndTurn()
+	if turn.Requests == 0 {
+		return
+	}
+	if d, ok := a.display.(EventDisplay); ok {
+		d.Usage(turn, a.usage.Session())
+		return
+	}
+	fmt.Printf("\u001b[90mTurn: %s\nSession: %s\u001b[0m\n", turn, a.usage.Session())
+}
+
+// retryLastPrompt queues the most recent user message to be sent again. By
+// default the turn it produced is discarded so the model starts over; with
+// keep the failed turn stays in the conversation for the model to learn from.
+func (a *Agent) retryLastPrompt(keep bool) bool {
+	i := a.lastPrompt()
+	if i < 0 {
+		return false
+	}
+	msg := a.conversation[i]
+	if keep {
+		a.conversation = append(a.conversation, msg)
+	} else {
+		a.conversation = a.conversation[:i+1]
+	}
+	fmt.Printf("\u001b[90mRetrying: %s\u001b[0m\n", msg.Content)
+	return true
+}
+
+// lastPrompt returns the index of the user's last message in the
+// conversation, or -1 when there is none.
+func (a *Agent) lastPrompt() int {
+	for i := len(a.conversation) - 1; i >= 0; i-- {
+		if a.conversation[i].Role == llm.RoleUser {
+			return i
 		}
 	}
+	return -1
+}
+
+// typedText is what the user typed of a message, without the files and
+// notes the agent added to it, which all start on a line of their own with
+// "(Attached by the user" or "(Note:".
+func typedText(content string) string {
+	for _, marker := range []string{"\n\n(Attached by the user with @", "\n\n(Note: "} {
+		if i := strings.Index(content, marker); i >= 0 {
+			content = content[:i]
+		}
+	}
+	return content
+}
+
+func (a *Agent) executeTool(ctx context.Context, id string, name string, input []byte) (result tools.ToolResult) {
+	toolDef, found := a.findTool(name)
 	if !found {
-		return "tool not found"
+		return tools.Failed(fmt.Sprintf("tool %s not found", name))
+	}
+
+	a.display.ToolCall(id, name, string(input))
+	start := time.Now()
+	// The files a call changes are found from the checkpoints it takes.
+	lastID := -1
+	if a.auditLog != nil && toolDef.Category == tools.CategoryWrite {
+		lastID = audit.LastCheckpoint(tools.Checkpoints)
+	}
+	// called is set once the tool runs, for the post_tool hooks.
+	called := false
+	defer func() {
+		// Credentials the tool came across are not shown to the model.
+		result.Output = redact.String(result.Output)
+		result.Error = redact.String(result.Error)
+		if called {
+			a.postToolHooks(ctx, name, input, result)
+		}
+		a.display.ToolResult(id, name, result)
+		a.recordCall(toolDef, input, result, start, lastID)
+		log.Info("tool call", "tool", name, "success", result.Success,
+			"duration_ms", time.Since(start).Milliseconds(), "output_bytes", len(result.Output)+len(result.Error))
+		if log.Verbose() {
+			log.Debug("tool call", "tool", name, "input", redact.String(string(input)),
+				"output", result.Output, "error", result.Error)
+		}
+	}()
+	a.lastToolCallMu.Lock()
+	a.lastToolCall = &toolCall{Name: name, Input: string(input)}
+	a.lastToolCallMu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = tools.Failed(fmt.Sprintf("tool %s crashed: %v", name, a.recoverCrash(r)))
+		}
+	}()
+
+	if tools.ReadOnly && toolDef.Category != tools.CategoryRead {
+		return tools.Failed(fmt.Sprintf("%s is not available: the session is read-only, so files cannot be changed and commands cannot run.", name))
 	}
 
-	fmt.Printf("\u001b[92mtool\u001b[0m: %s(%s)\n", name, string(input))
-	response, err := toolDef.Function(input)
+	// Arguments repairArguments could not fix are sent back with the schema.
+	if !json.Valid(input) {
+		return argumentsFailure(toolDef, input)
+	}
+
+	verdict := checkPolicy(toolDef, input)
+	if verdict.decision == policy.Deny {
+		return refusedByPolicy(name, verdict)
+	}
+
+	if result, stopped := a.preToolHooks(ctx, name, input); stopped {
+		return result
+	}
+
+	// In a dry run, tools that change files only show what they would do.
+	if tools.IsDryRun(toolDef, input) {
+		shown, response, err := tools.RunDry(ctx, toolDef, input)
+		if err != nil {
+			return tools.Failed(err.Error())
+		}
+		fmt.Printf("\u001b[96mDry run\u001b[0m: %s would make these changes:\n%s\n", name, shown)
+		return tools.Succeeded(response)
+	}
+
+	// Tools that change things show what they would do and wait for the
+	// user's go-ahead, unless the approval policy says otherwise.
+	defer tools.BeginCall(name)()
+	if !approveCall(toolDef, input, verdict) {
+		return tools.Failed(fmt.Sprintf("The user declined to run %s. Ask them how they would like to proceed.", name))
+	}
+
+	called = true
+	done := a.showProgress("Running " + name)
+	response, err := a.callTool(ctx, toolDef, input)
+	done()
 	if err != nil {
-		return err.Error()
-	}
-	return response
-}
-
-func (a *Agent) runInference(ctx context.Context, conversation []openai.ChatCompletionMessage,
-) (*openai.ChatCompletionMessage, error) {
-	openaiTools := []openai.Tool{}
-	for _, tool := range a.tools {
-		openaiTools = append(openaiTools, openai.Tool{
-			Type: openai.ToolTypeFunction,
-			Function: openai.FunctionDefinition{
-				Name:        tool.Name,
-				Description: tool.Description,
-				Parameters:  tool.InputSchema,
-			},
+		return tools.Failed(withSchema(toolDef, err))
+	}
+	return tools.Succeeded(response)
+}
+
+// llmTools describes the agent's tools to the model.
+func (a *Agent) llmTools() []llm.Tool {
+	var llmTools []llm.Tool
+	for _, tool := range a.tools.Enabled() {
+		llmTools = append(llmTools, llm.Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.InputSchema,
 		})
 	}
+	return llmTools
+}
 
-	resp, err := a.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:     openai.GPT3Dot5Turbo,
-		MaxTokens: 1024,
-		Messages:  conversation,
-		Tools:     openaiTools,
-	})
+func (a *Agent) runInference(ctx context.Context, conversation []llm.Message) (*llm.Message, error) {
+	if a.workspace != nil {
+		a.workspace.Unlock()
+		defer a.workspace.Lock()
+	}
+	model := a.requestModel()
+	temperature := a.temperature
+	if a.turnTemperature != nil {
+		temperature = a.turnTemperature
+	}
+	if log.Verbose() {
+		log.Debug("model request", "model", model, "new_messages", redactMessages(newMessages(conversation)))
+	}
+	start := time.Now()
+	done := a.showProgress("Waiting for " + model)
+	// Text is shown as it arrives.
+	resp, err := a.provider.ChatStream(ctx, llm.Request{
+		Model:       model,
+		MaxTokens:   a.maxTokens,
+		Temperature: temperature,
+		Messages:    conversation,
+		Tools:       a.llmTools(),
+	}, a.display.AssistantText)
+	done()
+	a.display.AssistantDone()
 	if err != nil {
+		log.Warn("model request failed", "model", model, "messages", len(conversation),
+			"duration_ms", time.Since(start).Milliseconds(), "error", err.Error())
 		return nil, err
 	}
+	a.usage.Add(model, resp.Usage)
+	var calls []string
+	for _, call := range resp.Message.ToolCalls {
+		calls = append(calls, call.Name)
+	}
+	log.Info("model request", "model", model, "messages", len(conversation),
+		"duration_ms", time.Since(start).Milliseconds(), "prompt_tokens", resp.Usage.PromptTokens,
+		"completion_tokens", resp.Usage.CompletionTokens, "tool_calls", calls)
+	if log.Verbose() {
+		log.Debug("model response", "model", model, "message", redactMessages([]llm.Message{resp.Message})[0])
+	}
+
+	if resp.Message.Content == "" && len(resp.Message.ToolCalls) == 0 {
+		return nil, fmt.Errorf("model returned an empty response")
+	}
+	return &resp.Message, nil
+}
 
-	message := resp.Choices[0].Message
-	return &openai.ChatCompletionMessage{
-		Role:      message.Role,
-		Content:   message.Content,
-		ToolCalls: message.ToolCalls,
-	}, nil
+// newMessages returns the messages added since the model's last reply: the
+// user's message or the results of the tools it called.
+func newMessages(conversation []llm.Message) []llm.Message {
+	for i := len(conversation) - 1; i >= 0; i-- {
+		if conversation[i].Role == llm.RoleAssistant {
+			return conversation[i+1:]
+		}
+	}
+	return conversation
 }
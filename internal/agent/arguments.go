@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/tools"
+)
+
+// repairArguments fixes the arguments of calls that are not valid JSON but
+// only for a slip that leaves no doubt about what was meant, so the calls
+// run instead of failing. The calls are changed in place, which fixes them
+// in the conversation too. Arguments that are cut off, as when the reply ran
+// out of tokens, are left alone: closing them could write half a file.
+func repairArguments(calls []llm.ToolCall) {
+	for i, call := range calls {
+		if json.Valid([]byte(call.Arguments)) {
+			continue
+		}
+		if repaired, ok := repairJSON(call.Arguments); ok {
+			log.Info("repaired tool call arguments", "tool", call.Name)
+			if log.Verbose() {
+				log.Debug("repaired tool call arguments", "tool", call.Name, "before", call.Arguments, "after", repaired)
+			}
+			calls[i].Arguments = repaired
+		}
+	}
+}
+
+// repairJSON returns s as a valid JSON object, fixing what models get wrong
+// in the arguments they write: a Markdown code fence around them, trailing
+// commas, single-quoted strings, unquoted keys, Python's True, False and
+// None, and line breaks and tabs left unescaped in strings. It reports false
+// when s is still not valid, or is cut off.
+func repairJSON(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "{}", true
+	}
+	if fenced, ok := strings.CutPrefix(s, "```"); ok {
+		// The fence may name the language: ```json.
+		if newline := strings.IndexByte(fenced, '\n'); newline >= 0 {
+			fenced = fenced[newline+1:]
+		}
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+	}
+	if !strings.HasPrefix(s, "{") {
+		return "", false
+	}
+
+	var out strings.Builder
+	var open []byte
+	var quote byte // the quote of the string being read, if any
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			switch {
+			case c == '\\' && i+1 < len(s):
+				i++
+				switch next := s[i]; {
+				case next == '\'':
+					out.WriteByte('\'')
+				case strings.IndexByte(`"\/bfnrtu`, next) >= 0:
+					out.WriteByte('\\')
+					out.WriteByte(next)
+				default:
+					// An escape JSON does not have is taken as a backslash.
+					out.WriteString(`\\`)
+					out.WriteByte(next)
+				}
+			case c == quote:
+				out.WriteByte('"')
+				quote = 0
+			case c == '"':
+				out.WriteString(`\"`)
+			case c == '\n':
+				out.WriteString(`\n`)
+			case c == '\r':
+				out.WriteString(`\r`)
+			case c == '\t':
+				out.WriteString(`\t`)
+			case c < 0x20:
+				fmt.Fprintf(&out, `\u%04x`, c)
+			default:
+				out.WriteByte(c)
+			}
+			continue
+		}
+		switch {
+		case c == '"' || c == '\'':
+			quote = c
+			out.WriteByte('"')
+		case c == '{' || c == '[':
+			open = append(open, c)
+			out.WriteByte(c)
+		case c == '}' || c == ']':
+			if len(open) == 0 {
+				return "", false
+			}
+			open = open[:len(open)-1]
+			trimTrailingComma(&out)
+			out.WriteByte(c)
+		case isWordStart(c):
+			j := i
+			for j < len(s) && isWordPart(s[j]) {
+				j++
+			}
+			word := s[i:j]
+			switch word {
+			case "True":
+				word = "true"
+			case "False":
+				word = "false"
+			case "None":
+				word = "null"
+			default:
+				// A bare word before a colon is a key.
+				if rest := strings.TrimLeft(s[j:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+					word = `"` + word + `"`
+				}
+			}
+			out.WriteString(word)
+			i = j - 1
+		default:
+			out.WriteByte(c)
+		}
+	}
+	if quote != 0 || len(open) > 0 {
+		return "", false
+	}
+	repaired := out.String()
+	var object map[string]json.RawMessage
+	if json.Unmarshal([]byte(repaired), &object) != nil {
+		return "", false
+	}
+	return repaired, true
+}
+
+// trimTrailingComma drops a comma, and the space after it, from the end of
+// out, before the bracket that closes an object or array.
+func trimTrailingComma(out *strings.Builder) {
+	text := out.String()
+	trimmed := strings.TrimRight(text, " \t\r\n")
+	if strings.HasSuffix(trimmed, ",") {
+		out.Reset()
+		out.WriteString(trimmed[:len(trimmed)-1])
+	}
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || (c >= '0' && c <= '9')
+}
+
+// argumentsFailure is the result of a call whose arguments are not valid
+// JSON even after repairArguments, asking the model to send it again with
+// the tool's schema.
+func argumentsFailure(tool tools.ToolDefinition, input []byte) tools.ToolResult {
+	var v interface{}
+	err := json.Unmarshal(input, &v)
+	problem := "they are empty"
+	if err != nil {
+		problem = err.Error()
+	}
+	return tools.Failed(fmt.Sprintf("The arguments of this %s call are not valid JSON (%s), so it did not run. "+
+		"Send the call again with arguments that are one complete JSON object, with double-quoted keys and strings, "+
+		"matching this schema:\n%s", tool.Name, problem, toolSchema(tool)))
+}
+
+// withSchema adds the tool's schema to err when the tool could not decode
+// its arguments, such as a string given for a number, so the model can
+// send them again as the tool expects.
+func withSchema(tool tools.ToolDefinition, err error) string {
+	message := err.Error()
+	if !strings.HasPrefix(message, "failed to parse "+tool.Name+" input") {
+		return message
+	}
+	return message + "\nSend the call again with arguments matching this schema:\n" + toolSchema(tool)
+}
+
+// toolSchema is the JSON schema of a tool's arguments.
+func toolSchema(tool tools.ToolDefinition) string {
+	data, err := json.MarshalIndent(tool.InputSchema, "", "  ")
+	if err != nil {
+		return fmt.Sprint(tool.InputSchema)
+	}
+	return string(data)
+}
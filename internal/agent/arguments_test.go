@@ -0,0 +1,60 @@
+package agent
+
+import "testing"
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "  ", `{}`},
+		{"trailing comma in object", `{"path": "a.go",}`, `{"path": "a.go"}`},
+		{"trailing comma in array", `{"paths": ["a.go", "b.go", ]}`, `{"paths": ["a.go", "b.go"]}`},
+		{"single quotes", `{'path': 'a.go'}`, `{"path": "a.go"}`},
+		{"double quote in single quotes", `{'old_str': 'say "hi"'}`, `{"old_str": "say \"hi\""}`},
+		{"escaped single quote", `{'content': 'it\'s'}`, `{"content": "it's"}`},
+		{"bare keys", `{path: "a.go", line: 3}`, `{"path": "a.go", "line": 3}`},
+		{"python literals", `{"a": True, "b": False, "c": None}`, `{"a": true, "b": false, "c": null}`},
+		{"code fence", "```json\n{\"path\": \"a.go\"}\n```", `{"path": "a.go"}`},
+		{"code fence without language", "```\n{\"path\": \"a.go\"}\n```", `{"path": "a.go"}`},
+		{"raw newline and tab", "{\"content\": \"a\n\tb\"}", `{"content": "a\n\tb"}`},
+		{"raw carriage return", "{\"content\": \"a\r\nb\"}", `{"content": "a\r\nb"}`},
+		{"invalid escape", `{"pattern": "\d+"}`, `{"pattern": "\\d+"}`},
+		{"valid escapes kept", `{"content": "a\nbé",}`, `{"content": "a\nbé"}`},
+		{"words in strings kept", `{'content': 'True, None',}`, `{"content": "True, None"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := repairJSON(tt.in)
+			if !ok {
+				t.Fatalf("repairJSON(%q) refused, want %q", tt.in, tt.want)
+			}
+			if got != tt.want {
+				t.Errorf("repairJSON(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepairJSONRefuses(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"cut off string", `{"path": "a.go", "content": "cut off`},
+		{"cut off object", `{"path": "a.go", "line": 1`},
+		{"cut off array", `{"paths": ["a.go", "b.go"`},
+		{"unmatched close", `{"a": 1}}`},
+		{"bare value", `{"a": foo}`},
+		{"array", `[1, 2]`},
+		{"not json", `path=a.go`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := repairJSON(tt.in); ok {
+				t.Errorf("repairJSON(%q) = %q, want it refused", tt.in, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"time"
+
+	"code-editing-agent/internal/audit"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/tools"
+)
+
+// SetAudit records every tool call in l from now on, sub-tasks' included.
+func (a *Agent) SetAudit(l *audit.Log) {
+	a.auditLog = l
+}
+
+// recordCall adds a finished call to the audit log. lastID is the newest
+// checkpoint before a call that may change files, or -1 for other calls.
+func (a *Agent) recordCall(tool tools.ToolDefinition, input []byte, result tools.ToolResult, start time.Time, lastID int) {
+	if a.auditLog == nil {
+		return
+	}
+	entry := audit.Entry{
+		Time:       start,
+		Tool:       tool.Name,
+		Category:   tool.Category,
+		Input:      input,
+		Success:    result.Success,
+		Output:     result.Output,
+		Error:      result.Error,
+		DurationMS: time.Since(start).Milliseconds(),
+		DryRun:     tools.IsDryRun(tool, input),
+	}
+	if lastID >= 0 && result.Success && !entry.DryRun {
+		entry.Files, entry.Diff = audit.Changes(tools.Checkpoints, lastID)
+	}
+	if err := a.auditLog.Record(entry); err != nil {
+		log.Warn("audit log write failed", "tool", tool.Name, "error", err.Error())
+	}
+}
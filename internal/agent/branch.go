@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/commands"
+	"code-editing-agent/internal/llm"
+)
+
+// mainBranch is the name of the conversation a session starts with.
+const mainBranch = "main"
+
+// branch is a line of the conversation kept by /fork while another one is
+// being talked in.
+type branch struct {
+	name         string
+	parent       string
+	forkedAt     int
+	conversation []llm.Message
+}
+
+// currentBranch returns the branch being talked in, creating the main one
+// the first time branches are used.
+func (a *Agent) currentBranch() *branch {
+	if len(a.branches) == 0 {
+		a.branches = []*branch{{name: mainBranch}}
+	}
+	return a.branches[a.branch]
+}
+
+func (a *Agent) findBranch(name string) int {
+	for i, b := range a.branches {
+		if b.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Fork copies the conversation so far into a new branch called name, or a
+// numbered one when name is empty, and carries on in it. The branch it
+// was forked from is kept as it is, to be switched back to.
+func (a *Agent) Fork(name string) (string, error) {
+	current := a.currentBranch()
+	if name == "" {
+		for n := len(a.branches); ; n++ {
+			name = fmt.Sprintf("branch-%d", n)
+			if a.findBranch(name) < 0 {
+				break
+			}
+		}
+	}
+	if strings.ContainsAny(name, " \t/") {
+		return "", fmt.Errorf("branch names cannot contain spaces or slashes")
+	}
+	if a.findBranch(name) >= 0 {
+		return "", fmt.Errorf("a branch called %s already exists", name)
+	}
+
+	// Each branch gets its own copy, so /retry truncating one and appending
+	// to it cannot overwrite the other.
+	current.conversation = a.conversation
+	a.conversation = append([]llm.Message(nil), a.conversation...)
+	a.branches = append(a.branches, &branch{name: name, parent: current.name, forkedAt: len(a.conversation)})
+	a.branch = len(a.branches) - 1
+	return name, nil
+}
+
+// SwitchBranch puts the current conversation aside and carries on with
+// the branch called name.
+func (a *Agent) SwitchBranch(name string) error {
+	current := a.currentBranch()
+	i := a.findBranch(name)
+	if i < 0 {
+		return fmt.Errorf("no branch called %s", name)
+	}
+	if i == a.branch {
+		return fmt.Errorf("already on %s", name)
+	}
+	current.conversation = a.conversation
+	a.conversation, a.branches[i].conversation = a.branches[i].conversation, nil
+	a.branch = i
+	// The workspace is shared by all branches, so the other one may have
+	// changed files since this one last saw them.
+	a.switchedFrom = current.name
+	a.interrupted = false
+	return nil
+}
+
+// Branches lists the branches of the conversation in the order they were
+// made; the session has a single main one until /fork is used.
+func (a *Agent) Branches() []commands.Branch {
+	a.currentBranch()
+	list := make([]commands.Branch, len(a.branches))
+	for i, b := range a.branches {
+		messages := len(b.conversation)
+		if i == a.branch {
+			messages = len(a.conversation)
+		}
+		list[i] = commands.Branch{
+			Name:     b.name,
+			Parent:   b.parent,
+			ForkedAt: b.forkedAt,
+			Messages: messages,
+			Current:  i == a.branch,
+		}
+	}
+	return list
+}
+
+// branchNote tells the model, with the first message after switching
+// branches, that files may have changed under it.
+func (a *Agent) branchNote() string {
+	if a.switchedFrom == "" {
+		return ""
+	}
+	from := a.switchedFrom
+	a.switchedFrom = ""
+	return fmt.Sprintf("\n\n(Note: the user explored another approach in a separate conversation (%s) since your last turn, in the same workspace; files may have changed since you last read them, so re-read them before editing.)", from)
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/tools"
+)
+
+// ErrBudgetExhausted ends a turn when the session's budget is used up and
+// the user chose not to go on.
+var ErrBudgetExhausted = errors.New("session budget exhausted")
+
+// Budget caps the model requests of a session. Zero means no limit.
+type Budget struct {
+	MaxRequests int
+	// MaxCost is in dollars; requests to models without a known price do
+	// not count towards it.
+	MaxCost float64
+}
+
+func (b Budget) String() string {
+	var limits []string
+	if b.MaxRequests > 0 {
+		limits = append(limits, fmt.Sprintf("%d requests", b.MaxRequests))
+	}
+	if b.MaxCost > 0 {
+		limits = append(limits, fmt.Sprintf("$%.2f", b.MaxCost))
+	}
+	return strings.Join(limits, " or ")
+}
+
+// SetBudget makes the agent stop and ask the user before going past budget,
+// so a model looping on tool calls cannot run up costs unattended.
+func (a *Agent) SetBudget(budget Budget) {
+	a.budget = budget
+	a.budgetStart = a.usage.Session()
+}
+
+// checkBudget is called before each request. Once the budget is used up it
+// asks the user whether to go on, granting the same budget again if so, and
+// returns ErrBudgetExhausted if not.
+func (a *Agent) checkBudget() error {
+	if a.budget == (Budget{}) {
+		return nil
+	}
+	used := a.usage.Session()
+	requests := used.Requests - a.budgetStart.Requests
+	cost := used.Cost - a.budgetStart.Cost
+	if (a.budget.MaxRequests <= 0 || requests < a.budget.MaxRequests) && (a.budget.MaxCost <= 0 || cost < a.budget.MaxCost) {
+		return nil
+	}
+	fmt.Printf("\u001b[93mBudget\u001b[0m: the budget of %s is used up (%d request(s), $%.4f since it was granted)\n",
+		a.budget, requests, cost)
+	if !tools.Confirm("Continue with another " + a.budget.String() + "?") {
+		return ErrBudgetExhausted
+	}
+	a.budgetStart = used
+	return nil
+}
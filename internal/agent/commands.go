@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"code-editing-agent/internal/commands"
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// RegisterCommands makes slash commands available in the chat. A command
+// with the name of one already registered replaces it.
+func (a *Agent) RegisterCommands(list ...commands.CommandDefinition) {
+	for _, command := range list {
+		replaced := false
+		for i, existing := range a.commands {
+			if existing.Name == command.Name {
+				a.commands[i] = command
+				replaced = true
+			}
+		}
+		if !replaced {
+			a.commands = append(a.commands, command)
+		}
+	}
+}
+
+// runCommand runs the slash command called name, reporting its failure to
+// the user. Only commands.ErrExit is returned.
+func (a *Agent) runCommand(name string, args []string) error {
+	command, found := commands.Find(a.commands, name)
+	if !found {
+		fmt.Printf("Unknown command /%s. Type /help to list the commands.\n", name)
+		return nil
+	}
+	err := command.Function(a, args)
+	if errors.Is(err, commands.ErrExit) {
+		return err
+	}
+	if err != nil {
+		fmt.Printf("\u001b[91mError\u001b[0m: %v\n", err)
+	}
+	return nil
+}
+
+// The methods below let commands act on the agent as a commands.Session.
+
+func (a *Agent) Model() string {
+	return a.model
+}
+
+func (a *Agent) SetModel(model string) {
+	a.model = model
+	// A model chosen by the user is not routed away from.
+	a.routing = false
+	// The new model may have a different context window.
+	a.resetContextManager()
+}
+
+func (a *Agent) Tools() *tools.Registry {
+	return a.tools
+}
+
+func (a *Agent) SetToolEnabled(name string, enabled bool) error {
+	err := a.tools.SetEnabled(name, enabled)
+	if err != nil {
+		return err
+	}
+	// The tools offered take up a different part of the context window.
+	a.resetContextManager()
+	return nil
+}
+
+func (a *Agent) Commands() []commands.CommandDefinition {
+	return a.commands
+}
+
+func (a *Agent) Conversation() []llm.Message {
+	return a.conversation
+}
+
+func (a *Agent) ClearConversation() {
+	a.conversation = []llm.Message{}
+	if a.systemPrompt != "" {
+		a.conversation = append(a.conversation, llm.Message{Role: llm.RoleSystem, Content: a.systemPrompt})
+	}
+}
+
+func (a *Agent) AppendMessage(msg llm.Message) {
+	a.conversation = append(a.conversation, msg)
+}
+
+func (a *Agent) Retry(keep bool) bool {
+	a.resend = a.retryLastPrompt(keep)
+	return a.resend
+}
+
+func (a *Agent) SetTurnTemperature(temperature float64) {
+	a.turnTemperature = &temperature
+}
+
+func (a *Agent) LastPrompt() (string, bool) {
+	i := a.lastPrompt()
+	if i < 0 {
+		return "", false
+	}
+	return typedText(a.conversation[i].Content), true
+}
+
+func (a *Agent) EditLastPrompt(text string) bool {
+	i := a.lastPrompt()
+	if i < 0 {
+		return false
+	}
+	if len(a.conversation[i].Images) > 0 {
+		fmt.Println("\u001b[93mWarning\u001b[0m: the images attached to your last message are not sent again; attach them with /image")
+	}
+	a.conversation = a.conversation[:i]
+	a.composed = text
+	return true
+}
+
+func (a *Agent) Send(text string) {
+	a.composed = text
+}
+
+func (a *Agent) AttachImage(image llm.Image) int {
+	a.images = append(a.images, image)
+	return len(a.images)
+}
+
+func (a *Agent) Usage() llm.UsageTotal {
+	return a.usage.Session()
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"code-editing-agent/internal/llm"
+)
+
+// maxCompactionRetries bounds how often a request is retried after the API
+// rejects it for exceeding the context window.
+const maxCompactionRetries = 3
+
+// truncatedToolResultSize is how much of a tool result survives when the
+// current turn alone is too large for the context window.
+const truncatedToolResultSize = 2000
+
+// inferWithCompaction runs inference on the conversation, with stale tool
+// results pruned, trimmed to the token budget and, when the API still finds
+// it too long for the model's context window, compacts it further and tries
+// again.
+func (a *Agent) inferWithCompaction(ctx context.Context) (*llm.Message, error) {
+	a.pruneStaleResults()
+	a.conversation = a.contextManager.Fit(ctx, a.conversation)
+	for attempt := 0; ; attempt++ {
+		resp, err := a.runInference(ctx, a.conversation)
+		if err == nil || !isContextLengthError(err) || attempt == maxCompactionRetries {
+			return resp, err
+		}
+
+		compacted, ok := compactConversation(a.conversation)
+		if !ok {
+			return nil, err
+		}
+		fmt.Printf("\u001b[93mContext\u001b[0m: conversation too long for the model, compacted %d -> %d messages and retrying\n",
+			len(a.conversation), len(compacted))
+		a.conversation = compacted
+	}
+}
+
+// isContextLengthError reports whether the provider rejected a request
+// because it exceeded the model's context window.
+func isContextLengthError(err error) bool {
+	return errors.Is(err, llm.ErrContextLength)
+}
+
+// compactConversation drops the oldest complete turn (a user message and
+// everything up to the next user message), so tool results are never
+// separated from the tool calls that produced them. When only the current
+// turn is left, its tool results are truncated instead. It reports false if
+// nothing could be removed.
+func compactConversation(conversation []llm.Message) ([]llm.Message, bool) {
+	var turnStarts []int
+	for i, msg := range conversation {
+		if msg.Role == llm.RoleUser {
+			turnStarts = append(turnStarts, i)
+		}
+	}
+
+	if len(turnStarts) > 1 {
+		// Keep any leading system messages, drop the first turn.
+		var compacted []llm.Message
+		for _, msg := range conversation[:turnStarts[0]] {
+			if msg.Role == llm.RoleSystem {
+				compacted = append(compacted, msg)
+			}
+		}
+		return append(compacted, conversation[turnStarts[1]:]...), true
+	}
+
+	compacted := make([]llm.Message, len(conversation))
+	copy(compacted, conversation)
+	changed := false
+	for i, msg := range compacted {
+		if msg.Role == llm.RoleTool && len(msg.Content) > truncatedToolResultSize {
+			compacted[i].Content = msg.Content[:truncatedToolResultSize] +
+				fmt.Sprintf("\n[truncated %d bytes to fit the context window]", len(msg.Content)-truncatedToolResultSize)
+			changed = true
+		}
+	}
+	return compacted, changed
+}
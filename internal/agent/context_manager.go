@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"code-editing-agent/internal/llm"
+)
+
+const (
+	// summaryPrefix starts the synthetic message that stands in for history
+	// dropped from the conversation.
+	summaryPrefix = "Summary of earlier conversation, dropped to fit the context window:\n"
+	// maxSummarySize bounds the summary; the oldest lines go first.
+	maxSummarySize = 4000
+	// summaryLineSize bounds how much of each dropped message is quoted.
+	summaryLineSize = 160
+)
+
+const (
+	// Once the conversation takes up more than summarizeThreshold of the
+	// budget, the oldest turns are summarized until it takes up no more
+	// than summarizeTarget, so that summaries, which cost a request, are
+	// not needed again at every step.
+	summarizeThreshold = 0.9
+	summarizeTarget    = 0.6
+)
+
+// ContextManager keeps the conversation within the model's token budget.
+// It takes whole turns, oldest first, out of the conversation, so the system
+// prompt stays and every tool result stays next to the tool call that
+// produced it, and folds them into a summary message.
+type ContextManager struct {
+	provider llm.Provider
+	budget   int
+	// Summarize, when set, condenses the dropped messages and the previous
+	// summary into a new summary. Without it, or when it fails, a line per
+	// dropped message is added to the summary instead.
+	Summarize func(ctx context.Context, previous string, dropped []llm.Message) (string, error)
+}
+
+// NewContextManager returns a ContextManager for model that leaves room for
+// the reply and the tool definitions.
+func NewContextManager(provider llm.Provider, model string, maxTokens int, tools []llm.Tool) *ContextManager {
+	budget := llm.ContextWindow(model) - maxTokens
+	if schemas, err := json.Marshal(tools); err == nil {
+		budget -= provider.CountTokens([]llm.Message{{Content: string(schemas)}})
+	}
+	return &ContextManager{provider: provider, budget: budget}
+}
+
+// Fit returns conversation trimmed to the token budget.
+func (m *ContextManager) Fit(ctx context.Context, conversation []llm.Message) []llm.Message {
+	if m.provider.CountTokens(conversation) <= int(float64(m.budget)*summarizeThreshold) {
+		return conversation
+	}
+
+	var system []llm.Message
+	summary := ""
+	rest := conversation
+	for len(rest) > 0 && rest[0].Role == llm.RoleSystem {
+		if strings.HasPrefix(rest[0].Content, summaryPrefix) {
+			summary = strings.TrimPrefix(rest[0].Content, summaryPrefix)
+		} else {
+			system = append(system, rest[0])
+		}
+		rest = rest[1:]
+	}
+
+	var turnStarts []int
+	for i, msg := range rest {
+		if msg.Role == llm.RoleUser {
+			turnStarts = append(turnStarts, i)
+		}
+	}
+
+	// Drop turns until the rest fits, always keeping the current one. The
+	// line-per-message summary stands in for the final one while measuring.
+	target := int(float64(m.budget) * summarizeTarget)
+	var dropped []llm.Message
+	for len(turnStarts) > 1 {
+		next := turnStarts[1]
+		dropped = append(dropped, rest[:next]...)
+		rest = rest[next:]
+		for i := range turnStarts {
+			turnStarts[i] -= next
+		}
+		turnStarts = turnStarts[1:]
+
+		candidate := m.assemble(system, summarize(summary, dropped), rest)
+		if m.provider.CountTokens(candidate) <= target {
+			break
+		}
+	}
+	if len(dropped) == 0 {
+		return conversation
+	}
+	if m.Summarize != nil {
+		condensed, err := m.Summarize(ctx, summary, dropped)
+		if err == nil && condensed != "" {
+			return m.assemble(system, condensed+"\n", rest)
+		}
+		if ctx.Err() == nil {
+			fmt.Printf("\u001b[93mContext\u001b[0m: could not summarize earlier messages (%v); keeping an outline of them instead\n", err)
+		}
+	}
+	return m.assemble(system, summarize(summary, dropped), rest)
+}
+
+func (m *ContextManager) assemble(system []llm.Message, summary string, rest []llm.Message) []llm.Message {
+	out := append([]llm.Message{}, system...)
+	out = append(out, llm.Message{Role: llm.RoleSystem, Content: summaryPrefix + summary})
+	return append(out, rest...)
+}
+
+// summarize appends a line per dropped user request, assistant reply and
+// tool call to the previous summary. Tool results are left out; the model
+// can run the tool again if it needs them.
+func summarize(previous string, dropped []llm.Message) string {
+	var sb strings.Builder
+	sb.WriteString(previous)
+	for _, msg := range dropped {
+		switch msg.Role {
+		case llm.RoleUser:
+			fmt.Fprintf(&sb, "- User asked: %s\n", clip(msg.Content))
+		case llm.RoleAssistant:
+			if msg.Content != "" {
+				fmt.Fprintf(&sb, "- Assistant: %s\n", clip(msg.Content))
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&sb, "- Ran %s %s\n", call.Name, clip(call.Arguments))
+			}
+		}
+	}
+
+	summary := sb.String()
+	for len(summary) > maxSummarySize {
+		_, after, ok := strings.Cut(summary, "\n")
+		if !ok {
+			summary = summary[len(summary)-maxSummarySize:]
+			break
+		}
+		summary = after
+	}
+	return summary
+}
+
+// clip shortens text to one line of at most summaryLineSize bytes.
+func clip(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > summaryLineSize {
+		cut := summaryLineSize
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut] + "..."
+	}
+	return text
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/redact"
+)
+
+// crashTailMessages is how many of the latest messages go into a crash report.
+const crashTailMessages = 10
+
+// toolCall remembers the tool invocation in flight, for crash reports.
+type toolCall struct {
+	Name  string `json:"name"`
+	Input string `json:"input"`
+}
+
+type crashReport struct {
+	Time             string        `json:"time"`
+	Panic            string        `json:"panic"`
+	Stack            string        `json:"stack"`
+	GoVersion        string        `json:"go_version"`
+	Platform         string        `json:"platform"`
+	WorkingDirectory string        `json:"working_directory"`
+	Model            string        `json:"model"`
+	MaxTokens        int           `json:"max_tokens"`
+	Tools            []string      `json:"tools"`
+	LastToolCall     *toolCall     `json:"last_tool_call,omitempty"`
+	Conversation     []llm.Message `json:"conversation_tail"`
+}
+
+// writeCrashReport saves a redacted diagnostic bundle for a recovered panic
+// and returns the path of the file.
+func (a *Agent) writeCrashReport(recovered interface{}, stack []byte) (string, error) {
+	cwd, _ := os.Getwd()
+	report := crashReport{
+		Time:             time.Now().Format(time.RFC3339),
+		Panic:            redact.String(fmt.Sprint(recovered)),
+		Stack:            string(stack),
+		GoVersion:        runtime.Version(),
+		Platform:         runtime.GOOS + "/" + runtime.GOARCH,
+		WorkingDirectory: cwd,
+		Model:            a.model,
+		MaxTokens:        a.maxTokens,
+	}
+	for _, tool := range a.tools.Enabled() {
+		report.Tools = append(report.Tools, tool.Name)
+	}
+	a.lastToolCallMu.Lock()
+	if a.lastToolCall != nil {
+		report.LastToolCall = &toolCall{Name: a.lastToolCall.Name, Input: redact.String(a.lastToolCall.Input)}
+	}
+	a.lastToolCallMu.Unlock()
+
+	tail := a.conversation
+	if len(tail) > crashTailMessages {
+		tail = tail[len(tail)-crashTailMessages:]
+	}
+	for _, msg := range tail {
+		msg.Content = redact.String(msg.Content)
+		var calls []llm.ToolCall
+		for _, call := range msg.ToolCalls {
+			call.Arguments = redact.String(call.Arguments)
+			calls = append(calls, call)
+		}
+		msg.ToolCalls = calls
+		report.Conversation = append(report.Conversation, msg)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	dir := os.TempDir()
+	if home, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(home, ".code-agent", "crashes")
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s.json", time.Now().Format("20060102-150405")))
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// recoverCrash writes a crash report for a recovered panic and returns it
+// as an error pointing at the report.
+func (a *Agent) recoverCrash(recovered interface{}) error {
+	stack := debug.Stack()
+	path, err := a.writeCrashReport(recovered, stack)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "panic: %v\n%s\n(failed to write crash report: %v)\n", recovered, stack, err)
+		return fmt.Errorf("panic: %v", recovered)
+	}
+	log.Error("crash", "panic", fmt.Sprint(recovered), "report", path)
+	fmt.Printf("\u001b[91mCrash\u001b[0m: %v\nA diagnostic report was written to %s; please attach it to a bug report.\n", recovered, path)
+	return fmt.Errorf("panic: %v (crash report: %s)", recovered, path)
+}
+
+// redactMessages returns copies of messages with credentials masked.
+func redactMessages(messages []llm.Message) []llm.Message {
+	out := make([]llm.Message, len(messages))
+	for i, msg := range messages {
+		msg.Content = redact.String(msg.Content)
+		calls := make([]llm.ToolCall, len(msg.ToolCalls))
+		for j, call := range msg.ToolCalls {
+			call.Arguments = redact.String(call.Arguments)
+			calls[j] = call
+		}
+		msg.ToolCalls = calls
+		out[i] = msg
+	}
+	return out
+}
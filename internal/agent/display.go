@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"fmt"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/markdown"
+	"code-editing-agent/internal/tools"
+)
+
+// Display shows the conversation to the user as it happens.
+type Display interface {
+	// AssistantText shows the next piece of the streamed reply.
+	AssistantText(text string)
+	// AssistantDone marks the end of a reply.
+	AssistantDone()
+	// ToolCall shows that a tool is about to run.
+	ToolCall(id, name, input string)
+	// ToolResult shows the outcome of a tool call.
+	ToolResult(id, name string, result tools.ToolResult)
+}
+
+// EventDisplay is a Display that also shows the messages sent to the model
+// and the usage of every turn, such as the JSON event stream.
+type EventDisplay interface {
+	Display
+	// UserMessage shows a message sent to the model.
+	UserMessage(text string)
+	// Usage shows the tokens and cost of the turn that just ended and of
+	// the session.
+	Usage(turn, session llm.UsageTotal)
+}
+
+// showUserMessage shows a message sent to the model on displays that show
+// them.
+func (a *Agent) showUserMessage(text string) {
+	if d, ok := a.display.(EventDisplay); ok {
+		d.UserMessage(text)
+	}
+}
+
+// consoleDisplay prints the conversation to stdout as plain lines, and
+// the replies as rendered markdown when it has a renderer.
+type consoleDisplay struct {
+	printing bool
+	markdown *markdown.Renderer
+}
+
+// MarkdownDisplay returns a Display that prints the conversation to stdout
+// like the default one, with the replies rendered by renderer as they
+// stream in.
+func MarkdownDisplay(renderer *markdown.Renderer) Display {
+	return &consoleDisplay{markdown: renderer}
+}
+
+func (d *consoleDisplay) AssistantText(text string) {
+	if d.markdown != nil {
+		if !d.printing {
+			fmt.Println("\u001b[93mAssistant\u001b[0m:")
+			d.printing = true
+		}
+		fmt.Print(d.markdown.Write(text))
+		return
+	}
+	if !d.printing {
+		fmt.Print("\u001b[93mAssistant\u001b[0m: ")
+		d.printing = true
+	}
+	fmt.Print(text)
+}
+
+func (d *consoleDisplay) AssistantDone() {
+	if !d.printing {
+		return
+	}
+	if d.markdown != nil {
+		fmt.Print(d.markdown.Flush())
+	} else {
+		fmt.Println()
+	}
+	d.printing = false
+}
+
+func (d *consoleDisplay) ToolCall(id, name, input string) {
+	fmt.Printf("\u001b[92mtool\u001b[0m: %s(%s)\n", name, input)
+}
+
+func (d *consoleDisplay) ToolResult(id, name string, result tools.ToolResult) {}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code-editing-agent/internal/audit"
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// DefaultMaxSteps bounds how many requests a non-interactive run may make
+// before it gives up.
+const DefaultMaxSteps = 50
+
+// Outcomes of a non-interactive run.
+const (
+	// StatusCompleted means the model finished with a final reply.
+	StatusCompleted = "completed"
+	// StatusIncomplete means the run hit its step limit first.
+	StatusIncomplete = "incomplete"
+	// StatusFailed means the run was ended by an error.
+	StatusFailed = "failed"
+)
+
+// Report summarizes a non-interactive run for scripts and CI.
+type Report struct {
+	Status string `json:"status"`
+	Prompt string `json:"prompt"`
+	// Reply is the model's last message, normally its summary of the work.
+	Reply           string         `json:"reply,omitempty"`
+	Steps           int            `json:"steps"`
+	ToolCalls       int            `json:"tool_calls"`
+	FailedToolCalls int            `json:"failed_tool_calls"`
+	FilesChanged    []string       `json:"files_changed"`
+	Usage           llm.UsageTotal `json:"usage"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// ExitCode is the process exit code for the report: 0 when the run
+// completed, 1 when it failed and 2 when it ran out of steps.
+func (r Report) ExitCode() int {
+	switch r.Status {
+	case StatusCompleted:
+		return 0
+	case StatusIncomplete:
+		return 2
+	}
+	return 1
+}
+
+func (r Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Status: %s\n", r.Status)
+	if r.Error != "" {
+		fmt.Fprintf(&sb, "Error: %s\n", r.Error)
+	}
+	fmt.Fprintf(&sb, "Steps: %d, tool calls: %d (%d failed)\n", r.Steps, r.ToolCalls, r.FailedToolCalls)
+	if len(r.FilesChanged) == 0 {
+		sb.WriteString("Files changed: none\n")
+	} else {
+		sb.WriteString("Files changed:\n")
+		for _, path := range r.FilesChanged {
+			fmt.Fprintf(&sb, "  %s\n", path)
+		}
+	}
+	fmt.Fprintf(&sb, "Usage: %s\n", r.Usage)
+	return sb.String()
+}
+
+// RunPrompt works on prompt without a user to talk to: the model keeps
+// going through failed tool calls until it replies without calling any
+// tool, or until maxSteps requests have been made. Approval prompts are
+// answered by tools.AskUser, which the caller sets up to deny or approve.
+func (a *Agent) RunPrompt(ctx context.Context, prompt string, maxSteps int) (report Report) {
+	report = Report{Status: StatusFailed, Prompt: prompt, FilesChanged: []string{}}
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	// Files changed are those of the checkpoints taken during the run.
+	lastID := audit.LastCheckpoint(tools.Checkpoints)
+	defer func() {
+		if r := recover(); r != nil {
+			report.Status = StatusFailed
+			report.Error = fmt.Sprintf("agent crashed: %v", a.recoverCrash(r))
+		}
+		report.FilesChanged = changedSince(lastID)
+		report.Usage = a.usage.Session()
+	}()
+
+	a.ClearConversation()
+	a.startSession()
+	defer a.EndSession()
+	files, images := a.mentionedFiles(prompt)
+	a.conversation = append(a.conversation, llm.Message{Role: llm.RoleUser, Content: prompt + files, Images: images})
+	a.showUserMessage(prompt + files)
+	a.routeTurn(prompt)
+	result, err := a.runTurn(ctx, maxSteps, true)
+	report.Reply = result.Reply
+	report.Steps = result.Steps
+	report.ToolCalls = result.ToolCalls
+	report.FailedToolCalls = result.FailedToolCalls
+	switch {
+	case err != nil:
+		report.Error = err.Error()
+	case result.Finished:
+		report.Status = StatusCompleted
+	default:
+		report.Status = StatusIncomplete
+		report.Error = fmt.Sprintf("stopped after %d steps without a final reply", result.Steps)
+	}
+	return report
+}
+
+// changedSince lists the files checkpointed after the checkpoint with ID
+// lastID, that is, the files the tools changed since then.
+func changedSince(lastID int) []string {
+	checkpoints, err := tools.Checkpoints.List()
+	if err != nil {
+		return []string{}
+	}
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, cp := range checkpoints {
+		if cp.ID <= lastID {
+			continue
+		}
+		for _, file := range cp.Files {
+			if !seen[file.Path] {
+				seen[file.Path] = true
+				paths = append(paths, file.Path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"code-editing-agent/internal/hooks"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/tools"
+)
+
+// SetHooks runs the configured hooks on tool calls, sub-tasks' included,
+// and at the start and end of the session.
+func (a *Agent) SetHooks(runner *hooks.Runner) {
+	a.hooks = runner
+}
+
+// preToolHooks runs the pre_tool hooks of a call and returns the result of
+// the call when one of them stops it.
+func (a *Agent) preToolHooks(ctx context.Context, name string, input []byte) (tools.ToolResult, bool) {
+	err := a.hooks.Run(ctx, hooks.Payload{Event: hooks.PreTool, Tool: name, Input: input})
+	if err == nil {
+		return tools.ToolResult{}, false
+	}
+	fmt.Printf("\u001b[93mBlocked\u001b[0m: %s (%v)\n", name, err)
+	log.Info("tool call blocked by hook", "tool", name, "error", err.Error())
+	return tools.Failed(fmt.Sprintf("The %s call was stopped: %v. Do not retry it unchanged; adjust the call or ask the user how to proceed.", name, err)), true
+}
+
+// postToolHooks runs the post_tool hooks of a finished call. Their
+// failures are reported to the user but do not change the result.
+func (a *Agent) postToolHooks(ctx context.Context, name string, input []byte, result tools.ToolResult) {
+	success := result.Success
+	err := a.hooks.Run(ctx, hooks.Payload{
+		Event:   hooks.PostTool,
+		Tool:    name,
+		Input:   input,
+		Success: &success,
+		Output:  result.Output,
+		Error:   result.Error,
+	})
+	if err != nil {
+		a.hookFailed(hooks.PostTool, err)
+	}
+}
+
+// startSession runs the session_start hooks.
+func (a *Agent) startSession() {
+	if err := a.hooks.Run(context.Background(), hooks.Payload{Event: hooks.SessionStart}); err != nil {
+		a.hookFailed(hooks.SessionStart, err)
+	}
+}
+
+// EndSession runs the session_end hooks, the first time it is called. Run
+// and RunPrompt call it when they return; call it before exiting while
+// they are still running.
+func (a *Agent) EndSession() {
+	a.endSession.Do(func() {
+		if err := a.hooks.Run(context.Background(), hooks.Payload{Event: hooks.SessionEnd}); err != nil {
+			a.hookFailed(hooks.SessionEnd, err)
+		}
+	})
+}
+
+func (a *Agent) hookFailed(event string, err error) {
+	fmt.Printf("\u001b[93mWarning\u001b[0m: %s %v\n", event, err)
+	log.Warn("hook failed", "event", event, "error", err.Error())
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"code-editing-agent/internal/shell"
+	"code-editing-agent/internal/tools"
+)
+
+// Interrupt stops the request or tool calls the agent is waiting on and
+// returns it to the prompt, keeping what the turn did so far. It reports
+// false when there is nothing to stop, either because the agent is waiting
+// for the user or because the turn is already being stopped, which callers
+// take as the user wanting to quit.
+func (a *Agent) Interrupt() bool {
+	a.turnMu.Lock()
+	defer a.turnMu.Unlock()
+	if a.cancelTurn == nil {
+		return false
+	}
+	a.cancelTurn()
+	a.cancelTurn = nil
+	shell.Interrupt()
+	return true
+}
+
+// startTurn returns the context of a turn that Interrupt can cancel, and the
+// function to call once the turn is over.
+func (a *Agent) startTurn(ctx context.Context) (context.Context, func()) {
+	turnCtx, cancel := context.WithCancel(ctx)
+	a.turnMu.Lock()
+	a.cancelTurn = cancel
+	a.turnMu.Unlock()
+	return turnCtx, func() {
+		a.turnMu.Lock()
+		a.cancelTurn = nil
+		a.turnMu.Unlock()
+		cancel()
+	}
+}
+
+// interruptionNote tells the model, with the message following an
+// interrupted turn, that its work was cut short.
+func (a *Agent) interruptionNote() string {
+	if !a.interrupted {
+		return ""
+	}
+	a.interrupted = false
+	return "\n\n(Note: the user interrupted your previous turn; do not carry on with it unless asked to.)"
+}
+
+// interruptedResult is the result of a tool call skipped or abandoned
+// because the user interrupted the turn.
+func interruptedResult(name string) tools.ToolResult {
+	return tools.Failed(fmt.Sprintf("%s was not run to completion: the user interrupted the turn", name))
+}
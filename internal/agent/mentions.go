@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/images"
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/mentions"
+	"code-editing-agent/internal/tools"
+)
+
+// maxMentionedFiles bounds how many files a message attaches with @path.
+const maxMentionedFiles = 10
+
+// mentionedFiles reads the files the user mentioned as @path in text, as
+// read_file would return them, into a note to append to their message, and
+// loads the images among them to send with it. It saves the model asking
+// for files it was pointed at.
+func (a *Agent) mentionedFiles(text string) (string, []llm.Image) {
+	paths := mentions.Find(text)
+	if len(paths) > maxMentionedFiles {
+		fmt.Printf("\u001b[93mWarning\u001b[0m: only the first %d of the %d files mentioned are attached\n", maxMentionedFiles, len(paths))
+		paths = paths[:maxMentionedFiles]
+	}
+	var sb strings.Builder
+	var attached []string
+	var loaded []llm.Image
+	for _, path := range paths {
+		if images.IsImage(path) {
+			image, err := images.Load(path)
+			if err != nil {
+				fmt.Printf("\u001b[93mWarning\u001b[0m: %s not attached: %v\n", path, err)
+				continue
+			}
+			loaded = append(loaded, image)
+			attached = append(attached, path)
+			continue
+		}
+		input, err := json.Marshal(tools.ReadFileInput{Path: path})
+		if err != nil {
+			continue
+		}
+		content, err := tools.ReadFile(context.Background(), input)
+		if err != nil {
+			fmt.Printf("\u001b[93mWarning\u001b[0m: %s not attached: %v\n", path, err)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n\n(Attached by the user with @%s:)\n%s", path, strings.TrimSuffix(content, "\n"))
+		attached = append(attached, path)
+	}
+	if len(attached) > 0 {
+		fmt.Printf("\u001b[90mAttached: %s\u001b[0m\n", strings.Join(attached, ", "))
+	}
+	return sb.String(), loaded
+}
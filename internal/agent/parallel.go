@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+const (
+	// maxParallelTools bounds how many tool calls run at once.
+	maxParallelTools = 4
+	// defaultToolTimeout applies to read-only tools that set no Timeout of
+	// their own.
+	defaultToolTimeout = 2 * time.Minute
+)
+
+// executeTools runs the tool calls of one reply and returns their results in
+// the same order. Consecutive calls to read-only tools run concurrently;
+// anything else runs on its own, in order, since it may ask the user for
+// approval and later calls may depend on its effects. Once ctx is cancelled
+// the calls not started yet are skipped.
+func (a *Agent) executeTools(ctx context.Context, calls []llm.ToolCall) []tools.ToolResult {
+	results := make([]tools.ToolResult, len(calls))
+	for i := 0; i < len(calls); {
+		if ctx.Err() != nil {
+			results[i] = interruptedResult(calls[i].Name)
+			i++
+			continue
+		}
+		if !a.isReadTool(calls[i].Name) {
+			results[i] = a.executeTool(ctx, calls[i].ID, calls[i].Name, []byte(calls[i].Arguments))
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(calls) && a.isReadTool(calls[j].Name) {
+			j++
+		}
+		a.executeConcurrently(ctx, calls[i:j], results[i:j])
+		i = j
+	}
+	return results
+}
+
+// executeConcurrently runs calls on a pool of workers, storing each result
+// at the call's index.
+func (a *Agent) executeConcurrently(ctx context.Context, calls []llm.ToolCall, results []tools.ToolResult) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < maxParallelTools && w < len(calls); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					results[i] = interruptedResult(calls[i].Name)
+					continue
+				}
+				results[i] = a.executeTool(ctx, calls[i].ID, calls[i].Name, []byte(calls[i].Arguments))
+			}
+		}()
+	}
+	for i := range calls {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// toolTimeout is how long a call to the tool may run: its own Timeout, or
+// the default for read-only tools. Other tools, which may stop to ask the
+// user something, only end early when the turn is interrupted.
+func toolTimeout(tool tools.ToolDefinition) time.Duration {
+	if tool.Timeout > 0 {
+		return tool.Timeout
+	}
+	if tool.Category == tools.CategoryRead {
+		return defaultToolTimeout
+	}
+	return 0
+}
+
+// callTool runs the tool's function with a context that is done once ctx
+// is or the tool's timeout has passed. A call with a timeout runs on a
+// goroutine of its own, so that one stuck where it does not check its
+// context, such as in a hung read, is given up on: it finishes in the
+// background and its result is discarded.
+func (a *Agent) callTool(ctx context.Context, tool tools.ToolDefinition, input json.RawMessage) (string, error) {
+	timeout := toolTimeout(tool)
+	if timeout <= 0 {
+		output, err := tool.Function(ctx, input)
+		if err != nil && ctx.Err() != nil {
+			return "", stoppedError(ctx, tool.Name, timeout)
+		}
+		return output, err
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type reply struct {
+		output string
+		err    error
+	}
+	done := make(chan reply, 1)
+	go func() {
+		var r reply
+		defer func() {
+			if p := recover(); p != nil {
+				r.err = fmt.Errorf("tool %s crashed: %v", tool.Name, a.recoverCrash(p))
+			}
+			done <- r
+		}()
+		r.output, r.err = tool.Function(callCtx, input)
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil && callCtx.Err() != nil {
+			return "", stoppedError(ctx, tool.Name, timeout)
+		}
+		return r.output, r.err
+	case <-callCtx.Done():
+		return "", stoppedError(ctx, tool.Name, timeout)
+	}
+}
+
+// stoppedError explains why a call was stopped: the user interrupted the
+// turn, ctx being done, or else the call ran out of time.
+func stoppedError(ctx context.Context, name string, timeout time.Duration) error {
+	if ctx.Err() != nil {
+		return errors.New(interruptedResult(name).Error)
+	}
+	return fmt.Errorf("tool %s timed out after %s", name, timeout)
+}
+
+func (a *Agent) isReadTool(name string) bool {
+	tool, ok := a.findTool(name)
+	return ok && tool.Category == tools.CategoryRead
+}
+
+func (a *Agent) findTool(name string) (tools.ToolDefinition, bool) {
+	return a.tools.Lookup(name)
+}
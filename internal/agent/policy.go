@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/policy"
+	"code-editing-agent/internal/tools"
+)
+
+// pathKeys are the arguments in which the tools that write name the files
+// they write.
+var pathKeys = map[string]bool{"path": true, "paths": true, "destination": true}
+
+// callPolicy is what the approval policy decides for a call.
+type callPolicy struct {
+	decision policy.Decision
+	// confirm are the paths the call names whose writes must be approved
+	// one by one, even for tools approved for the session.
+	confirm []string
+	// reason explains a refusal.
+	reason string
+}
+
+// checkPolicy applies the approval policy to a call: its category's
+// decision, and for tools that write, the rules of the paths it names.
+func checkPolicy(tool tools.ToolDefinition, input []byte) callPolicy {
+	decision := tools.Policy.Category(string(tool.Category))
+	if decision == policy.Deny {
+		return callPolicy{decision: policy.Deny, reason: fmt.Sprintf("the approval policy does not allow %s tools", tool.Category)}
+	}
+	result := callPolicy{decision: decision}
+	if tool.Category != tools.CategoryWrite {
+		return result
+	}
+	for _, path := range callPaths(input) {
+		switch d, pattern := tools.Policy.Write(path); d {
+		case policy.Deny:
+			return callPolicy{decision: policy.Deny, reason: fmt.Sprintf("the approval policy forbids writing %s (rule %q)", path, pattern)}
+		case policy.Ask:
+			result.confirm = append(result.confirm, path)
+		}
+	}
+	return result
+}
+
+// approveCall asks the user to approve a call when the policy or the tool
+// calls for it, and reports whether it may run. A preview that fails is
+// left for the tool itself to report.
+func approveCall(tool tools.ToolDefinition, input []byte, p callPolicy) bool {
+	switch {
+	case len(p.confirm) > 0:
+		preview := ""
+		if tool.Preview != nil {
+			preview, _ = tool.Preview(input)
+		}
+		if preview == "" {
+			preview = argumentsPreview(input)
+		}
+		return tools.ConfirmWrites(tool.Name, preview, p.confirm)
+	case p.decision == policy.Allow:
+		return true
+	case p.decision == policy.Ask && tool.Preview == nil:
+		// Tools that change nothing have no preview; their arguments
+		// show what they would look at.
+		return tools.RequestApproval(tool.Name, argumentsPreview(input))
+	case tool.Preview != nil && !tools.Approved(tool.Name):
+		preview, err := tool.Preview(input)
+		return err != nil || preview == "" || tools.RequestApproval(tool.Name, preview)
+	}
+	return true
+}
+
+// refusedByPolicy is the result of a call the approval policy refuses.
+func refusedByPolicy(name string, p callPolicy) tools.ToolResult {
+	fmt.Printf("\u001b[93mRefused\u001b[0m: %s (%s)\n", name, p.reason)
+	log.Info("tool call refused by policy", "tool", name, "reason", p.reason)
+	return tools.Failed(fmt.Sprintf("The %s call was refused: %s. Do not retry it; find another way or ask the user.", name, p.reason))
+}
+
+// argumentsPreview shows the arguments of a call, indented.
+func argumentsPreview(input []byte) string {
+	var v interface{}
+	if json.Unmarshal(input, &v) != nil {
+		return string(input) + "\n"
+	}
+	indented, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return string(input) + "\n"
+	}
+	return "  " + string(indented) + "\n"
+}
+
+// callPaths returns the paths a call's arguments name in pathKeys, at any
+// depth, such as the path of every edit of an edit_files call.
+func callPaths(input []byte) []string {
+	var v interface{}
+	if json.Unmarshal(input, &v) != nil {
+		return nil
+	}
+	var paths []string
+	var walk func(v interface{}, key string)
+	walk = func(v interface{}, key string) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, value := range v {
+				walk(value, k)
+			}
+		case []interface{}:
+			for _, value := range v {
+				walk(value, key)
+			}
+		case string:
+			if pathKeys[key] && v != "" {
+				paths = append(paths, v)
+			}
+		}
+	}
+	walk(v, "")
+	return paths
+}
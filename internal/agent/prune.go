@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/tools"
+)
+
+// pruneMinSize is the smallest tool result worth pruning, in bytes.
+const pruneMinSize = 1024
+
+// prunedPrefix starts the placeholder of a pruned result, so it is not
+// pruned again.
+const prunedPrefix = "[read_file "
+
+// numberedLine matches a line of a file as read_file shows it.
+var numberedLine = regexp.MustCompile(`(?m)^ *\d+\t`)
+
+// scopeTools are tools whose path argument is only one of the files they
+// change; a call to one may change any file.
+var scopeTools = map[string]bool{"rename_symbol": true}
+
+// fileEvent is a successful tool call that read or changed files.
+type fileEvent struct {
+	// step is the index of the assistant message that made the call.
+	step  int
+	write bool
+	paths []string
+	// args and whole describe a read: its arguments, and whether it read
+	// the whole file rather than some of its lines.
+	args  string
+	whole bool
+	// result is the index of the read's result in the conversation.
+	result int
+}
+
+// pruneStaleResults replaces the contents of read_file results the model
+// has moved past, those of files read again or changed in a later step,
+// with a line saying what was there. Old file dumps otherwise take up most
+// of the context window, and are out of date once the file is changed.
+func (a *Agent) pruneStaleResults() {
+	results := map[string]int{}
+	for i, msg := range a.conversation {
+		if msg.Role == llm.RoleTool {
+			results[msg.ToolCallID] = i
+		}
+	}
+
+	var events []fileEvent
+	for step, msg := range a.conversation {
+		if msg.Role != llm.RoleAssistant {
+			continue
+		}
+		for _, call := range msg.ToolCalls {
+			i, ok := results[call.ID]
+			if !ok || !succeeded(a.conversation[i].Content) {
+				continue
+			}
+			if call.Name == tools.ReadFileDefinition.Name {
+				var input tools.ReadFileInput
+				if json.Unmarshal([]byte(call.Arguments), &input) != nil || input.Path == "" {
+					continue
+				}
+				events = append(events, fileEvent{
+					step:   step,
+					paths:  []string{filepath.Clean(input.Path)},
+					args:   call.Arguments,
+					whole:  input.StartLine == 0 && input.EndLine == 0 && input.Tail == 0,
+					result: i,
+				})
+				continue
+			}
+			if tool, ok := a.findTool(call.Name); ok && tool.Category == tools.CategoryWrite {
+				paths := changedPaths(call.Arguments)
+				if len(paths) == 0 || scopeTools[call.Name] {
+					paths = []string{"."}
+				}
+				events = append(events, fileEvent{step: step, write: true, paths: paths})
+			}
+		}
+	}
+
+	pruned := 0
+	for i, read := range events {
+		if read.write {
+			continue
+		}
+		msg := &a.conversation[read.result]
+		if len(msg.Content) < pruneMinSize {
+			continue
+		}
+		for _, later := range events[i+1:] {
+			if later.step <= read.step {
+				continue
+			}
+			reason := ""
+			switch {
+			case later.write && touches(later.paths, read.paths[0]):
+				reason = "changed later"
+			case !later.write && later.paths[0] == read.paths[0] && (later.whole || later.args == read.args):
+				reason = "read again later"
+			default:
+				continue
+			}
+			msg.Content = tools.Succeeded(fmt.Sprintf("%s%s — %d lines, pruned: %s]",
+				prunedPrefix, filepath.ToSlash(read.paths[0]), resultLines(msg.Content), reason)).JSON()
+			pruned++
+			break
+		}
+	}
+	if pruned > 0 {
+		log.Info("pruned stale tool results", "results", pruned)
+	}
+}
+
+// succeeded reports whether content is the result of a tool call that
+// succeeded and has not been pruned.
+func succeeded(content string) bool {
+	var result tools.ToolResult
+	if json.Unmarshal([]byte(content), &result) != nil {
+		return false
+	}
+	return result.Success && !strings.HasPrefix(result.Output, prunedPrefix)
+}
+
+// resultLines counts the file lines in the output of a read_file result,
+// which are numbered.
+func resultLines(content string) int {
+	var result tools.ToolResult
+	json.Unmarshal([]byte(content), &result)
+	return len(numberedLine.FindAllStringIndex(result.Output, -1))
+}
+
+// changedPaths returns the files named in the arguments of a tool that
+// changes files: its path, source and destination, the paths of its edits,
+// and the files of its patch.
+func changedPaths(arguments string) []string {
+	var args struct {
+		Path        string `json:"path"`
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		Edits       []struct {
+			Path string `json:"path"`
+		} `json:"edits"`
+		Patch string `json:"patch"`
+	}
+	if json.Unmarshal([]byte(arguments), &args) != nil {
+		return nil
+	}
+	var paths []string
+	for _, path := range []string{args.Path, args.Source, args.Destination} {
+		if path != "" {
+			paths = append(paths, filepath.Clean(path))
+		}
+	}
+	for _, edit := range args.Edits {
+		if edit.Path != "" {
+			paths = append(paths, filepath.Clean(edit.Path))
+		}
+	}
+	for _, line := range strings.Split(args.Patch, "\n") {
+		if !strings.HasPrefix(line, "--- ") && !strings.HasPrefix(line, "+++ ") {
+			continue
+		}
+		path, _, _ := strings.Cut(strings.TrimSpace(line[4:]), "\t")
+		if path == "/dev/null" {
+			continue
+		}
+		if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+			path = path[2:]
+		}
+		paths = append(paths, filepath.Clean(path))
+	}
+	return paths
+}
+
+// touches reports whether path is one of paths or lies in one of them.
+func touches(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == "." || p == path || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// defaultMaxCheapLength is the longest message, in characters, the
+	// cheap model answers when the router does not set one.
+	defaultMaxCheapLength = 300
+	// defaultMaxFailures is how many tool calls may fail before the
+	// strong model takes over, when the router does not set it.
+	defaultMaxFailures = 2
+)
+
+// DefaultStrongKeywords are words that ask for code to be written, so that
+// a message containing one goes to the strong model.
+var DefaultStrongKeywords = []string{
+	"implement", "refactor", "rewrite", "write", "create", "add", "generate",
+	"fix", "port", "migrate", "optimize", "design", "test",
+}
+
+// Router sends turns that only look things up or dispatch a tool or two
+// to a cheap model, and turns that write code to a strong one.
+type Router struct {
+	// CheapModel is used for simple turns; routing is off without it.
+	CheapModel string
+	// StrongModel writes code; empty means the agent's model.
+	StrongModel string
+	// MaxCheapLength is the longest message, in characters, sent to the
+	// cheap model; zero means 300.
+	MaxCheapLength int
+	// StrongKeywords send a message containing any of them to the strong
+	// model; nil means DefaultStrongKeywords.
+	StrongKeywords []string
+	// MaxFailures is how many tool calls may fail, since the model last
+	// finished a turn cleanly, before the strong model takes over; zero
+	// means 2.
+	MaxFailures int
+}
+
+// SetRouter picks the model of every turn with router from now on, unless
+// the user pins one with /model.
+func (a *Agent) SetRouter(router Router) {
+	if router.CheapModel == "" {
+		a.router = nil
+		return
+	}
+	a.router = &router
+	a.routing = true
+}
+
+func (a *Agent) strongModel() string {
+	if a.router.StrongModel != "" {
+		return a.router.StrongModel
+	}
+	return a.model
+}
+
+// lightModel is the model for requests that need no skill, such as naming
+// the session.
+func (a *Agent) lightModel() string {
+	if a.router != nil && a.routing {
+		return a.router.CheapModel
+	}
+	return a.model
+}
+
+// requestModel is the model the requests of the turn in progress go to.
+func (a *Agent) requestModel() string {
+	if a.turnModel != "" {
+		return a.turnModel
+	}
+	return a.model
+}
+
+// routeTurn picks the model for a turn starting with message: the one set
+// with /model for this turn, else the one the router picks.
+func (a *Agent) routeTurn(message string) {
+	a.turnModel = ""
+	if a.nextTurnModel != "" {
+		a.turnModel, a.nextTurnModel = a.nextTurnModel, ""
+		fmt.Printf("\u001b[90mModel for this turn: %s\u001b[0m\n", a.turnModel)
+		return
+	}
+	if a.router == nil || !a.routing {
+		return
+	}
+	model, reason := a.router.CheapModel, "a short request"
+	maxLength := a.router.MaxCheapLength
+	if maxLength <= 0 {
+		maxLength = defaultMaxCheapLength
+	}
+	maxFailures := a.router.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFailures
+	}
+	if len(message) > maxLength {
+		model, reason = a.strongModel(), "a long request"
+	} else if keyword := strongKeyword(message, a.router.StrongKeywords); keyword != "" {
+		model, reason = a.strongModel(), fmt.Sprintf("the request asks to %s", keyword)
+	} else if a.failedCalls >= maxFailures {
+		model, reason = a.strongModel(), fmt.Sprintf("%d tool call(s) failed", a.failedCalls)
+	}
+	a.turnModel = model
+	fmt.Printf("\u001b[90mRouting: %s (%s)\u001b[0m\n", model, reason)
+}
+
+// routeFailures counts the failed tool calls of a step, and hands the rest
+// of the turn to the strong model once too many have failed.
+func (a *Agent) routeFailures(failed int) {
+	a.failedCalls += failed
+	if a.router == nil || a.turnModel != a.router.CheapModel {
+		return
+	}
+	maxFailures := a.router.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFailures
+	}
+	if a.failedCalls >= maxFailures {
+		a.turnModel = a.strongModel()
+		fmt.Printf("\u001b[90mRouting: %d tool call(s) failed; %s takes over\u001b[0m\n", a.failedCalls, a.turnModel)
+	}
+}
+
+// strongKeyword returns the first of keywords that is a word of message,
+// or the start of one such as "fixes" or "tests".
+func strongKeyword(message string, keywords []string) string {
+	if keywords == nil {
+		keywords = DefaultStrongKeywords
+	}
+	words := strings.FieldsFunc(strings.ToLower(message), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+	})
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(keyword)
+		for _, word := range words {
+			if word == keyword || strings.HasPrefix(word, keyword) && len(word) <= len(keyword)+3 {
+				return keyword
+			}
+		}
+	}
+	return ""
+}
+
+// The methods below let /model override the routing.
+
+func (a *Agent) SetTurnModel(model string) {
+	a.nextTurnModel = model
+}
+
+func (a *Agent) SetRouting(on bool) error {
+	if a.router == nil {
+		return fmt.Errorf("model routing is not configured; set routing.cheap_model in the config")
+	}
+	a.routing = on
+	return nil
+}
+
+func (a *Agent) Routing() string {
+	if a.router == nil || !a.routing {
+		return ""
+	}
+	return fmt.Sprintf("%s for simple requests, %s for writing code", a.router.CheapModel, a.strongModel())
+}
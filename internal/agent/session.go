@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/sessions"
+)
+
+const (
+	// titleMaxTokens bounds the reply of the request naming a session, and
+	// titleTimeout how long it may take.
+	titleMaxTokens = 30
+	titleTimeout   = 30 * time.Second
+	// maxTitleLength bounds a title, in characters.
+	maxTitleLength = 60
+)
+
+const titleInstructions = `Write a title for a coding session that starts with the user's message below: at most six
+words naming the task, such as "Fix flaky upload test". Reply with the title alone, without quotes
+or a full stop.`
+
+// SetSessionIndex records the session in the index at path: a title made
+// from its first prompt, when it started, the model, the working directory
+// and the tokens used, updated after every turn.
+func (a *Agent) SetSessionIndex(path string) {
+	cwd, _ := os.Getwd()
+	a.sessionIndex = path
+	a.session = sessions.New(a.model, cwd)
+}
+
+// nameSession titles the session after prompt, unless it has a title. The
+// model is asked in the background, so the turn does not wait for it; until
+// it answers, or if it fails, the title is the start of the prompt.
+func (a *Agent) nameSession(prompt string) {
+	if a.sessionIndex == "" {
+		return
+	}
+	a.sessionMu.Lock()
+	named := a.session.Title != ""
+	if !named {
+		a.session.Title = clipTitle(prompt)
+	}
+	a.sessionMu.Unlock()
+	if named {
+		return
+	}
+
+	model := a.lightModel()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+		defer cancel()
+		resp, err := a.provider.Chat(ctx, llm.Request{
+			Model:     model,
+			MaxTokens: titleMaxTokens,
+			Messages: []llm.Message{
+				{Role: llm.RoleSystem, Content: titleInstructions},
+				{Role: llm.RoleUser, Content: shorten(prompt, transcriptMessageSize)},
+			},
+		})
+		if err != nil {
+			log.Warn("naming the session failed", "error", err.Error())
+			return
+		}
+		a.usage.Add(model, resp.Usage)
+		title := strings.Trim(strings.TrimSpace(resp.Message.Content), "\"'`*#. ")
+		if title == "" {
+			return
+		}
+		a.updateSession(func(e *sessions.Entry) {
+			e.Title = clipTitle(title)
+		})
+	}()
+}
+
+// recordTurn updates the session in the index after a turn.
+func (a *Agent) recordTurn() {
+	messages := 0
+	for _, msg := range a.conversation {
+		if msg.Role != llm.RoleSystem {
+			messages++
+		}
+	}
+	a.updateSession(func(e *sessions.Entry) {
+		e.Updated = time.Now()
+		e.Model = a.model
+		e.Messages = messages
+		e.Usage = a.usage.Session()
+	})
+}
+
+func (a *Agent) updateSession(update func(e *sessions.Entry)) {
+	if a.sessionIndex == "" {
+		return
+	}
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+	update(&a.session)
+	if err := sessions.Record(a.sessionIndex, a.session); err != nil {
+		log.Warn("session index write failed", "error", err.Error())
+	}
+}
+
+// clipTitle cuts text to its first line and at most maxTitleLength
+// characters, at a word where it can.
+func clipTitle(text string) string {
+	text, _, _ = strings.Cut(strings.TrimSpace(text), "\n")
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) <= maxTitleLength {
+		return text
+	}
+	runes := []rune(text)[:maxTitleLength]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > maxTitleLength/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(cut) + "..."
+}
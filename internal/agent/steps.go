@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// defaultMaxTurnSteps is how many requests an interactive turn makes before
+// the user is asked whether the model should go on.
+const defaultMaxTurnSteps = 25
+
+// minRepeatedCalls is how many identical tool calls in a row are pointed
+// out to the user as a likely loop.
+const minRepeatedCalls = 3
+
+// SetMaxTurnSteps sets how many requests an interactive turn may make, the
+// model calling tools after every one, before the user is asked whether to
+// go on, stop, or steer the model. Zero or less uses the default.
+func (a *Agent) SetMaxTurnSteps(n int) {
+	a.maxTurnSteps = n
+}
+
+func (a *Agent) turnStepLimit() int {
+	if a.maxTurnSteps > 0 {
+		return a.maxTurnSteps
+	}
+	return defaultMaxTurnSteps
+}
+
+// turnCalls tallies the tool calls of a turn for the summary shown when it
+// is paused.
+type turnCalls struct {
+	byName map[string]int
+	// last and repeats are the latest call and how many times in a row it
+	// was made with the same arguments.
+	last    llm.ToolCall
+	repeats int
+}
+
+func (t *turnCalls) record(call llm.ToolCall) {
+	if t.byName == nil {
+		t.byName = map[string]int{}
+	}
+	t.byName[call.Name]++
+	if call.Name == t.last.Name && call.Arguments == t.last.Arguments {
+		t.repeats++
+	} else {
+		t.last, t.repeats = call, 1
+	}
+}
+
+// summary describes the calls as "edit_file ×3, read_file ×2", most
+// frequent first.
+func (t *turnCalls) summary() string {
+	names := make([]string, 0, len(t.byName))
+	for name := range t.byName {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if t.byName[names[i]] != t.byName[names[j]] {
+			return t.byName[names[i]] > t.byName[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s ×%d", name, t.byName[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escalate pauses a turn that has used up its steps, so a model stuck
+// calling tools cannot go on forever. It shows what the turn did so far
+// and asks the user whether to continue, abort, or give the model new
+// instructions, which are added to the conversation. It reports whether
+// the turn should go on.
+func (a *Agent) escalate(result turnResult, calls *turnCalls) bool {
+	fmt.Printf("\u001b[93mPaused\u001b[0m: the model has made %d requests in this turn without finishing.\n", result.Steps)
+	fmt.Printf("  Tool calls: %d", result.ToolCalls)
+	if result.FailedToolCalls > 0 {
+		fmt.Printf(" (%d failed)", result.FailedToolCalls)
+	}
+	fmt.Printf(": %s\n", calls.summary())
+	if calls.repeats >= minRepeatedCalls {
+		fmt.Printf("  \u001b[93mThe last %d calls were identical\u001b[0m: %s %s\n", calls.repeats, calls.last.Name, clip(calls.last.Arguments))
+	}
+	if note := clip(result.Reply); note != "" {
+		fmt.Printf("  Latest note from the model: %s\n", note)
+	}
+
+	if tools.AskUser == nil {
+		return false
+	}
+	limit := a.turnStepLimit()
+	for {
+		answer, ok := tools.AskUser(fmt.Sprintf("[c]ontinue for %d more requests, [a]bort the turn, or type instructions to change course: ", limit))
+		if !ok {
+			return false
+		}
+		answer = strings.TrimSpace(answer)
+		switch strings.ToLower(answer) {
+		case "":
+			continue
+		case "c", "continue", "y", "yes":
+			return true
+		case "a", "abort", "n", "no", "q", "quit":
+			fmt.Println("Turn stopped. Send a message to carry on from here.")
+			return false
+		}
+		a.conversation = append(a.conversation, llm.Message{
+			Role:    llm.RoleUser,
+			Content: fmt.Sprintf("(The user paused you after %d requests in this turn and said:)\n%s", result.Steps, answer),
+		})
+		return true
+	}
+}
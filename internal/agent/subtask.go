@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// subtaskMaxSteps bounds the requests of a sub-task, besides its token
+// budget.
+const subtaskMaxSteps = 30
+
+// subtaskPrompt is added to the system prompt of a sub-task.
+const subtaskPrompt = `
+
+You are a helper agent working on a single task handed to you by another agent, which sees
+nothing of this conversation but your final reply. Use your tools to do the task, then reply
+with a concise summary of what you found or did: name files, line numbers and symbols rather
+than pasting code, and say what you could not find out.`
+
+// RunSubtask works on task in a conversation of its own, with a child agent
+// restricted to toolNames and to a budget of maxTokens, and returns only the
+// child's final summary, so the research behind it does not fill the
+// parent's context. The child's usage counts towards the parent's. With
+// model routing on, the child runs on the cheap model.
+func (a *Agent) RunSubtask(ctx context.Context, task string, toolNames []string, maxTokens int) (string, error) {
+	registry, err := a.subtaskTools(toolNames)
+	if err != nil {
+		return "", err
+	}
+	child := &Agent{
+		provider:     a.provider,
+		model:        a.lightModel(),
+		maxTokens:    a.maxTokens,
+		temperature:  a.temperature,
+		systemPrompt: a.systemPrompt + subtaskPrompt,
+		display:      &subtaskDisplay{},
+		tools:        registry,
+		tokenBudget:  maxTokens,
+		auditLog:     a.auditLog,
+		hooks:        a.hooks,
+	}
+	child.resetContextManager()
+	child.ClearConversation()
+	child.conversation = append(child.conversation, llm.Message{Role: llm.RoleUser, Content: task})
+	defer func() {
+		a.usage.AddTotal(child.usage.Session())
+	}()
+
+	fmt.Printf("\u001b[90mSub-task started with %d tool(s)\u001b[0m\n", len(registry.All()))
+	result, err := child.runTurn(ctx, subtaskMaxSteps, true)
+	if err != nil {
+		return "", fmt.Errorf("sub-task failed: %w", err)
+	}
+
+	summary := result.Reply
+	stopped := ""
+	if !result.Finished {
+		stopped = "; stopped before finishing"
+		summary = child.finalSummary(ctx)
+	}
+	used := child.usage.Session()
+	fmt.Printf("\u001b[90mSub-task done: %s\u001b[0m\n", used)
+	return fmt.Sprintf("%s\n\n(Sub-task: %d step(s), %d tool call(s), %d tokens%s)",
+		summary, result.Steps, result.ToolCalls, used.Tokens(), stopped), nil
+}
+
+// subtaskTools is the registry of a sub-task: the named tools, which must be
+// enabled for the parent, or else the parent's read-only tools. Sub-tasks
+// cannot spawn sub-tasks of their own.
+func (a *Agent) subtaskTools(names []string) (*tools.Registry, error) {
+	var list []tools.ToolDefinition
+	if len(names) == 0 {
+		list = tools.ReadOnlyTools(a.tools.Enabled())
+	}
+	for _, name := range names {
+		tool, ok := a.tools.Lookup(name)
+		if !ok || name == tools.SpawnTaskDefinition.Name {
+			return nil, fmt.Errorf("tool %s is not available to sub-tasks", name)
+		}
+		list = append(list, tool)
+	}
+	registry := tools.NewRegistry(list...)
+	registry.Unregister(tools.SpawnTaskDefinition.Name)
+	return registry, nil
+}
+
+// finalSummary asks a sub-task that ran out of steps or tokens for what it
+// found so far.
+func (a *Agent) finalSummary(ctx context.Context) string {
+	a.conversation = append(a.conversation, llm.Message{
+		Role:    llm.RoleUser,
+		Content: "You have run out of budget for this task. Do not call any more tools; reply now with a summary of what you found so far.",
+	})
+	resp, err := a.inferWithCompaction(ctx)
+	if err != nil || resp.Content == "" {
+		return "The sub-task ran out of budget before reaching a conclusion."
+	}
+	return resp.Content
+}
+
+// subtaskDisplay shows a sub-task's tool calls, dimmed and indented, and
+// leaves its text out, since only the summary matters.
+type subtaskDisplay struct{}
+
+func (d *subtaskDisplay) AssistantText(text string) {}
+
+func (d *subtaskDisplay) AssistantDone() {}
+
+func (d *subtaskDisplay) ToolCall(id, name, input string) {
+	if len(input) > 120 {
+		input = input[:120] + "..."
+	}
+	fmt.Printf("\u001b[90m  ↳ %s(%s)\u001b[0m\n", name, input)
+}
+
+func (d *subtaskDisplay) ToolResult(id, name string, result tools.ToolResult) {}
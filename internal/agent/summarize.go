@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"code-editing-agent/internal/llm"
+)
+
+const (
+	// summaryMaxTokens bounds the reply of a summary request.
+	summaryMaxTokens = 1500
+	// maxTranscriptSize bounds the transcript sent to be summarized, so the
+	// request fits the context window of even small models.
+	maxTranscriptSize = 40_000
+	// transcriptMessageSize and transcriptToolSize bound how much of each
+	// message, and of each tool call or result, goes into the transcript.
+	transcriptMessageSize = 2000
+	transcriptToolSize    = 600
+)
+
+const summaryInstructions = `You condense the earlier part of a conversation between a user and a coding
+agent, so the agent can carry on without it. Write short bullet points covering:
+- the user's original task, in their words where possible, and any later changes to it
+- decisions made and the reasons for them
+- files read, created or changed, with their paths, and the symbols involved
+- commands run and their outcomes, including failing tests or builds
+- what remains to be done
+Merge in the earlier summary if there is one. Leave out anything not needed to continue, and do
+not invent anything.`
+
+// resetContextManager sets up the context manager for the current model and
+// tools, summarizing what it drops with the model.
+func (a *Agent) resetContextManager() {
+	a.contextManager = NewContextManager(a.provider, a.model, a.maxTokens, a.llmTools())
+	a.contextManager.Summarize = a.summarizeMessages
+}
+
+// summarizeMessages asks the model to condense messages dropped from the
+// conversation, together with the previous summary, into a new summary.
+func (a *Agent) summarizeMessages(ctx context.Context, previous string, dropped []llm.Message) (string, error) {
+	fmt.Printf("\u001b[90mContext: summarizing %d earlier message(s) to fit the context window\u001b[0m\n", len(dropped))
+	resp, err := a.provider.Chat(ctx, llm.Request{
+		Model:     a.model,
+		MaxTokens: summaryMaxTokens,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: summaryInstructions},
+			{Role: llm.RoleUser, Content: transcript(previous, dropped)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	a.usage.Add(a.model, resp.Usage)
+	return strings.TrimSpace(resp.Message.Content), nil
+}
+
+// transcript renders messages as plain text to be summarized. Long messages
+// and tool output are cut short, and when the whole is still too long the
+// messages after the first are left out, oldest first, so the original task
+// survives.
+func transcript(previous string, messages []llm.Message) string {
+	var lines []string
+	for _, msg := range messages {
+		switch msg.Role {
+		case llm.RoleUser:
+			lines = append(lines, "User: "+shorten(msg.Content, transcriptMessageSize))
+		case llm.RoleAssistant:
+			if msg.Content != "" {
+				lines = append(lines, "Assistant: "+shorten(msg.Content, transcriptMessageSize))
+			}
+			for _, call := range msg.ToolCalls {
+				lines = append(lines, fmt.Sprintf("Tool call: %s(%s)", call.Name, shorten(call.Arguments, transcriptToolSize)))
+			}
+		case llm.RoleTool:
+			lines = append(lines, "Tool result: "+shorten(msg.Content, transcriptToolSize))
+		}
+	}
+
+	size := len(previous)
+	for _, line := range lines {
+		size += len(line) + 1
+	}
+	left := 0
+	for size > maxTranscriptSize && len(lines) > 2 {
+		size -= len(lines[1]) + 1
+		lines = append(lines[:1], lines[2:]...)
+		left++
+	}
+	if left > 0 {
+		lines = append(lines[:1], append([]string{fmt.Sprintf("[%d message(s) left out]", left)}, lines[1:]...)...)
+	}
+
+	var sb strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&sb, "Earlier summary:\n%s\n\n", strings.TrimSpace(previous))
+	}
+	sb.WriteString("Conversation:\n")
+	sb.WriteString(strings.Join(lines, "\n"))
+	return sb.String()
+}
+
+// shorten cuts text to at most size bytes, saying how much was cut.
+func shorten(text string, size int) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= size {
+		return text
+	}
+	cut := size
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s [... %d bytes cut]", text[:cut], len(text)-cut)
+}
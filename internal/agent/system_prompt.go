@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"code-editing-agent/internal/memory"
+	"code-editing-agent/internal/redact"
+	"code-editing-agent/internal/tools/git"
+)
+
+// DefaultInstructions tell the model how to behave as a coding agent.
+const DefaultInstructions = `You are a coding agent working in the user's repository through the tools you are given.
+Read the relevant code before changing it, and match the style of the surrounding code.
+Make the smallest change that does what was asked, then check it, for example by building or running the tests.
+When a tool fails, read the error and fix the cause instead of repeating the same call.
+Keep replies short: say what you changed and anything the user needs to know.`
+
+// DefaultContextFiles are the files in the workspace root whose contents are
+// added to the system prompt when present.
+var DefaultContextFiles = []string{"AGENT.md", "CONTEXT.md"}
+
+// maxContextFileSize bounds how much of each context file is included.
+const maxContextFileSize = 16 * 1024
+
+// SystemPromptBuilder assembles the system message: the agent's
+// instructions, facts about the environment and the project's own notes.
+type SystemPromptBuilder struct {
+	// Instructions replace DefaultInstructions when set.
+	Instructions string
+	// WorkDir is the workspace the agent runs in.
+	WorkDir string
+	// ContextFiles are read relative to WorkDir; nil means
+	// DefaultContextFiles.
+	ContextFiles []string
+	// ReadOnly tells the model it cannot change anything.
+	ReadOnly bool
+}
+
+// Build returns the system prompt. Missing context files are skipped.
+func (b SystemPromptBuilder) Build() string {
+	var sb strings.Builder
+	instructions := b.Instructions
+	if instructions == "" {
+		instructions = DefaultInstructions
+	}
+	sb.WriteString(strings.TrimSpace(instructions))
+	sb.WriteString("\n\n# Environment\n")
+	fmt.Fprintf(&sb, "- OS: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&sb, "- Working directory: %s; relative paths in tool calls are resolved against it, and tools may not change files outside it.\n", b.WorkDir)
+	if branch, err := git.Run("-C", b.WorkDir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+		fmt.Fprintf(&sb, "- Git branch: %s\n", strings.TrimSpace(branch))
+	}
+	fmt.Fprintf(&sb, "- Credentials such as API keys are masked as %s in tool results; never write the mask into a file.\n", redact.Mask)
+	if b.ReadOnly {
+		sb.WriteString("- Read-only mode: you can read and search the code but not change files or run commands. Answer from what you read, and describe changes for the user to make.\n")
+	}
+
+	files := b.ContextFiles
+	if files == nil {
+		files = DefaultContextFiles
+	}
+	for _, name := range files {
+		content, err := os.ReadFile(filepath.Join(b.WorkDir, name))
+		if err != nil {
+			continue
+		}
+		text := string(content)
+		if len(text) > maxContextFileSize {
+			text = text[:maxContextFileSize] + "\n[truncated]"
+		}
+		fmt.Fprintf(&sb, "\n# Project notes from %s\n%s\n", name, strings.TrimSpace(text))
+	}
+
+	// Facts remembered in earlier sessions, with the remember tool.
+	if facts, err := memory.Load(filepath.Join(b.WorkDir, memory.DefaultPath)); err == nil && len(facts) > 0 {
+		if len(facts) > memory.MaxFacts {
+			facts = facts[len(facts)-memory.MaxFacts:]
+		}
+		sb.WriteString("\n# Memories\nFacts remembered about this project in earlier sessions. Forget those that turn out to be wrong or outdated.\n")
+		for _, fact := range facts {
+			fmt.Fprintf(&sb, "- %s\n", fact)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// SetAutoVerify makes the agent check that the project still compiles after
+// every batch of tool calls that changed files, and show the model the
+// compiler's errors without it having to ask.
+func (a *Agent) SetAutoVerify(on bool) {
+	a.autoVerify = on
+}
+
+// verifyEdits checks the build after calls that edited files and, when it
+// fails, adds the errors to the result of the last edit.
+func (a *Agent) verifyEdits(ctx context.Context, calls []llm.ToolCall, results []tools.ToolResult) {
+	if !a.autoVerify {
+		return
+	}
+	last := -1
+	for i, call := range calls {
+		tool, ok := a.tools.Lookup(call.Name)
+		if ok && tool.Category == tools.CategoryWrite && results[i].Success &&
+			!tools.IsDryRun(tool, json.RawMessage(call.Arguments)) {
+			last = i
+		}
+	}
+	if last < 0 {
+		return
+	}
+
+	report, err := tools.VerifyBuild(ctx, "")
+	if err != nil {
+		// Nothing to check, such as in a directory without a manifest.
+		fmt.Printf("\u001b[90mBuild check skipped: %v\u001b[0m\n", err)
+		return
+	}
+	if report.Passed {
+		fmt.Printf("\u001b[90mBuild check passed: %s\u001b[0m\n", report.Command)
+		return
+	}
+	fmt.Printf("\u001b[93mBuild check failed\u001b[0m: %s; the errors go back to the model\n", report.Command)
+	results[last].Output += "\n\nAutomatic build check after these edits failed; fix these errors:\n" + report.Summary()
+}
@@ -0,0 +1,205 @@
+// Package audit keeps an append-only record of every tool call in a
+// session, with the changes the calls made to files, so that a session can
+// be looked into afterwards and its edits replayed on another checkout.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code-editing-agent/internal/checkpoint"
+	"code-editing-agent/internal/tools"
+)
+
+// DefaultDir is where audit logs are kept, relative to the workspace.
+const DefaultDir = ".agent/audit"
+
+// sessionFormat is the layout of the time a session started, which names
+// its log.
+const sessionFormat = "20060102-150405"
+
+// maxOutput bounds how much of a tool's result an entry keeps.
+const maxOutput = 64 * 1024
+
+// Entry records one tool call.
+type Entry struct {
+	Time       time.Time       `json:"time"`
+	Tool       string          `json:"tool"`
+	Category   tools.Category  `json:"category"`
+	Input      json.RawMessage `json:"input"`
+	Success    bool            `json:"success"`
+	Output     string          `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+	DryRun     bool            `json:"dry_run,omitempty"`
+	// Files are the files the call changed and Diff the changes, as a
+	// unified diff per file.
+	Files []string `json:"files,omitempty"`
+	Diff  string   `json:"diff,omitempty"`
+}
+
+// Log appends the entries of one session to a file of its own, named after
+// the time the session started.
+type Log struct {
+	Session string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open starts the log of a new session in dir.
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	// Keep the logs out of the user's commits.
+	ignore := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		os.WriteFile(ignore, []byte("*\n"), 0644)
+	}
+
+	session := time.Now().Format(sessionFormat)
+	file, err := os.OpenFile(filepath.Join(dir, session+".jsonl"), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+	if os.IsExist(err) {
+		// Two sessions started within the same second.
+		session = fmt.Sprintf("%s-%d", session, os.Getpid())
+		file, err = os.OpenFile(filepath.Join(dir, session+".jsonl"), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{Session: session, file: file}, nil
+}
+
+// Record appends e to the log. Results longer than maxOutput are cut short.
+func (l *Log) Record(e Entry) error {
+	if !json.Valid(e.Input) {
+		// Arguments the model garbled are kept as written.
+		e.Input, _ = json.Marshal(string(e.Input))
+	}
+	if len(e.Output) > maxOutput {
+		e.Output = fmt.Sprintf("%s\n[%d bytes truncated]", e.Output[:maxOutput], len(e.Output)-maxOutput)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// Sessions lists the sessions logged in dir, oldest first.
+func Sessions(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var sessions []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".jsonl"); ok {
+			sessions = append(sessions, name)
+		}
+	}
+	sort.Strings(sessions)
+	return sessions, nil
+}
+
+// SessionStart returns when session started, from its name.
+func SessionStart(session string) (time.Time, error) {
+	if len(session) < len(sessionFormat) {
+		return time.Time{}, fmt.Errorf("%s is not the name of a session", session)
+	}
+	start, err := time.ParseInLocation(sessionFormat, session[:len(sessionFormat)], time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not the name of a session", session)
+	}
+	return start, nil
+}
+
+// Load reads the entries of session, which is the name of a session logged
+// in dir or the path of a log file.
+func Load(dir, session string) ([]Entry, error) {
+	path := session
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Join(dir, strings.TrimSuffix(session, ".jsonl")+".jsonl")
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no audit log of session %s in %s", session, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// LastCheckpoint returns the ID of the newest checkpoint in store, or 0.
+// The files a tool call changes are those of the checkpoints taken after
+// the one current when it started.
+func LastCheckpoint(store *checkpoint.Store) int {
+	checkpoints, err := store.List()
+	if err != nil || len(checkpoints) == 0 {
+		return 0
+	}
+	return checkpoints[len(checkpoints)-1].ID
+}
+
+// Changes returns the files checkpointed in store after the checkpoint with
+// ID lastID, and how each differs now from its first checkpoint since.
+func Changes(store *checkpoint.Store, lastID int) (files []string, diff string) {
+	checkpoints, err := store.List()
+	if err != nil {
+		return nil, ""
+	}
+	before := map[string]checkpoint.File{}
+	for _, cp := range checkpoints {
+		if cp.ID <= lastID {
+			continue
+		}
+		for _, file := range cp.Files {
+			if _, ok := before[file.Path]; !ok {
+				before[file.Path] = file
+				files = append(files, file.Path)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, path := range files {
+		old, err := store.Content(before[path])
+		if err != nil {
+			continue
+		}
+		current, _ := os.ReadFile(path)
+		sb.WriteString(tools.UnifiedDiff(filepath.ToSlash(path), string(old), string(current)))
+	}
+	return files, sb.String()
+}
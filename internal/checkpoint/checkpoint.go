@@ -0,0 +1,378 @@
+// Package checkpoint snapshots files before the agent modifies them so that
+// changes can be reverted later. File contents are kept in a
+// content-addressed store, so a file saved many times unchanged is stored
+// once.
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultDir is where checkpoints are kept, relative to the workspace.
+const DefaultDir = ".agent/checkpoints"
+
+// maxCheckpoints bounds how many checkpoints are kept; the oldest go first,
+// except those a running session still needs.
+const maxCheckpoints = 100
+
+// File is the state of one file when a checkpoint was taken. An empty Hash
+// means the file did not exist, so reverting removes it.
+type File struct {
+	Path string      `json:"path"`
+	Hash string      `json:"hash,omitempty"`
+	Mode fs.FileMode `json:"mode,omitempty"`
+}
+
+// Checkpoint is the state of the files one mutation was about to change.
+type Checkpoint struct {
+	ID          int       `json:"id"`
+	Time        time.Time `json:"time"`
+	Description string    `json:"description"`
+	Files       []File    `json:"files"`
+	// Session is the session of the server that took the checkpoint,
+	// empty outside the server.
+	Session string `json:"session,omitempty"`
+}
+
+// mu serializes the changes to the stores of this process, several of
+// which can share a directory.
+var mu sync.Mutex
+
+// Store keeps checkpoints on disk: file contents under objects/, named by
+// their SHA-256, and the list of checkpoints in index.json.
+type Store struct {
+	dir string
+	// session, when set, limits the store to the checkpoints of one
+	// session.
+	session string
+	// start, when set, is when the session began.
+	start time.Time
+}
+
+// NewStore returns a store in dir. Nothing is written until the first
+// checkpoint is saved.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// ForSession returns a store in the same directory that takes checkpoints
+// for session, and lists and undoes only those, so sessions of the server
+// working in the same directory do not undo each other's changes.
+func (s *Store) ForSession(session string) *Store {
+	return &Store{dir: s.dir, session: session, start: s.start}
+}
+
+// StartedAt returns a store in the same directory for a session that
+// began at start. However many checkpoints follow, it keeps the first one
+// of each file the session changes, which holds the file as it was before
+// the session and is what its changes are reviewed and reverted against.
+func (s *Store) StartedAt(start time.Time) *Store {
+	return &Store{dir: s.dir, session: s.session, start: start}
+}
+
+// Save records the current state of paths under description. It must be
+// called before the files are modified.
+func (s *Store) Save(description string, paths ...string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	checkpoints, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	cp := Checkpoint{Time: time.Now(), Description: description, Session: s.session}
+	if n := len(checkpoints); n > 0 {
+		cp.ID = checkpoints[n-1].ID + 1
+	} else {
+		cp.ID = 1
+	}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		file, err := s.snapshot(path)
+		if err != nil {
+			return err
+		}
+		cp.Files = append(cp.Files, file)
+	}
+
+	checkpoints = append(checkpoints, cp)
+	return s.store(s.trim(checkpoints))
+}
+
+// trim drops the oldest checkpoints beyond maxCheckpoints, keeping the
+// first checkpoint of each file since the session started.
+func (s *Store) trim(checkpoints []Checkpoint) []Checkpoint {
+	excess := len(checkpoints) - maxCheckpoints
+	if excess <= 0 {
+		return checkpoints
+	}
+	originals := map[int]bool{}
+	if !s.start.IsZero() {
+		seen := map[string]bool{}
+		for i, cp := range checkpoints {
+			if cp.Time.Before(s.start) || cp.Session != s.session {
+				continue
+			}
+			for _, file := range cp.Files {
+				if !seen[file.Path] {
+					seen[file.Path] = true
+					originals[i] = true
+				}
+			}
+		}
+	}
+	var kept []Checkpoint
+	for i, cp := range checkpoints {
+		if excess > 0 && !originals[i] {
+			excess--
+			continue
+		}
+		kept = append(kept, cp)
+	}
+	return kept
+}
+
+// List returns the saved checkpoints, oldest first.
+func (s *Store) List() ([]Checkpoint, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	checkpoints, err := s.load()
+	if err != nil || s.session == "" {
+		return checkpoints, err
+	}
+	var own []Checkpoint
+	for _, cp := range checkpoints {
+		if cp.Session == s.session {
+			own = append(own, cp)
+		}
+	}
+	return own, nil
+}
+
+// Undo reverts the last n checkpoints, newest first, and removes them. It
+// returns the checkpoints that were reverted.
+func (s *Store) Undo(n int) ([]Checkpoint, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	checkpoints, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		n = 1
+	}
+
+	var undone []Checkpoint
+	for i := len(checkpoints) - 1; i >= 0 && len(undone) < n; i-- {
+		cp := checkpoints[i]
+		if s.session != "" && cp.Session != s.session {
+			continue
+		}
+		err := s.restore(cp)
+		if err != nil {
+			// Forget what was already reverted so it is not reverted twice.
+			if storeErr := s.store(checkpoints); storeErr != nil {
+				return undone, errors.Join(err, storeErr)
+			}
+			return undone, err
+		}
+		checkpoints = append(checkpoints[:i], checkpoints[i+1:]...)
+		undone = append(undone, cp)
+	}
+	if len(undone) == 0 {
+		return nil, fmt.Errorf("nothing to undo")
+	}
+	return undone, s.store(checkpoints)
+}
+
+// Restore puts files back the way they were when their checkpoints were
+// taken, leaving the checkpoints in place.
+func (s *Store) Restore(files ...File) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return s.restore(Checkpoint{Files: files})
+}
+
+// Content returns the content file had when its checkpoint was taken, or
+// nil if it did not exist.
+func (s *Store) Content(file File) ([]byte, error) {
+	if file.Hash == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(s.objectPath(file.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint of %s: %w", file.Path, err)
+	}
+	return content, nil
+}
+
+// snapshot copies path into the object store and describes it.
+func (s *Store) snapshot(path string) (File, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return File{Path: path}, nil
+	}
+	if err != nil {
+		return File{}, fmt.Errorf("failed to checkpoint %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return File{}, fmt.Errorf("failed to checkpoint %s: not a regular file", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to checkpoint %s: %w", path, err)
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	object := s.objectPath(hash)
+	if _, err := os.Stat(object); os.IsNotExist(err) {
+		err = writeAtomic(object, content, 0644)
+		if err != nil {
+			return File{}, fmt.Errorf("failed to checkpoint %s: %w", path, err)
+		}
+	}
+	return File{Path: path, Hash: hash, Mode: info.Mode().Perm()}, nil
+}
+
+// restore puts every file of cp back the way it was.
+func (s *Store) restore(cp Checkpoint) error {
+	for i := len(cp.Files) - 1; i >= 0; i-- {
+		file := cp.Files[i]
+		if file.Hash == "" {
+			err := os.Remove(file.Path)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file.Path, err)
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(s.objectPath(file.Hash))
+		if err != nil {
+			return fmt.Errorf("failed to read checkpoint of %s: %w", file.Path, err)
+		}
+		err = os.MkdirAll(filepath.Dir(file.Path), 0755)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+		err = os.WriteFile(file.Path, content, file.Mode)
+		if err == nil {
+			err = os.Chmod(file.Path, file.Mode)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash[2:])
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+func (s *Store) load() ([]Checkpoint, error) {
+	data, err := os.ReadFile(s.indexPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	var checkpoints []Checkpoint
+	err = json.Unmarshal(data, &checkpoints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.indexPath(), err)
+	}
+	return checkpoints, nil
+}
+
+// store writes the index and deletes objects no checkpoint refers to.
+func (s *Store) store(checkpoints []Checkpoint) error {
+	err := os.MkdirAll(s.dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.dir, err)
+	}
+	// Keep the snapshots out of the user's commits.
+	ignore := filepath.Join(s.dir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		os.WriteFile(ignore, []byte("*\n"), 0644)
+	}
+
+	data, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeAtomic(s.indexPath(), data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	s.prune(checkpoints)
+	return nil
+}
+
+// prune removes objects that are no longer referenced. Failures are
+// ignored; an orphaned object only costs disk space.
+func (s *Store) prune(checkpoints []Checkpoint) {
+	used := map[string]bool{}
+	for _, cp := range checkpoints {
+		for _, file := range cp.Files {
+			if file.Hash != "" {
+				used[s.objectPath(file.Hash)] = true
+			}
+		}
+	}
+	filepath.WalkDir(filepath.Join(s.dir, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !used[path] {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// writeAtomic writes data to a temporary file and renames it into place so
+// a crash never leaves a truncated file behind.
+func writeAtomic(path string, data []byte, perm fs.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveKeepsSessionOriginals(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(filepath.Join(dir, "checkpoints"))
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A checkpoint of an earlier session, which trimming may drop.
+	write(a, "before the earlier session\n")
+	if err := store.Save("earlier", a); err != nil {
+		t.Fatal(err)
+	}
+
+	session := store.StartedAt(time.Now())
+	write(a, "original a\n")
+	write(b, "original b\n")
+	if err := session.Save("first", a, b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxCheckpoints+10; i++ {
+		write(a, fmt.Sprintf("edit %d\n", i))
+		if err := session.Save(fmt.Sprintf("edit %d", i), a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkpoints, err := session.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != maxCheckpoints {
+		t.Errorf("%d checkpoints kept, want %d", len(checkpoints), maxCheckpoints)
+	}
+	first := checkpoints[0]
+	if first.Description != "first" {
+		t.Fatalf("oldest checkpoint kept is %q, want the session's first", first.Description)
+	}
+	for i, want := range []string{"original a\n", "original b\n"} {
+		content, err := session.Content(first.Files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("%s was checkpointed as %q, want %q", first.Files[i].Path, content, want)
+		}
+	}
+	if checkpoints[1].Description == "edit 0" {
+		t.Error("the checkpoints after the session's first were not trimmed")
+	}
+}
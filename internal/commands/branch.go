@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/llm"
+)
+
+// --- Fork Command ---
+
+var ForkDefinition = CommandDefinition{
+	Name:        "fork",
+	Usage:       "[name]",
+	Description: "Branch the conversation here to try another approach, keeping the current one to /switch back to",
+	Function:    Fork,
+}
+
+func Fork(session Session, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /fork [name]")
+	}
+	name := ""
+	if len(args) == 1 {
+		name = args[0]
+	}
+	from := currentBranch(session)
+	name, err := session.Fork(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Forked %s into %s with %d messages; /switch %s goes back. Files are shared by all branches.\n",
+		from, name, len(session.Conversation()), from)
+	return nil
+}
+
+// --- Switch Command ---
+
+var SwitchDefinition = CommandDefinition{
+	Name:        "switch",
+	Usage:       "[name]",
+	Description: "List the branches of the conversation, or carry on with another one",
+	Function:    Switch,
+}
+
+func Switch(session Session, args []string) error {
+	if len(args) == 0 {
+		branches := session.Branches()
+		if len(branches) == 1 {
+			fmt.Println("The conversation has a single branch; /fork makes another.")
+			return nil
+		}
+		for _, b := range branches {
+			marker := " "
+			if b.Current {
+				marker = "*"
+			}
+			line := fmt.Sprintf("%s %s  (%d messages", marker, b.Name, b.Messages)
+			if b.Parent != "" {
+				line += fmt.Sprintf(", forked from %s at message %d", b.Parent, b.ForkedAt)
+			}
+			line += ")"
+			if b.Current {
+				line = "\u001b[96m" + line + "\u001b[0m"
+			}
+			fmt.Println(line)
+		}
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /switch [name]")
+	}
+	if err := session.SwitchBranch(args[0]); err != nil {
+		return fmt.Errorf("%w; type /switch to list the branches", err)
+	}
+	conversation := session.Conversation()
+	fmt.Printf("Switched to %s (%d messages).\n", args[0], len(conversation))
+	if last := lastExchange(conversation); last != "" {
+		fmt.Printf("\u001b[90m%s\u001b[0m\n", last)
+	}
+	return nil
+}
+
+func currentBranch(session Session) string {
+	for _, b := range session.Branches() {
+		if b.Current {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// lastExchange recalls where a branch left off: the user's last message
+// and the last reply to it, each cut to its first line.
+func lastExchange(conversation []llm.Message) string {
+	var lines []string
+	for i := len(conversation) - 1; i >= 0; i-- {
+		msg := conversation[i]
+		text := strings.TrimSpace(msg.Content)
+		if text == "" || (msg.Role != llm.RoleUser && msg.Role != llm.RoleAssistant) {
+			continue
+		}
+		if msg.Role == llm.RoleAssistant && len(lines) > 0 {
+			// Only the last reply is shown.
+			continue
+		}
+		text, _, _ = strings.Cut(text, "\n")
+		if len(text) > 120 {
+			text = text[:120] + "..."
+		}
+		lines = append([]string{fmt.Sprintf("%s: %s", msg.Role, text)}, lines...)
+		if msg.Role == llm.RoleUser {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
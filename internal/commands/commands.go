@@ -0,0 +1,420 @@
+// Package commands implements the slash commands typed into the chat, such
+// as /help or /model, which control the agent instead of being sent to the
+// model.
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// ErrExit is returned by a command that ends the session.
+var ErrExit = errors.New("session ended by the user")
+
+// CommandDefinition describes a slash command the user can type, much like
+// a ToolDefinition describes a tool for the model.
+type CommandDefinition struct {
+	// Name is the command without its slash, e.g. "model".
+	Name string
+	// Usage shows the arguments the command takes, e.g. "<name>".
+	Usage       string
+	Description string
+	Function    func(session Session, args []string) error
+}
+
+// Session is the part of the agent that commands act on.
+type Session interface {
+	// Model is the name of the model the agent talks to.
+	Model() string
+	// SetModel switches the model used for the following requests, and
+	// turns model routing off.
+	SetModel(model string)
+	// SetTurnModel uses model for the next turn only, whatever the routing.
+	SetTurnModel(model string)
+	// SetRouting turns model routing on or off; it fails when no routing
+	// is configured.
+	SetRouting(on bool) error
+	// Routing describes the models routed between, or is empty while
+	// routing is off.
+	Routing() string
+	// Tools holds the tools the model can be offered, enabled or not.
+	Tools() *tools.Registry
+	// SetToolEnabled switches a tool on or off for the following requests.
+	SetToolEnabled(name string, enabled bool) error
+	// Commands lists the registered commands.
+	Commands() []CommandDefinition
+	// Conversation is the conversation so far, system prompt included.
+	Conversation() []llm.Message
+	// ClearConversation forgets everything but the system prompt.
+	ClearConversation()
+	// AppendMessage adds msg to the conversation, to be sent with the next
+	// request.
+	AppendMessage(msg llm.Message)
+	// Retry resends the last user message, dropping the reply it produced
+	// unless keep is set. It reports false when there is nothing to retry.
+	Retry(keep bool) bool
+	// SetTurnTemperature uses temperature for the next turn only.
+	SetTurnTemperature(temperature float64)
+	// LastPrompt is what the user typed of their last message, without the
+	// files and notes added to it.
+	LastPrompt() (string, bool)
+	// EditLastPrompt discards the user's last message and everything after
+	// it, and sends text in its place once the command is done. It reports
+	// false when the user has sent no message yet.
+	EditLastPrompt(text string) bool
+	// Send sends text as the user's next message once the command is done.
+	Send(text string)
+	// AttachImage adds image to the user's next message and returns how
+	// many images it has.
+	AttachImage(image llm.Image) int
+	// Usage is the tokens used and their cost so far in the session.
+	Usage() llm.UsageTotal
+	// Fork copies the conversation into a new branch, named automatically
+	// when name is empty, and carries on in it. It returns the name.
+	Fork(name string) (string, error)
+	// SwitchBranch carries on with another branch of the conversation.
+	SwitchBranch(name string) error
+	// Branches lists the branches of the conversation.
+	Branches() []Branch
+}
+
+// Branch is a line of the conversation made with /fork.
+type Branch struct {
+	Name string
+	// Parent is the branch this one was forked from, sharing its first
+	// ForkedAt messages.
+	Parent   string
+	ForkedAt int
+	Messages int
+	Current  bool
+}
+
+// Parse splits a chat line into a command name and its arguments. It
+// reports false for lines that are not commands, including ones that merely
+// start with an absolute path such as "/etc/hosts".
+func Parse(line string) (string, []string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil, false
+	}
+	name := fields[0][1:]
+	if name == "" || strings.Contains(name, "/") {
+		return "", nil, false
+	}
+	return name, fields[1:], true
+}
+
+// Find returns the command called name.
+func Find(list []CommandDefinition, name string) (CommandDefinition, bool) {
+	for _, command := range list {
+		if command.Name == name {
+			return command, true
+		}
+	}
+	return CommandDefinition{}, false
+}
+
+// Builtin returns the commands every session has.
+func Builtin() []CommandDefinition {
+	return []CommandDefinition{
+		HelpDefinition,
+		ClearDefinition,
+		ModelDefinition,
+		ToolsDefinition,
+		CostDefinition,
+		SaveDefinition,
+		ExportDefinition,
+		UndoDefinition,
+		ReviewDefinition,
+		RetryDefinition,
+		EditLastDefinition,
+		ForkDefinition,
+		SwitchDefinition,
+		SessionsDefinition,
+		EditorDefinition,
+		TemplateDefinition,
+		ImageDefinition,
+		ExitDefinition,
+	}
+}
+
+// --- Help Command ---
+
+var HelpDefinition = CommandDefinition{
+	Name:        "help",
+	Description: "List the available commands",
+	Function:    Help,
+}
+
+func Help(session Session, args []string) error {
+	list := append([]CommandDefinition{}, session.Commands()...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	width := 0
+	for _, command := range list {
+		if n := len(command.synopsis()); n > width {
+			width = n
+		}
+	}
+	for _, command := range list {
+		fmt.Printf("  \u001b[96m%-*s\u001b[0m  %s\n", width, command.synopsis(), command.Description)
+	}
+	return nil
+}
+
+func (c CommandDefinition) synopsis() string {
+	if c.Usage == "" {
+		return "/" + c.Name
+	}
+	return "/" + c.Name + " " + c.Usage
+}
+
+// --- Clear Command ---
+
+var ClearDefinition = CommandDefinition{
+	Name:        "clear",
+	Description: "Start a new conversation, keeping the system prompt",
+	Function:    Clear,
+}
+
+func Clear(session Session, args []string) error {
+	session.ClearConversation()
+	fmt.Println("Conversation cleared.")
+	return nil
+}
+
+// --- Model Command ---
+
+var ModelDefinition = CommandDefinition{
+	Name:        "model",
+	Usage:       "[name|once <name>|auto]",
+	Description: "Show the current model, switch to another one of the same provider, use one for the next turn only, or route between the configured models",
+	Function:    Model,
+}
+
+func Model(session Session, args []string) error {
+	switch {
+	case len(args) == 0:
+		if routing := session.Routing(); routing != "" {
+			fmt.Printf("Routing between models: %s\n", routing)
+			return nil
+		}
+		fmt.Printf("Current model: %s\n", session.Model())
+	case len(args) == 1 && args[0] == "auto":
+		if err := session.SetRouting(true); err != nil {
+			return err
+		}
+		fmt.Printf("Routing between models: %s\n", session.Routing())
+	case len(args) == 2 && args[0] == "once":
+		session.SetTurnModel(args[1])
+		fmt.Printf("The next turn uses %s.\n", args[1])
+	case len(args) == 1:
+		routed := session.Routing() != ""
+		session.SetModel(args[0])
+		fmt.Printf("Switched to %s.\n", args[0])
+		if routed {
+			fmt.Println("Model routing is off; /model auto turns it back on.")
+		}
+	default:
+		return fmt.Errorf("usage: /model [name|once <name>|auto]")
+	}
+	return nil
+}
+
+// --- Tools Command ---
+
+var ToolsDefinition = CommandDefinition{
+	Name:        "tools",
+	Usage:       "[enable|disable <name>...]",
+	Description: "List the tools the model can use, or switch tools on and off for this session",
+	Function:    Tools,
+}
+
+func Tools(session Session, args []string) error {
+	registry := session.Tools()
+	if len(args) == 0 {
+		list := registry.All()
+		width := 0
+		for _, tool := range list {
+			if len(tool.Name) > width {
+				width = len(tool.Name)
+			}
+		}
+		for _, tool := range list {
+			summary, _, _ := strings.Cut(strings.TrimSpace(tool.Description), "\n")
+			if !registry.IsEnabled(tool.Name) {
+				fmt.Printf("  \u001b[90m%-*s  %-7s  (disabled) %s\u001b[0m\n", width, tool.Name, tool.Category, summary)
+				continue
+			}
+			fmt.Printf("  \u001b[92m%-*s\u001b[0m  \u001b[90m%-7s\u001b[0m  %s\n", width, tool.Name, tool.Category, summary)
+		}
+		return nil
+	}
+
+	if len(args) < 2 || (args[0] != "enable" && args[0] != "disable") {
+		return fmt.Errorf("usage: /tools [enable|disable <name>...]")
+	}
+	enable := args[0] == "enable"
+	for _, name := range args[1:] {
+		if err := session.SetToolEnabled(name, enable); err != nil {
+			return fmt.Errorf("%w; type /tools to list them", err)
+		}
+		fmt.Printf("%s %sd.\n", name, args[0])
+	}
+	return nil
+}
+
+// --- Cost Command ---
+
+var CostDefinition = CommandDefinition{
+	Name:        "cost",
+	Description: "Show the tokens used in this session and what they cost",
+	Function:    Cost,
+}
+
+func Cost(session Session, args []string) error {
+	usage := session.Usage()
+	fmt.Printf("Session: %s\n", usage)
+	if usage.Unpriced == usage.Requests && usage.Requests > 0 {
+		fmt.Printf("No price is known for %s, so no cost is shown.\n", session.Model())
+	}
+	return nil
+}
+
+// --- Undo Command ---
+
+var UndoDefinition = CommandDefinition{
+	Name:        "undo",
+	Usage:       "[N]",
+	Description: "Revert the last N file changes made by the tools (default 1)",
+	Function:    Undo,
+}
+
+// Undo reverts checkpointed file changes and tells the model about it with
+// the next message, so it does not rely on stale contents.
+func Undo(session Session, args []string) error {
+	if tools.ReadOnly {
+		return fmt.Errorf("/undo changes files, which read-only mode does not allow")
+	}
+	n := 1
+	if len(args) > 0 {
+		parsed, err := strconv.Atoi(args[0])
+		if err != nil || parsed < 1 {
+			return fmt.Errorf("usage: /undo [N]")
+		}
+		n = parsed
+	}
+
+	summary, err := tools.Undo(n)
+	if err != nil {
+		return fmt.Errorf("undo failed: %w", err)
+	}
+	fmt.Print(summary)
+	session.AppendMessage(llm.Message{
+		Role:    llm.RoleUser,
+		Content: "I reverted your recent file changes with /undo:\n" + summary,
+	})
+	return nil
+}
+
+// --- Retry Command ---
+
+var RetryDefinition = CommandDefinition{
+	Name:        "retry",
+	Usage:       "[keep] [model <name>] [temperature <t>]",
+	Description: "Resend your last message, discarding the reply unless 'keep' is given, optionally to another model or at another temperature",
+	Function:    Retry,
+}
+
+// Retry regenerates the last reply. The model and temperature it is given
+// apply to the regenerated turn only.
+func Retry(session Session, args []string) error {
+	keep := false
+	model := ""
+	var temperature *float64
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "keep":
+			keep = true
+		case args[i] == "model" && i+1 < len(args):
+			i++
+			model = args[i]
+		case args[i] == "temperature" && i+1 < len(args):
+			i++
+			t, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || t < 0 {
+				return fmt.Errorf("invalid temperature %q: expected a number such as 0.7", args[i])
+			}
+			temperature = &t
+		default:
+			return fmt.Errorf("usage: /retry [keep] [model <name>] [temperature <t>]")
+		}
+	}
+
+	if !session.Retry(keep) {
+		fmt.Println("Nothing to retry yet.")
+		return nil
+	}
+	if model != "" {
+		session.SetTurnModel(model)
+	}
+	if temperature != nil {
+		session.SetTurnTemperature(*temperature)
+		fmt.Printf("\u001b[90mTemperature for this turn: %g\u001b[0m\n", *temperature)
+	}
+	return nil
+}
+
+// --- EditLast Command ---
+
+var EditLastDefinition = CommandDefinition{
+	Name:        "edit-last",
+	Usage:       "[text]",
+	Description: "Replace your last message, in $EDITOR or with text, and send it again, discarding the replies to it",
+	Function:    EditLast,
+}
+
+// EditLast amends the user's last message. Without text, the message is
+// opened in the editor to be changed there.
+func EditLast(session Session, args []string) error {
+	last, ok := session.LastPrompt()
+	if !ok {
+		fmt.Println("Nothing to edit yet.")
+		return nil
+	}
+	text := strings.Join(args, " ")
+	if text == "" {
+		if Editor == nil {
+			return fmt.Errorf("no editor can be opened in this session; give the new message as /edit-last <text>")
+		}
+		edited, err := Editor(last)
+		if err != nil {
+			return err
+		}
+		if edited == "" {
+			fmt.Println("Left the message empty; nothing changed.")
+			return nil
+		}
+		text = edited
+	}
+	session.EditLastPrompt(text)
+	return nil
+}
+
+// --- Exit Command ---
+
+var ExitDefinition = CommandDefinition{
+	Name:        "exit",
+	Description: "End the session",
+	Function:    Exit,
+}
+
+func Exit(session Session, args []string) error {
+	return ErrExit
+}
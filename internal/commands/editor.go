@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Editor opens text in the user's editor and returns it as saved. The
+// interface sets it, as it owns the terminal.
+var Editor func(text string) (string, error)
+
+// --- Editor Command ---
+
+var EditorDefinition = CommandDefinition{
+	Name:        "editor",
+	Usage:       "[text]",
+	Description: "Write your next message in $EDITOR, starting from text",
+	Function:    OpenEditor,
+}
+
+// OpenEditor lets the user compose a long message, such as one with code in
+// it, in their editor, and sends it when the editor exits.
+func OpenEditor(session Session, args []string) error {
+	if Editor == nil {
+		return fmt.Errorf("no editor can be opened in this session")
+	}
+	text, err := Editor(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		fmt.Println("Nothing to send.")
+		return nil
+	}
+	fmt.Println(text)
+	session.Send(text)
+	return nil
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// DefaultExportDir is where /export writes transcripts when no file is given.
+const DefaultExportDir = ".agent/exports"
+
+// Export formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+)
+
+// exportedSession is the JSON transcript written by /export. Unlike /save,
+// which keeps the messages as sent to the model, each tool call is shown
+// together with its result.
+type exportedSession struct {
+	Model      string            `json:"model"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Usage      llm.UsageTotal    `json:"usage"`
+	Messages   []exportedMessage `json:"messages"`
+}
+
+type exportedMessage struct {
+	Role      string             `json:"role"`
+	Content   string             `json:"content,omitempty"`
+	ToolCalls []exportedToolCall `json:"tool_calls,omitempty"`
+}
+
+type exportedToolCall struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Arguments json.RawMessage   `json:"arguments"`
+	Result    *tools.ToolResult `json:"result,omitempty"`
+}
+
+// --- Export Command ---
+
+var ExportDefinition = CommandDefinition{
+	Name:        "export",
+	Usage:       "[md|json|file]",
+	Description: "Export the conversation with its tool calls and diffs as Markdown or JSON (default: " + DefaultExportDir + "/<time>.md)",
+	Function:    Export,
+}
+
+func Export(session Session, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /export [md|json|file]")
+	}
+	format := FormatMarkdown
+	path := ""
+	if len(args) == 1 {
+		switch strings.ToLower(args[0]) {
+		case "md", "markdown":
+		case "json":
+			format = FormatJSON
+		default:
+			path = args[0]
+			if strings.EqualFold(filepath.Ext(path), ".json") {
+				format = FormatJSON
+			}
+		}
+	}
+	if path == "" {
+		ext := ".md"
+		if format == FormatJSON {
+			ext = ".json"
+		}
+		path = filepath.Join(DefaultExportDir, time.Now().Format("20060102-150405")+ext)
+	}
+
+	var out bytes.Buffer
+	err := ExportSession(&out, session, format)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	err = os.WriteFile(path, out.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to export conversation: %w", err)
+	}
+	fmt.Printf("Exported %d messages to %s\n", len(session.Conversation()), path)
+	return nil
+}
+
+// ExportSession writes the conversation of session to w as a transcript in
+// format, FormatMarkdown or FormatJSON, with every tool call next to its
+// result.
+func ExportSession(w io.Writer, session Session, format string) error {
+	transcript := exportedSession{
+		Model:      session.Model(),
+		ExportedAt: time.Now(),
+		Usage:      session.Usage(),
+		Messages:   transcriptMessages(session.Conversation()),
+	}
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(transcript)
+		if err != nil {
+			return fmt.Errorf("failed to encode conversation: %w", err)
+		}
+		return nil
+	case FormatMarkdown:
+		_, err := io.WriteString(w, transcript.markdown())
+		return err
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// transcriptMessages folds the tool messages of conversation into the
+// calls they answer.
+func transcriptMessages(conversation []llm.Message) []exportedMessage {
+	results := map[string]*tools.ToolResult{}
+	for _, msg := range conversation {
+		if msg.Role != llm.RoleTool {
+			continue
+		}
+		var result tools.ToolResult
+		if json.Unmarshal([]byte(msg.Content), &result) != nil {
+			// Not written by the agent's tools; keep it as it is.
+			result = tools.ToolResult{Success: true, Output: msg.Content}
+		}
+		results[msg.ToolCallID] = &result
+	}
+
+	var messages []exportedMessage
+	for _, msg := range conversation {
+		if msg.Role == llm.RoleTool {
+			continue
+		}
+		exported := exportedMessage{Role: msg.Role, Content: msg.Content}
+		for _, call := range msg.ToolCalls {
+			arguments := json.RawMessage(call.Arguments)
+			if !json.Valid(arguments) {
+				arguments, _ = json.Marshal(call.Arguments)
+			}
+			exported.ToolCalls = append(exported.ToolCalls, exportedToolCall{
+				ID:        call.ID,
+				Name:      call.Name,
+				Arguments: arguments,
+				Result:    results[call.ID],
+			})
+		}
+		messages = append(messages, exported)
+	}
+	return messages
+}
+
+func (t exportedSession) markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Conversation with %s\n\n", t.Model)
+	fmt.Fprintf(&sb, "Exported %s. Usage: %s.\n", t.ExportedAt.Format(time.RFC1123), t.Usage)
+	for _, msg := range t.Messages {
+		switch msg.Role {
+		case llm.RoleSystem:
+			sb.WriteString("\n<details>\n<summary>System prompt</summary>\n\n")
+			sb.WriteString(fence("", msg.Content))
+			sb.WriteString("\n</details>\n")
+			continue
+		case llm.RoleUser:
+			sb.WriteString("\n## User\n")
+		default:
+			sb.WriteString("\n## Assistant\n")
+		}
+		if msg.Content != "" {
+			sb.WriteString("\n" + strings.TrimSpace(msg.Content) + "\n")
+		}
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(&sb, "\n### Tool call: `%s`\n\n", call.Name)
+			var arguments bytes.Buffer
+			if json.Indent(&arguments, call.Arguments, "", "  ") != nil {
+				arguments.Reset()
+				arguments.Write(call.Arguments)
+			}
+			sb.WriteString(fence("json", arguments.String()))
+			switch {
+			case call.Result == nil:
+				sb.WriteString("\nNo result.\n")
+			case !call.Result.Success:
+				sb.WriteString("\n**Failed:**\n\n")
+				sb.WriteString(fence("", call.Result.Error))
+			default:
+				sb.WriteString("\n**Result:**\n\n")
+				language := ""
+				if strings.Contains(call.Result.Output, "\n@@ ") {
+					language = "diff"
+				}
+				sb.WriteString(fence(language, call.Result.Output))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// fence wraps text in a Markdown code block, using a fence longer than any
+// run of backticks inside it.
+func fence(language, text string) string {
+	ticks := "```"
+	for strings.Contains(text, ticks) {
+		ticks += "`"
+	}
+	return ticks + language + "\n" + strings.TrimSuffix(text, "\n") + "\n" + ticks + "\n"
+}
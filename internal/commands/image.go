@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/images"
+	"code-editing-agent/internal/llm"
+)
+
+// --- Image Command ---
+
+var ImageDefinition = CommandDefinition{
+	Name:        "image",
+	Usage:       "[path]",
+	Description: "Attach an image file, or the image in the clipboard, to your next message",
+	Function:    Image,
+}
+
+func Image(session Session, args []string) error {
+	var image llm.Image
+	var err error
+	name := "the clipboard's image"
+	if len(args) > 0 {
+		name = strings.Join(args, " ")
+		image, err = images.Load(name)
+	} else {
+		image, err = images.FromClipboard()
+	}
+	if err != nil {
+		return err
+	}
+	count := session.AttachImage(image)
+	fmt.Printf("Attached %s (%s, %d KB); it is sent with your next message", name, image.MediaType, (len(image.Data)+1023)>>10)
+	if count > 1 {
+		fmt.Printf(" along with %d other images", count-1)
+	}
+	fmt.Println(".")
+	return nil
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// --- Review Command ---
+
+var ReviewDefinition = CommandDefinition{
+	Name:        "review",
+	Description: "Review the files changed in this session one by one, reverting the ones you reject",
+	Function:    Review,
+}
+
+// Review shows every file the tools changed in the session as one diff and
+// asks about each whether to keep it. Rejected files are reverted to how
+// they were before the session, and the model is told, so a commit that
+// follows only has the approved changes. Once some are approved, the model
+// can be asked to commit them.
+func Review(session Session, args []string) error {
+	if tools.AskUser == nil {
+		return fmt.Errorf("/review needs an interactive session")
+	}
+	changes, err := tools.SessionChanges()
+	if err != nil {
+		return fmt.Errorf("review failed: %w", err)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No files were changed in this session.")
+		return nil
+	}
+
+	for _, change := range changes {
+		fmt.Print(tools.ColorizeDiff(change.Diff))
+	}
+	fmt.Printf("\u001b[93mReview\u001b[0m: %d file(s) changed in this session\n", len(changes))
+	for _, change := range changes {
+		fmt.Printf("  %-8s %s \u001b[92m+%d\u001b[0m \u001b[91m-%d\u001b[0m\n", change.Status, change.Path, change.Added, change.Removed)
+	}
+
+	var approved, rejected []tools.FileChange
+	decideRest := -1 // -1 undecided, 0 reject the rest, 1 approve the rest
+	for i, change := range changes {
+		keep := decideRest == 1
+		for decideRest < 0 {
+			answer, ok := tools.AskUser(fmt.Sprintf("Keep %s (%d/%d)? [y]es, [n]o (revert), [d]iff, [a]ll remaining, [r]evert remaining: ", change.Path, i+1, len(changes)))
+			if !ok {
+				fmt.Println("Review cancelled; no files were reverted.")
+				return nil
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				keep = true
+			case "n", "no":
+				keep = false
+			case "d", "diff":
+				fmt.Print(tools.ColorizeDiff(change.Diff))
+				continue
+			case "a", "all":
+				keep = true
+				decideRest = 1
+			case "r", "revert":
+				keep = false
+				decideRest = 0
+			default:
+				continue
+			}
+			break
+		}
+		if keep {
+			approved = append(approved, change)
+		} else {
+			rejected = append(rejected, change)
+		}
+	}
+
+	if len(rejected) > 0 {
+		if tools.ReadOnly {
+			return fmt.Errorf("reverting files changes them, which read-only mode does not allow")
+		}
+		if err := tools.RevertChanges(rejected); err != nil {
+			return fmt.Errorf("failed to revert the rejected files: %w", err)
+		}
+		fmt.Printf("Reverted %d file(s); /undo brings them back.\n", len(rejected))
+	} else {
+		fmt.Println("All changes kept.")
+	}
+
+	var note strings.Builder
+	note.WriteString("I reviewed the files you changed in this session with /review.\n")
+	if len(rejected) > 0 {
+		note.WriteString("I rejected these, and they are now reverted to how they were before the session; do not redo them unless I ask:\n")
+		for _, change := range rejected {
+			fmt.Fprintf(&note, "- %s\n", change.Path)
+		}
+	}
+	if len(approved) > 0 {
+		note.WriteString("I approved these:\n")
+		for _, change := range approved {
+			fmt.Fprintf(&note, "- %s\n", change.Path)
+		}
+	}
+
+	if len(approved) > 0 && session.Tools().IsEnabled("git_commit") && tools.Confirm("Have the agent commit the approved files?") {
+		note.WriteString("Commit the approved files, and only those, with git_commit.")
+		session.Send(note.String())
+		return nil
+	}
+	session.AppendMessage(llm.Message{Role: llm.RoleUser, Content: note.String()})
+	return nil
+}
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code-editing-agent/internal/llm"
+)
+
+// DefaultSaveDir is where /save writes conversations when no file is given.
+const DefaultSaveDir = ".agent/sessions"
+
+// savedConversation is the file format written by /save.
+type savedConversation struct {
+	Model    string         `json:"model"`
+	SavedAt  time.Time      `json:"saved_at"`
+	Usage    llm.UsageTotal `json:"usage"`
+	Messages []llm.Message  `json:"messages"`
+}
+
+// --- Save Command ---
+
+var SaveDefinition = CommandDefinition{
+	Name:        "save",
+	Usage:       "[file]",
+	Description: "Save the conversation as JSON (default: " + DefaultSaveDir + "/<time>.json)",
+	Function:    Save,
+}
+
+func Save(session Session, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /save [file]")
+	}
+	now := time.Now()
+	path := filepath.Join(DefaultSaveDir, now.Format("20060102-150405")+".json")
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	data, err := json.MarshalIndent(savedConversation{
+		Model:    session.Model(),
+		SavedAt:  now,
+		Usage:    session.Usage(),
+		Messages: session.Conversation(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	err = os.WriteFile(path, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	fmt.Printf("Saved %d messages to %s\n", len(session.Conversation()), path)
+	return nil
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"code-editing-agent/internal/sessions"
+)
+
+// SessionIndex is the index /sessions lists; main sets it in workspaces
+// where sessions are recorded.
+var SessionIndex string
+
+// defaultSessionsShown is how many sessions /sessions lists without a
+// count.
+const defaultSessionsShown = 20
+
+// --- Sessions Command ---
+
+var SessionsDefinition = CommandDefinition{
+	Name:        "sessions",
+	Usage:       "[count|all]",
+	Description: fmt.Sprintf("List the latest sessions held in this workspace (default %d) with their titles, models and usage", defaultSessionsShown),
+	Function:    Sessions,
+}
+
+func Sessions(session Session, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /sessions [count|all]")
+	}
+	if SessionIndex == "" {
+		return fmt.Errorf("sessions are only recorded in trusted workspaces")
+	}
+	count := defaultSessionsShown
+	if len(args) == 1 {
+		if args[0] == "all" {
+			count = 0
+		} else if n, err := strconv.Atoi(args[0]); err == nil && n > 0 {
+			count = n
+		} else {
+			return fmt.Errorf("usage: /sessions [count|all]")
+		}
+	}
+
+	list, err := sessions.Load(SessionIndex)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Println("No sessions recorded yet.")
+		return nil
+	}
+	shown := list
+	if count > 0 && len(shown) > count {
+		shown = shown[len(shown)-count:]
+	}
+	for i := len(shown) - 1; i >= 0; i-- {
+		e := shown[i]
+		title := e.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		details := fmt.Sprintf("%s, %d messages, %d tokens", e.Model, e.Messages, e.Usage.Tokens())
+		if e.Usage.Cost > 0 {
+			details += fmt.Sprintf(", $%.4f", e.Usage.Cost)
+		}
+		fmt.Printf("  \u001b[96m%s\u001b[0m  %s  \u001b[90m%s-%s, %s\u001b[0m\n",
+			e.ID, title, e.Started.Format("Jan 2 15:04"), e.Updated.Format("15:04"), details)
+	}
+	if len(shown) < len(list) {
+		fmt.Printf("\u001b[90m%d of %d sessions; /sessions all lists every one.\u001b[0m\n", len(shown), len(list))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/templates"
+)
+
+// TemplateDir and ConfiguredTemplates are where /template finds templates
+// besides the built-in ones. main sets them; the directory is read on every
+// use, so new template files need no restart.
+var (
+	TemplateDir         string
+	ConfiguredTemplates map[string]string
+)
+
+// --- Template Command ---
+
+var TemplateDefinition = CommandDefinition{
+	Name:        "template",
+	Usage:       "[name [args...]]",
+	Description: "List the prompt templates, or send one with its {{variables}} filled in from args",
+	Function:    Template,
+}
+
+func Template(session Session, args []string) error {
+	list, err := templates.Load(TemplateDir, ConfiguredTemplates)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		width := 0
+		for _, t := range list {
+			if n := len(t.Name) + 1 + len(t.Usage()); n > width {
+				width = n
+			}
+		}
+		for _, t := range list {
+			synopsis := strings.TrimSpace(t.Name + " " + t.Usage())
+			summary, _, _ := strings.Cut(strings.TrimSpace(t.Text), "\n")
+			fmt.Printf("  \u001b[96m%-*s\u001b[0m  %s \u001b[90m(%s)\u001b[0m\n", width, synopsis, summary, t.Source)
+		}
+		return nil
+	}
+
+	t, ok := templates.Find(list, args[0])
+	if !ok {
+		return fmt.Errorf("no template called %s; type /template to list them", args[0])
+	}
+	text, err := t.Expand(args[1:])
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	session.Send(text)
+	return nil
+}
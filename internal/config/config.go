@@ -0,0 +1,485 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"code-editing-agent/internal/hooks"
+	"code-editing-agent/internal/policy"
+	"code-editing-agent/internal/redact"
+)
+
+// WorkspaceFile is the name of the per-repository settings file.
+const WorkspaceFile = ".agent.yaml"
+
+// Config holds the model and tool settings. Unset fields keep their
+// defaults.
+type Config struct {
+	Provider    string                  `yaml:"provider"`
+	Model       string                  `yaml:"model"`
+	Temperature *float64                `yaml:"temperature"`
+	MaxTokens   int                     `yaml:"max_tokens"`
+	BaseURL     string                  `yaml:"base_url"`
+	Tools       map[string]ToolSettings `yaml:"tools"`
+	// SystemPrompt replaces the agent's default instructions.
+	SystemPrompt string `yaml:"system_prompt"`
+	// ContextFiles lists the workspace files added to the system prompt;
+	// an empty list adds none.
+	ContextFiles []string `yaml:"context_files"`
+	// Retry controls how failed API requests are retried.
+	Retry RetrySettings `yaml:"retry"`
+	// EmbeddingModel is the model semantic_search embeds code with.
+	EmbeddingModel string `yaml:"embedding_model"`
+	// FetchDomains are the domains fetch_url may download from besides the
+	// documentation sites it knows; "*" allows any. The lists of all config
+	// files are combined.
+	FetchDomains []string `yaml:"fetch_domains"`
+	// WebSearch is the engine web_search uses: brave, serpapi or
+	// duckduckgo. By default it is chosen by the API keys that are set.
+	WebSearch string `yaml:"web_search"`
+	// Formatters maps file extensions such as ".go" to the command run on
+	// a file, whose path is appended, after a tool edits it, e.g.
+	// "gofmt -w". An empty command turns off the formatter of an earlier
+	// config file.
+	Formatters map[string]string `yaml:"formatters"`
+	// AutoVerify checks that the project still compiles after each batch
+	// of edits and tells the model the errors.
+	AutoVerify bool `yaml:"auto_verify"`
+	// ReadFileMaxSize is the largest file, in bytes, that read_file reads
+	// whole; larger ones are only read a part at a time. Zero means 1MB.
+	ReadFileMaxSize int64 `yaml:"read_file_max_size"`
+	// Limits caps how fast and how much the model API is used.
+	Limits LimitSettings `yaml:"limits"`
+	// Routing sends simple turns to a cheaper model.
+	Routing RoutingSettings `yaml:"routing"`
+	// Azure configures the azure provider; its endpoint is BaseURL.
+	Azure AzureSettings `yaml:"azure"`
+	// Gemini configures the gemini provider.
+	Gemini GeminiSettings `yaml:"gemini"`
+	// Plugins are tools implemented by executables. A plugin replaces one
+	// of the same name from an earlier config file.
+	Plugins []PluginSettings `yaml:"plugins"`
+	// Hooks are commands run before and after tool calls and when sessions
+	// start and end. The lists of all config files are combined, those of
+	// the user config running first.
+	Hooks []HookSettings `yaml:"hooks"`
+	// Templates are prompts sent with /template, by name; {{name}} in them
+	// is filled in from the command's arguments. They replace built-in
+	// templates of the same name, and an empty one turns a template off.
+	// The maps of all config files are combined.
+	Templates map[string]string `yaml:"templates"`
+	// LSP configures the language servers behind the code intelligence
+	// tools.
+	LSP LSPSettings `yaml:"lsp"`
+	// Redaction configures how credentials are masked in what is sent to
+	// the model and written to logs.
+	Redaction RedactionSettings `yaml:"redaction"`
+	// Approval decides which tool calls run without asking, ask first or
+	// are refused.
+	Approval ApprovalSettings `yaml:"approval"`
+	// PullRequests configures how create_pr opens pull requests.
+	PullRequests PullRequestSettings `yaml:"pull_requests"`
+}
+
+// PullRequestSettings configures create_pr.
+type PullRequestSettings struct {
+	// GitHubToken and GitLabToken are the tokens pull requests are opened
+	// with, in place of GITHUB_TOKEN and GITLAB_TOKEN.
+	GitHubToken string `yaml:"github_token"`
+	GitLabToken string `yaml:"gitlab_token"`
+	// Base is the branch they are opened against, the repository's
+	// default branch when unset.
+	Base string `yaml:"base"`
+	// Draft opens them as drafts.
+	Draft bool `yaml:"draft"`
+}
+
+// ApprovalSettings is the approval policy: allow, ask or deny for the
+// tools of each category, and rules for writes under some paths.
+type ApprovalSettings struct {
+	// Read, Write and Execute decide for the tools of that category; unset
+	// ones keep the usual behavior of asking before changes and commands.
+	Read    string `yaml:"read"`
+	Write   string `yaml:"write"`
+	Execute string `yaml:"execute"`
+	// Paths are rules for writes to the files under some paths, the last
+	// matching rule deciding. The lists of all config files are combined,
+	// those of the user config first.
+	Paths []PathApproval `yaml:"paths"`
+}
+
+// PathApproval decides, ask or deny, for writes under Path, a pattern such
+// as "vendor" or "db/migrations/*.sql".
+type PathApproval struct {
+	Path  string `yaml:"path"`
+	Write string `yaml:"write"`
+}
+
+// RedactionSettings configures the masking of credentials.
+type RedactionSettings struct {
+	// Patterns are regular expressions matching credentials besides the
+	// built-in ones, such as an internal token format. Text matched by a
+	// pattern's first group is kept, as is text matched by its second
+	// group. The lists of all config files are combined.
+	Patterns []string `yaml:"patterns"`
+}
+
+// LSPSettings configures language servers.
+type LSPSettings struct {
+	// Servers maps languages (go, python, typescript, rust) to the command
+	// that starts their server, replacing the default; an empty command
+	// turns a language off. The maps of all config files are combined.
+	Servers map[string][]string `yaml:"servers"`
+}
+
+// PluginSettings describes a tool implemented by an executable, which gets
+// the call's arguments as JSON on stdin and writes its result to stdout.
+type PluginSettings struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Command     string   `yaml:"command"`
+	Args        []string `yaml:"args"`
+	// Schema is the JSON schema of the arguments, written in YAML.
+	Schema map[string]interface{} `yaml:"schema"`
+	// Category is read, write or execute (the default); calls to plugins
+	// that are not read-only ask for approval.
+	Category string        `yaml:"category"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// HookSettings describes a command run on an event: pre_tool, post_tool,
+// session_start or session_end. The command gets the event as JSON on
+// stdin; a pre_tool hook that exits with a non-zero status stops the call.
+type HookSettings struct {
+	Event string `yaml:"event"`
+	// Tools limits pre_tool and post_tool hooks to the tools named, which
+	// may be patterns such as "git_*"; by default they run for all tools.
+	Tools   []string      `yaml:"tools"`
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// AzureSettings configures Azure OpenAI.
+type AzureSettings struct {
+	// APIVersion is the Azure OpenAI API version, e.g. "2024-10-21".
+	APIVersion string `yaml:"api_version"`
+	// Deployments maps model names to the deployments serving them, for
+	// deployments not named after their model. The maps of all config
+	// files are combined.
+	Deployments map[string]string `yaml:"deployments"`
+}
+
+// GeminiSettings configures Google Gemini.
+type GeminiSettings struct {
+	// SafetySettings maps harm categories, such as dangerous_content, to
+	// the threshold at which replies are blocked, such as block_only_high.
+	// The maps of all config files are combined.
+	SafetySettings map[string]string `yaml:"safety_settings"`
+}
+
+// LimitSettings caps the use of the model API. Zero means no limit.
+type LimitSettings struct {
+	// RequestsPerMinute holds requests back so that no more than this many
+	// are sent in any minute.
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	// MaxRequests and MaxCost, in dollars, are the session's budget; once
+	// either is used up the user is asked whether to go on.
+	MaxRequests int     `yaml:"max_requests"`
+	MaxCost     float64 `yaml:"max_cost"`
+	// MaxTurnSteps is how many requests the model may make in one turn,
+	// calling tools after each, before the user is asked whether it should
+	// go on; zero means the default of 25.
+	MaxTurnSteps int `yaml:"max_turn_steps"`
+}
+
+// RoutingSettings configures which model each turn goes to. Turns go to
+// CheapModel unless their message is long, contains one of StrongKeywords,
+// or follows failed tool calls, in which case they go to StrongModel.
+type RoutingSettings struct {
+	// CheapModel turns routing on.
+	CheapModel string `yaml:"cheap_model"`
+	// StrongModel defaults to the model.
+	StrongModel string `yaml:"strong_model"`
+	// MaxCheapLength is the longest message, in characters, sent to the
+	// cheap model; zero means 300.
+	MaxCheapLength int `yaml:"max_cheap_length"`
+	// StrongKeywords replace the default words, such as "implement" or
+	// "fix", that send a message to the strong model.
+	StrongKeywords []string `yaml:"strong_keywords"`
+	// MaxFailures is how many tool calls may fail before the strong model
+	// takes over; zero means 2.
+	MaxFailures int `yaml:"max_failures"`
+}
+
+// RetrySettings configures retries of failed API requests. Durations are
+// written like "500ms" or "2s".
+type RetrySettings struct {
+	// MaxAttempts is the total number of tries; 1 disables retrying.
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// Jitter is the fraction, between 0 and 1, by which waits vary.
+	Jitter *float64 `yaml:"jitter"`
+}
+
+// ToolSettings configures a single tool.
+type ToolSettings struct {
+	// Disabled hides the tool from the model.
+	Disabled bool `yaml:"disabled"`
+	// AutoApprove runs the tool without asking for approval.
+	AutoApprove bool `yaml:"auto_approve"`
+}
+
+// Load reads ~/.code-agent/config.yaml and then, when workspace is not
+// empty, the workspace's .agent.yaml, whose settings take precedence.
+// Missing files are skipped.
+func Load(workspace string) (Config, error) {
+	var cfg Config
+	dir, err := Dir()
+	if err != nil {
+		return cfg, err
+	}
+	paths := []string{filepath.Join(dir, "config.yaml")}
+	if workspace != "" {
+		paths = append(paths, filepath.Join(workspace, WorkspaceFile))
+	}
+
+	for _, path := range paths {
+		file, err := loadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.merge(file)
+	}
+	return cfg, nil
+}
+
+func loadFile(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// Unknown keys are rejected so that a typo does not silently do nothing.
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if cfg.Temperature != nil && (*cfg.Temperature < 0 || *cfg.Temperature > 2) {
+		return cfg, fmt.Errorf("invalid temperature %v in %s: must be between 0 and 2", *cfg.Temperature, path)
+	}
+	if cfg.MaxTokens < 0 {
+		return cfg, fmt.Errorf("invalid max_tokens %d in %s", cfg.MaxTokens, path)
+	}
+	if cfg.ReadFileMaxSize < 0 {
+		return cfg, fmt.Errorf("invalid read_file_max_size %d in %s", cfg.ReadFileMaxSize, path)
+	}
+	if r := cfg.Retry; r.MaxAttempts < 0 || r.InitialBackoff < 0 || r.MaxBackoff < 0 {
+		return cfg, fmt.Errorf("invalid retry settings in %s: attempts and backoffs cannot be negative", path)
+	}
+	if l := cfg.Limits; l.RequestsPerMinute < 0 || l.MaxRequests < 0 || l.MaxCost < 0 || l.MaxTurnSteps < 0 {
+		return cfg, fmt.Errorf("invalid limits in %s: limits cannot be negative", path)
+	}
+	for _, plugin := range cfg.Plugins {
+		if plugin.Name == "" || plugin.Command == "" {
+			return cfg, fmt.Errorf("invalid plugin in %s: name and command are required", path)
+		}
+	}
+	for _, hook := range cfg.Hooks {
+		if !hooks.ValidEvent(hook.Event) || hook.Command == "" || hook.Timeout < 0 {
+			return cfg, fmt.Errorf("invalid hook in %s: event must be pre_tool, post_tool, session_start or session_end, and command is required", path)
+		}
+	}
+	if _, err := redact.Compile(cfg.Redaction.Patterns); err != nil {
+		return cfg, fmt.Errorf("%w in %s", err, path)
+	}
+	if r := cfg.Routing; r.MaxCheapLength < 0 || r.MaxFailures < 0 {
+		return cfg, fmt.Errorf("invalid routing settings in %s: lengths and failures cannot be negative", path)
+	}
+	if _, err := cfg.Approval.Policy(); err != nil {
+		return cfg, fmt.Errorf("invalid approval settings in %s: %w", path, err)
+	}
+	if j := cfg.Retry.Jitter; j != nil && (*j < 0 || *j > 1) {
+		return cfg, fmt.Errorf("invalid retry jitter %v in %s: must be between 0 and 1", *j, path)
+	}
+	return cfg, nil
+}
+
+// merge overrides cfg with every field set in other.
+func (cfg *Config) merge(other Config) {
+	if other.Provider != "" {
+		cfg.Provider = other.Provider
+	}
+	if other.Model != "" {
+		cfg.Model = other.Model
+	}
+	if other.Temperature != nil {
+		cfg.Temperature = other.Temperature
+	}
+	if other.MaxTokens != 0 {
+		cfg.MaxTokens = other.MaxTokens
+	}
+	if other.BaseURL != "" {
+		cfg.BaseURL = other.BaseURL
+	}
+	if other.SystemPrompt != "" {
+		cfg.SystemPrompt = other.SystemPrompt
+	}
+	if other.WebSearch != "" {
+		cfg.WebSearch = other.WebSearch
+	}
+	if other.EmbeddingModel != "" {
+		cfg.EmbeddingModel = other.EmbeddingModel
+	}
+	if other.ContextFiles != nil {
+		cfg.ContextFiles = other.ContextFiles
+	}
+	if other.ReadFileMaxSize != 0 {
+		cfg.ReadFileMaxSize = other.ReadFileMaxSize
+	}
+	if other.Retry.MaxAttempts != 0 {
+		cfg.Retry.MaxAttempts = other.Retry.MaxAttempts
+	}
+	if other.Retry.InitialBackoff != 0 {
+		cfg.Retry.InitialBackoff = other.Retry.InitialBackoff
+	}
+	if other.Retry.MaxBackoff != 0 {
+		cfg.Retry.MaxBackoff = other.Retry.MaxBackoff
+	}
+	if other.Retry.Jitter != nil {
+		cfg.Retry.Jitter = other.Retry.Jitter
+	}
+	if other.Limits.RequestsPerMinute != 0 {
+		cfg.Limits.RequestsPerMinute = other.Limits.RequestsPerMinute
+	}
+	if other.Limits.MaxRequests != 0 {
+		cfg.Limits.MaxRequests = other.Limits.MaxRequests
+	}
+	if other.Limits.MaxCost != 0 {
+		cfg.Limits.MaxCost = other.Limits.MaxCost
+	}
+	if other.Limits.MaxTurnSteps != 0 {
+		cfg.Limits.MaxTurnSteps = other.Limits.MaxTurnSteps
+	}
+	if other.Routing.CheapModel != "" {
+		cfg.Routing.CheapModel = other.Routing.CheapModel
+	}
+	if other.Routing.StrongModel != "" {
+		cfg.Routing.StrongModel = other.Routing.StrongModel
+	}
+	if other.Routing.MaxCheapLength != 0 {
+		cfg.Routing.MaxCheapLength = other.Routing.MaxCheapLength
+	}
+	if other.Routing.StrongKeywords != nil {
+		cfg.Routing.StrongKeywords = other.Routing.StrongKeywords
+	}
+	if other.Routing.MaxFailures != 0 {
+		cfg.Routing.MaxFailures = other.Routing.MaxFailures
+	}
+	if other.AutoVerify {
+		cfg.AutoVerify = true
+	}
+	if other.PullRequests.GitHubToken != "" {
+		cfg.PullRequests.GitHubToken = other.PullRequests.GitHubToken
+	}
+	if other.PullRequests.GitLabToken != "" {
+		cfg.PullRequests.GitLabToken = other.PullRequests.GitLabToken
+	}
+	if other.PullRequests.Base != "" {
+		cfg.PullRequests.Base = other.PullRequests.Base
+	}
+	if other.PullRequests.Draft {
+		cfg.PullRequests.Draft = true
+	}
+	if other.Azure.APIVersion != "" {
+		cfg.Azure.APIVersion = other.Azure.APIVersion
+	}
+	for category, threshold := range other.Gemini.SafetySettings {
+		if cfg.Gemini.SafetySettings == nil {
+			cfg.Gemini.SafetySettings = map[string]string{}
+		}
+		cfg.Gemini.SafetySettings[category] = threshold
+	}
+	for model, deployment := range other.Azure.Deployments {
+		if cfg.Azure.Deployments == nil {
+			cfg.Azure.Deployments = map[string]string{}
+		}
+		cfg.Azure.Deployments[model] = deployment
+	}
+	for ext, command := range other.Formatters {
+		if cfg.Formatters == nil {
+			cfg.Formatters = map[string]string{}
+		}
+		cfg.Formatters[ext] = command
+	}
+	for name, text := range other.Templates {
+		if cfg.Templates == nil {
+			cfg.Templates = map[string]string{}
+		}
+		cfg.Templates[name] = text
+	}
+	for language, command := range other.LSP.Servers {
+		if cfg.LSP.Servers == nil {
+			cfg.LSP.Servers = map[string][]string{}
+		}
+		cfg.LSP.Servers[language] = command
+	}
+	for _, plugin := range other.Plugins {
+		replaced := false
+		for i := range cfg.Plugins {
+			if cfg.Plugins[i].Name == plugin.Name {
+				cfg.Plugins[i], replaced = plugin, true
+			}
+		}
+		if !replaced {
+			cfg.Plugins = append(cfg.Plugins, plugin)
+		}
+	}
+	cfg.Hooks = append(cfg.Hooks, other.Hooks...)
+	if other.Approval.Read != "" {
+		cfg.Approval.Read = other.Approval.Read
+	}
+	if other.Approval.Write != "" {
+		cfg.Approval.Write = other.Approval.Write
+	}
+	if other.Approval.Execute != "" {
+		cfg.Approval.Execute = other.Approval.Execute
+	}
+	cfg.Approval.Paths = append(cfg.Approval.Paths, other.Approval.Paths...)
+	cfg.FetchDomains = append(cfg.FetchDomains, other.FetchDomains...)
+	cfg.Redaction.Patterns = append(cfg.Redaction.Patterns, other.Redaction.Patterns...)
+	for name, settings := range other.Tools {
+		if cfg.Tools == nil {
+			cfg.Tools = map[string]ToolSettings{}
+		}
+		cfg.Tools[name] = settings
+	}
+}
+
+// Policy returns the approval policy the settings describe.
+func (s ApprovalSettings) Policy() (*policy.Policy, error) {
+	categories := map[string]policy.Decision{}
+	for category, decision := range map[string]string{"read": s.Read, "write": s.Write, "execute": s.Execute} {
+		if decision != "" {
+			categories[category] = policy.Decision(decision)
+		}
+	}
+	rules := make([]policy.PathRule, len(s.Paths))
+	for i, rule := range s.Paths {
+		rules[i] = policy.PathRule{Pattern: rule.Path, Write: policy.Decision(rule.Write)}
+	}
+	return policy.New(categories, rules)
+}
@@ -0,0 +1,121 @@
+// Package config holds the agent's settings: the user's, stored under
+// ~/.code-agent, and each workspace's own .agent.yaml.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir returns the directory holding the user's agent configuration.
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".code-agent"), nil
+}
+
+type trustedDirectories struct {
+	Directories []string `json:"trusted_directories"`
+}
+
+func trustFile() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trusted.json"), nil
+}
+
+func loadTrusted() (trustedDirectories, error) {
+	var trusted trustedDirectories
+	path, err := trustFile()
+	if err != nil {
+		return trusted, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return trusted, nil
+	}
+	if err != nil {
+		return trusted, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	err = json.Unmarshal(data, &trusted)
+	if err != nil {
+		return trusted, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return trusted, nil
+}
+
+// canonicalDir resolves dir to an absolute path without symlinks, so a
+// workspace is recognized however it is reached.
+func canonicalDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	return abs, nil
+}
+
+// IsTrusted reports whether the user has trusted dir or a directory
+// containing it.
+func IsTrusted(dir string) (bool, error) {
+	dir, err := canonicalDir(dir)
+	if err != nil {
+		return false, err
+	}
+	trusted, err := loadTrusted()
+	if err != nil {
+		return false, err
+	}
+	for _, t := range trusted.Directories {
+		if dir == t || strings.HasPrefix(dir, t+string(filepath.Separator)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Trust records dir as trusted, so later sessions in it or below it start
+// with every tool enabled.
+func Trust(dir string) error {
+	dir, err := canonicalDir(dir)
+	if err != nil {
+		return err
+	}
+	trusted, err := loadTrusted()
+	if err != nil {
+		return err
+	}
+	for _, t := range trusted.Directories {
+		if t == dir {
+			return nil
+		}
+	}
+	trusted.Directories = append(trusted.Directories, dir)
+
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err := trustFile()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package console makes the colored output of the agent readable on every
+// terminal. Windows consoles only understand ANSI escape codes once virtual
+// terminal processing is turned on, and older ones not at all; there the
+// colors are removed instead of being printed as garbage.
+package console
+
+import (
+	"io"
+	"os"
+	"regexp"
+
+	"code-editing-agent/internal/shell"
+)
+
+var (
+	// escapePattern matches color and other escape codes that a console
+	// without virtual terminal processing prints as text.
+	escapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	// partialEscapePattern matches the start of an escape code at the end
+	// of what has been read so far.
+	partialEscapePattern = regexp.MustCompile(`\x1b(\[[0-9;?]*)?$`)
+)
+
+// Colors reports whether escape codes reach the terminal as colors. It is
+// false after Setup on a console that cannot show them, which also rules
+// out the full-screen interface.
+var Colors = true
+
+// Setup prepares stdout and stderr for colored output. Where the console
+// cannot show colors, they are taken over and what is printed there is
+// passed on with the colors removed. The returned function gives them back
+// once everything printed has been passed on.
+func Setup() func() {
+	stdoutOK := enableColors(os.Stdout)
+	stderrOK := enableColors(os.Stderr)
+	if stdoutOK && stderrOK {
+		return func() {}
+	}
+	Colors = false
+
+	var restores []func()
+	if !stdoutOK {
+		if w, restore, err := strip(os.Stdout); err == nil {
+			os.Stdout, shell.Output = w, w
+			restores = append(restores, restore)
+		}
+	}
+	if !stderrOK {
+		if w, restore, err := strip(os.Stderr); err == nil {
+			os.Stderr = w
+			restores = append(restores, restore)
+		}
+	}
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// strip returns a pipe whose contents are written to out without colors,
+// and a function that closes it and puts out back in its place.
+func strip(out *os.File) (*os.File, func(), error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		forward(out, r)
+	}()
+	restore := func() {
+		if os.Stdout == w {
+			os.Stdout, shell.Output = out, out
+		}
+		if os.Stderr == w {
+			os.Stderr = out
+		}
+		w.Close()
+		<-done
+	}
+	return w, restore, nil
+}
+
+// forward copies r to out with the escape codes removed, as soon as it is
+// read, except for an escape code cut in two, which waits for its end.
+func forward(out io.Writer, r io.Reader) {
+	var pending []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		pending = append(pending, buf[:n]...)
+		keep := 0
+		if loc := partialEscapePattern.FindIndex(pending); loc != nil && err == nil {
+			keep = len(pending) - loc[0]
+		}
+		out.Write(escapePattern.ReplaceAll(pending[:len(pending)-keep], nil))
+		pending = append(pending[:0], pending[len(pending)-keep:]...)
+		if err != nil {
+			return
+		}
+	}
+}
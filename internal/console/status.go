@@ -0,0 +1,211 @@
+package console
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"code-editing-agent/internal/shell"
+)
+
+const (
+	// statusDelay is how long something runs before the status shows it,
+	// so quick steps do not make it flicker.
+	statusDelay = 300 * time.Millisecond
+	// statusTick is how often the spinner turns.
+	statusTick = 100 * time.Millisecond
+)
+
+// spinnerFrames are the spinner's frames, drawn in turn.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Status shows a spinner with what the agent is busy with and for how long,
+// such as "⠹ Running execute_shell (12s)", on the line after the output.
+// It takes over stdout, like the full-screen interface does, to take the
+// status down before anything else is printed and put it back once the
+// output has ended a line; while the output stops mid-line, such as at a
+// question, the status is not shown.
+type Status struct {
+	mu  sync.Mutex
+	out *os.File
+	// tasks are what is being waited on, in the order they started.
+	tasks []*task
+	// drawn is set while the status is on the screen, and lineStart while
+	// the output so far ends a line.
+	drawn     bool
+	lineStart bool
+	frame     int
+
+	// pipe takes stdout's place while the status is started, and forwarded
+	// is closed once what was written to it has been passed on. stopTick
+	// stops the spinner, and ticked is closed once it has stopped.
+	pipe      *os.File
+	forwarded chan struct{}
+	stopTick  chan struct{}
+	ticked    chan struct{}
+}
+
+type task struct {
+	label string
+	start time.Time
+}
+
+// NewStatus returns a Status for the terminal stdout is.
+func NewStatus() *Status {
+	return &Status{out: os.Stdout, lineStart: true}
+}
+
+// Start takes over stdout and starts the spinner.
+func (s *Status) Start() error {
+	if s.pipe != nil {
+		return nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture output: %w", err)
+	}
+	s.pipe = w
+	s.forwarded = make(chan struct{})
+	s.stopTick = make(chan struct{})
+	s.ticked = make(chan struct{})
+	os.Stdout, shell.Output = w, w
+	go s.forward(r)
+	go s.tick(s.stopTick, s.ticked)
+	return nil
+}
+
+// Stop takes the status down and gives stdout back, once what was printed
+// has been passed on. It is called before handing the terminal to another
+// program, such as an editor, and at exit.
+func (s *Status) Stop() {
+	if s.pipe == nil {
+		return
+	}
+	close(s.stopTick)
+	<-s.ticked
+	os.Stdout, shell.Output = s.out, s.out
+	s.pipe.Close()
+	<-s.forwarded
+	s.pipe = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.erase()
+}
+
+// Show shows label, such as "Running run_tests", until the returned function
+// is called. When several things are waited on at once, the one that started
+// first is shown with a count of the others.
+func (s *Status) Show(label string) func() {
+	t := &task{label: label, start: time.Now()}
+	s.mu.Lock()
+	s.tasks = append(s.tasks, t)
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for i, other := range s.tasks {
+				if other == t {
+					s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+					break
+				}
+			}
+			if len(s.tasks) == 0 {
+				s.erase()
+			}
+		})
+	}
+}
+
+// forward passes on what is printed, taking the status down first.
+func (s *Status) forward(r io.Reader) {
+	defer close(s.forwarded)
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.erase()
+			s.out.Write(buf[:n])
+			s.lineStart = buf[n-1] == '\n'
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Status) tick(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(statusTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.draw()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// draw puts the status on the screen, over the previous frame. It is called
+// with mu held.
+func (s *Status) draw() {
+	if len(s.tasks) == 0 || !s.lineStart {
+		return
+	}
+	first := s.tasks[0]
+	elapsed := time.Since(first.start)
+	if elapsed < statusDelay {
+		return
+	}
+	label := first.label
+	if len(s.tasks) > 1 {
+		label += fmt.Sprintf(" and %d more", len(s.tasks)-1)
+	}
+	line := fmt.Sprintf("%s %s (%s)", spinnerFrames[s.frame%len(spinnerFrames)], label, Elapsed(elapsed))
+	// A status wider than the terminal would wrap, and only its last line
+	// be taken down.
+	if width, _, err := term.GetSize(int(s.out.Fd())); err == nil && width > 1 {
+		if runes := []rune(line); len(runes) > width-1 {
+			line = string(runes[:width-1])
+		}
+	}
+	s.frame++
+	fmt.Fprintf(s.out, "\r\u001b[K\u001b[90m%s\u001b[0m", line)
+	s.drawn = true
+}
+
+// erase takes the status down. It is called with mu held.
+func (s *Status) erase() {
+	if s.drawn {
+		fmt.Fprint(s.out, "\r\u001b[K")
+		s.drawn = false
+	}
+}
+
+// Elapsed formats how long something has been running, such as "12s" or
+// "3m05s".
+func Elapsed(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	minutes := int(d.Minutes())
+	seconds := int(d.Seconds()) % 60
+	if minutes < 60 {
+		return fmt.Sprintf("%dm%02ds", minutes, seconds)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
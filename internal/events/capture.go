@@ -0,0 +1,137 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"code-editing-agent/internal/shell"
+)
+
+// ansiPattern matches color escape codes.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// StripColors removes the color escape codes and surrounding space from a
+// line printed for the terminal.
+func StripColors(text string) string {
+	return strings.TrimSpace(ansiPattern.ReplaceAllString(text, ""))
+}
+
+// syncMarker is written to the captured output to learn when everything
+// printed before it has been passed on.
+const syncMarker = "\x1b]events-sync\x07"
+
+// Capture takes over stdout and the output of shell commands, passing what
+// is printed there on a line at a time with the colors removed.
+type Capture struct {
+	out    *os.File
+	pipe   *os.File
+	output func(text string)
+	// syncMu lets one sync marker through the pipe at a time.
+	syncMu sync.Mutex
+	synced chan struct{}
+	done   chan struct{}
+}
+
+// StartCapture redirects stdout, calling output with every line printed
+// there until Close.
+func StartCapture(output func(text string)) (*Capture, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture output: %w", err)
+	}
+	c := &Capture{
+		out:    os.Stdout,
+		pipe:   w,
+		output: output,
+		synced: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	os.Stdout = w
+	shell.Output = w
+	go c.forward(r)
+	return c, nil
+}
+
+// Stdout is stdout as it was before the capture.
+func (c *Capture) Stdout() *os.File {
+	return c.out
+}
+
+// Close gives stdout back, once the output printed so far has been passed
+// on.
+func (c *Capture) Close() {
+	c.Sync()
+	os.Stdout = c.out
+	shell.Output = c.out
+	c.pipe.Close()
+	<-c.done
+}
+
+// Sync waits until everything printed so far has been passed on, so that
+// what follows keeps the order things happened in.
+func (c *Capture) Sync() {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	if _, err := io.WriteString(c.pipe, syncMarker); err != nil {
+		return
+	}
+	select {
+	case <-c.synced:
+	case <-c.done:
+	}
+}
+
+// forward passes on captured output a line at a time and acknowledges sync
+// markers.
+func (c *Capture) forward(r io.Reader) {
+	defer close(c.done)
+	var pending []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		pending = append(pending, buf[:n]...)
+		for {
+			i := bytes.Index(pending, []byte(syncMarker))
+			if i < 0 {
+				break
+			}
+			c.pass(pending[:i], true)
+			pending = pending[i+len(syncMarker):]
+			c.synced <- struct{}{}
+		}
+		// Text after the last newline, which may be the start of a marker,
+		// waits for the rest.
+		if i := bytes.LastIndexByte(pending, '\n'); i >= 0 {
+			c.pass(pending[:i+1], false)
+			pending = pending[i+1:]
+		}
+		if err != nil {
+			c.pass(pending, true)
+			return
+		}
+	}
+}
+
+// pass passes on complete lines of text, or all of it when flush is set.
+func (c *Capture) pass(text []byte, flush bool) {
+	if len(text) == 0 {
+		return
+	}
+	clean := ansiPattern.ReplaceAllString(string(text), "")
+	if !flush && !strings.HasSuffix(clean, "\n") {
+		return
+	}
+	if strings.TrimSpace(clean) != "" {
+		c.output(clean)
+	}
+}
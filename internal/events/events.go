@@ -0,0 +1,168 @@
+// Package events runs the session as a stream of newline-delimited JSON
+// events on stdout instead of colored text, so that editors and other
+// programs can embed the agent. The user's messages and answers are read
+// from stdin, a line each.
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// Event types.
+const (
+	// TypeUserMessage is a message sent to the model, as typed or with the
+	// notes the agent adds.
+	TypeUserMessage = "user_message"
+	// TypeAssistantDelta is the next piece of the model's streamed reply,
+	// and TypeAssistantDone marks the end of a reply.
+	TypeAssistantDelta = "assistant_delta"
+	TypeAssistantDone  = "assistant_done"
+	TypeToolCall       = "tool_call"
+	TypeToolResult     = "tool_result"
+	// TypeUsage follows every turn with the tokens and cost of the turn and
+	// of the session.
+	TypeUsage = "usage"
+	// TypePrompt asks a question, such as whether a tool may run; the next
+	// line of input is the answer.
+	TypePrompt = "prompt"
+	// TypeOutput is anything else the agent prints for people, such as
+	// diffs and status lines, with the colors removed.
+	TypeOutput = "output"
+	// TypeReport is the report of a run with -p.
+	TypeReport = "report"
+)
+
+// Event is one line of the stream. Only the fields of its type are set.
+type Event struct {
+	Type    string          `json:"type"`
+	Text    string          `json:"text,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Input   json.RawMessage `json:"input,omitempty"`
+	Success *bool           `json:"success,omitempty"`
+	Output  string          `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Turn    *llm.UsageTotal `json:"turn,omitempty"`
+	Session *llm.UsageTotal `json:"session,omitempty"`
+	Report  interface{}     `json:"report,omitempty"`
+}
+
+// Stream writes events to stdout and reads input from stdin. It shows the
+// conversation as an agent.Display with the methods of Emitter.
+type Stream struct {
+	Emitter
+
+	mu      sync.Mutex
+	enc     *json.Encoder
+	capture *Capture
+	input   *bufio.Scanner
+}
+
+// Start takes over stdout: from now on only events are written to it, and
+// what the agent and its tools print there is sent as output events.
+func Start() (*Stream, error) {
+	s := &Stream{
+		enc:   json.NewEncoder(os.Stdout),
+		input: bufio.NewScanner(os.Stdin),
+	}
+	s.Emitter = s.Emit
+	s.enc.SetEscapeHTML(false)
+	s.input.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	capture, err := StartCapture(func(text string) {
+		s.emit(Event{Type: TypeOutput, Text: text})
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.capture = capture
+	return s, nil
+}
+
+// Close gives stdout back, once the output printed so far has been sent.
+func (s *Stream) Close() {
+	s.capture.Close()
+}
+
+// Emit writes an event, after the output printed before it.
+func (s *Stream) Emit(event Event) {
+	s.capture.Sync()
+	s.emit(event)
+}
+
+func (s *Stream) emit(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(event)
+}
+
+// NextMessage reads the user's next message: a line of input, or a JSON
+// object with the message as its "text", which may span lines. It reports
+// false at the end of input.
+func (s *Stream) NextMessage() (string, bool) {
+	return s.readLine()
+}
+
+// ReadLine asks a question with a prompt event and returns the next line of
+// input as the answer.
+func (s *Stream) ReadLine(prompt string) (string, bool) {
+	s.Emit(Event{Type: TypePrompt, Text: StripColors(prompt)})
+	return s.readLine()
+}
+
+func (s *Stream) readLine() (string, bool) {
+	if !s.input.Scan() {
+		return "", false
+	}
+	line := s.input.Text()
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		var message struct {
+			Text string `json:"text"`
+		}
+		if json.Unmarshal([]byte(line), &message) == nil {
+			return message.Text, true
+		}
+	}
+	return line, true
+}
+
+// Emitter shows the conversation as an agent.Display by passing events to
+// the function.
+type Emitter func(Event)
+
+func (emit Emitter) UserMessage(text string) {
+	emit(Event{Type: TypeUserMessage, Text: text})
+}
+
+func (emit Emitter) AssistantText(text string) {
+	emit(Event{Type: TypeAssistantDelta, Text: text})
+}
+
+func (emit Emitter) AssistantDone() {
+	emit(Event{Type: TypeAssistantDone})
+}
+
+func (emit Emitter) ToolCall(id, name, input string) {
+	event := Event{Type: TypeToolCall, ID: id, Name: name}
+	if json.Valid([]byte(input)) {
+		event.Input = json.RawMessage(input)
+	} else {
+		event.Text = input
+	}
+	emit(event)
+}
+
+func (emit Emitter) ToolResult(id, name string, result tools.ToolResult) {
+	success := result.Success
+	emit(Event{Type: TypeToolResult, ID: id, Name: name, Success: &success, Output: result.Output, Error: result.Error})
+}
+
+func (emit Emitter) Usage(turn, session llm.UsageTotal) {
+	emit(Event{Type: TypeUsage, Turn: &turn, Session: &session})
+}
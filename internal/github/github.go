@@ -0,0 +1,322 @@
+// Package github fetches issues and their comments from the GitHub API, so
+// the agent can start from what was reported instead of a retelling of it.
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	requestTimeout = 15 * time.Second
+	// maxComments is how many comments are fetched, the first ones.
+	maxComments = 100
+	// maxBodyLength cuts off the issue's text, and maxCommentLength each
+	// comment's, so a pasted log does not fill the context.
+	maxBodyLength    = 20000
+	maxCommentLength = 4000
+)
+
+// Issue is an issue or pull request with its comments.
+type Issue struct {
+	Repo     string
+	Number   int
+	Title    string
+	State    string
+	Author   string
+	URL      string
+	Labels   []string
+	Body     string
+	Created  time.Time
+	Comments []Comment
+	// TotalComments counts the comments on the issue, including those past
+	// maxComments that were not fetched.
+	TotalComments int
+	PullRequest   bool
+}
+
+// Comment is a comment on an issue.
+type Comment struct {
+	Author  string
+	Created time.Time
+	Body    string
+}
+
+// Ref names an issue: its repository and number.
+type Ref struct {
+	Owner  string
+	Repo   string
+	Number int
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
+
+var (
+	issueURL = regexp.MustCompile(`^https?://[^/]+/([\w.-]+)/([\w.-]+)/(?:issues|pull)/(\d+)(?:[/?#].*)?$`)
+	issueRef = regexp.MustCompile(`^(?:([\w.-]+)/([\w.-]+)#|#)?(\d+)$`)
+)
+
+// ParseRef parses an issue's URL, such as
+// https://github.com/owner/repo/issues/42, or a reference such as
+// owner/repo#42, #42 or 42. A reference without a repository is to the
+// workspace's, taken from its origin remote.
+func ParseRef(ctx context.Context, s string) (Ref, error) {
+	s = strings.TrimSpace(s)
+	var owner, repo, number string
+	if m := issueURL.FindStringSubmatch(s); m != nil {
+		owner, repo, number = m[1], m[2], m[3]
+	} else if m := issueRef.FindStringSubmatch(s); m != nil {
+		owner, repo, number = m[1], m[2], m[3]
+	} else {
+		return Ref{}, fmt.Errorf("invalid issue %q (expected a URL such as https://github.com/owner/repo/issues/42, owner/repo#42 or #42)", s)
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return Ref{}, fmt.Errorf("invalid issue number %q", number)
+	}
+	if owner == "" {
+		owner, repo, err = WorkspaceRepo(ctx)
+		if err != nil {
+			return Ref{}, err
+		}
+	}
+	return Ref{Owner: owner, Repo: strings.TrimSuffix(repo, ".git"), Number: n}, nil
+}
+
+// remoteRepo matches the owner and name of a repository in a remote's URL,
+// such as git@github.com:owner/repo.git or https://github.com/owner/repo.
+var remoteRepo = regexp.MustCompile(`[:/]([\w.-]+)/([\w.-]+?)(?:\.git)?/?$`)
+
+// WorkspaceRepo returns the owner and name of the repository the workspace's
+// origin remote points to.
+func WorkspaceRepo(ctx context.Context) (string, string, error) {
+	out, err := exec.CommandContext(ctx, "git", "remote", "get-url", "origin").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("the workspace has no origin remote to take the repository from; name it, as in owner/repo#42")
+	}
+	remote := strings.TrimSpace(string(out))
+	m := remoteRepo.FindStringSubmatch(remote)
+	if m == nil {
+		return "", "", fmt.Errorf("cannot tell the repository from the origin remote %s; name it, as in owner/repo#42", remote)
+	}
+	return m[1], m[2], nil
+}
+
+// Client reads from the GitHub API.
+type Client struct {
+	// BaseURL is the API's, https://api.github.com unless GITHUB_API_URL
+	// names a GitHub Enterprise server's.
+	BaseURL string
+	// Token authenticates the requests, which private repositories need
+	// and which raises the rate limit. It is GITHUB_TOKEN, or GH_TOKEN.
+	Token  string
+	client *http.Client
+}
+
+// NewClient returns a Client configured from the environment.
+func NewClient() *Client {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+type apiUser struct {
+	Login string `json:"login"`
+}
+
+type apiIssue struct {
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	State     string    `json:"state"`
+	User      apiUser   `json:"user"`
+	HTMLURL   string    `json:"html_url"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	Comments  int       `json:"comments"`
+	Labels    []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+type apiComment struct {
+	User      apiUser   `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Issue fetches the issue ref names with its first comments.
+func (c *Client) Issue(ctx context.Context, ref Ref) (*Issue, error) {
+	path := fmt.Sprintf("%s/issues/%d", repoPath(ref.Owner, ref.Repo), ref.Number)
+	var raw apiIssue
+	if err := c.get(ctx, path, &raw); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	issue := &Issue{
+		Repo:          ref.Owner + "/" + ref.Repo,
+		Number:        raw.Number,
+		Title:         raw.Title,
+		State:         raw.State,
+		Author:        raw.User.Login,
+		URL:           raw.HTMLURL,
+		Body:          truncate(raw.Body, maxBodyLength),
+		Created:       raw.CreatedAt,
+		TotalComments: raw.Comments,
+		PullRequest:   raw.PullRequest != nil,
+	}
+	for _, label := range raw.Labels {
+		issue.Labels = append(issue.Labels, label.Name)
+	}
+	if raw.Comments > 0 {
+		var comments []apiComment
+		if err := c.get(ctx, fmt.Sprintf("%s/comments?per_page=%d", path, maxComments), &comments); err != nil {
+			return nil, fmt.Errorf("failed to fetch the comments on %s: %w", ref, err)
+		}
+		for _, comment := range comments {
+			issue.Comments = append(issue.Comments, Comment{
+				Author:  comment.User.Login,
+				Created: comment.CreatedAt,
+				Body:    truncate(comment.Body, maxCommentLength),
+			})
+		}
+	}
+	return issue, nil
+}
+
+// get decodes the response to a GET request for path into v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, v)
+}
+
+// do sends a request for path with body, when not nil, as JSON, and
+// decodes the response into v.
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "code-editing-agent")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read GitHub response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+			// Errors explain a request GitHub refused as invalid.
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			message = apiErr.Message
+			for _, e := range apiErr.Errors {
+				if e.Message != "" {
+					message += ": " + e.Message
+				}
+			}
+		}
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+		// GitHub answers 404 for private repositories it was not shown a
+		// token for.
+		if (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) && c.Token == "" {
+			message += " (set GITHUB_TOKEN for private repositories and a higher rate limit)"
+		}
+		return fmt.Errorf("GitHub returned HTTP %d: %s", resp.StatusCode, message)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode GitHub response: %w", err)
+	}
+	return nil
+}
+
+// Markdown shows the issue as the model is given it: a header with its
+// state, author and labels, its text and its comments in order.
+func (i *Issue) Markdown() string {
+	var sb strings.Builder
+	kind := "Issue"
+	if i.PullRequest {
+		kind = "Pull request"
+	}
+	fmt.Fprintf(&sb, "# %s %s#%d: %s\n\n", kind, i.Repo, i.Number, i.Title)
+	fmt.Fprintf(&sb, "State: %s · opened by @%s on %s", i.State, i.Author, i.Created.Format("2006-01-02"))
+	if len(i.Labels) > 0 {
+		fmt.Fprintf(&sb, " · labels: %s", strings.Join(i.Labels, ", "))
+	}
+	fmt.Fprintf(&sb, "\n%s\n\n", i.URL)
+	body := strings.TrimSpace(i.Body)
+	if body == "" {
+		body = "(no description)"
+	}
+	sb.WriteString(body + "\n")
+	for _, comment := range i.Comments {
+		fmt.Fprintf(&sb, "\n## @%s on %s\n\n%s\n", comment.Author, comment.Created.Format("2006-01-02"), strings.TrimSpace(comment.Body))
+	}
+	if i.TotalComments > len(i.Comments) {
+		fmt.Fprintf(&sb, "\n(%d later comments not shown; see %s)\n", i.TotalComments-len(i.Comments), i.URL)
+	}
+	return sb.String()
+}
+
+// truncate cuts s off after max bytes, at a line break when there is one
+// near, and says so.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := s[:max]
+	if i := strings.LastIndex(cut, "\n"); i > max/2 {
+		cut = cut[:i]
+	}
+	for !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	return cut + fmt.Sprintf("\n\n[... %d more bytes cut off]", len(s)-len(cut))
+}
@@ -0,0 +1,63 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// PullRequest is an open pull request.
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"html_url"`
+	Title  string `json:"title"`
+	Draft  bool   `json:"draft"`
+}
+
+// NewPullRequest is a pull request to open, from the branch Head into Base.
+type NewPullRequest struct {
+	Title string `json:"title"`
+	Head  string `json:"head"`
+	Base  string `json:"base"`
+	Body  string `json:"body"`
+	Draft bool   `json:"draft"`
+}
+
+// DefaultBranch returns the name of the repository's default branch.
+func (c *Client) DefaultBranch(ctx context.Context, owner, repo string) (string, error) {
+	var out struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := c.get(ctx, repoPath(owner, repo), &out); err != nil {
+		return "", fmt.Errorf("failed to look up the default branch of %s/%s: %w", owner, repo, err)
+	}
+	return out.DefaultBranch, nil
+}
+
+// OpenPullRequest returns the open pull request from the repository's
+// branch head, or nil when there is none.
+func (c *Client) OpenPullRequest(ctx context.Context, owner, repo, head string) (*PullRequest, error) {
+	params := url.Values{"head": {owner + ":" + head}, "state": {"open"}}
+	var pulls []PullRequest
+	if err := c.get(ctx, repoPath(owner, repo)+"/pulls?"+params.Encode(), &pulls); err != nil {
+		return nil, fmt.Errorf("failed to look for a pull request from %s: %w", head, err)
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return &pulls[0], nil
+}
+
+// CreatePullRequest opens pr in the repository.
+func (c *Client) CreatePullRequest(ctx context.Context, owner, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var out PullRequest
+	if err := c.do(ctx, http.MethodPost, repoPath(owner, repo)+"/pulls", pr, &out); err != nil {
+		return nil, fmt.Errorf("failed to open the pull request: %w", err)
+	}
+	return &out, nil
+}
+
+func repoPath(owner, repo string) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(repo))
+}
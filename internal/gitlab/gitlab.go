@@ -0,0 +1,157 @@
+// Package gitlab opens merge requests through the GitLab API, on gitlab.com
+// or a self-managed server.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 15 * time.Second
+
+// Client talks to the API of one GitLab server.
+type Client struct {
+	// BaseURL is the API's, such as https://gitlab.com/api/v4.
+	BaseURL string
+	// Token is a personal, project or group access token with the api
+	// scope.
+	Token  string
+	client *http.Client
+}
+
+// NewClient returns a Client for the GitLab server at host, authenticated
+// with token or, when it is empty, GITLAB_TOKEN.
+func NewClient(host, token string) *Client {
+	if token == "" {
+		token = os.Getenv("GITLAB_TOKEN")
+	}
+	return &Client{
+		BaseURL: "https://" + host + "/api/v4",
+		Token:   token,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// MergeRequest is an open merge request.
+type MergeRequest struct {
+	IID   int    `json:"iid"`
+	URL   string `json:"web_url"`
+	Title string `json:"title"`
+	Draft bool   `json:"draft"`
+}
+
+// NewMergeRequest is a merge request to open, from the branch
+// SourceBranch into TargetBranch.
+type NewMergeRequest struct {
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+}
+
+// DefaultBranch returns the name of the default branch of the project at
+// path, such as group/subgroup/project.
+func (c *Client) DefaultBranch(ctx context.Context, project string) (string, error) {
+	var out struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := c.do(ctx, http.MethodGet, projectPath(project), nil, &out); err != nil {
+		return "", fmt.Errorf("failed to look up the default branch of %s: %w", project, err)
+	}
+	return out.DefaultBranch, nil
+}
+
+// OpenMergeRequest returns the open merge request from the project's branch
+// source, or nil when there is none.
+func (c *Client) OpenMergeRequest(ctx context.Context, project, source string) (*MergeRequest, error) {
+	params := url.Values{"source_branch": {source}, "state": {"opened"}}
+	var requests []MergeRequest
+	if err := c.do(ctx, http.MethodGet, projectPath(project)+"/merge_requests?"+params.Encode(), nil, &requests); err != nil {
+		return nil, fmt.Errorf("failed to look for a merge request from %s: %w", source, err)
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	return &requests[0], nil
+}
+
+// CreateMergeRequest opens mr in the project. A title starting with
+// "Draft:" opens it as a draft.
+func (c *Client) CreateMergeRequest(ctx context.Context, project string, mr NewMergeRequest) (*MergeRequest, error) {
+	var out MergeRequest
+	if err := c.do(ctx, http.MethodPost, projectPath(project)+"/merge_requests", mr, &out); err != nil {
+		return nil, fmt.Errorf("failed to open the merge request: %w", err)
+	}
+	return &out, nil
+}
+
+// projectPath is the API path of a project, which GitLab takes by its
+// URL-encoded full path.
+func projectPath(project string) string {
+	return "/projects/" + url.PathEscape(project)
+}
+
+// do sends a request for path with body, when not nil, as JSON, and
+// decodes the response into v.
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) error {
+	if c.Token == "" {
+		return fmt.Errorf("no GitLab token: set GITLAB_TOKEN or pull_requests.gitlab_token in the config")
+	}
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.Token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach GitLab: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read GitLab response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// GitLab explains errors in message, as a string, a list or a map
+		// of fields to their problems, or in error.
+		var apiErr struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil {
+			if apiErr.Message != nil {
+				message = fmt.Sprint(apiErr.Message)
+			} else if apiErr.Error != "" {
+				message = apiErr.Error
+			}
+		}
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+		return fmt.Errorf("GitLab returned HTTP %d: %s", resp.StatusCode, message)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode GitLab response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package hooks runs the shell commands configured to run on the agent's
+// events: before and after tool calls, and when a session starts and ends.
+// A hook gets the event as a JSON object on stdin; a hook run before a tool
+// call can stop the call by exiting with a non-zero status.
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+// Events hooks run on.
+const (
+	// PreTool runs before a tool is called, once the call is known but
+	// before the user is asked to approve it. A hook that fails stops the
+	// call, and the model is told why.
+	PreTool = "pre_tool"
+	// PostTool runs after a tool has been called, with its result.
+	PostTool = "post_tool"
+	// SessionStart and SessionEnd run when a session, interactive or with
+	// -p, starts and ends.
+	SessionStart = "session_start"
+	SessionEnd   = "session_end"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// maxMessage bounds how much of a failed hook's output is reported.
+	maxMessage = 2000
+)
+
+// ValidEvent reports whether hooks can run on event.
+func ValidEvent(event string) bool {
+	switch event {
+	case PreTool, PostTool, SessionStart, SessionEnd:
+		return true
+	}
+	return false
+}
+
+// Hook is a command run on an event.
+type Hook struct {
+	Event string
+	// Tools limits a tool hook to the tools whose names match one of these
+	// patterns, such as "edit_file" or "git_*"; by default it runs for
+	// every tool.
+	Tools []string
+	// Command is run by the shell, sh or cmd on Windows, in the workspace.
+	Command string
+	// Timeout defaults to 30 seconds. A hook still running then is killed
+	// and counts as failed.
+	Timeout time.Duration
+}
+
+// Payload is the event a hook gets on stdin. Only the fields of its event
+// are set.
+type Payload struct {
+	Event     string          `json:"event"`
+	Workspace string          `json:"workspace,omitempty"`
+	Tool      string          `json:"tool,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	// Success, Output and Error are the result of a PostTool event.
+	Success *bool  `json:"success,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Error is a hook that failed: it exited with a non-zero status, timed out
+// or could not be run.
+type Error struct {
+	Command string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("hook %q failed: %s", e.Command, e.Message)
+}
+
+// Runner runs the hooks of a session.
+type Runner struct {
+	hooks     []Hook
+	workspace string
+}
+
+// New returns a Runner of hooks, run in the workspace directory. It fails
+// when a hook has no command or an unknown event.
+func New(workspace string, hooks []Hook) (*Runner, error) {
+	for _, hook := range hooks {
+		if !ValidEvent(hook.Event) {
+			return nil, fmt.Errorf("hook %q has unknown event %q (expected pre_tool, post_tool, session_start or session_end)", hook.Command, hook.Event)
+		}
+		if strings.TrimSpace(hook.Command) == "" {
+			return nil, fmt.Errorf("%s hook has no command", hook.Event)
+		}
+		for _, pattern := range hook.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("hook %q has invalid tool pattern %q", hook.Command, pattern)
+			}
+		}
+	}
+	return &Runner{hooks: hooks, workspace: workspace}, nil
+}
+
+// Run runs the hooks of payload's event, in the order they were configured,
+// and returns an *Error for the first one that fails. The hooks after it
+// are not run.
+func (r *Runner) Run(ctx context.Context, payload Payload) error {
+	if r == nil {
+		return nil
+	}
+	payload.Workspace = r.workspace
+	if len(payload.Input) > 0 && !json.Valid(payload.Input) {
+		// The model sent arguments that are not JSON; the tool reports it.
+		payload.Input = nil
+	}
+	var stdin []byte
+	for _, hook := range r.hooks {
+		if hook.Event != payload.Event || !hook.matches(payload.Tool) {
+			continue
+		}
+		if stdin == nil {
+			var err error
+			stdin, err = json.Marshal(payload)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s event: %w", payload.Event, err)
+			}
+		}
+		if err := r.run(ctx, hook, stdin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) run(ctx context.Context, hook Hook, stdin []byte) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name, args := "sh", []string{"-c", hook.Command}
+	if runtime.GOOS == "windows" {
+		name, args = "cmd", []string{"/C", hook.Command}
+	}
+	result, err := shell.RunInput(ctx, r.workspace, stdin, name, args...)
+	switch {
+	case err != nil:
+		return &Error{Command: hook.Command, Message: err.Error()}
+	case result.TimedOut:
+		return &Error{Command: hook.Command, Message: fmt.Sprintf("did not finish within %s", timeout)}
+	case result.ExitCode != 0:
+		message := strings.TrimSpace(result.Stderr)
+		if message == "" {
+			message = strings.TrimSpace(result.Stdout)
+		}
+		if len(message) > maxMessage {
+			message = message[len(message)-maxMessage:]
+		}
+		if message == "" {
+			message = fmt.Sprintf("exit status %d", result.ExitCode)
+		}
+		return &Error{Command: hook.Command, Message: message}
+	}
+	return nil
+}
+
+// matches reports whether the hook runs for tool, which is empty for
+// session events.
+func (h Hook) matches(tool string) bool {
+	if len(h.Tools) == 0 || tool == "" {
+		return true
+	}
+	for _, pattern := range h.Tools {
+		if ok, _ := path.Match(pattern, tool); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// Package images loads the pictures the user attaches to a message, such
+// as a mockup to implement or a screenshot of what went wrong, from files
+// or the clipboard.
+package images
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/llm"
+)
+
+// MaxSize is the largest image accepted, the most the model APIs take.
+const MaxSize = 5 << 20
+
+// clipboardTimeout bounds how long reading the clipboard may take.
+const clipboardTimeout = 10 * time.Second
+
+// extensions are those of the image formats the models read.
+var extensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true}
+
+// IsImage reports whether path is named like an image the models read.
+func IsImage(path string) bool {
+	return extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Load reads the image file at path.
+func Load(path string) (llm.Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return llm.Image{}, err
+	}
+	if info.Size() > MaxSize {
+		return llm.Image{}, fmt.Errorf("%s is %d KB; images may be at most %d KB", path, info.Size()>>10, MaxSize>>10)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return llm.Image{}, err
+	}
+	image, ok := decode(data)
+	if !ok {
+		return llm.Image{}, fmt.Errorf("%s is not a PNG, JPEG, GIF or WebP image", path)
+	}
+	return image, nil
+}
+
+// FromClipboard reads an image copied to the clipboard, with osascript on
+// macOS, wl-paste or xclip on Linux and PowerShell on Windows.
+func FromClipboard() (llm.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+	defer cancel()
+
+	var data []byte
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		data, err = clipboardMac(ctx)
+	case "windows":
+		data, err = clipboardWindows(ctx)
+	default:
+		data, err = clipboardUnix(ctx)
+	}
+	if err != nil {
+		return llm.Image{}, err
+	}
+	if len(data) == 0 {
+		return llm.Image{}, errors.New("the clipboard holds no image")
+	}
+	if len(data) > MaxSize {
+		return llm.Image{}, fmt.Errorf("the image in the clipboard is %d KB; images may be at most %d KB", len(data)>>10, MaxSize>>10)
+	}
+	image, ok := decode(data)
+	if !ok {
+		return llm.Image{}, errors.New("the clipboard holds no PNG, JPEG, GIF or WebP image")
+	}
+	return image, nil
+}
+
+// decode recognizes the format of an image from its first bytes.
+func decode(data []byte) (llm.Image, bool) {
+	switch mediaType := http.DetectContentType(data); mediaType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return llm.Image{MediaType: mediaType, Data: data}, true
+	}
+	return llm.Image{}, false
+}
+
+// clipboardMac asks AppleScript for the clipboard as PNG, which it prints
+// as «data PNGf89504E47...».
+func clipboardMac(ctx context.Context) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "osascript", "-e", "the clipboard as «class PNGf»").Output()
+	if err != nil {
+		return nil, errors.New("the clipboard holds no image")
+	}
+	text := strings.TrimSpace(string(out))
+	text = strings.TrimPrefix(text, "«data PNGf")
+	text = strings.TrimSuffix(text, "»")
+	return hex.DecodeString(text)
+}
+
+// clipboardUnix reads the clipboard with wl-paste under Wayland and xclip
+// under X11.
+func clipboardUnix(ctx context.Context) ([]byte, error) {
+	name, args := "xclip", []string{"-selection", "clipboard", "-t", "image/png", "-o"}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		name, args = "wl-paste", []string{"--no-newline", "--type", "image/png"}
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("reading images from the clipboard needs %s; give the image's path instead", name)
+	}
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, errors.New("the clipboard holds no image")
+	}
+	return out, nil
+}
+
+// clipboardWindows has PowerShell save the clipboard's image as PNG and
+// print it in base64.
+func clipboardWindows(ctx context.Context) ([]byte, error) {
+	script := `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$image = [System.Windows.Forms.Clipboard]::GetImage()
+if ($image -ne $null) {
+	$stream = New-Object System.IO.MemoryStream
+	$image.Save($stream, [System.Drawing.Imaging.ImageFormat]::Png)
+	[Convert]::ToBase64String($stream.ToArray())
+}`
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-STA", "-Command", script).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the clipboard: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,361 @@
+// Package index keeps an embeddings index of the workspace's source files
+// for searching them by meaning rather than by exact text.
+package index
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code-editing-agent/internal/llm"
+)
+
+// DefaultDir is where the index is kept, relative to the workspace.
+const DefaultDir = ".agent/index"
+
+const (
+	// chunkLines is how many lines make up a chunk, and chunkOverlap how
+	// many of them are shared with the previous chunk so that code around
+	// a boundary is found either way.
+	chunkLines   = 60
+	chunkOverlap = 10
+	// maxChunkBytes bounds the text embedded per chunk, well within the
+	// input limit of embedding models.
+	maxChunkBytes = 6000
+	// maxFileSize skips files too large to be source code.
+	maxFileSize = 1 << 20
+	// batchSize is how many chunks are embedded per request.
+	batchSize = 64
+)
+
+// Chunk is an embedded range of lines of a file.
+type Chunk struct {
+	StartLine int
+	EndLine   int
+	Vector    []float32
+}
+
+// fileEntry is the index of one file, kept until the file changes.
+type fileEntry struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string
+	Chunks  []Chunk
+}
+
+// store is what is saved to disk.
+type store struct {
+	Model string
+	Files map[string]*fileEntry
+}
+
+// Result is a chunk matching a query.
+type Result struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	// Score is the cosine similarity of the chunk to the query, up to 1.
+	Score float32
+}
+
+// UpdateStats tells what an update did.
+type UpdateStats struct {
+	Embedded int
+	Removed  int
+	Chunks   int
+}
+
+// Index is an embeddings index stored as a single file in a directory. It
+// is safe for concurrent use.
+type Index struct {
+	dir      string
+	embedder llm.Embedder
+	model    string
+
+	mu     sync.Mutex
+	store  *store
+	loaded bool
+}
+
+// New returns the index kept in dir, embedding with model. Nothing is read
+// or written until it is first used.
+func New(dir string, embedder llm.Embedder, model string) *Index {
+	return &Index{dir: dir, embedder: embedder, model: model}
+}
+
+func (ix *Index) path() string {
+	return filepath.Join(ix.dir, "index.gob")
+}
+
+// load reads the index from disk once. An index built with another model
+// is discarded, since its vectors cannot be compared with new ones.
+func (ix *Index) load() error {
+	if ix.loaded {
+		return nil
+	}
+	ix.store = &store{Model: ix.model, Files: map[string]*fileEntry{}}
+	data, err := os.ReadFile(ix.path())
+	if errors.Is(err, os.ErrNotExist) {
+		ix.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	var saved store
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&saved); err == nil && saved.Model == ix.model && saved.Files != nil {
+		ix.store = &saved
+	}
+	ix.loaded = true
+	return nil
+}
+
+func (ix *Index) save() error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ix.store); err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	if err := os.MkdirAll(ix.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	tmp := ix.path() + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return os.Rename(tmp, ix.path())
+}
+
+// Invalidate makes the next Update check paths again even if their size
+// and modification time look unchanged, which a quick edit can leave them.
+func (ix *Index) Invalidate(paths ...string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.loaded {
+		return
+	}
+	for _, path := range paths {
+		if entry := ix.store.Files[filepath.ToSlash(filepath.Clean(path))]; entry != nil {
+			entry.ModTime = time.Time{}
+		}
+	}
+}
+
+// pendingChunk is a chunk waiting to be embedded.
+type pendingChunk struct {
+	path  string
+	chunk Chunk
+	text  string
+}
+
+// Update brings the index in line with paths, the files that should be in
+// it: files that changed since the last update are embedded again and
+// files no longer listed are dropped. Unchanged files cost only a stat.
+// progress, when set, is told how many chunks are about to be embedded.
+func (ix *Index) Update(ctx context.Context, paths []string, progress func(files, chunks int)) (UpdateStats, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var stats UpdateStats
+	if err := ix.load(); err != nil {
+		return stats, err
+	}
+
+	listed := map[string]bool{}
+	changed := map[string]*fileEntry{}
+	var pending []pendingChunk
+	for _, path := range paths {
+		path = filepath.ToSlash(filepath.Clean(path))
+		listed[path] = true
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxFileSize {
+			listed[path] = false
+			continue
+		}
+		old := ix.store.Files[path]
+		if old != nil && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(content, 0) >= 0 {
+			listed[path] = false
+			continue
+		}
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if old != nil && old.Hash == hash {
+			// Touched but not changed.
+			old.Size, old.ModTime = info.Size(), info.ModTime()
+			continue
+		}
+		entry := &fileEntry{Size: info.Size(), ModTime: info.ModTime(), Hash: hash}
+		changed[path] = entry
+		for _, c := range chunkText(path, string(content)) {
+			pending = append(pending, pendingChunk{path: path, chunk: c.chunk, text: c.text})
+		}
+	}
+
+	dirty := false
+	for path := range ix.store.Files {
+		if !listed[path] {
+			delete(ix.store.Files, path)
+			stats.Removed++
+			dirty = true
+		}
+	}
+
+	if len(pending) > 0 && progress != nil {
+		progress(len(changed), len(pending))
+	}
+	var embedErr error
+	for start := 0; start < len(pending); start += batchSize {
+		end := min(start+batchSize, len(pending))
+		texts := make([]string, 0, end-start)
+		for _, p := range pending[start:end] {
+			texts = append(texts, p.text)
+		}
+		vectors, err := ix.embedder.Embed(ctx, ix.model, texts)
+		if err != nil {
+			embedErr = fmt.Errorf("failed to embed chunks: %w", err)
+			break
+		}
+		for i, p := range pending[start:end] {
+			p.chunk.Vector = normalize(vectors[i])
+			changed[p.path].Chunks = append(changed[p.path].Chunks, p.chunk)
+		}
+	}
+	// Only files whose chunks were all embedded are stored, so a failed
+	// update is picked up where it stopped next time.
+	for path, entry := range changed {
+		if embedErr != nil && len(entry.Chunks) < countChunks(pending, path) {
+			continue
+		}
+		ix.store.Files[path] = entry
+		stats.Embedded++
+		dirty = true
+	}
+	for _, entry := range ix.store.Files {
+		stats.Chunks += len(entry.Chunks)
+	}
+
+	if dirty {
+		if err := ix.save(); err != nil {
+			return stats, err
+		}
+	}
+	return stats, embedErr
+}
+
+func countChunks(pending []pendingChunk, path string) int {
+	n := 0
+	for _, p := range pending {
+		if p.path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// Search returns the k chunks most similar in meaning to query, among the
+// files accepted by keep, when set.
+func (ix *Index) Search(ctx context.Context, query string, k int, keep func(path string) bool) ([]Result, error) {
+	vectors, err := ix.embedder.Embed(ctx, ix.model, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	q := normalize(vectors[0])
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if err := ix.load(); err != nil {
+		return nil, err
+	}
+	var results []Result
+	for path, entry := range ix.store.Files {
+		if keep != nil && !keep(path) {
+			continue
+		}
+		for _, c := range entry.Chunks {
+			if len(c.Vector) != len(q) {
+				continue
+			}
+			results = append(results, Result{Path: path, StartLine: c.StartLine, EndLine: c.EndLine, Score: dot(q, c.Vector)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].StartLine < results[j].StartLine
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+type textChunk struct {
+	chunk Chunk
+	text  string
+}
+
+// chunkText splits content into overlapping ranges of lines. The path is
+// embedded with each chunk, since names of files and directories say a lot
+// about what the code in them does.
+func chunkText(path, content string) []textChunk {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	var chunks []textChunk
+	for start := 0; start < len(lines); start += chunkLines - chunkOverlap {
+		end := min(start+chunkLines, len(lines))
+		text := path + "\n" + strings.Join(lines[start:end], "\n")
+		if len(text) > maxChunkBytes {
+			text = text[:maxChunkBytes]
+		}
+		if strings.TrimSpace(strings.Join(lines[start:end], "")) != "" {
+			chunks = append(chunks, textChunk{chunk: Chunk{StartLine: start + 1, EndLine: end}, text: text})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,65 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// EditorCommand returns the user's editor and its arguments, from $VISUAL or
+// $EDITOR, falling back to vi (Notepad on Windows).
+func EditorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// Edit opens text in the user's editor and returns it as saved. run runs
+// the editor; when nil, the editor is run attached to the terminal.
+func Edit(text string, run func(*exec.Cmd) error) (string, error) {
+	file, err := os.CreateTemp("", "agent-message-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create message file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(text)
+	file.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to write message file: %w", err)
+	}
+
+	editor := EditorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	if run == nil {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		run = (*exec.Cmd).Run
+	}
+	if err := run(cmd); err != nil {
+		return "", fmt.Errorf("%s failed: %w", editor[0], err)
+	}
+
+	content, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read message file: %w", err)
+	}
+	return strings.TrimSpace(normalizeNewlines(string(content))), nil
+}
+
+// Edit opens text in the user's editor, handing it the terminal meanwhile,
+// and returns it as saved.
+func (r *Reader) Edit(text string) (string, error) {
+	resume, err := r.Suspend()
+	if err != nil {
+		return "", err
+	}
+	defer resume()
+	return Edit(text, nil)
+}
@@ -0,0 +1,100 @@
+package input
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxHistory is how many prompts are kept across sessions.
+const maxHistory = 1000
+
+// History is the list of prompts the user has entered, oldest first,
+// persisted to a file so it survives restarts.
+type History struct {
+	path    string
+	entries []string
+}
+
+// DefaultHistoryPath is where prompt history is stored unless configured
+// otherwise.
+func DefaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".code-agent", "history")
+}
+
+// LoadHistory reads the history stored at path. A missing file yields an
+// empty history; an empty path keeps history in memory only.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+		err = h.rewrite()
+	}
+	return h, err
+}
+
+// Entries returns the stored prompts, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add records a prompt and appends it to the history file. Blank lines and
+// repeats of the previous prompt are not recorded.
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	if h.path == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(h.path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(line + "\n")
+	return err
+}
+
+// rewrite replaces the history file with the entries in memory.
+func (h *History) rewrite() error {
+	tmp := h.path + ".tmp"
+	err := os.WriteFile(tmp, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
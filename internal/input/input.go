@@ -0,0 +1,533 @@
+// Package input reads user input from the terminal with line editing and
+// configurable key bindings. When stdin is not a terminal it falls back to
+// reading plain lines.
+package input
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/muesli/cancelreader"
+	"golang.org/x/term"
+
+	"code-editing-agent/internal/console"
+	"code-editing-agent/internal/mentions"
+)
+
+// ansiPattern matches color escape codes, which take no space on screen.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// Terminal sequences that turn bracketed paste mode on and off; in it,
+// pasted text arrives marked so its line breaks are not taken for Enter.
+const (
+	pasteModeOn  = "\x1b[?2004h"
+	pasteModeOff = "\x1b[?2004l"
+)
+
+// Reader reads lines from the user.
+type Reader struct {
+	fd       int
+	restore  func()
+	keys     <-chan Key
+	scanner  *bufio.Scanner
+	bindings map[string]string
+
+	// The raw input from the terminal: chunks is fed by a goroutine reading
+	// stdin, which Suspend stops, and closes when input ends.
+	chunks  chan []byte
+	stdin   cancelreader.CancelReader
+	reading chan struct{}
+
+	capture *capture
+	queue   []string // lines typed while the agent was working
+	pending []rune   // unfinished line typed while the agent was working
+
+	// History, when set, is browsed with the Up and Down keys and searched
+	// with Ctrl-R. Callers decide which lines are added to it.
+	History *History
+
+	// Complete, when set, suggests up to limit files for an @path being
+	// typed. The suggestions are shown after the line, and Tab puts them
+	// in one after another.
+	Complete func(query string, limit int) []string
+
+	// OnInterrupt is called when Ctrl-C is pressed. By default the terminal
+	// is restored and the process exits.
+	OnInterrupt func()
+}
+
+// NewReader returns a Reader for stdin. When stdin is a terminal it is put
+// into raw mode until Close is called.
+func NewReader() *Reader {
+	r := &Reader{
+		fd:       int(os.Stdin.Fd()),
+		bindings: map[string]string{},
+	}
+	r.OnInterrupt = func() {
+		r.Close()
+		fmt.Println()
+		os.Exit(130)
+	}
+
+	// The line editor moves the cursor with escape codes, which a console
+	// that cannot show colors does not understand either.
+	if term.IsTerminal(r.fd) && console.Colors {
+		restore, err := makeRaw(r.fd)
+		if err == nil {
+			r.chunks = make(chan []byte, 64)
+			err = r.startReading()
+		}
+		if err == nil {
+			keys := make(chan Key, 64)
+			go (&keyDecoder{bytes: r.chunks}).run(keys)
+			fmt.Print(pasteModeOn)
+			r.restore = restore
+			r.keys = keys
+			return r
+		}
+		if restore != nil {
+			restore()
+		}
+	}
+	r.scanner = bufio.NewScanner(os.Stdin)
+	r.scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return r
+}
+
+// Interactive reports whether the reader is editing lines on a terminal.
+func (r *Reader) Interactive() bool {
+	return r.keys != nil
+}
+
+// Bind makes a key submit text as if it had been typed as its own line. Key
+// names look like "alt+r" or "ctrl+g".
+func (r *Reader) Bind(key, text string) {
+	r.bindings[key] = text
+}
+
+// Close restores the terminal to the mode it was in before NewReader.
+func (r *Reader) Close() {
+	if r.restore != nil {
+		fmt.Print(pasteModeOff)
+		r.restore()
+		r.restore = nil
+	}
+}
+
+// Suspend hands the terminal to another program, such as an editor: it
+// stops reading input and leaves raw mode until the returned function is
+// called.
+func (r *Reader) Suspend() (resume func(), err error) {
+	if r.restore == nil {
+		return func() {}, nil
+	}
+	capturing := r.capture != nil
+	r.stopCapture()
+	if !r.stdin.Cancel() {
+		if capturing {
+			r.startCapture()
+		}
+		return nil, fmt.Errorf("cannot stop reading the terminal")
+	}
+	<-r.reading
+	r.stdin.Close()
+	fmt.Print(pasteModeOff)
+	r.restore()
+	r.restore = nil
+
+	return func() {
+		restore, err := makeRaw(r.fd)
+		if err == nil {
+			err = r.startReading()
+		}
+		if err != nil {
+			// Without the terminal there is no more input.
+			close(r.chunks)
+			return
+		}
+		fmt.Print(pasteModeOn)
+		r.restore = restore
+		if capturing {
+			r.startCapture()
+		}
+	}, nil
+}
+
+// ReadLine prints prompt and returns the line the user entered. It reports
+// false at end of input.
+func (r *Reader) ReadLine(prompt string) (string, bool) {
+	if r.capture != nil {
+		// A tool is asking a question while the agent works; the answer
+		// must not end up in the queue.
+		r.stopCapture()
+		defer r.startCapture()
+		return r.readLine(prompt, nil)
+	}
+	initial := r.pending
+	r.pending = nil
+	return r.readLine(prompt, initial)
+}
+
+func (r *Reader) readLine(prompt string, initial []rune) (string, bool) {
+	if r.keys == nil {
+		fmt.Print(prompt)
+		if !r.scanner.Scan() {
+			return "", false
+		}
+		return r.scanner.Text(), true
+	}
+
+	e := &editor{prompt: prompt, fd: r.fd, buf: initial, pos: len(initial), complete: r.Complete}
+	if r.History != nil {
+		e.history = r.History.Entries()
+	}
+	e.histPos = len(e.history)
+	e.render()
+	for {
+		key, ok := <-r.keys
+		if !ok {
+			fmt.Print("\r\n")
+			return "", false
+		}
+
+		if e.searching && e.handleSearch(key) {
+			e.render()
+			continue
+		}
+
+		if text, bound := r.bindings[key.Name()]; bound {
+			e.buf = []rune(text)
+			e.pos = len(e.buf)
+			e.render()
+			fmt.Print("\r\n")
+			return text, true
+		}
+
+		switch {
+		case (key.Code == KeyEnter && key.Alt) || (key.Code == KeyCtrl && key.Rune == 'j'):
+			// Alt+Enter and Ctrl+J start a new line in the message.
+			e.insert('\n')
+		case key.Code == KeyEnter:
+			fmt.Print("\r\n")
+			return string(e.buf), true
+		case key.Code == KeyCtrl && key.Rune == 'c':
+			fmt.Print("^C\r\n")
+			r.OnInterrupt()
+			return "", false
+		case key.Code == KeyCtrl && key.Rune == 'd' && len(e.buf) == 0:
+			fmt.Print("\r\n")
+			return "", false
+		default:
+			e.handle(key)
+		}
+		e.render()
+	}
+}
+
+// startReading copies raw input from stdin to r.chunks until it fails,
+// closing r.chunks, or Suspend cancels it.
+func (r *Reader) startReading() error {
+	stdin, err := cancelreader.NewReader(os.Stdin)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	r.stdin, r.reading = stdin, done
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1024)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				chunk := make([]byte, n)
+				copy(chunk, buf[:n])
+				r.chunks <- chunk
+			}
+			if errors.Is(err, cancelreader.ErrCanceled) {
+				return
+			}
+			if err != nil {
+				close(r.chunks)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// editor holds the state of the line being edited.
+type editor struct {
+	prompt string
+	fd     int
+	buf    []rune
+	pos    int
+	offset int // first visible rune when the line is wider than the terminal
+
+	history []string
+	histPos int    // index into history of the line shown; len(history) for a new line
+	draft   []rune // the new line, kept while browsing history
+
+	searching bool
+	query     []rune
+	match     int // index into history of the current search match, -1 for none
+	failing   bool
+
+	complete     func(query string, limit int) []string
+	suggestions  []string // the files Tab cycles through, once it was pressed
+	mentionStart int      // where the @path being completed starts
+	choice       int      // the suggestion Tab puts in next
+}
+
+// maxSuggestions is how many files are suggested for an @path.
+const maxSuggestions = 10
+
+// handle applies an editing key to the buffer.
+func (e *editor) handle(key Key) {
+	if key.Code != KeyTab {
+		e.suggestions = nil
+	}
+	switch {
+	case key.Code == KeyRune && !key.Alt:
+		e.insert(key.Rune)
+	case key.Code == KeyPaste:
+		for _, r := range key.Text {
+			e.insert(r)
+		}
+	case key.Code == KeyBackspace || (key.Code == KeyCtrl && key.Rune == 'h'):
+		if e.pos > 0 {
+			e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+			e.pos--
+		}
+	case key.Code == KeyDelete || (key.Code == KeyCtrl && key.Rune == 'd'):
+		if e.pos < len(e.buf) {
+			e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+		}
+	case key.Code == KeyLeft || (key.Code == KeyCtrl && key.Rune == 'b'):
+		if e.pos > 0 {
+			e.pos--
+		}
+	case key.Code == KeyRight || (key.Code == KeyCtrl && key.Rune == 'f'):
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case key.Code == KeyHome || (key.Code == KeyCtrl && key.Rune == 'a'):
+		e.pos = 0
+	case key.Code == KeyEnd || (key.Code == KeyCtrl && key.Rune == 'e'):
+		e.pos = len(e.buf)
+	case key.Code == KeyCtrl && key.Rune == 'u':
+		e.buf = append([]rune{}, e.buf[e.pos:]...)
+		e.pos = 0
+	case key.Code == KeyCtrl && key.Rune == 'k':
+		e.buf = e.buf[:e.pos]
+	case key.Code == KeyCtrl && key.Rune == 'w':
+		start := e.pos
+		for start > 0 && e.buf[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && e.buf[start-1] != ' ' {
+			start--
+		}
+		e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+		e.pos = start
+	case key.Code == KeyTab:
+		if !e.completeMention() {
+			e.insert(' ')
+		}
+	case key.Code == KeyUp || (key.Code == KeyCtrl && key.Rune == 'p'):
+		e.browse(e.histPos - 1)
+	case key.Code == KeyDown || (key.Code == KeyCtrl && key.Rune == 'n'):
+		e.browse(e.histPos + 1)
+	case key.Code == KeyCtrl && key.Rune == 'r':
+		e.searching = true
+		e.query = nil
+		e.match = -1
+		e.failing = false
+		e.draft = append([]rune{}, e.buf...)
+	}
+}
+
+// completeMention replaces the @path before the cursor with the next file
+// suggested for it, going through them on repeated Tabs. It reports false
+// when there is no mention to complete.
+func (e *editor) completeMention() bool {
+	if e.suggestions == nil {
+		if e.complete == nil {
+			return false
+		}
+		before := string(e.buf[:e.pos])
+		start, query, ok := mentions.Token(before)
+		if !ok {
+			return false
+		}
+		e.suggestions = e.complete(query, maxSuggestions)
+		if len(e.suggestions) == 0 {
+			e.suggestions = nil
+			return false
+		}
+		e.mentionStart = utf8.RuneCountInString(before[:start])
+		e.choice = 0
+	}
+	mention := []rune("@" + e.suggestions[e.choice%len(e.suggestions)])
+	rest := append([]rune{}, e.buf[e.pos:]...)
+	e.buf = append(append(e.buf[:e.mentionStart], mention...), rest...)
+	e.pos = e.mentionStart + len(mention)
+	e.choice++
+	return true
+}
+
+// hint lists the files suggested for the @path before the cursor, to show
+// after the line.
+func (e *editor) hint() string {
+	if e.complete == nil || e.searching || e.suggestions != nil {
+		return ""
+	}
+	_, query, ok := mentions.Token(string(e.buf[:e.pos]))
+	if !ok {
+		return ""
+	}
+	suggestions := e.complete(query, 3)
+	if len(suggestions) == 0 {
+		return "  no matching files"
+	}
+	return "  " + strings.Join(suggestions, "  ") + "  (Tab)"
+}
+
+// browse shows history entry i, or the line being typed once past the end.
+func (e *editor) browse(i int) {
+	if i < 0 || i > len(e.history) {
+		return
+	}
+	if e.histPos == len(e.history) {
+		e.draft = append([]rune{}, e.buf...)
+	}
+	e.histPos = i
+	if i == len(e.history) {
+		e.buf = append([]rune{}, e.draft...)
+	} else {
+		e.buf = []rune(e.history[i])
+	}
+	e.pos = len(e.buf)
+}
+
+// handleSearch processes a key during a Ctrl-R search and reports whether it
+// was consumed. Keys that are not part of the search end it, leaving the
+// match in the buffer for the key to act on.
+func (e *editor) handleSearch(key Key) bool {
+	switch {
+	case key.Code == KeyCtrl && key.Rune == 'r':
+		from := e.match - 1
+		if e.match < 0 {
+			from = len(e.history) - 1
+		}
+		e.search(from)
+	case key.Code == KeyRune && !key.Alt:
+		e.query = append(e.query, key.Rune)
+		from := e.match
+		if from < 0 {
+			from = len(e.history) - 1
+		}
+		e.search(from)
+	case key.Code == KeyBackspace:
+		if len(e.query) > 0 {
+			e.query = e.query[:len(e.query)-1]
+		}
+		e.search(len(e.history) - 1)
+	case key.Code == KeyEscape || (key.Code == KeyCtrl && key.Rune == 'g'):
+		e.searching = false
+		e.buf = e.draft
+		e.pos = len(e.buf)
+	default:
+		e.searching = false
+		if e.match >= 0 {
+			e.histPos = e.match
+		}
+		return false
+	}
+	return true
+}
+
+// search finds the newest history entry at or before index from that
+// contains the query and shows it.
+func (e *editor) search(from int) {
+	query := string(e.query)
+	for i := from; i >= 0; i-- {
+		idx := strings.Index(e.history[i], query)
+		if idx < 0 {
+			continue
+		}
+		e.match = i
+		e.failing = false
+		e.buf = []rune(e.history[i])
+		e.pos = utf8.RuneCountInString(e.history[i][:idx])
+		return
+	}
+	e.failing = query != ""
+	if e.match < 0 {
+		e.buf = e.draft
+		e.pos = len(e.buf)
+	}
+}
+
+func (e *editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+// render redraws the prompt and the visible part of the line, scrolling
+// horizontally so the cursor stays on screen.
+func (e *editor) render() {
+	prompt := e.prompt
+	if e.searching {
+		label := "reverse-i-search"
+		if e.failing {
+			label = "failing " + label
+		}
+		prompt = fmt.Sprintf("(%s)`%s': ", label, string(e.query))
+	}
+	promptWidth := visibleWidth(prompt)
+
+	width, _, err := term.GetSize(e.fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	avail := width - promptWidth - 1
+	if avail < 10 {
+		avail = 10
+	}
+	if e.pos < e.offset {
+		e.offset = e.pos
+	}
+	if e.pos-e.offset > avail {
+		e.offset = e.pos - avail
+	}
+	end := e.offset + avail
+	if end > len(e.buf) {
+		end = len(e.buf)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\r")
+	sb.WriteString(prompt)
+	// The line breaks of a multi-line message are shown as ↵.
+	sb.WriteString(strings.ReplaceAll(string(e.buf[e.offset:end]), "\n", "↵"))
+	if hint := e.hint(); hint != "" && promptWidth+end-e.offset+utf8.RuneCountInString(hint) < width {
+		sb.WriteString("\x1b[90m" + hint + "\x1b[0m")
+	}
+	sb.WriteString("\x1b[K\r")
+	if col := promptWidth + e.pos - e.offset; col > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dC", col)
+	}
+	fmt.Print(sb.String())
+}
+
+// visibleWidth is the number of terminal columns text occupies.
+func visibleWidth(text string) int {
+	return utf8.RuneCountInString(ansiPattern.ReplaceAllString(text, ""))
+}
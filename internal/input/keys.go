@@ -0,0 +1,237 @@
+package input
+
+import (
+	"bytes"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// escapeTimeout is how long to wait for the rest of an escape sequence
+// before treating a lone ESC as the Escape key.
+const escapeTimeout = 30 * time.Millisecond
+
+// KeyCode identifies a non-printable key.
+type KeyCode int
+
+const (
+	KeyRune KeyCode = iota
+	KeyEnter
+	KeyBackspace
+	KeyDelete
+	KeyTab
+	KeyEscape
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyCtrl
+	// KeyPaste is text pasted into a terminal in bracketed paste mode.
+	KeyPaste
+)
+
+// pasteEnd ends the text of a bracketed paste, which starts with ESC [200~.
+const pasteEnd = "\x1b[201~"
+
+// Key is a single decoded keypress. For KeyRune and KeyCtrl, Rune holds the
+// character ('a' for Ctrl-A); for KeyPaste, Text holds the pasted text with
+// line breaks as "\n".
+type Key struct {
+	Code KeyCode
+	Rune rune
+	Alt  bool
+	Text string
+}
+
+// Name returns the binding name of the key, such as "ctrl+r" or "alt+r".
+func (k Key) Name() string {
+	prefix := ""
+	if k.Alt {
+		prefix = "alt+"
+	}
+	switch k.Code {
+	case KeyRune:
+		return prefix + string(k.Rune)
+	case KeyCtrl:
+		return prefix + "ctrl+" + string(k.Rune)
+	case KeyEnter:
+		return prefix + "enter"
+	case KeyTab:
+		return prefix + "tab"
+	case KeyEscape:
+		return "escape"
+	case KeyUp:
+		return prefix + "up"
+	case KeyDown:
+		return prefix + "down"
+	case KeyLeft:
+		return prefix + "left"
+	case KeyRight:
+		return prefix + "right"
+	case KeyHome:
+		return prefix + "home"
+	case KeyEnd:
+		return prefix + "end"
+	case KeyBackspace:
+		return prefix + "backspace"
+	case KeyDelete:
+		return prefix + "delete"
+	}
+	return ""
+}
+
+// keyDecoder turns the raw byte stream from the terminal into keys.
+type keyDecoder struct {
+	bytes <-chan []byte
+	buf   []byte
+}
+
+// run decodes keys into out until the input is closed.
+func (d *keyDecoder) run(out chan<- Key) {
+	defer close(out)
+	for {
+		key, ok := d.next()
+		if !ok {
+			return
+		}
+		out <- key
+	}
+}
+
+// fill waits for more input. With a timeout it gives up after that long and
+// reports false.
+func (d *keyDecoder) fill(timeout time.Duration) bool {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	select {
+	case chunk, ok := <-d.bytes:
+		if !ok {
+			return false
+		}
+		d.buf = append(d.buf, chunk...)
+		return true
+	case <-timer:
+		return false
+	}
+}
+
+// next blocks until a complete key is available. It reports false once the
+// input is closed.
+func (d *keyDecoder) next() (Key, bool) {
+	for len(d.buf) == 0 {
+		if !d.fill(0) {
+			return Key{}, false
+		}
+	}
+
+	b := d.buf[0]
+	switch {
+	case b == 0x1b:
+		return d.escape(), true
+	case b == '\r' || b == '\n':
+		d.buf = d.buf[1:]
+		if b == '\n' {
+			return Key{Code: KeyCtrl, Rune: 'j'}, true
+		}
+		return Key{Code: KeyEnter}, true
+	case b == '\t':
+		d.buf = d.buf[1:]
+		return Key{Code: KeyTab}, true
+	case b == 0x7f || b == 0x08:
+		d.buf = d.buf[1:]
+		return Key{Code: KeyBackspace}, true
+	case b < 0x20:
+		d.buf = d.buf[1:]
+		return Key{Code: KeyCtrl, Rune: rune('a' + b - 1)}, true
+	}
+
+	for !utf8.FullRune(d.buf) {
+		if !d.fill(escapeTimeout) {
+			break
+		}
+	}
+	r, size := utf8.DecodeRune(d.buf)
+	d.buf = d.buf[size:]
+	return Key{Code: KeyRune, Rune: r}, true
+}
+
+// escape decodes a sequence starting with ESC: CSI sequences for cursor keys,
+// Alt+key, or a lone Escape.
+func (d *keyDecoder) escape() Key {
+	if len(d.buf) == 1 && !d.fill(escapeTimeout) {
+		d.buf = d.buf[1:]
+		return Key{Code: KeyEscape}
+	}
+
+	if d.buf[1] != '[' && d.buf[1] != 'O' {
+		d.buf = d.buf[1:]
+		key, _ := d.next()
+		key.Alt = true
+		return key
+	}
+
+	// CSI: ESC [ params final, where final is in 0x40-0x7e.
+	end := 2
+	for {
+		for end >= len(d.buf) {
+			if !d.fill(escapeTimeout) {
+				d.buf = d.buf[len(d.buf):]
+				return Key{Code: KeyEscape}
+			}
+		}
+		if d.buf[end] >= 0x40 && d.buf[end] <= 0x7e {
+			break
+		}
+		end++
+	}
+	seq := string(d.buf[2 : end+1])
+	d.buf = d.buf[end+1:]
+	if seq == "200~" {
+		return d.paste()
+	}
+
+	switch seq {
+	case "A":
+		return Key{Code: KeyUp}
+	case "B":
+		return Key{Code: KeyDown}
+	case "C":
+		return Key{Code: KeyRight}
+	case "D":
+		return Key{Code: KeyLeft}
+	case "H", "1~", "7~":
+		return Key{Code: KeyHome}
+	case "F", "4~", "8~":
+		return Key{Code: KeyEnd}
+	case "3~":
+		return Key{Code: KeyDelete}
+	}
+	return Key{Code: KeyEscape}
+}
+
+// paste reads pasted text up to the end of the bracketed paste, so that
+// its line breaks do not act as Enter.
+func (d *keyDecoder) paste() Key {
+	for {
+		if i := bytes.Index(d.buf, []byte(pasteEnd)); i >= 0 {
+			text := string(d.buf[:i])
+			d.buf = d.buf[i+len(pasteEnd):]
+			return Key{Code: KeyPaste, Text: normalizeNewlines(text)}
+		}
+		if !d.fill(0) {
+			text := string(d.buf)
+			d.buf = nil
+			return Key{Code: KeyPaste, Text: normalizeNewlines(text)}
+		}
+	}
+}
+
+// normalizeNewlines turns the "\r\n" and "\r" line breaks terminals send
+// into "\n".
+func normalizeNewlines(text string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+}
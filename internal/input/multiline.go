@@ -0,0 +1,82 @@
+package input
+
+import (
+	"regexp"
+	"strings"
+)
+
+// continuePrompt is shown for the lines of a message after its first.
+const continuePrompt = "\u001b[90m...\u001b[0m "
+
+// tripleQuote opens and closes a block of lines sent as one message.
+const tripleQuote = `"""`
+
+// heredocPattern matches a line ending in a heredoc marker such as <<EOF or
+// <<'END', capturing the word that ends the message.
+var heredocPattern = regexp.MustCompile(`(^|\s)<<['"]?([A-Z][A-Z0-9_]*)['"]?$`)
+
+// Continue completes a message that first opens as a multi-line block,
+// reading further lines with next:
+//
+//	"""                  Review this:
+//	lines of text        <<EOF
+//	"""                  lines of text
+//	                     EOF
+//
+// Text before a heredoc marker starts the message. Any other line is the
+// whole message and is returned as it is.
+func Continue(first string, next func() (string, bool)) string {
+	trimmed := strings.TrimSpace(first)
+	var end string
+	var lines []string
+	switch {
+	case strings.HasPrefix(trimmed, tripleQuote):
+		rest := strings.TrimPrefix(trimmed, tripleQuote)
+		if before, ok := strings.CutSuffix(rest, tripleQuote); ok {
+			return before
+		}
+		if rest != "" {
+			lines = append(lines, rest)
+		}
+		end = tripleQuote
+	case heredocPattern.MatchString(first):
+		m := heredocPattern.FindStringSubmatchIndex(first)
+		if before := strings.TrimSpace(first[:m[0]]); before != "" {
+			lines = append(lines, before)
+		}
+		end = first[m[4]:m[5]]
+	default:
+		return first
+	}
+
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+		if end == tripleQuote {
+			if before, found := strings.CutSuffix(strings.TrimRight(line, " \t"), tripleQuote); found {
+				if before != "" {
+					lines = append(lines, before)
+				}
+				break
+			}
+		} else if strings.TrimSpace(line) == end {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NextMessage is NextLine for messages that may span several lines, entered
+// as a """ block or a heredoc; see Continue.
+func (r *Reader) NextMessage(prompt string) (string, bool) {
+	line, ok := r.NextLine(prompt)
+	if !ok {
+		return "", false
+	}
+	return Continue(line, func() (string, bool) {
+		return r.NextLine(continuePrompt)
+	}), true
+}
@@ -0,0 +1,92 @@
+package input
+
+import "fmt"
+
+// capture collects keys typed while the agent is working.
+type capture struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartQueueing marks the agent as busy. Lines typed from now on are queued
+// instead of being lost or mixed into tool output, and are handed out by
+// NextLine once the agent is ready for input again.
+func (r *Reader) StartQueueing() {
+	if r.keys == nil || r.capture != nil {
+		return
+	}
+	r.startCapture()
+}
+
+// NextLine returns the oldest line queued while the agent was working,
+// echoed after prompt, or reads a new line when nothing is queued.
+func (r *Reader) NextLine(prompt string) (string, bool) {
+	r.stopCapture()
+	if len(r.queue) > 0 {
+		line := r.queue[0]
+		r.queue = r.queue[1:]
+		fmt.Printf("%s%s\n", prompt, line)
+		return line, true
+	}
+	return r.ReadLine(prompt)
+}
+
+func (r *Reader) startCapture() {
+	c := &capture{stop: make(chan struct{}), done: make(chan struct{})}
+	r.capture = c
+	go func() {
+		defer close(c.done)
+		for {
+			select {
+			case <-c.stop:
+				return
+			case key, ok := <-r.keys:
+				if !ok {
+					return
+				}
+				r.captureKey(key)
+			}
+		}
+	}()
+}
+
+func (r *Reader) stopCapture() {
+	if r.capture == nil {
+		return
+	}
+	close(r.capture.stop)
+	<-r.capture.done
+	r.capture = nil
+}
+
+// captureKey applies a key typed while the agent works. Nothing is echoed
+// until Enter, so typing does not break up the agent's output.
+func (r *Reader) captureKey(key Key) {
+	switch {
+	case key.Code == KeyEnter:
+		line := string(r.pending)
+		r.pending = nil
+		if line == "" {
+			return
+		}
+		r.queue = append(r.queue, line)
+		fmt.Printf("\u001b[90m(queued for the next turn) %s\u001b[0m\n", line)
+	case key.Code == KeyCtrl && key.Rune == 'c':
+		r.OnInterrupt()
+	case key.Code == KeyCtrl && key.Rune == 'u':
+		r.pending = nil
+	case key.Code == KeyBackspace:
+		if len(r.pending) > 0 {
+			r.pending = r.pending[:len(r.pending)-1]
+		}
+	case key.Code == KeyRune && !key.Alt:
+		r.pending = append(r.pending, key.Rune)
+	case key.Code == KeyPaste:
+		r.pending = append(r.pending, []rune(key.Text)...)
+	default:
+		if text, bound := r.bindings[key.Name()]; bound {
+			r.queue = append(r.queue, text)
+			fmt.Printf("\u001b[90m(queued for the next turn) %s\u001b[0m\n", text)
+		}
+	}
+}
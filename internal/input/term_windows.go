@@ -0,0 +1,28 @@
+//go:build windows
+
+package input
+
+import "golang.org/x/sys/windows"
+
+// makeRaw switches the console to deliver keys one at a time without echo
+// or Ctrl+C handling, with the arrow and other special keys sent as the
+// same escape sequences as on a Unix terminal. It returns a function that
+// restores the previous mode.
+func makeRaw(fd int) (func(), error) {
+	handle := windows.Handle(fd)
+	var old uint32
+	if err := windows.GetConsoleMode(handle, &old); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw &^= windows.ENABLE_ECHO_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_PROCESSED_INPUT
+	raw |= windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(handle, raw); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		windows.SetConsoleMode(handle, old)
+	}, nil
+}
@@ -0,0 +1,344 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAnthropicModel   = "claude-3-5-sonnet-latest"
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+)
+
+// Anthropic talks to the Anthropic Messages API.
+type Anthropic struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewAnthropic returns an Anthropic provider. An empty baseURL uses the
+// official API.
+func NewAnthropic(apiKey, baseURL string) *Anthropic {
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+	return &Anthropic{apiKey: apiKey, baseURL: strings.TrimSuffix(baseURL, "/"), client: http.DefaultClient}
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is one content block: text, an image, a tool_use request
+// from the model, or a tool_result answering it.
+type anthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Content []anthropicBlock `json:"content"`
+	Usage   anthropicUsage   `json:"usage"`
+}
+
+// anthropicEvent is one server-sent event of a streamed response.
+type anthropicEvent struct {
+	Type         string          `json:"type"`
+	Index        int             `json:"index"`
+	ContentBlock anthropicBlock  `json:"content_block"`
+	Message      json.RawMessage `json:"message"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *Anthropic) Chat(ctx context.Context, req Request) (*Response, error) {
+	body, err := p.send(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var resp anthropicResponse
+	err = json.NewDecoder(body).Decode(&resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Anthropic response: %w", err)
+	}
+
+	message := Message{Role: RoleAssistant}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			message.Content += block.Text
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	return &Response{
+		Message: message,
+		Usage:   Usage{PromptTokens: resp.Usage.InputTokens, CompletionTokens: resp.Usage.OutputTokens},
+	}, nil
+}
+
+func (p *Anthropic) ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error) {
+	body, err := p.send(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	// Content blocks are streamed by index; tool_use blocks build their
+	// input from partial JSON fragments.
+	message := Message{Role: RoleAssistant}
+	toolIndex := map[int]int{}
+	usage := Usage{}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event anthropicEvent
+		err := json.Unmarshal([]byte(data), &event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Anthropic stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			var start struct {
+				Usage anthropicUsage `json:"usage"`
+			}
+			json.Unmarshal(event.Message, &start)
+			usage.PromptTokens = start.Usage.InputTokens
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				toolIndex[event.Index] = len(message.ToolCalls)
+				message.ToolCalls = append(message.ToolCalls, ToolCall{ID: event.ContentBlock.ID, Name: event.ContentBlock.Name})
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				message.Content += event.Delta.Text
+				if onText != nil {
+					onText(event.Delta.Text)
+				}
+			case "input_json_delta":
+				if i, ok := toolIndex[event.Index]; ok {
+					message.ToolCalls[i].Arguments += event.Delta.PartialJSON
+				}
+			}
+		case "message_delta":
+			usage.CompletionTokens = event.Usage.OutputTokens
+		case "error":
+			return nil, p.wrapError(anthropicStreamStatus[event.Error.Type], event.Error.Message, nil)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Anthropic stream: %w", err)
+	}
+
+	// A tool called without arguments streams no input at all.
+	for i := range message.ToolCalls {
+		if message.ToolCalls[i].Arguments == "" {
+			message.ToolCalls[i].Arguments = "{}"
+		}
+	}
+	return &Response{Message: message, Usage: usage}, nil
+}
+
+func (p *Anthropic) CountTokens(messages []Message) int {
+	return estimateTokens(messages)
+}
+
+// send posts the request and returns the response body, turning API errors
+// into Go errors.
+func (p *Anthropic) send(ctx context.Context, req Request, stream bool) (io.ReadCloser, error) {
+	payload, err := json.Marshal(p.request(req, stream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Anthropic request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Anthropic API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		message := strings.TrimSpace(string(data))
+		var apiErr anthropicError
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+		}
+		return nil, p.wrapError(resp.StatusCode, message, resp.Header)
+	}
+	return resp.Body, nil
+}
+
+// request translates a Request to the Messages API format: system messages
+// move to the system field, tool results become tool_result blocks in a
+// user message, and consecutive messages of the same role are merged since
+// the API requires user and assistant turns to alternate.
+func (p *Anthropic) request(req Request, stream bool) anthropicRequest {
+	out := anthropicRequest{Model: req.Model, MaxTokens: req.MaxTokens, Temperature: req.Temperature, Stream: stream}
+
+	var system []string
+	for _, msg := range req.Messages {
+		var role string
+		var blocks []anthropicBlock
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, msg.Content)
+			continue
+		case RoleTool:
+			role = RoleUser
+			blocks = []anthropicBlock{{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content}}
+		case RoleAssistant:
+			role = RoleAssistant
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+			}
+		default:
+			role = RoleUser
+			// Images go first, which the API recommends.
+			for _, image := range msg.Images {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicImageSource{
+					Type: "base64", MediaType: image.MediaType, Data: image.Base64(),
+				}})
+			}
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+		} else {
+			out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: blocks})
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: anthropicInputSchema(tool.Parameters),
+		})
+	}
+	return out
+}
+
+// anthropicInputSchema translates a tool's JSON schema to the input_schema
+// the Messages API accepts: an object schema without the $schema and $id
+// keywords and without null properties or required fields, which
+// generated schemas of tools that take no arguments contain.
+func anthropicInputSchema(parameters interface{}) map[string]interface{} {
+	schema := map[string]interface{}{}
+	if data, err := json.Marshal(parameters); err == nil {
+		json.Unmarshal(data, &schema)
+	}
+	if schema == nil {
+		schema = map[string]interface{}{}
+	}
+	delete(schema, "$schema")
+	delete(schema, "$id")
+	schema["type"] = "object"
+	if schema["properties"] == nil {
+		schema["properties"] = map[string]interface{}{}
+	}
+	if required, ok := schema["required"].([]interface{}); !ok || len(required) == 0 {
+		delete(schema, "required")
+	}
+	return schema
+}
+
+// anthropicStreamStatus maps the errors sent in the middle of a stream to
+// the HTTP status they would have had before it started.
+var anthropicStreamStatus = map[string]int{
+	"rate_limit_error": http.StatusTooManyRequests,
+	"api_error":        http.StatusInternalServerError,
+	"overloaded_error": 529,
+}
+
+// wrapError turns an API error into an *APIError, marking oversized
+// requests with ErrContextLength.
+func (p *Anthropic) wrapError(status int, message string, header http.Header) error {
+	if strings.Contains(message, "prompt is too long") || strings.Contains(message, "context window") {
+		return fmt.Errorf("%w: %s", ErrContextLength, message)
+	}
+	return &APIError{Provider: "Anthropic", StatusCode: status, Message: message, RetryAfter: retryAfter(header)}
+}
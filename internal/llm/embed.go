@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embedder turns texts into vectors that lie close together when the texts
+// mean similar things.
+type Embedder interface {
+	// Embed returns one vector per text, in order.
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, error)
+}
+
+// DefaultEmbeddingModel is the embedding model used with provider when none
+// is configured.
+func DefaultEmbeddingModel(provider string) string {
+	switch strings.ToLower(provider) {
+	case "ollama":
+		return "nomic-embed-text"
+	}
+	return string(openai.SmallEmbedding3)
+}
+
+// EmbedderOf returns the embeddings endpoint of provider. It reports false
+// for providers without one, such as Anthropic.
+func EmbedderOf(provider Provider) (Embedder, bool) {
+	// Wrappers such as WithRetry can embed whenever the provider they wrap
+	// can.
+	inner := provider
+	for {
+		w, ok := inner.(wrapper)
+		if !ok {
+			break
+		}
+		inner = w.unwrap()
+	}
+	if _, ok := inner.(Embedder); !ok {
+		return nil, false
+	}
+	embedder, ok := provider.(Embedder)
+	return embedder, ok
+}
+
+// wrapper is a Provider that adds behaviour to another one.
+type wrapper interface {
+	unwrap() Provider
+}
+
+func (p *retryingProvider) unwrap() Provider {
+	return p.Provider
+}
+
+func (p *retryingProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	embedder, ok := p.Provider.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("the provider has no embeddings endpoint")
+	}
+	return retry(ctx, p, func() ([][]float32, error) {
+		return embedder.Embed(ctx, model, texts)
+	}, nil)
+}
+
+func (p *OpenAI) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
+	})
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("OpenAI returned %d embeddings for %d texts", len(resp.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, e := range resp.Data {
+		if e.Index < 0 || e.Index >= len(vectors) {
+			return nil, fmt.Errorf("OpenAI returned an embedding for unknown text %d", e.Index)
+		}
+		vectors[e.Index] = e.Embedding
+	}
+	return vectors, nil
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+	Error      string      `json:"error,omitempty"`
+}
+
+func (p *Ollama) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	payload, err := json.Marshal(ollamaEmbedRequest{Model: model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Ollama request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/embed", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Ollama at %s (is `ollama serve` running?): %w", p.baseURL, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Ollama response: %w", err)
+	}
+	var out ollamaEmbedResponse
+	decodeErr := json.Unmarshal(data, &out)
+	if resp.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(data))
+		if decodeErr == nil && out.Error != "" {
+			message = out.Error
+		}
+		return nil, &APIError{Provider: "Ollama", StatusCode: resp.StatusCode, Message: message, RetryAfter: retryAfter(resp.Header)}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode Ollama response: %w", decodeErr)
+	}
+	if len(out.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("Ollama returned %d embeddings for %d texts", len(out.Embeddings), len(texts))
+	}
+	return out.Embeddings, nil
+}
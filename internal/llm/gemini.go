@@ -0,0 +1,450 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultGeminiModel   = "gemini-2.5-flash"
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com"
+	// geminiSkipSignature stands in for the thought signature Gemini
+	// attaches to its function calls, which the conversation does not keep;
+	// the API accepts it for calls whose signature is not at hand.
+	geminiSkipSignature = "skip_thought_signature_validator"
+)
+
+// Gemini talks to the Google Gemini API.
+type Gemini struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+	safety  []geminiSafetySetting
+}
+
+// NewGemini returns a Gemini provider. An empty baseURL uses the official
+// API. safety maps harm categories such as "dangerous_content" or
+// "HARM_CATEGORY_HARASSMENT" to block thresholds such as "block_only_high"
+// or "BLOCK_NONE"; categories not in it keep the API's defaults.
+func NewGemini(apiKey, baseURL string, safety map[string]string) *Gemini {
+	if baseURL == "" {
+		baseURL = defaultGeminiBaseURL
+	}
+	p := &Gemini{apiKey: apiKey, baseURL: strings.TrimSuffix(baseURL, "/"), client: http.DefaultClient}
+	for category, threshold := range safety {
+		category = strings.ToUpper(category)
+		if !strings.HasPrefix(category, "HARM_CATEGORY_") {
+			category = "HARM_CATEGORY_" + category
+		}
+		p.safety = append(p.safety, geminiSafetySetting{Category: category, Threshold: strings.ToUpper(threshold)})
+	}
+	sort.Slice(p.safety, func(i, j int) bool { return p.safety[i].Category < p.safety[j].Category })
+	return p
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent       `json:"contents"`
+	SystemInstruction *geminiContent        `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool          `json:"tools,omitempty"`
+	SafetySettings    []geminiSafetySetting `json:"safetySettings,omitempty"`
+	GenerationConfig  struct {
+		MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+		Temperature     *float64 `json:"temperature,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart is one part of a message: text, an image, a function call
+// from the model or the response to one.
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// geminiResponse is a complete response, or one event of a streamed one.
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	} `json:"usageMetadata"`
+	Error *geminiError `json:"error"`
+}
+
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+func (p *Gemini) Chat(ctx context.Context, req Request) (*Response, error) {
+	body, err := p.send(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var resp geminiResponse
+	err = json.NewDecoder(body).Decode(&resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Gemini response: %w", err)
+	}
+	message := Message{Role: RoleAssistant}
+	usage, err := p.add(&message, resp, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Message: message, Usage: usage}, nil
+}
+
+func (p *Gemini) ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error) {
+	body, err := p.send(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	// Each event carries more text or whole function calls, and the usage
+	// so far.
+	message := Message{Role: RoleAssistant}
+	usage := Usage{}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event geminiResponse
+		err := json.Unmarshal([]byte(data), &event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Gemini stream event: %w", err)
+		}
+		if event.Error != nil {
+			return nil, p.wrapError(event.Error.Code, event.Error.Message, nil)
+		}
+		usage, err = p.add(&message, event, onText)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Gemini stream: %w", err)
+	}
+	return &Response{Message: message, Usage: usage}, nil
+}
+
+func (p *Gemini) CountTokens(messages []Message) int {
+	return estimateTokens(messages)
+}
+
+// add appends the text and function calls of resp to message and returns
+// the usage it reports. Gemini does not assign IDs to function calls, so
+// they are numbered. Replies stopped by the safety filters are errors.
+func (p *Gemini) add(message *Message, resp geminiResponse, onText func(string)) (Usage, error) {
+	if reason := resp.PromptFeedback.BlockReason; reason != "" {
+		return Usage{}, fmt.Errorf("Gemini blocked the prompt (%s); see gemini.safety_settings in the config", reason)
+	}
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				arguments := string(part.FunctionCall.Args)
+				if arguments == "" || arguments == "null" {
+					arguments = "{}"
+				}
+				message.ToolCalls = append(message.ToolCalls, ToolCall{
+					ID:        fmt.Sprintf("call_%d", len(message.ToolCalls)),
+					Name:      part.FunctionCall.Name,
+					Arguments: arguments,
+				})
+			case part.Text != "" && !part.Thought:
+				message.Content += part.Text
+				if onText != nil {
+					onText(part.Text)
+				}
+			}
+		}
+		switch candidate.FinishReason {
+		case "SAFETY", "PROHIBITED_CONTENT", "BLOCKLIST", "SPII":
+			if message.Content == "" && len(message.ToolCalls) == 0 {
+				return Usage{}, fmt.Errorf("Gemini stopped the reply (%s); see gemini.safety_settings in the config", candidate.FinishReason)
+			}
+		}
+	}
+	return Usage{
+		PromptTokens:     resp.UsageMetadata.PromptTokenCount,
+		CompletionTokens: resp.UsageMetadata.CandidatesTokenCount + resp.UsageMetadata.ThoughtsTokenCount,
+	}, nil
+}
+
+// send posts the request and returns the response body, turning API errors
+// into Go errors.
+func (p *Gemini) send(ctx context.Context, req Request, stream bool) (io.ReadCloser, error) {
+	payload, err := json.Marshal(p.request(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Gemini request: %w", err)
+	}
+	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent", p.baseURL, req.Model)
+	if stream {
+		url = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", p.baseURL, req.Model)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Gemini API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return nil, p.wrapError(resp.StatusCode, geminiErrorMessage(data), resp.Header)
+	}
+	return resp.Body, nil
+}
+
+// request translates a Request to the Gemini format: system messages move
+// to the system instruction, the assistant is the "model" role, and tool
+// results become function responses in a user message, named after the
+// call they answer. Consecutive messages of the same role are merged.
+func (p *Gemini) request(req Request) geminiRequest {
+	out := geminiRequest{SafetySettings: p.safety}
+	out.GenerationConfig.MaxOutputTokens = req.MaxTokens
+	out.GenerationConfig.Temperature = req.Temperature
+
+	var system []geminiPart
+	callNames := map[string]string{}
+	for _, msg := range req.Messages {
+		role := "user"
+		var parts []geminiPart
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, geminiPart{Text: msg.Content})
+			continue
+		case RoleTool:
+			parts = []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				Name:     callNames[msg.ToolCallID],
+				Response: map[string]interface{}{"content": msg.Content},
+			}}}
+		case RoleAssistant:
+			role = "model"
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			for i, call := range msg.ToolCalls {
+				callNames[call.ID] = call.Name
+				args := json.RawMessage(call.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				part := geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Name, Args: args}}
+				if i == 0 {
+					part.ThoughtSignature = geminiSkipSignature
+				}
+				parts = append(parts, part)
+			}
+		default:
+			parts = []geminiPart{{Text: msg.Content}}
+			for _, image := range msg.Images {
+				parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: image.MediaType, Data: image.Base64()}})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		if n := len(out.Contents); n > 0 && out.Contents[n-1].Role == role {
+			out.Contents[n-1].Parts = append(out.Contents[n-1].Parts, parts...)
+		} else {
+			out.Contents = append(out.Contents, geminiContent{Role: role, Parts: parts})
+		}
+	}
+	if len(system) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(req.Tools) > 0 {
+		tool := geminiTool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, geminiFunctionDeclaration{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  geminiSchema(t.Parameters),
+			})
+		}
+		out.Tools = []geminiTool{tool}
+	}
+	return out
+}
+
+// geminiUnsupported are JSON schema keywords the Gemini API rejects in
+// function parameters.
+var geminiUnsupported = []string{"$schema", "$id", "$defs", "$ref", "additionalProperties", "default", "examples"}
+
+// geminiSchema translates a tool's JSON schema to the OpenAPI subset Gemini
+// accepts, or nil for tools that take no arguments, whose parameters
+// Gemini wants left out.
+func geminiSchema(parameters interface{}) map[string]interface{} {
+	schema := anthropicInputSchema(parameters)
+	if properties, _ := schema["properties"].(map[string]interface{}); len(properties) == 0 {
+		return nil
+	}
+	clean(schema)
+	return schema
+}
+
+// clean removes the keywords Gemini rejects from schema and the schemas
+// nested in it.
+func clean(schema interface{}) {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		for _, key := range geminiUnsupported {
+			delete(s, key)
+		}
+		for key, value := range s {
+			// The keys of properties are argument names, not keywords.
+			if properties, ok := value.(map[string]interface{}); ok && key == "properties" {
+				for _, property := range properties {
+					clean(property)
+				}
+			} else {
+				clean(value)
+			}
+		}
+	case []interface{}:
+		for _, value := range s {
+			clean(value)
+		}
+	}
+}
+
+// geminiErrorMessage picks the message out of an error response body.
+func geminiErrorMessage(data []byte) string {
+	var resp struct {
+		Error geminiError `json:"error"`
+	}
+	if json.Unmarshal(data, &resp) == nil && resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// wrapError turns an API error into an *APIError, marking oversized
+// requests with ErrContextLength.
+func (p *Gemini) wrapError(status int, message string, header http.Header) error {
+	if strings.Contains(message, "exceeds the maximum number of tokens") {
+		return fmt.Errorf("%w: %s", ErrContextLength, message)
+	}
+	return &APIError{Provider: "Gemini", StatusCode: status, Message: message, RetryAfter: retryAfter(header)}
+}
+
+// ListModels returns the models that can generate content, following the
+// pages of the list.
+func (p *Gemini) ListModels(ctx context.Context) ([]string, error) {
+	var models []string
+	pageToken := ""
+	for {
+		url := p.baseURL + "/v1beta/models?pageSize=1000"
+		if pageToken != "" {
+			url += "&pageToken=" + pageToken
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("x-goog-api-key", p.apiKey)
+		resp, err := p.client.Do(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reach Gemini API: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Gemini response: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, p.wrapError(resp.StatusCode, geminiErrorMessage(data), resp.Header)
+		}
+
+		var page struct {
+			Models []struct {
+				Name    string   `json:"name"`
+				Methods []string `json:"supportedGenerationMethods"`
+			} `json:"models"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("failed to decode Gemini response: %w", err)
+		}
+		for _, model := range page.Models {
+			for _, method := range model.Methods {
+				if method == "generateContent" {
+					models = append(models, strings.TrimPrefix(model.Name, "models/"))
+					break
+				}
+			}
+		}
+		if page.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
@@ -0,0 +1,233 @@
+// Package llm abstracts the chat model behind the agent, so the same
+// conversation and tools work with hosted and local models.
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrContextLength is wrapped by provider errors when a request does not fit
+// in the model's context window.
+var ErrContextLength = errors.New("context length exceeded")
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is one entry in a conversation. Assistant messages may carry tool
+// calls; tool messages answer the call named by ToolCallID. User messages
+// may carry images, for models that take them.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Images     []Image    `json:"images,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Image is a picture attached to a message.
+type Image struct {
+	// MediaType is image/png, image/jpeg, image/gif or image/webp.
+	MediaType string `json:"media_type"`
+	Data      []byte `json:"data"`
+}
+
+// Base64 is the image's data in standard base64.
+func (i Image) Base64() string {
+	return base64.StdEncoding.EncodeToString(i.Data)
+}
+
+// DataURL is the image as a data: URL.
+func (i Image) DataURL() string {
+	return "data:" + i.MediaType + ";base64," + i.Base64()
+}
+
+// imageTokens is roughly what one image costs in a request. Providers count
+// by its size; a screenshot scaled down to what they take comes to about
+// this much.
+const imageTokens = 1500
+
+// ToolCall is a request from the model to run a tool with JSON arguments.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Tool describes a tool the model may call. Parameters is a JSON schema.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  interface{}
+}
+
+// Request is a single chat completion request.
+type Request struct {
+	Model     string
+	MaxTokens int
+	// Temperature is left to the provider's default when nil.
+	Temperature *float64
+	Messages    []Message
+	Tools       []Tool
+}
+
+// Usage counts the tokens a request consumed.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Response is the model's reply to a Request.
+type Response struct {
+	Message Message
+	Usage   Usage
+}
+
+// Provider is a chat model backend.
+type Provider interface {
+	// Chat sends the request and waits for the complete reply.
+	Chat(ctx context.Context, req Request) (*Response, error)
+	// ChatStream sends the request and calls onText with each piece of reply
+	// text as it arrives. Tool calls are assembled and returned with the
+	// complete reply.
+	ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error)
+	// CountTokens estimates how many tokens messages take up in a request.
+	CountTokens(messages []Message) int
+}
+
+// ModelLister is implemented by providers that can list the models they
+// serve.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// Config selects and configures a provider and the parameters of the
+// requests sent to it.
+type Config struct {
+	Provider    string // "openai", "azure", "anthropic", "gemini" or "ollama"
+	Model       string
+	APIKey      string
+	BaseURL     string
+	MaxTokens   int
+	Temperature *float64
+	// APIVersion and Deployments configure Azure OpenAI: the API version,
+	// and the deployment that serves each model.
+	APIVersion  string
+	Deployments map[string]string
+	// SafetySettings maps Gemini harm categories to block thresholds.
+	SafetySettings map[string]string
+}
+
+// ApplyEnv overrides cfg with LLM_PROVIDER and LLM_MODEL when they are
+// set.
+func (cfg *Config) ApplyEnv() {
+	if provider := os.Getenv("LLM_PROVIDER"); provider != "" {
+		cfg.Provider = provider
+	}
+	if model := os.Getenv("LLM_MODEL"); model != "" {
+		cfg.Model = model
+	}
+}
+
+// New creates the provider named in cfg, openai by default. The model, API
+// key and address fall back to the provider's defaults and its own
+// environment variables (OPENAI_API_KEY and OPENAI_BASE_URL,
+// AZURE_OPENAI_API_KEY, AZURE_OPENAI_ENDPOINT and AZURE_OPENAI_API_VERSION,
+// ANTHROPIC_API_KEY, GEMINI_API_KEY or GOOGLE_API_KEY, OLLAMA_HOST).
+func New(cfg *Config) (Provider, error) {
+	cfg.Provider = strings.ToLower(cfg.Provider)
+	if cfg.Provider == "" {
+		cfg.Provider = "openai"
+	}
+	switch cfg.Provider {
+	case "openai":
+		if cfg.APIKey == "" {
+			cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+		}
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = os.Getenv("OPENAI_BASE_URL")
+		}
+		if cfg.Model == "" {
+			cfg.Model = defaultOpenAIModel
+		}
+		return NewOpenAI(cfg.APIKey, cfg.BaseURL), nil
+	case "azure":
+		if cfg.APIKey == "" {
+			cfg.APIKey = os.Getenv("AZURE_OPENAI_API_KEY")
+		}
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("AZURE_OPENAI_API_KEY is not set")
+		}
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = os.Getenv("AZURE_OPENAI_ENDPOINT")
+		}
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("no Azure OpenAI endpoint: set AZURE_OPENAI_ENDPOINT or base_url")
+		}
+		if cfg.APIVersion == "" {
+			cfg.APIVersion = os.Getenv("AZURE_OPENAI_API_VERSION")
+		}
+		if cfg.Model == "" {
+			cfg.Model = defaultOpenAIModel
+		}
+		return NewAzureOpenAI(cfg.APIKey, cfg.BaseURL, cfg.APIVersion, cfg.Deployments), nil
+	case "anthropic":
+		if cfg.APIKey == "" {
+			cfg.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+		}
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY is not set")
+		}
+		if cfg.Model == "" {
+			cfg.Model = defaultAnthropicModel
+		}
+		return NewAnthropic(cfg.APIKey, cfg.BaseURL), nil
+	case "gemini":
+		if cfg.APIKey == "" {
+			cfg.APIKey = os.Getenv("GEMINI_API_KEY")
+		}
+		if cfg.APIKey == "" {
+			cfg.APIKey = os.Getenv("GOOGLE_API_KEY")
+		}
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is not set")
+		}
+		if cfg.Model == "" {
+			cfg.Model = defaultGeminiModel
+		}
+		return NewGemini(cfg.APIKey, cfg.BaseURL, cfg.SafetySettings), nil
+	case "ollama":
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = os.Getenv("OLLAMA_HOST")
+		}
+		if cfg.Model == "" {
+			cfg.Model = defaultOllamaModel
+		}
+		return NewOllama(cfg.BaseURL), nil
+	}
+	return nil, fmt.Errorf("unknown LLM provider %q (expected openai, azure, anthropic, gemini or ollama)", cfg.Provider)
+}
+
+// estimateTokens approximates the token count of messages at about four
+// characters per token, for providers without a tokenizer at hand.
+func estimateTokens(messages []Message) int {
+	chars := 0
+	images := 0
+	for _, msg := range messages {
+		chars += len(msg.Content)
+		images += len(msg.Images)
+		for _, call := range msg.ToolCalls {
+			chars += len(call.Name) + len(call.Arguments)
+		}
+	}
+	// Every message also carries a few tokens of framing.
+	return chars/4 + 4*len(messages) + images*imageTokens
+}
@@ -0,0 +1,276 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultOllamaModel   = "llama3.1"
+	defaultOllamaBaseURL = "http://localhost:11434"
+)
+
+// Ollama talks to a local Ollama server. Models that support tool calling,
+// such as llama3.1 and qwen2.5-coder, are sent the tools; for models that
+// do not, the tools are described in the prompt and the calls read from the
+// reply text in the ReAct style.
+type Ollama struct {
+	baseURL string
+	client  *http.Client
+
+	mu sync.Mutex
+	// textTools are the models found not to support tool calling.
+	textTools map[string]bool
+}
+
+// NewOllama returns an Ollama provider for the server at baseURL, or the
+// default local address when empty.
+func NewOllama(baseURL string) *Ollama {
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return &Ollama{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		client:    http.DefaultClient,
+		textTools: map[string]bool{},
+	}
+}
+
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Tools    []ollamaTool           `json:"tools,omitempty"`
+	Stream   bool                   `json:"stream"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string      `json:"name"`
+		Description string      `json:"description"`
+		Parameters  interface{} `json:"parameters"`
+	} `json:"function"`
+}
+
+// ollamaChunk is a complete response, or one line of a streamed one.
+type ollamaChunk struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (p *Ollama) Chat(ctx context.Context, req Request) (*Response, error) {
+	return p.chat(ctx, req, false, nil)
+}
+
+func (p *Ollama) ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error) {
+	return p.chat(ctx, req, true, onText)
+}
+
+func (p *Ollama) CountTokens(messages []Message) int {
+	return estimateTokens(messages)
+}
+
+// chat sends req with its tools, or falls back to ReAct prompting when the
+// model turns out not to support them.
+func (p *Ollama) chat(ctx context.Context, req Request, stream bool, onText func(string)) (*Response, error) {
+	if len(req.Tools) == 0 {
+		return p.send(ctx, p.request(req, stream), onText)
+	}
+	p.mu.Lock()
+	textTools := p.textTools[req.Model]
+	p.mu.Unlock()
+	if !textTools {
+		resp, err := p.send(ctx, p.request(req, stream), onText)
+		var apiErr *APIError
+		if err == nil || !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "does not support tools") {
+			return resp, err
+		}
+		p.mu.Lock()
+		p.textTools[req.Model] = true
+		p.mu.Unlock()
+	}
+
+	var filter *reactFilter
+	if onText != nil {
+		filter = &reactFilter{onText: onText}
+		onText = filter.write
+	}
+	body := p.request(reactRequest(req), stream)
+	body.Options["stop"] = []string{reactStop}
+	resp, err := p.send(ctx, body, onText)
+	if err != nil {
+		return nil, err
+	}
+	if filter != nil {
+		filter.flush()
+	}
+	resp.Message.Content, resp.Message.ToolCalls = parseReAct(resp.Message.Content)
+	return resp, nil
+}
+
+// send sends the request and reads the reply, which is a single JSON object
+// or, when streaming, one JSON object per line.
+func (p *Ollama) send(ctx context.Context, body ollamaRequest, onText func(string)) (*Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Ollama request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Ollama at %s (is `ollama serve` running?): %w", p.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		message := strings.TrimSpace(string(data))
+		var chunk ollamaChunk
+		if json.Unmarshal(data, &chunk) == nil && chunk.Error != "" {
+			message = chunk.Error
+		}
+		return nil, &APIError{Provider: "Ollama", StatusCode: resp.StatusCode, Message: message, RetryAfter: retryAfter(resp.Header)}
+	}
+
+	message := Message{Role: RoleAssistant}
+	usage := Usage{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChunk
+		err := json.Unmarshal(line, &chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Ollama response: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("Ollama error: %s", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			message.Content += chunk.Message.Content
+			if onText != nil {
+				onText(chunk.Message.Content)
+			}
+		}
+		// Ollama does not assign IDs to tool calls, so they are numbered.
+		for _, call := range chunk.Message.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:        fmt.Sprintf("call_%d", len(message.ToolCalls)),
+				Name:      call.Function.Name,
+				Arguments: string(call.Function.Arguments),
+			})
+		}
+		if chunk.Done {
+			usage = Usage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Ollama response: %w", err)
+	}
+	return &Response{Message: message, Usage: usage}, nil
+}
+
+func (p *Ollama) request(req Request, stream bool) ollamaRequest {
+	out := ollamaRequest{Model: req.Model, Stream: stream}
+	// Ollama cuts prompts down to a small context of its own unless told
+	// how much the model takes, which the context manager assumes.
+	out.Options = map[string]interface{}{"num_ctx": ContextWindow(req.Model)}
+	if req.MaxTokens > 0 {
+		out.Options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		out.Options["temperature"] = *req.Temperature
+	}
+	for _, msg := range req.Messages {
+		message := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		for _, image := range msg.Images {
+			message.Images = append(message.Images, image.Base64())
+		}
+		for _, call := range msg.ToolCalls {
+			var toolCall ollamaToolCall
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = json.RawMessage(call.Arguments)
+			if !json.Valid(toolCall.Function.Arguments) {
+				toolCall.Function.Arguments = json.RawMessage("{}")
+			}
+			message.ToolCalls = append(message.ToolCalls, toolCall)
+		}
+		out.Messages = append(out.Messages, message)
+	}
+	for _, tool := range req.Tools {
+		var t ollamaTool
+		t.Type = "function"
+		t.Function.Name = tool.Name
+		t.Function.Description = tool.Description
+		t.Function.Parameters = tool.Parameters
+		out.Tools = append(out.Tools, t)
+	}
+	return out
+}
+
+// ListModels returns the models pulled to the Ollama server.
+func (p *Ollama) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Ollama at %s (is `ollama serve` running?): %w", p.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Provider: "Ollama", StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode Ollama response: %w", err)
+	}
+	var models []string
+	for _, model := range tags.Models {
+		models = append(models, model.Name)
+	}
+	return models, nil
+}
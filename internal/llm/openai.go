@@ -0,0 +1,257 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultOpenAIModel = openai.GPT3Dot5Turbo
+
+// OpenAI talks to the OpenAI chat completions API, or any server compatible
+// with it.
+type OpenAI struct {
+	client *openai.Client
+}
+
+// NewOpenAI returns an OpenAI provider. An empty baseURL uses the official
+// API.
+func NewOpenAI(apiKey, baseURL string) *OpenAI {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	return &OpenAI{client: openai.NewClientWithConfig(config)}
+}
+
+// defaultAzureAPIVersion is the Azure OpenAI API version used when none is
+// configured; it is the first stable version that reports the usage of
+// streamed replies.
+const defaultAzureAPIVersion = "2024-10-21"
+
+// NewAzureOpenAI returns a provider for an Azure OpenAI resource at
+// endpoint, such as https://my-resource.openai.azure.com. Azure serves
+// models from deployments named by the user: deployments maps model names
+// to them, and models not in it are looked up under the name Azure gives
+// the model's deployments by default, e.g. gpt-35-turbo for gpt-3.5-turbo.
+func NewAzureOpenAI(apiKey, endpoint, apiVersion string, deployments map[string]string) *OpenAI {
+	config := openai.DefaultAzureConfig(apiKey, endpoint)
+	if apiVersion != "" {
+		config.APIVersion = apiVersion
+	} else {
+		config.APIVersion = defaultAzureAPIVersion
+	}
+	defaultDeployment := config.AzureModelMapperFunc
+	config.AzureModelMapperFunc = func(model string) string {
+		if deployment, ok := deployments[model]; ok {
+			return deployment
+		}
+		return defaultDeployment(model)
+	}
+	return &OpenAI{client: openai.NewClientWithConfig(config)}
+}
+
+func (p *OpenAI) Chat(ctx context.Context, req Request) (*Response, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.request(req))
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("model returned no choices")
+	}
+	message := resp.Choices[0].Message
+	return &Response{
+		Message: Message{
+			Role:      RoleAssistant,
+			Content:   message.Content,
+			ToolCalls: fromOpenAIToolCalls(message.ToolCalls),
+		},
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+		},
+	}, nil
+}
+
+func (p *OpenAI) ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error) {
+	request := p.request(req)
+	request.Stream = true
+	// The usage comes in a final chunk without choices.
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	defer stream.Close()
+
+	// Tool calls arrive in fragments keyed by index and are assembled until
+	// the stream ends.
+	var content strings.Builder
+	var toolCalls []ToolCall
+	var usage *openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, p.wrapError(err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			if onText != nil {
+				onText(delta.Content)
+			}
+		}
+
+		for _, part := range delta.ToolCalls {
+			index := len(toolCalls) - 1
+			if part.Index != nil {
+				index = *part.Index
+			} else if part.ID != "" {
+				index = len(toolCalls)
+			}
+			for len(toolCalls) <= index {
+				toolCalls = append(toolCalls, ToolCall{})
+			}
+			call := &toolCalls[index]
+			if part.ID != "" {
+				call.ID = part.ID
+			}
+			call.Name += part.Function.Name
+			call.Arguments += part.Function.Arguments
+		}
+	}
+
+	message := Message{Role: RoleAssistant, Content: content.String(), ToolCalls: toolCalls}
+	if usage == nil {
+		// Servers that ignore stream_options send no usage, so it is
+		// estimated.
+		return &Response{
+			Message: message,
+			Usage: Usage{
+				PromptTokens:     p.CountTokens(req.Messages),
+				CompletionTokens: p.CountTokens([]Message{message}),
+			},
+		}, nil
+	}
+	return &Response{
+		Message: message,
+		Usage:   Usage{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens},
+	}, nil
+}
+
+func (p *OpenAI) CountTokens(messages []Message) int {
+	return countTiktoken(messages)
+}
+
+func (p *OpenAI) request(req Request) openai.ChatCompletionRequest {
+	var messages []openai.ChatCompletionMessage
+	for _, msg := range req.Messages {
+		message := openai.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		if len(msg.Images) > 0 {
+			// Images make the content a list of parts.
+			message.Content = ""
+			message.MultiContent = []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: msg.Content}}
+			for _, image := range msg.Images {
+				message.MultiContent = append(message.MultiContent, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: image.DataURL()},
+				})
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   call.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+		messages = append(messages, message)
+	}
+
+	var tools []openai.Tool
+	for _, tool := range req.Tools {
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		Messages:  messages,
+		Tools:     tools,
+	}
+	if req.Temperature != nil {
+		request.Temperature = float32(*req.Temperature)
+	}
+	return request
+}
+
+// ListModels returns the models the API key can use.
+func (p *OpenAI) ListModels(ctx context.Context) ([]string, error) {
+	list, err := p.client.ListModels(ctx)
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	var models []string
+	for _, model := range list.Models {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+// wrapError turns error responses into an *APIError, marking oversized
+// requests with ErrContextLength.
+func (p *OpenAI) wrapError(err error) error {
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return &APIError{Provider: "OpenAI", StatusCode: requestErr.HTTPStatusCode, Message: requestErr.Error(), Err: err}
+	}
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	code, _ := apiErr.Code.(string)
+	if code == "context_length_exceeded" || strings.Contains(apiErr.Message, "maximum context length") {
+		return fmt.Errorf("%w: %w", ErrContextLength, err)
+	}
+	return &APIError{Provider: "OpenAI", StatusCode: apiErr.HTTPStatusCode, Message: apiErr.Message, Err: err}
+}
+
+func fromOpenAIToolCalls(calls []openai.ToolCall) []ToolCall {
+	var toolCalls []ToolCall
+	for _, call := range calls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return toolCalls
+}
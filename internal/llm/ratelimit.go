@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimitedProvider spaces out the requests of a Provider so that no more
+// than perMinute are sent in any minute.
+type rateLimitedProvider struct {
+	Provider
+	perMinute int
+	onWait    func(wait time.Duration)
+
+	mu   sync.Mutex
+	sent []time.Time
+}
+
+// WithRateLimit wraps provider so that it sends at most perMinute requests
+// in any minute, holding back the ones above the limit rather than letting
+// the API reject them. onWait, when set, is called before each wait. A
+// perMinute of zero or less leaves provider as it is.
+func WithRateLimit(provider Provider, perMinute int, onWait func(wait time.Duration)) Provider {
+	if perMinute <= 0 {
+		return provider
+	}
+	return &rateLimitedProvider{Provider: provider, perMinute: perMinute, onWait: onWait}
+}
+
+// wait blocks until a request may be sent and records it as sent.
+func (p *rateLimitedProvider) wait(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		for len(p.sent) > 0 && now.Sub(p.sent[0]) >= time.Minute {
+			p.sent = p.sent[1:]
+		}
+		if len(p.sent) < p.perMinute {
+			p.sent = append(p.sent, now)
+			p.mu.Unlock()
+			return nil
+		}
+		wait := p.sent[0].Add(time.Minute).Sub(now)
+		p.mu.Unlock()
+
+		if p.onWait != nil {
+			p.onWait(wait)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *rateLimitedProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.Provider.Chat(ctx, req)
+}
+
+func (p *rateLimitedProvider) ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.Provider.ChatStream(ctx, req, onText)
+}
+
+func (p *rateLimitedProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	embedder, ok := p.Provider.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("the provider has no embeddings endpoint")
+	}
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return embedder.Embed(ctx, model, texts)
+}
+
+func (p *rateLimitedProvider) unwrap() Provider {
+	return p.Provider
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// reactStop ends the model's reply where the tool's result would start,
+// so it does not make one up.
+const reactStop = "Observation:"
+
+// reactInstructions teach a model without native tool calling to ask for
+// tools in its reply text, in the ReAct style.
+const reactInstructions = `You can use the tools listed below. To use one, end your reply with exactly these two lines and nothing after them:
+Action: <the tool's name>
+Action Input: <the tool's arguments as a JSON object on one line>
+The tool's result comes back in a message starting with "Observation:". Use one tool at a time and wait for its result. When you need no more tools, reply normally, without an Action line.
+
+Tools:
+`
+
+// actionPattern matches the "Action:" and "Action Input:" lines of a ReAct
+// tool call, capturing the tool's name.
+var actionPattern = regexp.MustCompile("(?m)^[ \t]*Action:[ \t]*(.+?)[ \t]*\n+[ \t]*Action Input:[ \t]*")
+
+// reactRequest rewrites req for a model that cannot be sent tools: the tools
+// are described in the system prompt, earlier tool calls are written as
+// Action lines and their results as Observation messages.
+func reactRequest(req Request) Request {
+	var sb strings.Builder
+	sb.WriteString(reactInstructions)
+	for _, tool := range req.Tools {
+		schema, _ := json.Marshal(tool.Parameters)
+		fmt.Fprintf(&sb, "- %s: %s\n  Arguments (JSON schema): %s\n", tool.Name, strings.TrimSpace(tool.Description), schema)
+	}
+	instructions := sb.String()
+
+	out := req
+	out.Tools = nil
+	out.Messages = nil
+	if len(req.Messages) == 0 || req.Messages[0].Role != RoleSystem {
+		out.Messages = append(out.Messages, Message{Role: RoleSystem, Content: instructions})
+	}
+	for i, msg := range req.Messages {
+		switch {
+		case i == 0 && msg.Role == RoleSystem:
+			msg.Content += "\n\n" + instructions
+		case msg.Role == RoleTool:
+			msg = Message{Role: RoleUser, Content: reactStop + " " + msg.Content}
+		case len(msg.ToolCalls) > 0:
+			var content strings.Builder
+			if msg.Content != "" {
+				content.WriteString(msg.Content + "\n")
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&content, "Action: %s\nAction Input: %s\n", call.Name, call.Arguments)
+			}
+			msg = Message{Role: RoleAssistant, Content: strings.TrimSuffix(content.String(), "\n")}
+		}
+		out.Messages = append(out.Messages, msg)
+	}
+	return out
+}
+
+// parseReAct splits a ReAct reply into its text and the tool calls written
+// at its end. Arguments that are not valid JSON are passed on as written,
+// so that the tool's error tells the model what went wrong.
+func parseReAct(content string) (string, []ToolCall) {
+	matches := actionPattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content, nil
+	}
+	var calls []ToolCall
+	for i, m := range matches {
+		end := len(content)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		arguments := strings.TrimSpace(content[m[1]:end])
+		arguments = strings.TrimPrefix(arguments, "```json")
+		arguments = strings.TrimSpace(strings.Trim(arguments, "`"))
+		var object map[string]interface{}
+		if json.NewDecoder(strings.NewReader(arguments)).Decode(&object) == nil {
+			encoded, _ := json.Marshal(object)
+			arguments = string(encoded)
+		}
+		calls = append(calls, ToolCall{
+			ID:        fmt.Sprintf("call_%d", i),
+			Name:      strings.Trim(content[m[2]:m[3]], "`\"' "),
+			Arguments: arguments,
+		})
+	}
+	return strings.TrimSpace(content[:matches[0][0]]), calls
+}
+
+// reactFilter passes streamed reply text on, holding back each line until
+// it is clear it does not start an Action, and showing nothing from the
+// first Action on: the calls are shown as tool calls instead.
+type reactFilter struct {
+	onText func(string)
+	line   string
+	action bool
+}
+
+func (f *reactFilter) write(text string) {
+	for text != "" && !f.action {
+		piece := text
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			piece = text[:i+1]
+		}
+		text = text[len(piece):]
+		f.line += piece
+
+		start := strings.TrimLeft(f.line, " \t")
+		if strings.HasPrefix(start, "Action:") {
+			f.action = true
+			return
+		}
+		if strings.HasPrefix("Action:", start) && !strings.HasSuffix(f.line, "\n") {
+			continue
+		}
+		f.onText(f.line)
+		f.line = ""
+	}
+}
+
+// flush passes on the rest of the last line, if it was not an Action.
+func (f *reactFilter) flush() {
+	if !f.action && f.line != "" {
+		f.onText(f.line)
+	}
+	f.line = ""
+}
@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+// redactingProvider masks credentials in everything sent to a Provider.
+type redactingProvider struct {
+	Provider
+	mask func(string) string
+}
+
+// WithRedaction wraps provider so that the messages, tool call arguments
+// and texts to embed it is sent first go through mask, which replaces the
+// credentials in them.
+func WithRedaction(provider Provider, mask func(string) string) Provider {
+	return &redactingProvider{Provider: provider, mask: mask}
+}
+
+// request returns a copy of req with its messages masked.
+func (p *redactingProvider) request(req Request) Request {
+	messages := make([]Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		msg.Content = p.mask(msg.Content)
+		if len(msg.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(msg.ToolCalls))
+			for j, call := range msg.ToolCalls {
+				call.Arguments = p.mask(call.Arguments)
+				calls[j] = call
+			}
+			msg.ToolCalls = calls
+		}
+		messages[i] = msg
+	}
+	req.Messages = messages
+	return req
+}
+
+func (p *redactingProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	return p.Provider.Chat(ctx, p.request(req))
+}
+
+func (p *redactingProvider) ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error) {
+	return p.Provider.ChatStream(ctx, p.request(req), onText)
+}
+
+func (p *redactingProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	embedder, ok := p.Provider.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("the provider has no embeddings endpoint")
+	}
+	masked := make([]string, len(texts))
+	for i, text := range texts {
+		masked[i] = p.mask(text)
+	}
+	return embedder.Embed(ctx, model, masked)
+}
+
+func (p *redactingProvider) unwrap() Provider {
+	return p.Provider
+}
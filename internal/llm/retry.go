@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIError is an error response from a model API.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	// RetryAfter is how long the API asked to wait before retrying, when
+	// it said so.
+	RetryAfter time.Duration
+	// Err is the underlying error, when the provider's client returned one.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s API error: %s", e.Provider, e.Message)
+	}
+	return fmt.Sprintf("%s API returned status %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// retryAfter parses a Retry-After header given in seconds.
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// RetryPolicy says how often and how patiently failed requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, the first included. One
+	// disables retrying.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry; it doubles with
+	// each further retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter randomizes each wait by up to this fraction of it, so that
+	// clients rate limited together do not retry together.
+	Jitter float64
+}
+
+// DefaultRetryPolicy retries a failed request four times over about 15
+// seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
+// backoff returns the wait before retry number n, counting from 1.
+func (p RetryPolicy) backoff(n int, err error) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < n && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(wait))
+	}
+	// The API's own estimate wins when it asks for longer.
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+		wait = apiErr.RetryAfter
+	}
+	return wait
+}
+
+// IsRetryable reports whether a request that failed with err may succeed
+// when sent again: rate limits, overloaded or failing servers and dropped
+// connections. Authentication failures, invalid requests and cancellation
+// are final.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrContextLength) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+			return true
+		case 529: // Anthropic: overloaded
+			return true
+		}
+		return apiErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryingProvider retries the requests of a Provider that fail with a
+// retryable error.
+type retryingProvider struct {
+	Provider
+	policy  RetryPolicy
+	onRetry func(attempt int, wait time.Duration, err error)
+}
+
+// WithRetry wraps provider so that requests failing with a retryable error
+// are sent again according to policy. onRetry, when set, is called before
+// each wait with the number of the failed attempt, so the user can be told
+// what is going on.
+func WithRetry(provider Provider, policy RetryPolicy, onRetry func(attempt int, wait time.Duration, err error)) Provider {
+	if policy.MaxAttempts <= 1 {
+		return provider
+	}
+	return &retryingProvider{Provider: provider, policy: policy, onRetry: onRetry}
+}
+
+func (p *retryingProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	return retry(ctx, p, func() (*Response, error) {
+		return p.Provider.Chat(ctx, req)
+	}, nil)
+}
+
+func (p *retryingProvider) ChatStream(ctx context.Context, req Request, onText func(string)) (*Response, error) {
+	// Once text has been shown, a retry would show it twice, so only
+	// failures before the first piece of text are retried.
+	streamed := false
+	return retry(ctx, p, func() (*Response, error) {
+		return p.Provider.ChatStream(ctx, req, func(text string) {
+			streamed = true
+			if onText != nil {
+				onText(text)
+			}
+		})
+	}, &streamed)
+}
+
+// retry calls send until it succeeds or fails for good, following p's
+// policy. When streamed is set, a failure after text was streamed is final.
+func retry[T any](ctx context.Context, p *retryingProvider, send func() (T, error), streamed *bool) (T, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+		if err == nil || attempt >= p.policy.MaxAttempts || !IsRetryable(err) || (streamed != nil && *streamed) {
+			return resp, err
+		}
+
+		wait := p.policy.backoff(attempt, err)
+		if p.onRetry != nil {
+			p.onRetry(attempt, wait, err)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			var zero T
+			return zero, err
+		}
+	}
+}
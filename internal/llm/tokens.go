@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// contextWindows lists the context window of known models by name prefix;
+// the first match wins.
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4.1", 1000000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"o1", 128000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+	{"gemini-1.5-pro", 2097152},
+	{"gemini", 1048576},
+	{"llama3", 8192},
+	{"qwen", 32768},
+}
+
+// defaultContextWindow is assumed for models not in contextWindows.
+const defaultContextWindow = 8192
+
+// ContextWindow returns how many tokens model accepts in one request.
+func ContextWindow(model string) int {
+	model = strings.ToLower(model)
+	for _, w := range contextWindows {
+		if strings.HasPrefix(model, w.prefix) {
+			return w.tokens
+		}
+	}
+	return defaultContextWindow
+}
+
+var (
+	encodingOnce sync.Once
+	encoding     *tiktoken.Tiktoken
+)
+
+// countTiktoken counts tokens with OpenAI's cl100k_base encoding, following
+// OpenAI's accounting of per-message overhead. The encoding is downloaded
+// and cached on first use; when it is unavailable the count is estimated.
+func countTiktoken(messages []Message) int {
+	encodingOnce.Do(func() {
+		encoding, _ = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE)
+	})
+	if encoding == nil {
+		return estimateTokens(messages)
+	}
+
+	count := func(text string) int {
+		return len(encoding.EncodeOrdinary(text))
+	}
+	tokens := 3 // every reply is primed with <|start|>assistant<|message|>
+	for _, msg := range messages {
+		tokens += 3 + count(msg.Role) + count(msg.Content) + len(msg.Images)*imageTokens
+		for _, call := range msg.ToolCalls {
+			tokens += 3 + count(call.Name) + count(call.Arguments)
+		}
+	}
+	return tokens
+}
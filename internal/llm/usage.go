@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// modelPrices lists what known models cost in dollars per million prompt
+// and completion tokens, by name prefix; the first match wins, so more
+// specific prefixes come first.
+var modelPrices = []struct {
+	prefix     string
+	prompt     float64
+	completion float64
+}{
+	{"gpt-4o-mini", 0.15, 0.60},
+	{"gpt-4o", 2.50, 10.00},
+	{"gpt-4.1-nano", 0.10, 0.40},
+	{"gpt-4.1-mini", 0.40, 1.60},
+	{"gpt-4.1", 2.00, 8.00},
+	{"gpt-4-turbo", 10.00, 30.00},
+	{"gpt-4", 30.00, 60.00},
+	{"gpt-3.5-turbo", 0.50, 1.50},
+	{"o1-mini", 1.10, 4.40},
+	{"o1", 15.00, 60.00},
+	{"o3-mini", 1.10, 4.40},
+	{"o3", 2.00, 8.00},
+	{"o4-mini", 1.10, 4.40},
+	{"claude-3-haiku", 0.25, 1.25},
+	{"claude-3-5-haiku", 0.80, 4.00},
+	{"claude-haiku", 1.00, 5.00},
+	{"claude-3-5-sonnet", 3.00, 15.00},
+	{"claude-3-7-sonnet", 3.00, 15.00},
+	{"claude-sonnet", 3.00, 15.00},
+	{"claude-3-opus", 15.00, 75.00},
+	{"claude-opus-4-5", 5.00, 25.00},
+	{"claude-opus", 15.00, 75.00},
+	{"gemini-2.5-pro", 1.25, 10.00},
+	{"gemini-2.5-flash-lite", 0.10, 0.40},
+	{"gemini-2.5-flash", 0.30, 2.50},
+	{"gemini-2.0-flash", 0.10, 0.40},
+	{"gemini-1.5-pro", 1.25, 5.00},
+	{"gemini-1.5-flash", 0.075, 0.30},
+}
+
+// Cost returns the price in dollars of usage on model. It reports false for
+// models without a known price, such as local Ollama models.
+func Cost(model string, usage Usage) (float64, bool) {
+	model = strings.ToLower(model)
+	for _, p := range modelPrices {
+		if strings.HasPrefix(model, p.prefix) {
+			return (float64(usage.PromptTokens)*p.prompt + float64(usage.CompletionTokens)*p.completion) / 1e6, true
+		}
+	}
+	return 0, false
+}
+
+// UsageTotal adds up the usage of several requests.
+type UsageTotal struct {
+	Requests int `json:"requests"`
+	Usage
+	// Cost is the price in dollars of the requests to models with a known
+	// price.
+	Cost float64 `json:"cost"`
+	// Unpriced counts the requests left out of Cost.
+	Unpriced int `json:"unpriced,omitempty"`
+}
+
+func (t *UsageTotal) add(model string, usage Usage) {
+	t.Requests++
+	t.PromptTokens += usage.PromptTokens
+	t.CompletionTokens += usage.CompletionTokens
+	if cost, ok := Cost(model, usage); ok {
+		t.Cost += cost
+	} else {
+		t.Unpriced++
+	}
+}
+
+// Tokens is the number of prompt and completion tokens together.
+func (t UsageTotal) Tokens() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+func (t UsageTotal) String() string {
+	s := fmt.Sprintf("%d request(s), %d prompt + %d completion tokens",
+		t.Requests, t.PromptTokens, t.CompletionTokens)
+	switch {
+	case t.Unpriced == 0:
+		s += fmt.Sprintf(", $%.4f", t.Cost)
+	case t.Unpriced < t.Requests:
+		s += fmt.Sprintf(", $%.4f (%d request(s) to models without a known price not included)", t.Cost, t.Unpriced)
+	}
+	return s
+}
+
+// UsageTracker accumulates token usage and cost over a session and over
+// the current turn, which ends when the agent hands control back to the
+// user.
+type UsageTracker struct {
+	mu      sync.Mutex
+	session UsageTotal
+	turn    UsageTotal
+}
+
+// Add records the usage of a request to model.
+func (t *UsageTracker) Add(model string, usage Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session.add(model, usage)
+	t.turn.add(model, usage)
+}
+
+// AddTotal records usage added up elsewhere, such as by a sub-task's own
+// tracker.
+func (t *UsageTracker) AddTotal(total UsageTotal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, sum := range []*UsageTotal{&t.session, &t.turn} {
+		sum.Requests += total.Requests
+		sum.PromptTokens += total.PromptTokens
+		sum.CompletionTokens += total.CompletionTokens
+		sum.Cost += total.Cost
+		sum.Unpriced += total.Unpriced
+	}
+}
+
+// Session returns the usage of the whole session so far.
+func (t *UsageTracker) Session() UsageTotal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session
+}
+
+// EndTurn returns the usage of the current turn and starts a new one.
+func (t *UsageTracker) EndTurn() UsageTotal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	turn := t.turn
+	t.turn = UsageTotal{}
+	return turn
+}
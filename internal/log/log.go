@@ -0,0 +1,118 @@
+// Package log writes structured logs of the agent's requests, responses and
+// tool calls as JSON lines, one file per session, so that what happened in
+// a session can be looked into after the fact.
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxFileSize is the size at which a session's log continues in a new
+	// file.
+	maxFileSize = 10 << 20
+	// maxFiles is how many log files are kept; the oldest go first.
+	maxFiles = 20
+)
+
+var logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+// Open starts logging to a new file in dir and returns a function that
+// closes it. Requests and tool calls are logged with their sizes and
+// timings; with verbose, also with the messages, arguments and output
+// themselves. Until Open is called nothing is logged.
+func Open(dir string, verbose bool) (func() error, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	w := &rotatingFile{dir: dir}
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	logger = slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})).
+		With("session", time.Now().Format("20060102-150405"), "pid", os.Getpid())
+	return w.Close, nil
+}
+
+// Verbose reports whether contents, not only sizes and timings, are logged.
+func Verbose() bool {
+	return logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+func Debug(msg string, args ...any) { logger.Debug(msg, args...) }
+func Info(msg string, args ...any)  { logger.Info(msg, args...) }
+func Warn(msg string, args ...any)  { logger.Warn(msg, args...) }
+func Error(msg string, args ...any) { logger.Error(msg, args...) }
+
+// rotatingFile writes to a log file, moving on to a new one when it grows
+// past maxFileSize.
+type rotatingFile struct {
+	dir string
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func (w *rotatingFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.size+int64(len(p)) > maxFileSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingFile) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// rotate opens a new file, named after the time so files sort by age, and
+// removes the oldest files beyond maxFiles.
+func (w *rotatingFile) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+	}
+	name := fmt.Sprintf("agent-%s.jsonl", time.Now().Format("20060102-150405.000"))
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	w.file, w.size = file, 0
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil
+	}
+	var logs []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "agent-") && strings.HasSuffix(entry.Name(), ".jsonl") {
+			logs = append(logs, entry.Name())
+		}
+	}
+	sort.Strings(logs)
+	for len(logs) > maxFiles {
+		os.Remove(filepath.Join(w.dir, logs[0]))
+		logs = logs[1:]
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// shutdownTimeout is how long a server gets to exit when asked to.
+	shutdownTimeout = 5 * time.Second
+	// diagnosticsSettle is how long the client waits for further
+	// diagnostics after a server has published some, as servers often
+	// publish the quick checks first and the full ones after.
+	diagnosticsSettle = 500 * time.Millisecond
+	// maxStderr bounds the end of the server's error output that is kept
+	// to explain a failure.
+	maxStderr = 4096
+)
+
+// Client talks to one running language server about the files under its
+// root directory.
+type Client struct {
+	name string
+	root string
+	cmd  *exec.Cmd
+	conn *conn
+	// languageID names the language of a file for the server.
+	languageID func(path string) string
+	stderr     *tailBuffer
+
+	syncMu sync.Mutex
+	mu     sync.Mutex
+	// documents are the files opened on the server, by absolute path.
+	documents map[string]*document
+	// changed are files changed on disk that the server has not opened.
+	changed     map[string]int
+	diagnostics map[string]*published
+	// published is closed and replaced whenever diagnostics arrive.
+	published chan struct{}
+}
+
+// document is a file the server has open, with the content it was sent.
+type document struct {
+	version int
+	text    string
+	// synced is when the content was last sent.
+	synced time.Time
+}
+
+// published are the diagnostics a server last published for a file.
+type published struct {
+	items []Diagnostic
+	at    time.Time
+}
+
+// Start launches command as the language server of the files under root
+// and initializes it. languageID names the language of a file for it.
+func Start(ctx context.Context, command []string, root string, languageID func(path string) string) (*Client, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		name:        filepath.Base(command[0]),
+		root:        root,
+		languageID:  languageID,
+		stderr:      &tailBuffer{},
+		documents:   map[string]*document{},
+		changed:     map[string]int{},
+		diagnostics: map[string]*published{},
+		published:   make(chan struct{}),
+	}
+
+	c.cmd = exec.Command(command[0], command[1:]...)
+	c.cmd.Dir = root
+	c.cmd.Stderr = c.stderr
+	stdin, err := c.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := c.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", c.name, err)
+	}
+	c.conn = newConn(stdout, stdin, c.handle)
+
+	uri := FileURI(root)
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   uri,
+		"rootPath":  root,
+		"workspaceFolders": []map[string]string{
+			{"uri": uri, "name": filepath.Base(root)},
+		},
+		"clientInfo": map[string]string{"name": "code-editing-agent"},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"synchronization":    map[string]bool{"didSave": false},
+				"hover":              map[string]interface{}{"contentFormat": []string{"markdown", "plaintext"}},
+				"definition":         map[string]bool{"linkSupport": true},
+				"references":         map[string]interface{}{},
+				"publishDiagnostics": map[string]bool{"versionSupport": true},
+			},
+			"workspace": map[string]interface{}{
+				"workspaceFolders":      true,
+				"configuration":         true,
+				"didChangeWatchedFiles": map[string]bool{"dynamicRegistration": false},
+			},
+		},
+	}
+	err = c.conn.call(ctx, "initialize", params, nil)
+	if err == nil {
+		err = c.conn.notify("initialized", struct{}{})
+	}
+	if err != nil {
+		c.kill()
+		c.cmd.Wait()
+		return nil, c.failure(err)
+	}
+	return c, nil
+}
+
+// Name is the name of the server's executable.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// handle answers what the server sends on its own: diagnostics are kept,
+// and requests get empty answers, which servers take as defaults.
+func (c *Client) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "textDocument/publishDiagnostics":
+		var p publishDiagnosticsParams
+		if json.Unmarshal(params, &p) != nil {
+			return nil, nil
+		}
+		path, err := URIPath(p.URI)
+		if err != nil {
+			return nil, nil
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if doc := c.documents[path]; doc != nil && p.Version != nil && *p.Version < doc.version {
+			// Diagnostics of content that has changed since.
+			return nil, nil
+		}
+		c.diagnostics[path] = &published{items: p.Diagnostics, at: time.Now()}
+		close(c.published)
+		c.published = make(chan struct{})
+		return nil, nil
+	case "workspace/configuration":
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(params, &p)
+		return make([]interface{}, len(p.Items)), nil
+	case "workspace/workspaceFolders":
+		return []map[string]string{{"uri": FileURI(c.root), "name": filepath.Base(c.root)}}, nil
+	}
+	return nil, nil
+}
+
+// Changed tells the server a file under its root changed on disk, before
+// its next request.
+func (c *Client) Changed(path string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, open := c.documents[abs]; !open {
+		c.changed[abs] = fileChanged
+		if _, err := os.Stat(abs); os.IsNotExist(err) {
+			c.changed[abs] = fileDeleted
+		}
+	}
+}
+
+// sync sends the server the current content of path, opening it if it is
+// not open yet, along with the files changed since the last request.
+func (c *Client) sync(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+	text := validUTF8(string(content))
+	uri := FileURI(abs)
+
+	// Requests are sent in the order their files were synced. The state
+	// lock is not held while writing, as the server may be waiting for
+	// its own messages to be read.
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	c.mu.Lock()
+	changed := c.changed
+	c.changed = map[string]int{}
+	doc := c.documents[abs]
+	opened := doc == nil
+	if opened {
+		doc = &document{}
+		c.documents[abs] = doc
+	}
+	edited := doc.text != text
+	if opened || edited {
+		doc.version++
+		doc.text = text
+		doc.synced = time.Now()
+	}
+	version := doc.version
+	c.mu.Unlock()
+
+	if len(changed) > 0 {
+		var events []fileEvent
+		for path, kind := range changed {
+			events = append(events, fileEvent{URI: FileURI(path), Type: kind})
+		}
+		if err := c.conn.notify("workspace/didChangeWatchedFiles", map[string]interface{}{"changes": events}); err != nil {
+			return "", err
+		}
+	}
+	switch {
+	case opened:
+		err = c.conn.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": textDocumentItem{URI: uri, LanguageID: c.languageID(abs), Version: version, Text: text},
+		})
+	case edited:
+		err = c.conn.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+			"contentChanges": []map[string]string{{"text": text}},
+		})
+	}
+	return uri, err
+}
+
+// Definition returns where the symbol at pos in path is defined.
+func (c *Client) Definition(ctx context.Context, path string, pos Position) ([]Location, error) {
+	uri, err := c.sync(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	err = c.conn.call(ctx, "textDocument/definition", textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri},
+		Position:     pos,
+	}, &raw)
+	if err != nil {
+		return nil, c.failure(err)
+	}
+	return parseLocations(raw)
+}
+
+// References returns where the symbol at pos in path is used, with its
+// declaration when includeDeclaration is set.
+func (c *Client) References(ctx context.Context, path string, pos Position, includeDeclaration bool) ([]Location, error) {
+	uri, err := c.sync(path)
+	if err != nil {
+		return nil, err
+	}
+	params := referenceParams{}
+	params.TextDocument = textDocumentIdentifier{URI: uri}
+	params.Position = pos
+	params.Context.IncludeDeclaration = includeDeclaration
+	var raw json.RawMessage
+	if err := c.conn.call(ctx, "textDocument/references", params, &raw); err != nil {
+		return nil, c.failure(err)
+	}
+	return parseLocations(raw)
+}
+
+// Hover returns the documentation and type of the symbol at pos in path.
+func (c *Client) Hover(ctx context.Context, path string, pos Position) (string, error) {
+	uri, err := c.sync(path)
+	if err != nil {
+		return "", err
+	}
+	var raw json.RawMessage
+	err = c.conn.call(ctx, "textDocument/hover", textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri},
+		Position:     pos,
+	}, &raw)
+	if err != nil {
+		return "", c.failure(err)
+	}
+	return parseHover(raw)
+}
+
+// Diagnostics returns the server's errors and warnings for the current
+// content of path. Servers publish them on their own after a file opens or
+// changes, so this waits until they have, or ctx ends.
+func (c *Client) Diagnostics(ctx context.Context, path string) ([]Diagnostic, error) {
+	if _, err := c.sync(path); err != nil {
+		return nil, err
+	}
+	abs, _ := filepath.Abs(path)
+	for {
+		c.mu.Lock()
+		synced := c.documents[abs].synced
+		latest := c.diagnostics[abs]
+		next := c.published
+		c.mu.Unlock()
+
+		var settle <-chan time.Time
+		if latest != nil && latest.at.After(synced) {
+			if wait := diagnosticsSettle - time.Since(latest.at); wait > 0 {
+				settle = time.After(wait)
+			} else {
+				return latest.items, nil
+			}
+		}
+		select {
+		case <-next:
+		case <-settle:
+			return latest.items, nil
+		case <-c.conn.done:
+			return nil, c.failure(c.conn.err)
+		case <-ctx.Done():
+			if latest != nil {
+				// Diagnostics of earlier content are better than none.
+				return latest.items, nil
+			}
+			return nil, fmt.Errorf("%s published no diagnostics for %s in time", c.name, path)
+		}
+	}
+}
+
+// Close asks the server to exit, and kills it if it does not.
+func (c *Client) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if c.conn.call(ctx, "shutdown", nil, nil) == nil {
+		c.conn.notify("exit", nil)
+	}
+	exited := make(chan struct{})
+	go func() {
+		c.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		c.kill()
+	}
+}
+
+func (c *Client) kill() {
+	c.cmd.Process.Kill()
+}
+
+// failure adds what the server printed to an error talking to it.
+func (c *Client) failure(err error) error {
+	if output := strings.TrimSpace(c.stderr.String()); output != "" {
+		select {
+		case <-c.conn.done:
+			return fmt.Errorf("%s: %w\n%s", c.name, err, output)
+		default:
+		}
+	}
+	return fmt.Errorf("%s: %w", c.name, err)
+}
+
+// tailBuffer keeps the last maxStderr bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > maxStderr {
+		b.buf = bytes.Clone(b.buf[len(b.buf)-maxStderr:])
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
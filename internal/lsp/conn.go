@@ -0,0 +1,197 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// message is a JSON-RPC 2.0 request, notification or response.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// conn exchanges JSON-RPC messages with a server, each preceded by a
+// Content-Length header as LSP frames them.
+type conn struct {
+	w   io.Writer
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	// done is closed when the server's output ends, with err the reason.
+	done chan struct{}
+	err  error
+
+	// handle answers the server's notifications and requests; the result
+	// is sent back for requests.
+	handle func(method string, params json.RawMessage) (interface{}, error)
+}
+
+func newConn(r io.Reader, w io.Writer, handle func(string, json.RawMessage) (interface{}, error)) *conn {
+	c := &conn{
+		w:       w,
+		pending: map[int64]chan *message{},
+		done:    make(chan struct{}),
+		handle:  handle,
+	}
+	go c.read(bufio.NewReader(r))
+	return c
+}
+
+// call sends a request and decodes its result into result, which may be
+// nil. It gives up when ctx ends.
+func (c *conn) call(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	reply := make(chan *message, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(message{ID: json.RawMessage(strconv.FormatInt(id, 10)), Method: method}, params); err != nil {
+		return err
+	}
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %w", method, msg.Error)
+		}
+		if result == nil || len(msg.Result) == 0 {
+			return nil
+		}
+		if raw, ok := result.(*json.RawMessage); ok {
+			*raw = msg.Result
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-c.done:
+		return fmt.Errorf("%s: %w", method, c.err)
+	case <-ctx.Done():
+		// Tell the server it can stop working on it.
+		c.notify("$/cancelRequest", map[string]int64{"id": id})
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	return c.send(message{Method: method}, params)
+}
+
+func (c *conn) send(msg message, params interface{}) error {
+	msg.JSONRPC = "2.0"
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = raw
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return fmt.Errorf("failed to write to the language server: %w", err)
+	}
+	if _, err := c.w.Write(body); err != nil {
+		return fmt.Errorf("failed to write to the language server: %w", err)
+	}
+	return nil
+}
+
+// read dispatches the server's messages until its output ends.
+func (c *conn) read(r *bufio.Reader) {
+	headers := textproto.NewReader(r)
+	for {
+		header, err := headers.ReadMIMEHeader()
+		if err != nil {
+			c.close(fmt.Errorf("the language server stopped: %w", err))
+			return
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil || length < 0 {
+			c.close(fmt.Errorf("the language server sent a message without a valid Content-Length"))
+			return
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			c.close(fmt.Errorf("the language server stopped: %w", err))
+			return
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			continue
+		}
+		switch {
+		case msg.Method == "":
+			id, err := strconv.ParseInt(string(msg.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			reply := c.pending[id]
+			c.mu.Unlock()
+			if reply != nil {
+				reply <- &msg
+			}
+		case len(msg.ID) == 0:
+			c.handle(msg.Method, msg.Params)
+		default:
+			// Requests are answered on their own goroutine, so a slow one
+			// does not hold up the replies the client waits for.
+			go c.reply(msg)
+		}
+	}
+}
+
+func (c *conn) reply(request message) {
+	result, err := c.handle(request.Method, request.Params)
+	response := message{ID: request.ID}
+	if err != nil {
+		response.Error = &rpcError{Code: -32601, Message: err.Error()}
+	} else {
+		raw, _ := json.Marshal(result)
+		response.Result = raw
+	}
+	c.send(response, nil)
+}
+
+func (c *conn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		c.err = err
+		close(c.done)
+	}
+}
@@ -0,0 +1,182 @@
+// Package lsp runs language servers, such as gopls, pyright and the
+// TypeScript language server, and asks them about the workspace's code:
+// where symbols are defined and used, their documentation, and the errors
+// in a file. It speaks the parts of the Language Server Protocol over stdio
+// that this needs.
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Language is a language the agent knows a language server for.
+type Language struct {
+	Name       string
+	Extensions []string
+	// Command is the server, started in the workspace and spoken to on
+	// stdin and stdout.
+	Command []string
+}
+
+// Languages are the languages servers are started for, with their default
+// servers.
+var Languages = []Language{
+	{Name: "go", Extensions: []string{".go"}, Command: []string{"gopls"}},
+	{Name: "python", Extensions: []string{".py", ".pyi"}, Command: []string{"pyright-langserver", "--stdio"}},
+	{Name: "typescript", Extensions: []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"}, Command: []string{"typescript-language-server", "--stdio"}},
+	{Name: "rust", Extensions: []string{".rs"}, Command: []string{"rust-analyzer"}},
+}
+
+// languageIDs are the LSP language identifiers of file extensions whose
+// identifier is not their language's name.
+var languageIDs = map[string]string{
+	".tsx": "typescriptreact",
+	".js":  "javascript",
+	".jsx": "javascriptreact",
+	".mjs": "javascript",
+	".cjs": "javascript",
+}
+
+// Manager starts the server of a language the first time a file in it is
+// asked about and keeps it running for the session.
+type Manager struct {
+	root     string
+	commands map[string][]string
+
+	mu      sync.Mutex
+	clients map[string]*Client
+	// failed remembers servers that could not be started, so they are not
+	// tried again on every call.
+	failed map[string]error
+}
+
+// NewManager returns a manager for the files under root. servers maps
+// language names to the command of their server, replacing the default;
+// an empty command turns a language off.
+func NewManager(root string, servers map[string][]string) *Manager {
+	m := &Manager{
+		root:     root,
+		commands: map[string][]string{},
+		clients:  map[string]*Client{},
+		failed:   map[string]error{},
+	}
+	for _, language := range Languages {
+		m.commands[language.Name] = language.Command
+	}
+	for name, command := range servers {
+		m.commands[name] = command
+	}
+	return m
+}
+
+// languageOf returns the language of path, or nil.
+func languageOf(path string) *Language {
+	ext := strings.ToLower(filepath.Ext(path))
+	for i, language := range Languages {
+		for _, e := range language.Extensions {
+			if e == ext {
+				return &Languages[i]
+			}
+		}
+	}
+	return nil
+}
+
+func languageID(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if id, ok := languageIDs[ext]; ok {
+		return id
+	}
+	if language := languageOf(path); language != nil {
+		return language.Name
+	}
+	return "plaintext"
+}
+
+// Client returns the running server for path's language, starting it if
+// need be.
+func (m *Manager) Client(ctx context.Context, path string) (*Client, error) {
+	language := languageOf(path)
+	if language == nil {
+		return nil, fmt.Errorf("no language server is known for %s files; supported: %s", filepath.Ext(path), m.supported())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if client := m.clients[language.Name]; client != nil {
+		return client, nil
+	}
+	if err := m.failed[language.Name]; err != nil {
+		return nil, err
+	}
+
+	command := m.commands[language.Name]
+	if len(command) == 0 {
+		return nil, fmt.Errorf("the %s language server is turned off in the config", language.Name)
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		err = fmt.Errorf("%s, the %s language server, is not installed; install it or set lsp.servers.%s in the config", command[0], language.Name, language.Name)
+		m.failed[language.Name] = err
+		return nil, err
+	}
+	client, err := Start(ctx, command, m.root, languageID)
+	if err != nil {
+		// A server that was only slow to start is tried again next time.
+		if ctx.Err() == nil {
+			m.failed[language.Name] = err
+		}
+		return nil, err
+	}
+	m.clients[language.Name] = client
+	return client, nil
+}
+
+// supported lists the file extensions servers are known for.
+func (m *Manager) supported() string {
+	var extensions []string
+	for _, language := range Languages {
+		if len(m.commands[language.Name]) > 0 {
+			extensions = append(extensions, language.Extensions...)
+		}
+	}
+	sort.Strings(extensions)
+	return strings.Join(extensions, ", ")
+}
+
+// FileChanged tells the running server of path's language that the file
+// changed on disk.
+func (m *Manager) FileChanged(path string) {
+	language := languageOf(path)
+	if language == nil {
+		return
+	}
+	m.mu.Lock()
+	client := m.clients[language.Name]
+	m.mu.Unlock()
+	if client != nil {
+		client.Changed(path)
+	}
+}
+
+// Close stops the running servers.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = map[string]*Client{}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			client.Close()
+		}(client)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,149 @@
+// Package markdown renders the model's replies for the terminal as they
+// stream in: fenced code blocks are highlighted, and lists, headers and
+// emphasis are formatted.
+package markdown
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+)
+
+// escapePattern matches the color codes in rendered text.
+var escapePattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// minWidth is the narrowest width text is wrapped at, for terminals whose
+// width is unknown or tiny.
+const minWidth = 40
+
+// Renderer renders a reply a block at a time: a paragraph, list or table
+// once the blank line after it arrives, and a code block once it is closed,
+// as markdown cannot be rendered reliably before its block is complete.
+type Renderer struct {
+	term *glamour.TermRenderer
+	// line is the start of a line still arriving, and block the complete
+	// lines of the block in progress.
+	line  string
+	block []string
+	// fence opens the code block in progress, such as "```".
+	fence string
+	// rendered is set once a block of the reply has been returned.
+	rendered bool
+}
+
+// New returns a Renderer that wraps text at width columns.
+func New(width int) (*Renderer, error) {
+	if width < minWidth {
+		width = minWidth
+	}
+	term, err := glamour.NewTermRenderer(
+		glamour.WithStandardStyle(styles.DarkStyle),
+		glamour.WithWordWrap(width-2),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{term: term}, nil
+}
+
+// Write adds the next piece of the reply and returns what is ready to be
+// printed: the blocks it completes, rendered.
+func (r *Renderer) Write(text string) string {
+	r.line += text
+	var out strings.Builder
+	for {
+		i := strings.IndexByte(r.line, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(r.line[:i], "\r")
+		r.line = r.line[i+1:]
+		out.WriteString(r.addLine(line))
+	}
+	return out.String()
+}
+
+// Flush returns the rest of the reply, rendered, and readies the Renderer
+// for the next one.
+func (r *Renderer) Flush() string {
+	if r.line != "" {
+		r.block = append(r.block, r.line)
+		r.line = ""
+	}
+	out := r.render()
+	r.fence = ""
+	r.rendered = false
+	return out
+}
+
+// addLine adds a complete line to the block in progress and returns the
+// block, rendered, when the line ends it.
+func (r *Renderer) addLine(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if r.fence != "" {
+		r.block = append(r.block, line)
+		if strings.HasPrefix(trimmed, r.fence) && strings.Trim(trimmed, r.fence[:1]) == "" {
+			r.fence = ""
+			return r.render()
+		}
+		return ""
+	}
+	if trimmed == "" {
+		return r.render()
+	}
+	if fence := openingFence(trimmed); fence != "" {
+		r.fence = fence
+	}
+	r.block = append(r.block, line)
+	return ""
+}
+
+// render renders the block in progress, separated by a blank line from the
+// blocks before it.
+func (r *Renderer) render() string {
+	if len(r.block) == 0 {
+		return ""
+	}
+	source := strings.Join(r.block, "\n")
+	r.block = r.block[:0]
+	rendered, err := r.term.Render(source)
+	if err != nil {
+		rendered = source
+	}
+	rendered = trimBlankLines(rendered)
+	if r.rendered {
+		rendered = "\n" + rendered
+	}
+	r.rendered = true
+	return rendered + "\n"
+}
+
+// openingFence returns the fence a line opens a code block with, such as
+// "```" for "```go", or "" when it opens none.
+func openingFence(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// trimBlankLines removes the blank lines, colored or not, the renderer puts
+// around a block; the Renderer separates blocks itself.
+func trimBlankLines(text string) string {
+	lines := strings.Split(text, "\n")
+	blank := func(line string) bool {
+		return strings.TrimSpace(escapePattern.ReplaceAllString(line, "")) == ""
+	}
+	for len(lines) > 0 && blank(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && blank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
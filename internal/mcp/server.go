@@ -0,0 +1,223 @@
+// Package mcp serves the agent's tools to other programs, such as IDEs and
+// desktop assistants, over the Model Context Protocol: JSON-RPC 2.0
+// messages, one per line, on stdin and stdout.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"code-editing-agent/internal/tools"
+)
+
+// ProtocolVersion is the MCP revision the server implements.
+const ProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Server answers MCP requests by running tools.
+type Server struct {
+	Name    string
+	Version string
+	Tools   []tools.ToolDefinition
+
+	mu  sync.Mutex
+	out *json.Encoder
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type toolInfo struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"inputSchema"`
+}
+
+type callParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type callResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Serve reads requests from r and writes responses to w until r ends or
+// ctx is cancelled. Requests are handled one at a time, in order, since
+// tools that write files may depend on the effects of earlier calls.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.out = json.NewEncoder(w)
+	s.out.SetEscapeHTML(false)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.reply(nil, nil, &rpcError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		s.handle(ctx, req)
+	}
+	return scanner.Err()
+}
+
+func (s *Server) handle(ctx context.Context, req request) {
+	// Notifications, which have no ID, get no response.
+	notification := len(req.ID) == 0
+	if req.JSONRPC != "2.0" {
+		if !notification {
+			s.reply(req.ID, nil, &rpcError{Code: codeInvalidRequest, Message: "jsonrpc must be \"2.0\""})
+		}
+		return
+	}
+
+	var result interface{}
+	var rpcErr *rpcError
+	switch req.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": s.Name, "version": s.Version},
+		}
+	case "ping":
+		result = map[string]interface{}{}
+	case "tools/list":
+		list := []toolInfo{}
+		for _, tool := range s.Tools {
+			list = append(list, toolInfo{Name: tool.Name, Description: tool.Description, InputSchema: inputSchema(tool.InputSchema)})
+		}
+		result = map[string]interface{}{"tools": list}
+	case "tools/call":
+		result, rpcErr = s.call(ctx, req.Params)
+	default:
+		if notification {
+			// notifications/initialized and the like need no action.
+			return
+		}
+		rpcErr = &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not found", req.Method)}
+	}
+	if !notification {
+		s.reply(req.ID, result, rpcErr)
+	}
+}
+
+// call runs a tool, stopping it once ctx is done or the tool's timeout has
+// passed. A tool that fails is reported in the result, with isError set, so
+// the client's model can read what went wrong.
+func (s *Server) call(ctx context.Context, raw json.RawMessage) (result interface{}, rpcErr *rpcError) {
+	var params callParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid tools/call params: %v", err)}
+	}
+	var tool *tools.ToolDefinition
+	for i := range s.Tools {
+		if s.Tools[i].Name == params.Name {
+			tool = &s.Tools[i]
+		}
+	}
+	if tool == nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("tool %s not found", params.Name)}
+	}
+	arguments := params.Arguments
+	if len(arguments) == 0 || string(arguments) == "null" {
+		arguments = json.RawMessage("{}")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = callResult{Content: []content{{Type: "text", Text: fmt.Sprintf("tool %s crashed: %v", params.Name, r)}}, IsError: true}
+		}
+	}()
+	var output string
+	var err error
+	if tools.IsDryRun(*tool, arguments) {
+		_, output, err = tools.RunDry(ctx, *tool, arguments)
+	} else {
+		if tool.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tool.Timeout)
+			defer cancel()
+		}
+		output, err = tool.Function(ctx, arguments)
+	}
+	if err != nil {
+		return callResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return callResult{Content: []content{{Type: "text", Text: output}}}, nil
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr}
+	if result == nil && rpcErr == nil {
+		resp.Result = map[string]interface{}{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out.Encode(resp)
+}
+
+// inputSchema adapts a tool's schema for MCP clients, which expect an
+// object schema without null fields.
+func inputSchema(schema interface{}) interface{} {
+	m, ok := schema.(map[string]interface{})
+	if !ok {
+		return schema
+	}
+	adapted := map[string]interface{}{}
+	for key, value := range m {
+		if key == "required" {
+			if list, ok := value.([]string); ok && len(list) == 0 {
+				continue
+			}
+		}
+		if value != nil {
+			adapted[key] = value
+		}
+	}
+	return adapted
+}
@@ -0,0 +1,142 @@
+// Package memory keeps what the agent was asked to remember about a
+// project, such as "we use table-driven tests" or "the API server lives in
+// cmd/api", from one session to the next. The facts are kept as a Markdown
+// list in the workspace, which the user can edit as well.
+package memory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultPath is where the facts are kept, relative to the workspace.
+const DefaultPath = ".agent/memory.md"
+
+const (
+	// MaxFactLength bounds a fact, which is one line.
+	MaxFactLength = 500
+	// MaxFacts bounds how many facts are kept, so that they do not take
+	// over the system prompt.
+	MaxFacts = 100
+)
+
+const header = `# Memories
+
+Facts the agent remembers about this project, one per line, added to its system prompt in every session.
+Edit or remove them freely.
+
+`
+
+// mu serializes changes to the facts by the sessions of this process.
+var mu sync.Mutex
+
+// Load returns the facts kept at path, oldest first. A missing file holds
+// none.
+func Load(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memories: %w", err)
+	}
+	var facts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if fact, ok := strings.CutPrefix(line, "- "); ok && strings.TrimSpace(fact) != "" {
+			facts = append(facts, strings.TrimSpace(fact))
+		}
+	}
+	return facts, nil
+}
+
+// Remember adds fact to those kept at path. It reports false when the same
+// fact is already kept.
+func Remember(path, fact string) (bool, error) {
+	fact = strings.Join(strings.Fields(fact), " ")
+	if fact == "" {
+		return false, fmt.Errorf("fact cannot be empty")
+	}
+	if len(fact) > MaxFactLength {
+		return false, fmt.Errorf("fact is %d characters long; keep it under %d", len(fact), MaxFactLength)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	facts, err := Load(path)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range facts {
+		if strings.EqualFold(existing, fact) {
+			return false, nil
+		}
+	}
+	if len(facts) >= MaxFacts {
+		return false, fmt.Errorf("%d facts are already kept; forget outdated ones first", len(facts))
+	}
+	return true, save(path, append(facts, fact))
+}
+
+// Forget removes the fact kept at path that matches query: the one equal
+// to it or, when there is none, the only one containing it, ignoring case.
+// It returns the fact removed, and fails when query matches several.
+func Forget(path, query string) (string, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" {
+		return "", fmt.Errorf("fact cannot be empty")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	facts, err := Load(path)
+	if err != nil {
+		return "", err
+	}
+	var matched []int
+	for i, fact := range facts {
+		if strings.EqualFold(fact, query) {
+			matched = []int{i}
+			break
+		}
+		if strings.Contains(strings.ToLower(fact), strings.ToLower(query)) {
+			matched = append(matched, i)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("no remembered fact matches %q", query)
+	case 1:
+	default:
+		var list []string
+		for _, i := range matched {
+			list = append(list, "- "+facts[i])
+		}
+		return "", fmt.Errorf("%q matches %d facts; give the one to forget in full:\n%s", query, len(matched), strings.Join(list, "\n"))
+	}
+	removed := facts[matched[0]]
+	facts = append(facts[:matched[0]], facts[matched[0]+1:]...)
+	return removed, save(path, facts)
+}
+
+// save writes facts to path, aside and renamed so an interrupted write does
+// not lose them.
+func save(path string, facts []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create memory directory: %w", err)
+	}
+	var sb strings.Builder
+	sb.WriteString(header)
+	for _, fact := range facts {
+		sb.WriteString("- " + fact + "\n")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write memories: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write memories: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package mentions handles the @path mentions in the user's messages:
+// finding the files they name, whose contents are attached to the message,
+// and suggesting files while a mention is being typed.
+package mentions
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"code-editing-agent/internal/tools"
+)
+
+// refreshAfter is how long the list of files to suggest is kept before the
+// workspace is walked again.
+const refreshAfter = 10 * time.Second
+
+// trailingPunctuation may end a sentence right after a mention without
+// being part of the path.
+const trailingPunctuation = ".,;:!?)]}'\"`"
+
+// Find returns the files mentioned in text as @path, in order and without
+// repeats. Only files inside the workspace count, so an @ in an e-mail
+// address or before a name is left alone.
+func Find(text string) []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		path := word[1:]
+		for path != "" && !isFile(path) {
+			if !strings.ContainsRune(trailingPunctuation, rune(path[len(path)-1])) {
+				path = ""
+				break
+			}
+			path = path[:len(path)-1]
+		}
+		if path == "" {
+			continue
+		}
+		path = filepath.ToSlash(filepath.Clean(path))
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func isFile(path string) bool {
+	if !filepath.IsLocal(path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Token finds the mention being typed at the end of text. It returns where
+// the mention's @ is, in bytes, and what follows it, or false when the last
+// word of text is not a mention.
+func Token(text string) (start int, query string, ok bool) {
+	start = strings.LastIndexFunc(text, unicode.IsSpace) + 1
+	if !strings.HasPrefix(text[start:], "@") {
+		return 0, "", false
+	}
+	return start, text[start+1:], true
+}
+
+// Completer suggests the workspace's files for a mention being typed.
+type Completer struct {
+	root   string
+	mu     sync.Mutex
+	files  []string
+	loaded time.Time
+}
+
+// NewCompleter returns a Completer for the files under root, skipping those
+// list_files would skip.
+func NewCompleter(root string) *Completer {
+	return &Completer{root: root}
+}
+
+// Complete returns at most limit files matching query, best first. A file
+// matches when the letters of query appear in its path in order; files
+// whose name starts with or contains query come first, then those whose
+// path contains it, then the others by how closely together the letters
+// are, and shorter paths before longer ones.
+func (c *Completer) Complete(query string, limit int) []string {
+	type match struct {
+		path  string
+		score int
+	}
+	var matches []match
+	for _, path := range c.list() {
+		if score, ok := score(path, query); ok {
+			matches = append(matches, match{path, score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return matches[i].path < matches[j].path
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	paths := make([]string, len(matches))
+	for i, m := range matches {
+		paths[i] = m.path
+	}
+	return paths
+}
+
+// list returns the files to suggest, walking the workspace again once the
+// list is older than refreshAfter.
+func (c *Completer) list() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files != nil && time.Since(c.loaded) < refreshAfter {
+		return c.files
+	}
+	files, err := tools.ProjectFiles(c.root)
+	if err != nil {
+		return c.files
+	}
+	c.files = make([]string, len(files))
+	for i, file := range files {
+		if rel, err := filepath.Rel(c.root, file); err == nil {
+			file = rel
+		}
+		c.files[i] = filepath.ToSlash(file)
+	}
+	c.loaded = time.Now()
+	return c.files
+}
+
+// score ranks how well path matches query, lower being better, and reports
+// whether it matches at all.
+func score(path, query string) (int, bool) {
+	p, q := strings.ToLower(path), strings.ToLower(query)
+	name := p[strings.LastIndex(p, "/")+1:]
+	switch {
+	case q == "" || strings.HasPrefix(name, q):
+		return len(p), true
+	case strings.Contains(name, q):
+		return 1000 + len(p), true
+	case strings.Contains(p, q):
+		return 2000 + len(p), true
+	}
+
+	first, last, j := -1, -1, 0
+	for i := 0; i < len(p) && j < len(q); i++ {
+		if p[i] == q[j] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			j++
+		}
+	}
+	if j < len(q) {
+		return 0, false
+	}
+	return 3000 + 10*(last-first-len(q)+1) + len(p), true
+}
@@ -0,0 +1,184 @@
+// Package policy holds the approval policy of a session: which kinds of
+// tool calls run without asking, ask the user first or are refused, and
+// under which paths files may not be written or only with the user's
+// approval. The agent enforces it on every call, whatever the model does.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Decision is what happens to a tool call.
+type Decision string
+
+const (
+	// Allow runs the call without asking.
+	Allow Decision = "allow"
+	// Ask shows what the call would do and runs it once the user approves.
+	Ask Decision = "ask"
+	// Deny refuses the call; the model is told it is not allowed.
+	Deny Decision = "deny"
+)
+
+// ValidDecision reports whether d is allow, ask or deny.
+func ValidDecision(d string) bool {
+	switch Decision(d) {
+	case Allow, Ask, Deny:
+		return true
+	}
+	return false
+}
+
+// PathRule overrides the decision for writes to the files under a path.
+type PathRule struct {
+	// Pattern is a path relative to the workspace, such as "/vendor" or
+	// "db/migrations/*.sql", which also covers everything under the
+	// directories it matches. As in .gitignore, a pattern with no slash,
+	// or only a trailing one, such as "*.pem" or "testdata/", matches at
+	// any depth.
+	Pattern string
+	// Write is Ask or Deny.
+	Write Decision
+}
+
+// Policy is the approval policy of a session. The zero Policy, like a nil
+// one, leaves every tool to ask for approval as it normally does.
+type Policy struct {
+	// Categories maps the tool categories, read, write and execute, to the
+	// decision for their calls. A category without one keeps the usual
+	// behavior: tools that change things ask, the others do not.
+	Categories map[string]Decision
+	// Paths are checked in order for every file a tool writes; the last
+	// rule matching the file decides.
+	Paths []PathRule
+}
+
+// New returns a Policy, failing on a decision that is not allow, ask or
+// deny, or a path rule with a bad pattern or a decision other than ask or
+// deny.
+func New(categories map[string]Decision, rules []PathRule) (*Policy, error) {
+	for category, d := range categories {
+		if d != "" && !ValidDecision(string(d)) {
+			return nil, fmt.Errorf("invalid decision %q for %s tools (expected allow, ask or deny)", d, category)
+		}
+	}
+	for i, rule := range rules {
+		if rule.Write != Ask && rule.Write != Deny {
+			return nil, fmt.Errorf("invalid decision %q for writes to %s (expected ask or deny)", rule.Write, rule.Pattern)
+		}
+		pattern := cleanPattern(rule.Pattern)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid path pattern %q", rule.Pattern)
+		}
+		rules[i].Pattern = pattern
+	}
+	return &Policy{Categories: categories, Paths: rules}, nil
+}
+
+// Category returns the decision for the calls to tools of category, or ""
+// when the policy leaves them to ask as usual.
+func (p *Policy) Category(category string) Decision {
+	if p == nil {
+		return ""
+	}
+	return p.Categories[category]
+}
+
+// Write returns the decision for writing the file at name, or "" when no
+// rule covers it. Files outside the workspace are not covered.
+func (p *Policy) Write(name string) (Decision, string) {
+	if p == nil || len(p.Paths) == 0 {
+		return "", ""
+	}
+	rel, ok := relative(name)
+	if !ok {
+		return "", ""
+	}
+	var decision Decision
+	var pattern string
+	for _, rule := range p.Paths {
+		if matches(rule.Pattern, rel) {
+			decision, pattern = rule.Write, rule.Pattern
+		}
+	}
+	return decision, pattern
+}
+
+// CheckWrite returns an error for the first of paths the policy forbids
+// writing to, and otherwise those of paths whose writes the user must
+// approve. The tools call it for every file they are about to change,
+// which catches writes the call's arguments did not name.
+func (p *Policy) CheckWrite(paths ...string) ([]string, error) {
+	var ask []string
+	for _, name := range paths {
+		switch decision, pattern := p.Write(name); decision {
+		case Deny:
+			return nil, fmt.Errorf("the approval policy forbids writing %s (rule %q)", filepath.ToSlash(name), pattern)
+		case Ask:
+			ask = append(ask, name)
+		}
+	}
+	return ask, nil
+}
+
+// matches reports whether pattern, cleaned by cleanPattern, matches the
+// slash-separated relative path rel or one of the directories it is in.
+func matches(pattern, rel string) bool {
+	parts := strings.Split(rel, "/")
+	pattern, anchored := strings.CutPrefix(pattern, "/")
+	if !anchored && !strings.Contains(pattern, "/") {
+		for _, part := range parts {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 1; i <= len(parts); i++ {
+		if ok, _ := path.Match(pattern, strings.Join(parts[:i], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPattern drops what only restates that a pattern covers everything
+// under it, as in "vendor/" or "vendor/**". A pattern left without a slash
+// that only matches at the top of the workspace, like "/vendor" or
+// "vendor/**", is marked with a leading slash.
+func cleanPattern(pattern string) string {
+	pattern = filepath.ToSlash(strings.TrimSpace(pattern))
+	pattern = strings.TrimPrefix(pattern, "./")
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimSuffix(pattern, "/**")
+	pattern = strings.Trim(pattern, "/")
+	if anchored && !strings.Contains(pattern, "/") && pattern != "" {
+		pattern = "/" + pattern
+	}
+	return pattern
+}
+
+// relative returns name relative to the workspace, the working directory,
+// with slashes, or false when it is outside it.
+func relative(name string) (string, bool) {
+	if filepath.IsAbs(name) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", false
+		}
+		rel, err := filepath.Rel(cwd, name)
+		if err != nil {
+			return "", false
+		}
+		name = rel
+	}
+	name = filepath.Clean(name)
+	if !filepath.IsLocal(name) {
+		return "", false
+	}
+	return filepath.ToSlash(name), true
+}
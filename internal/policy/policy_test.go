@@ -0,0 +1,114 @@
+package policy
+
+import "testing"
+
+func TestCleanPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"*.pem", "*.pem"},
+		{"testdata/", "testdata"},
+		{"/vendor", "/vendor"},
+		{"/vendor/", "/vendor"},
+		{"vendor/**", "/vendor"},
+		{"./vendor", "vendor"},
+		{" secrets/ ", "secrets"},
+		{"db/migrations/*.sql", "db/migrations/*.sql"},
+		{"/db/migrations/", "db/migrations"},
+		{"db/migrations/**", "db/migrations"},
+		{"/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := cleanPattern(tt.pattern); got != tt.want {
+				t.Errorf("cleanPattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		// No slash: the pattern matches a file or directory at any depth.
+		{"*.pem", "server.pem", true},
+		{"*.pem", "certs/server.pem", true},
+		{"*.pem", "server.pem.bak", false},
+		{"testdata/", "testdata/input.json", true},
+		{"testdata/", "pkg/testdata/input.json", true},
+		{"testdata/", "testdata.go", false},
+
+		// A leading slash, or one inside, anchors it at the workspace.
+		{"/vendor", "vendor/github.com/x/y.go", true},
+		{"/vendor", "pkg/vendor/y.go", false},
+		{"vendor/**", "vendor/modules.txt", true},
+		{"vendor/**", "pkg/vendor/modules.txt", false},
+		{"db/migrations/*.sql", "db/migrations/001_init.sql", true},
+		{"db/migrations/*.sql", "src/db/migrations/001_init.sql", false},
+		{"db/migrations/*.sql", "db/migrations/001_init.go", false},
+		{"docs/*", "docs/guide/intro.md", true},
+		{"./secrets/", "secrets/prod.env", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.rel, func(t *testing.T) {
+			if got := matches(cleanPattern(tt.pattern), tt.rel); got != tt.want {
+				t.Errorf("matches(%q, %q) = %v, want %v", cleanPattern(tt.pattern), tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	p, err := New(nil, []PathRule{
+		{Pattern: "/config", Write: Ask},
+		{Pattern: "*.pem", Write: Deny},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want Decision
+	}{
+		{"config/app.yaml", Ask},
+		{"config/tls/server.pem", Deny},
+		{"main.go", ""},
+		{"../outside/server.pem", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := p.Write(tt.name); got != tt.want {
+				t.Errorf("Write(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+	ask, err := p.CheckWrite("main.go", "config/app.yaml", "config/db.yaml")
+	if err != nil || len(ask) != 2 || ask[0] != "config/app.yaml" || ask[1] != "config/db.yaml" {
+		t.Errorf("CheckWrite = %q, %v, want the two files under config to ask", ask, err)
+	}
+	if _, err := p.CheckWrite("main.go", "keys/server.pem"); err == nil {
+		t.Error("CheckWrite allowed writing keys/server.pem")
+	}
+}
+
+func TestNewRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule PathRule
+	}{
+		{"allow is not a write decision", PathRule{Pattern: "/vendor", Write: Allow}},
+		{"empty pattern", PathRule{Pattern: "/", Write: Deny}},
+		{"bad pattern", PathRule{Pattern: "[", Write: Deny}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(nil, []PathRule{tt.rule}); err == nil {
+				t.Errorf("New accepted %+v", tt.rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+// maxCheckErrors bounds how many compiler messages a check report lists.
+const maxCheckErrors = 50
+
+// CheckReport is the outcome of compiling or type-checking a project.
+type CheckReport struct {
+	Command string `json:"command"`
+	Passed  bool   `json:"passed"`
+	// Errors are the compiler's messages that point at a file, or start
+	// with "error", in the order printed.
+	Errors     []string `json:"errors,omitempty"`
+	ExitCode   int      `json:"exit_code"`
+	TimedOut   bool     `json:"timed_out,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+	// Output is the end of the raw output, included when the check failed
+	// without messages that could be picked out.
+	Output string `json:"output,omitempty"`
+}
+
+// checkCommands are the commands that check a project compiles, by type,
+// without running or testing it.
+var checkCommands = map[string][]string{
+	"go":     {"go", "build", "./..."},
+	"rust":   {"cargo", "check"},
+	"node":   {"npm", "run", "build", "--if-present"},
+	"python": {"python", "-m", "compileall", "-q", "."},
+	"maven":  {"mvn", "-q", "compile"},
+}
+
+// errorLine matches compiler messages: a path with a line number, as in
+// "main.go:12:5: ..." or "src/app.ts(3,7): ...", Rust's "--> src/main.rs:2:5"
+// and lines starting with "error" or "[ERROR]".
+var errorLine = regexp.MustCompile(`^\s*(--> )?[\w./\\-]+\.\w+(:\d+|\(\d+,\d+\))|^(error|\[ERROR\])`)
+
+// CheckCommand returns the command that checks the project in dir compiles.
+// TypeScript projects are type-checked with tsc rather than built.
+func (p Project) CheckCommand(dir string) []string {
+	if p.Type == "node" {
+		if _, err := os.Stat(filepath.Join(dir, "tsconfig.json")); err == nil {
+			return []string{"npx", "tsc", "--noEmit"}
+		}
+	}
+	return checkCommands[p.Type]
+}
+
+// Check compiles or type-checks the project in dir, streaming the output to
+// the terminal, and picks the compiler's messages out of it. Failing to
+// compile is reported in the CheckReport; err is only set when the check
+// could not be run at all.
+func (p Project) Check(ctx context.Context, dir string, timeout time.Duration) (CheckReport, error) {
+	command := p.CheckCommand(dir)
+	if len(command) == 0 {
+		return CheckReport{}, fmt.Errorf("no compile check known for %s projects", p.Type)
+	}
+	report := CheckReport{Command: strings.Join(command, " ")}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := shell.Run(ctx, dir, command[0], command[1:]...)
+	if err != nil {
+		return report, fmt.Errorf("%s failed: %w", report.Command, err)
+	}
+	report.ExitCode = result.ExitCode
+	report.TimedOut = result.TimedOut
+	report.DurationMS = result.Duration.Milliseconds()
+	report.Passed = result.ExitCode == 0 && !result.TimedOut
+	if report.Passed {
+		return report, nil
+	}
+
+	for _, line := range strings.Split(result.Combined, "\n") {
+		if errorLine.MatchString(line) && len(report.Errors) < maxCheckErrors {
+			report.Errors = append(report.Errors, strings.TrimSpace(line))
+		}
+	}
+	if len(report.Errors) == 0 {
+		report.Output = tail(result.Combined, maxReportOutput)
+	}
+	return report, nil
+}
+
+// Summary describes the report in a few lines for the model.
+func (r CheckReport) Summary() string {
+	if r.Passed {
+		return r.Command + " passed"
+	}
+	var sb strings.Builder
+	sb.WriteString(r.Command + " failed")
+	if r.TimedOut {
+		sb.WriteString(" (timed out)")
+	}
+	sb.WriteString(":\n")
+	if len(r.Errors) > 0 {
+		sb.WriteString(strings.Join(r.Errors, "\n"))
+	} else {
+		sb.WriteString(r.Output)
+	}
+	return sb.String()
+}
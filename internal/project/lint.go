@@ -0,0 +1,233 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+// maxFindings bounds how many findings a lint report lists.
+const maxFindings = 200
+
+// Finding is a problem a linter found.
+type Finding struct {
+	// File is relative to the working directory.
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+	// Severity is "error" or "warning" for linters that tell them apart.
+	Severity string `json:"severity,omitempty"`
+}
+
+// LintReport is the outcome of running a project's linter.
+type LintReport struct {
+	Command string `json:"command"`
+	// Passed is set when the linter ran and found nothing.
+	Passed   bool      `json:"passed"`
+	Findings []Finding `json:"findings,omitempty"`
+	// Total counts the findings, including those left out of Findings.
+	Total      int   `json:"total"`
+	ExitCode   int   `json:"exit_code"`
+	TimedOut   bool  `json:"timed_out,omitempty"`
+	DurationMS int64 `json:"duration_ms"`
+	// Output is the end of the raw output, included when the linter failed
+	// without findings, such as when it is misconfigured.
+	Output string `json:"output,omitempty"`
+}
+
+// linter runs the linter of a kind of project: command lints target, a
+// path or package pattern, and parse reads findings from what the command
+// wrote to stdout.
+type linter struct {
+	command func(target string) []string
+	parse   func(stdout string) []Finding
+}
+
+// linters are the linters run by project type.
+var linters = map[string]linter{
+	"go": {
+		command: func(target string) []string {
+			return []string{"golangci-lint", "run", orDefault(target, "./...")}
+		},
+		parse: parseGolangciLint,
+	},
+	"node": {
+		command: func(target string) []string {
+			return []string{"npx", "--no-install", "eslint", "--format", "json", orDefault(target, ".")}
+		},
+		parse: parseESLint,
+	},
+	"python": {
+		command: func(target string) []string {
+			return []string{"ruff", "check", "--output-format", "json", orDefault(target, ".")}
+		},
+		parse: parseRuff,
+	},
+}
+
+// LintCommand returns the command that lints target, the whole project
+// when empty, or nil when no linter is known for the project.
+func (p Project) LintCommand(target string) []string {
+	l, ok := linters[p.Type]
+	if !ok {
+		return nil
+	}
+	return l.command(target)
+}
+
+// Lint runs the project's linter in dir on target, the whole project when
+// empty: golangci-lint for Go, ESLint for Node and Ruff for Python. Lint
+// findings are reported in the LintReport; err is only set when the linter
+// could not be run at all, such as when it is not installed.
+func (p Project) Lint(ctx context.Context, dir, target string, timeout time.Duration) (LintReport, error) {
+	l, ok := linters[p.Type]
+	if !ok {
+		return LintReport{}, fmt.Errorf("no linter known for %s projects", p.Type)
+	}
+	command := l.command(target)
+	report := LintReport{Command: strings.Join(command, " ")}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// The findings are returned; their raw output is not worth showing.
+	result, err := shell.RunFiltered(ctx, dir, func(string) string { return "" }, command[0], command[1:]...)
+	if err != nil {
+		return report, fmt.Errorf("%s failed: %w; is %s installed?", report.Command, err, command[0])
+	}
+	report.ExitCode = result.ExitCode
+	report.TimedOut = result.TimedOut
+	report.DurationMS = result.Duration.Milliseconds()
+
+	findings := l.parse(result.Stdout)
+	for i := range findings {
+		findings[i].File = relativePath(dir, findings[i].File)
+	}
+	report.Total = len(findings)
+	if len(findings) > maxFindings {
+		findings = findings[:maxFindings]
+	}
+	report.Findings = findings
+	report.Passed = report.Total == 0 && result.ExitCode == 0 && !result.TimedOut
+	if report.Total == 0 && !report.Passed {
+		report.Output = tail(result.Combined, maxReportOutput)
+	}
+	return report, nil
+}
+
+// Summary describes the report in a few lines for the model.
+func (r LintReport) Summary() string {
+	if r.Passed {
+		return r.Command + " found nothing"
+	}
+	if r.Total == 0 {
+		return r.Command + " failed:\n" + r.Output
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s found %d problem(s):\n", r.Command, r.Total)
+	for _, f := range r.Findings {
+		fmt.Fprintf(&sb, "%s:%d: %s", f.File, f.Line, f.Message)
+		if f.Rule != "" {
+			fmt.Fprintf(&sb, " (%s)", f.Rule)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// golangciIssue matches an issue in golangci-lint's default output:
+// "internal/x.go:12:5: Error return value is not checked (errcheck)". The
+// source lines it prints under each issue do not match.
+var golangciIssue = regexp.MustCompile(`^(.+?\.go):(\d+)(?::(\d+))?: (.*) \(([\w-]+)\)$`)
+
+func parseGolangciLint(stdout string) []Finding {
+	var findings []Finding
+	for _, line := range strings.Split(stdout, "\n") {
+		m := golangciIssue.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		lineNumber, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		findings = append(findings, Finding{File: m[1], Line: lineNumber, Column: column, Rule: m[5], Message: m[4]})
+	}
+	return findings
+}
+
+func parseESLint(stdout string) []Finding {
+	var files []struct {
+		FilePath string `json:"filePath"`
+		Messages []struct {
+			RuleID   string `json:"ruleId"`
+			Severity int    `json:"severity"`
+			Message  string `json:"message"`
+			Line     int    `json:"line"`
+			Column   int    `json:"column"`
+		} `json:"messages"`
+	}
+	if json.Unmarshal([]byte(stdout), &files) != nil {
+		return nil
+	}
+	var findings []Finding
+	for _, file := range files {
+		for _, m := range file.Messages {
+			severity := "warning"
+			if m.Severity == 2 {
+				severity = "error"
+			}
+			findings = append(findings, Finding{File: file.FilePath, Line: m.Line, Column: m.Column, Rule: m.RuleID, Message: m.Message, Severity: severity})
+		}
+	}
+	return findings
+}
+
+func parseRuff(stdout string) []Finding {
+	var violations []struct {
+		Code     string `json:"code"`
+		Message  string `json:"message"`
+		Filename string `json:"filename"`
+		Location struct {
+			Row    int `json:"row"`
+			Column int `json:"column"`
+		} `json:"location"`
+	}
+	if json.Unmarshal([]byte(stdout), &violations) != nil {
+		return nil
+	}
+	var findings []Finding
+	for _, v := range violations {
+		findings = append(findings, Finding{File: v.Filename, Line: v.Location.Row, Column: v.Location.Column, Rule: v.Code, Message: v.Message})
+	}
+	return findings
+}
+
+// relativePath makes a path a linter run in dir reported relative to the
+// working directory: golangci-lint reports paths relative to dir, ESLint and
+// Ruff absolute ones.
+func relativePath(dir, path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(filepath.Join(dir, path))
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil {
+			path = rel
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
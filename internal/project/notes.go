@@ -0,0 +1,239 @@
+package project
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxLayoutEntries bounds how many directories the layout section lists.
+const maxLayoutEntries = 40
+
+// languages names the languages of source files by extension.
+var languages = map[string]string{
+	".go": "Go", ".rs": "Rust", ".py": "Python", ".java": "Java", ".kt": "Kotlin",
+	".js": "JavaScript", ".jsx": "JavaScript", ".mjs": "JavaScript", ".ts": "TypeScript", ".tsx": "TypeScript",
+	".rb": "Ruby", ".php": "PHP", ".cs": "C#", ".swift": "Swift", ".scala": "Scala",
+	".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++", ".hpp": "C++", ".sh": "Shell",
+}
+
+// testFile matches the names of test files of the languages above.
+var testFile = regexp.MustCompile(`(_test\.go|^test_.*\.py|_test\.py|\.(test|spec)\.[jt]sx?|Test\.java|_spec\.rb)$`)
+
+// makeTarget matches a rule of a Makefile that can be run by name.
+var makeTarget = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_-]*):([^=]|$)`)
+
+// Notes returns the AGENT.md that `agent init` writes for the project in
+// dir, from the scan of its files, given relative to dir: the languages it
+// is written in, the commands that build and test it, where its tests are
+// and how it is laid out.
+func Notes(dir string, files []string) string {
+	var sb strings.Builder
+	sb.WriteString("# Agent notes\n\n")
+	sb.WriteString("Generated by `agent init` from a scan of the repository. The agent reads this file at the start of\n")
+	sb.WriteString("every session, so keep it short, correct what the scan got wrong and add what it cannot know.\n")
+
+	sb.WriteString("\n## Languages\n\n")
+	counts := map[string]int{}
+	for _, file := range files {
+		if language, ok := languages[filepath.Ext(file)]; ok {
+			counts[language]++
+		}
+	}
+	if len(counts) == 0 {
+		sb.WriteString("- No source files of a known language were found.\n")
+	}
+	for _, language := range sortedByCount(counts) {
+		fmt.Fprintf(&sb, "- %s: %d file(s)\n", language, counts[language])
+	}
+
+	sb.WriteString("\n## Commands\n\n")
+	p, ok := Detect(dir)
+	if ok {
+		if len(p.BuildCommand) > 0 {
+			fmt.Fprintf(&sb, "- Build: `%s`\n", strings.Join(p.BuildCommand, " "))
+		}
+		if check := p.CheckCommand(dir); len(check) > 0 && strings.Join(check, " ") != strings.Join(p.BuildCommand, " ") {
+			fmt.Fprintf(&sb, "- Check that it compiles: `%s`\n", strings.Join(check, " "))
+		}
+		if test, err := p.TestCommand("", ""); err == nil {
+			// run_tests asks go test for JSON; people do not.
+			var args []string
+			for _, arg := range test {
+				if arg != "-json" {
+					args = append(args, arg)
+				}
+			}
+			fmt.Fprintf(&sb, "- Test: `%s`\n", strings.Join(args, " "))
+		}
+	}
+	scripts := npmScripts(dir)
+	for _, name := range scripts {
+		fmt.Fprintf(&sb, "- `npm run %s`\n", name)
+	}
+	targets := makeTargets(dir)
+	for _, target := range targets {
+		fmt.Fprintf(&sb, "- `make %s`\n", target)
+	}
+	if !ok && len(scripts) == 0 && len(targets) == 0 {
+		sb.WriteString("- No build system was recognized. Add the commands that build, test and lint the project.\n")
+	}
+
+	sb.WriteString("\n## Tests\n\n")
+	var tests []string
+	for _, file := range files {
+		if testFile.MatchString(filepath.Base(file)) {
+			tests = append(tests, file)
+		}
+	}
+	if len(tests) == 0 {
+		sb.WriteString("- No test files were found.\n")
+	} else {
+		examples := tests[:min(len(tests), 3)]
+		fmt.Fprintf(&sb, "- %d test file(s), such as `%s`.\n", len(tests), strings.Join(examples, "`, `"))
+	}
+
+	sb.WriteString("\n## Layout\n\n")
+	writeLayout(&sb, dir, files)
+
+	sb.WriteString("\n## Conventions\n\n")
+	sb.WriteString("- Add the project's conventions here: code style, naming, error handling, and anything to avoid.\n")
+	return sb.String()
+}
+
+// writeLayout lists the files at the top of the project and its directories
+// two levels deep, with how many files each holds and, for Go packages,
+// the first sentence of their documentation.
+func writeLayout(sb *strings.Builder, dir string, files []string) {
+	var top []string
+	counts := map[string]int{}
+	for _, file := range files {
+		parts := strings.Split(filepath.ToSlash(file), "/")
+		if len(parts) == 1 {
+			top = append(top, file)
+			continue
+		}
+		for depth := 1; depth <= 2 && depth < len(parts); depth++ {
+			counts[strings.Join(parts[:depth], "/")]++
+		}
+	}
+	if len(top) > 0 {
+		fmt.Fprintf(sb, "- Top level: `%s`\n", strings.Join(top[:min(len(top), 15)], "`, `"))
+		if len(top) > 15 {
+			fmt.Fprintf(sb, "  and %d more file(s)\n", len(top)-15)
+		}
+	}
+
+	dirs := make([]string, 0, len(counts))
+	for d := range counts {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	for i, d := range dirs {
+		if i == maxLayoutEntries {
+			fmt.Fprintf(sb, "- and %d more directories\n", len(dirs)-i)
+			break
+		}
+		indent := strings.Repeat("  ", strings.Count(d, "/"))
+		fmt.Fprintf(sb, "%s- `%s/` (%d file(s))", indent, d, counts[d])
+		if doc := goPackageDoc(filepath.Join(dir, d)); doc != "" {
+			fmt.Fprintf(sb, ": %s", doc)
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// goPackageDoc returns the first sentence of the documentation of the Go
+// package in dir, or "".
+func goPackageDoc(dir string) string {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		var doc []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			text, isComment := strings.CutPrefix(line, "//")
+			if !isComment {
+				break
+			}
+			text = strings.TrimSpace(text)
+			if len(doc) == 0 && !strings.HasPrefix(text, "Package ") {
+				continue
+			}
+			doc = append(doc, text)
+			if strings.Contains(text, ". ") || strings.HasSuffix(text, ".") {
+				break
+			}
+		}
+		file.Close()
+		if len(doc) > 0 {
+			sentence := strings.Join(doc, " ")
+			if i := strings.Index(sentence, ". "); i >= 0 {
+				sentence = sentence[:i+1]
+			}
+			return sentence
+		}
+	}
+	return ""
+}
+
+// npmScripts lists the scripts of dir's package.json.
+func npmScripts(dir string) []string {
+	content, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(content, &manifest) != nil {
+		return nil
+	}
+	names := make([]string, 0, len(manifest.Scripts))
+	for name := range manifest.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// makeTargets lists the targets of dir's Makefile, in order.
+func makeTargets(dir string) []string {
+	content, err := os.ReadFile(filepath.Join(dir, "Makefile"))
+	if err != nil {
+		return nil
+	}
+	var targets []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if match := makeTarget.FindStringSubmatch(line); match != nil && !seen[match[1]] {
+			seen[match[1]] = true
+			targets = append(targets, match[1])
+		}
+	}
+	return targets
+}
+
+// sortedByCount returns the keys of counts, most frequent first.
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
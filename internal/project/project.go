@@ -0,0 +1,70 @@
+// Package project detects the kind of project in a directory and knows how
+// to build it.
+package project
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+// buildTimeout bounds how long a build may run before it is killed.
+const buildTimeout = 5 * time.Minute
+
+// Project describes the toolchain used by a directory.
+type Project struct {
+	Type         string
+	BuildCommand []string
+}
+
+// markers maps manifest files to the project they indicate, in priority order.
+var markers = []struct {
+	file    string
+	project Project
+}{
+	{"go.mod", Project{Type: "go", BuildCommand: []string{"go", "build", "./..."}}},
+	{"Cargo.toml", Project{Type: "rust", BuildCommand: []string{"cargo", "build"}}},
+	{"package.json", Project{Type: "node", BuildCommand: []string{"npm", "run", "build", "--if-present"}}},
+	{"pyproject.toml", Project{Type: "python", BuildCommand: []string{"python", "-m", "compileall", "-q", "."}}},
+	{"setup.py", Project{Type: "python", BuildCommand: []string{"python", "-m", "compileall", "-q", "."}}},
+	{"pom.xml", Project{Type: "maven", BuildCommand: []string{"mvn", "-q", "compile"}}},
+}
+
+// Detect returns the project type of dir based on its manifest files.
+func Detect(dir string) (Project, bool) {
+	for _, m := range markers {
+		if _, err := os.Stat(filepath.Join(dir, m.file)); err == nil {
+			return m.project, true
+		}
+	}
+	return Project{}, false
+}
+
+// Build runs the project's build command, streaming its output to the
+// terminal, and returns the combined output.
+func (p Project) Build(ctx context.Context) (string, error) {
+	if len(p.BuildCommand) == 0 {
+		return "", fmt.Errorf("no build command known for %s projects", p.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
+	command := strings.Join(p.BuildCommand, " ")
+	result, err := shell.Run(ctx, "", p.BuildCommand[0], p.BuildCommand[1:]...)
+	if err != nil {
+		return result.Combined, fmt.Errorf("%s failed: %w", command, err)
+	}
+	if result.TimedOut {
+		return result.Combined, fmt.Errorf("%s timed out after %s", command, buildTimeout)
+	}
+	if result.ExitCode != 0 {
+		return result.Combined, fmt.Errorf("%s failed with exit code %d", command, result.ExitCode)
+	}
+	return result.Combined, nil
+}
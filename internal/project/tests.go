@@ -0,0 +1,416 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+const (
+	// maxFailures bounds how many failing tests a report describes.
+	maxFailures = 20
+	// maxFailureOutput is how much of each failing test's output is kept;
+	// the end is kept since that is where assertions are reported.
+	maxFailureOutput = 3000
+	// maxReportOutput is how much of the raw output is kept when the
+	// failures could not be picked out of it.
+	maxReportOutput = 6000
+)
+
+// TestReport is the outcome of a test run.
+type TestReport struct {
+	Framework  string        `json:"framework"`
+	Command    string        `json:"command"`
+	Passed     int           `json:"passed"`
+	Failed     int           `json:"failed"`
+	Skipped    int           `json:"skipped"`
+	Failures   []TestFailure `json:"failures,omitempty"`
+	ExitCode   int           `json:"exit_code"`
+	TimedOut   bool          `json:"timed_out,omitempty"`
+	DurationMS int64         `json:"duration_ms"`
+	// Output is the end of the raw output, included when the run failed
+	// without naming failing tests, e.g. because the code did not compile.
+	Output string `json:"output,omitempty"`
+}
+
+// TestFailure is a failing test and what it printed.
+type TestFailure struct {
+	Name   string `json:"name"`
+	Output string `json:"output,omitempty"`
+}
+
+// testRunner knows how to run and read the tests of one kind of project.
+type testRunner struct {
+	framework string
+	// command returns the command line for a run limited to target (a
+	// package, directory or file) and to tests matching filter.
+	command func(target, filter string) ([]string, error)
+	// filter, when set, turns machine-readable output into what is shown
+	// on the terminal while the tests run.
+	filter func(line string) string
+	parse  func(output string, report *TestReport)
+}
+
+var testRunners = map[string]testRunner{
+	"go": {
+		framework: "go test",
+		command: func(target, filter string) ([]string, error) {
+			if target == "" {
+				target = "./..."
+			}
+			args := []string{"go", "test", "-json", target}
+			if filter != "" {
+				args = append(args, "-run", filter)
+			}
+			return args, nil
+		},
+		filter: goTestLine,
+		parse:  parseGoTest,
+	},
+	"rust": {
+		framework: "cargo test",
+		command: func(target, filter string) ([]string, error) {
+			if target != "" {
+				return nil, fmt.Errorf("target is not supported for cargo test; use filter")
+			}
+			args := []string{"cargo", "test"}
+			if filter != "" {
+				args = append(args, filter)
+			}
+			return args, nil
+		},
+		parse: parseCargoTest,
+	},
+	"node": {
+		framework: "npm test",
+		command: func(target, filter string) ([]string, error) {
+			args := []string{"npm", "test", "--"}
+			if target != "" {
+				args = append(args, target)
+			}
+			if filter != "" {
+				// Understood by Jest and Vitest.
+				args = append(args, "-t", filter)
+			}
+			if len(args) == 3 {
+				args = args[:2]
+			}
+			return args, nil
+		},
+		parse: parseJSTest,
+	},
+	"python": {
+		framework: "pytest",
+		command: func(target, filter string) ([]string, error) {
+			args := []string{"python", "-m", "pytest", "-rfE"}
+			if target != "" {
+				args = append(args, target)
+			}
+			if filter != "" {
+				args = append(args, "-k", filter)
+			}
+			return args, nil
+		},
+		parse: parsePytest,
+	},
+	"maven": {
+		framework: "maven surefire",
+		command: func(target, filter string) ([]string, error) {
+			if target != "" {
+				return nil, fmt.Errorf("target is not supported for maven; use filter")
+			}
+			args := []string{"mvn", "-q", "test"}
+			if filter != "" {
+				args = append(args, "-Dtest="+filter)
+			}
+			return args, nil
+		},
+		parse: parseMaven,
+	},
+}
+
+// TestCommand returns the command that runs the project's tests, limited
+// to target and filter when they are set.
+func (p Project) TestCommand(target, filter string) ([]string, error) {
+	runner, ok := testRunners[p.Type]
+	if !ok {
+		return nil, fmt.Errorf("no test command known for %s projects", p.Type)
+	}
+	return runner.command(target, filter)
+}
+
+// Test runs the project's tests in dir, streaming their output to the
+// terminal, and reports the results. A failing test is reported in the
+// TestReport, not as an error.
+func (p Project) Test(ctx context.Context, dir, target, filter string, timeout time.Duration) (TestReport, error) {
+	runner, ok := testRunners[p.Type]
+	if !ok {
+		return TestReport{}, fmt.Errorf("no test command known for %s projects", p.Type)
+	}
+	args, err := runner.command(target, filter)
+	if err != nil {
+		return TestReport{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	report := TestReport{Framework: runner.framework, Command: strings.Join(args, " ")}
+	result, err := shell.RunFiltered(ctx, dir, runner.filter, args[0], args[1:]...)
+	if err != nil {
+		return report, fmt.Errorf("failed to run %s: %w", report.Command, err)
+	}
+	report.ExitCode = result.ExitCode
+	report.TimedOut = result.TimedOut
+	report.DurationMS = result.Duration.Milliseconds()
+
+	runner.parse(result.Combined, &report)
+	if len(report.Failures) > maxFailures {
+		report.Failures = report.Failures[:maxFailures]
+	}
+	for i := range report.Failures {
+		report.Failures[i].Output = tail(report.Failures[i].Output, maxFailureOutput)
+	}
+	if report.ExitCode != 0 && len(report.Failures) == 0 {
+		report.Output = tail(result.Combined, maxReportOutput)
+	}
+	return report, nil
+}
+
+// tail keeps the last limit bytes of output, noting how much was cut.
+func tail(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	return fmt.Sprintf("[%d bytes truncated]\n%s", len(output)-limit, output[len(output)-limit:])
+}
+
+// goTestEvent is a line of go test -json output.
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+	// ImportPath and FailedBuild tie compiler output to the package whose
+	// build it broke.
+	ImportPath  string
+	FailedBuild string
+}
+
+// goTestLine shows the text of a go test -json event, which is what go
+// test would have printed without -json.
+func goTestLine(line string) string {
+	var event goTestEvent
+	if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &event) != nil {
+		return line
+	}
+	return event.Output
+}
+
+func parseGoTest(output string, report *TestReport) {
+	outputs := map[string]*strings.Builder{}
+	failedTests := map[string]int{}
+	buildOutputs := map[string]*strings.Builder{}
+	for _, line := range strings.Split(output, "\n") {
+		var event goTestEvent
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &event) != nil {
+			continue
+		}
+		key := event.Package + " " + event.Test
+		switch event.Action {
+		case "build-output":
+			if buildOutputs[event.ImportPath] == nil {
+				buildOutputs[event.ImportPath] = &strings.Builder{}
+			}
+			buildOutputs[event.ImportPath].WriteString(event.Output)
+		case "output":
+			if outputs[key] == nil {
+				outputs[key] = &strings.Builder{}
+			}
+			outputs[key].WriteString(event.Output)
+		case "pass":
+			if event.Test != "" {
+				report.Passed++
+			}
+		case "skip":
+			if event.Test != "" {
+				report.Skipped++
+			}
+		case "fail":
+			var text string
+			if b := buildOutputs[event.FailedBuild]; b != nil {
+				text = b.String()
+			}
+			if b := outputs[key]; b != nil {
+				text += b.String()
+			}
+			if event.Test != "" {
+				report.Failed++
+				failedTests[event.Package]++
+				report.Failures = append(report.Failures, TestFailure{Name: event.Package + "." + event.Test, Output: text})
+			} else if failedTests[event.Package] == 0 {
+				// A package failing without a failing test did not build
+				// or crashed outside a test.
+				report.Failures = append(report.Failures, TestFailure{Name: event.Package, Output: text})
+			}
+		}
+	}
+}
+
+var (
+	cargoResult  = regexp.MustCompile(`test result: \w+\. (\d+) passed; (\d+) failed; (\d+) ignored`)
+	cargoFailure = regexp.MustCompile(`(?m)^---- (\S+) stdout ----$`)
+)
+
+func parseCargoTest(output string, report *TestReport) {
+	for _, m := range cargoResult.FindAllStringSubmatch(output, -1) {
+		report.Passed += atoi(m[1])
+		report.Failed += atoi(m[2])
+		report.Skipped += atoi(m[3])
+	}
+	// Each failure's output follows its "---- name stdout ----" header up
+	// to the next header or the summary list.
+	matches := cargoFailure.FindAllStringSubmatchIndex(output, -1)
+	for i, m := range matches {
+		end := len(output)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		} else if j := strings.Index(output[m[1]:], "\nfailures:\n"); j >= 0 {
+			end = m[1] + j
+		}
+		report.Failures = append(report.Failures, TestFailure{
+			Name:   output[m[2]:m[3]],
+			Output: strings.TrimSpace(output[m[1]:end]),
+		})
+	}
+}
+
+var (
+	pytestCounts  = regexp.MustCompile(`(\d+) (passed|failed|skipped|error|errors)\b`)
+	pytestSummary = regexp.MustCompile(`(?m)^=+ .*\b(passed|failed|error|errors|skipped)\b.* in [\d.]+s.*=+$`)
+	pytestFailure = regexp.MustCompile(`(?m)^(?:FAILED|ERROR) (\S+)(?: - (.*))?$`)
+)
+
+func parsePytest(output string, report *TestReport) {
+	if summaries := pytestSummary.FindAllString(output, -1); len(summaries) > 0 {
+		for _, m := range pytestCounts.FindAllStringSubmatch(summaries[len(summaries)-1], -1) {
+			switch m[2] {
+			case "passed":
+				report.Passed += atoi(m[1])
+			case "failed", "error", "errors":
+				report.Failed += atoi(m[1])
+			case "skipped":
+				report.Skipped += atoi(m[1])
+			}
+		}
+	}
+	for _, m := range pytestFailure.FindAllStringSubmatch(output, -1) {
+		name := m[1]
+		text := m[2]
+		// The traceback is in the section headed "___ test_name ___".
+		short := name[strings.LastIndex(name, "::")+2:]
+		if section := pytestSection(output, short); section != "" {
+			text = section
+		}
+		report.Failures = append(report.Failures, TestFailure{Name: name, Output: text})
+	}
+}
+
+// pytestSection returns the failure section pytest printed for test.
+func pytestSection(output, test string) string {
+	header := regexp.MustCompile(`(?m)^_{3,} ` + regexp.QuoteMeta(test) + ` _{3,}$`)
+	loc := header.FindStringIndex(output)
+	if loc == nil {
+		return ""
+	}
+	rest := output[loc[1]:]
+	next := regexp.MustCompile(`(?m)^(?:_{3,} .* _{3,}|=+ .* =+)$`).FindStringIndex(rest)
+	if next != nil {
+		rest = rest[:next[0]]
+	}
+	return strings.TrimSpace(rest)
+}
+
+var (
+	jestCounts   = regexp.MustCompile(`(?m)^Tests:\s+(.*)$`)
+	vitestCounts = regexp.MustCompile(`(?m)^\s*Tests\s+(.*\(\d+\))`)
+	mochaCounts  = regexp.MustCompile(`(?m)^\s*(\d+) (passing|failing|pending)\b`)
+	countWords   = regexp.MustCompile(`(\d+) (passed|failed|skipped|todo)`)
+	jestFailure  = regexp.MustCompile(`(?m)^\s*● (.+)$`)
+)
+
+func parseJSTest(output string, report *TestReport) {
+	summary := ""
+	if m := jestCounts.FindAllStringSubmatch(output, -1); len(m) > 0 {
+		summary = m[len(m)-1][1]
+	} else if m := vitestCounts.FindAllStringSubmatch(output, -1); len(m) > 0 {
+		summary = m[len(m)-1][1]
+	}
+	for _, m := range countWords.FindAllStringSubmatch(summary, -1) {
+		switch m[2] {
+		case "passed":
+			report.Passed += atoi(m[1])
+		case "failed":
+			report.Failed += atoi(m[1])
+		default:
+			report.Skipped += atoi(m[1])
+		}
+	}
+	if summary == "" {
+		for _, m := range mochaCounts.FindAllStringSubmatch(output, -1) {
+			switch m[2] {
+			case "passing":
+				report.Passed += atoi(m[1])
+			case "failing":
+				report.Failed += atoi(m[1])
+			case "pending":
+				report.Skipped += atoi(m[1])
+			}
+		}
+	}
+
+	// Jest prints each failure under a "● Suite › test" heading.
+	matches := jestFailure.FindAllStringSubmatchIndex(output, -1)
+	for i, m := range matches {
+		end := len(output)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		name := output[m[2]:m[3]]
+		if strings.HasPrefix(name, "Console") {
+			continue
+		}
+		report.Failures = append(report.Failures, TestFailure{Name: name, Output: strings.TrimSpace(output[m[1]:end])})
+	}
+}
+
+var (
+	mavenCounts = regexp.MustCompile(`Tests run: (\d+), Failures: (\d+), Errors: (\d+), Skipped: (\d+)`)
+	// Surefire lists each failure indented under "[ERROR] Failures:" or
+	// "[ERROR] Errors:", e.g. "[ERROR]   AppTest.testAdd:12 expected:<1>".
+	mavenFailure = regexp.MustCompile(`(?m)^\[ERROR\] {2,}(\S+?)(?::\d+)?\s+(.*)$`)
+)
+
+func parseMaven(output string, report *TestReport) {
+	// The last count is the total over all test classes.
+	if all := mavenCounts.FindAllStringSubmatch(output, -1); len(all) > 0 {
+		m := all[len(all)-1]
+		failed := atoi(m[2]) + atoi(m[3])
+		report.Failed = failed
+		report.Skipped = atoi(m[4])
+		report.Passed = atoi(m[1]) - failed - report.Skipped
+	}
+	for _, m := range mavenFailure.FindAllStringSubmatch(output, -1) {
+		report.Failures = append(report.Failures, TestFailure{Name: m[1], Output: m[2]})
+	}
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
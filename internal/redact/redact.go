@@ -0,0 +1,211 @@
+// Package redact masks credentials, such as API keys, tokens, private keys
+// and the values of secret environment variables, in text before it is
+// sent to the model or written to logs and crash reports.
+package redact
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Mask replaces every credential found.
+const Mask = "[REDACTED]"
+
+// minValueLength is the shortest environment value masked; shorter ones
+// are too likely to turn up by chance.
+const minValueLength = 8
+
+// builtinPatterns match well-known credential formats. Text matched by the
+// first group of a pattern, such as the name in "api_key: ...", and by its
+// second group, what follows the value, is kept.
+var builtinPatterns = []string{
+	`sk-[A-Za-z0-9_-]{16,}`,
+	`gh[pousr]_[A-Za-z0-9]{20,}`,
+	`github_pat_[A-Za-z0-9_]{20,}`,
+	`AKIA[0-9A-Z]{16}`,
+	`AIza[0-9A-Za-z_-]{35}`,
+	`xox[abprs]-[A-Za-z0-9-]{10,}`,
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{16,}`,
+}
+
+// assignmentPatterns match values given to names such as api_key or
+// password. The value, between the first and second groups, is masked only
+// when it looks like a credential, since names like max_tokens are common
+// in ordinary code and config.
+var assignmentPatterns = []string{
+	// Assignments in .env, YAML and INI files, one per line; values that
+	// are calls or expressions are left alone.
+	`(?im)^([ \t]*(?:export[ \t]+)?[\w.-]*(?:api[_-]?key|token|secret|password|passwd)[\w.-]*["']?[ \t]*[:=][ \t]*["']?)[^\s"'()]{4,}?(["']?[,;]?[ \t]*$)`,
+	// JSON fields.
+	`(?i)("[\w.-]*(?:api[_-]?key|token|secret|password|passwd)[\w.-]*"\s*:\s*")[^"]{4,}(")`,
+}
+
+// secretName matches the names of environment variables that hold
+// credentials, such as OPENAI_API_KEY or DATABASE_PASSWORD.
+var secretName = regexp.MustCompile(`(?i)(key|token|secret|passw|credential|auth|private|dsn)`)
+
+var (
+	mu       sync.RWMutex
+	patterns = mustCompile(builtinPatterns)
+	// assignments are compiled from assignmentPatterns.
+	assignments = mustCompile(assignmentPatterns)
+	// values are literal credentials, longest first so that one that
+	// contains another is masked whole.
+	values []string
+)
+
+func mustCompile(exprs []string) []*regexp.Regexp {
+	compiled, err := Compile(exprs)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
+
+// Compile compiles the regular expressions of configured patterns.
+func Compile(exprs []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// AddPatterns masks the matches of the regular expressions exprs from now
+// on, besides the built-in ones.
+func AddPatterns(exprs []string) error {
+	compiled, err := Compile(exprs)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	patterns = append(patterns, compiled...)
+	return nil
+}
+
+// AddValues masks the given credentials wherever they appear from now on.
+func AddValues(list ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, value := range list {
+		if len(value) < minValueLength || containsString(values, value) {
+			continue
+		}
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+}
+
+// AddEnv masks the values of the environment variables whose names show
+// they hold credentials, including those loaded from .env files.
+func AddEnv() {
+	var list []string
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if secretName.MatchString(name) {
+			list = append(list, value)
+		}
+	}
+	AddValues(list...)
+}
+
+// String returns text with every credential masked.
+func String(text string) string {
+	if text == "" {
+		return text
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, value := range values {
+		text = strings.ReplaceAll(text, value, Mask)
+	}
+	for _, re := range patterns {
+		switch re.NumSubexp() {
+		case 0:
+			text = re.ReplaceAllString(text, Mask)
+		case 1:
+			text = re.ReplaceAllString(text, "${1}"+Mask)
+		default:
+			text = re.ReplaceAllString(text, "${1}"+Mask+"${2}")
+		}
+	}
+	for _, re := range assignments {
+		text = maskValues(re, text)
+	}
+	return text
+}
+
+// maskValues masks the values assigned in the matches of re in text, those
+// between its first and second groups, that look like credentials.
+func maskValues(re *regexp.Regexp, text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[3], m[4]
+		if !looksSecret(text[start:end]) {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(Mask)
+		last = end
+	}
+	if last == 0 {
+		return text
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// looksSecret reports whether value, assigned to a name such as api_key,
+// looks like a credential rather than a number, a reference to a variable
+// or an environment variable, a path or a URL.
+func looksSecret(value string) bool {
+	if len(value) < minValueLength || value == Mask {
+		return false
+	}
+	if strings.ContainsAny(value[:1], "$<{%/.") || strings.Contains(value, "://") {
+		return false
+	}
+	var letters, digits, others int
+	for _, r := range value {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+		case unicode.IsDigit(r):
+			digits++
+		case r != '_' && r != '.':
+			others++
+		}
+	}
+	switch {
+	case letters == 0:
+		// Numbers, durations and versions.
+		return false
+	case digits > 0:
+		return true
+	}
+	// Letters alone, with underscores and dots, are names in code, such as
+	// defaultMaxTokens or cfg.Token. Longer words joined some other way may
+	// be passphrases.
+	return others > 0 && len(value) >= 16
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+
+	"code-editing-agent/internal/events"
+)
+
+// typeError reports a request sent over a WebSocket that failed.
+const typeError = "error"
+
+// maxBody limits the size of request bodies.
+const maxBody = 16 << 20
+
+// upgrader accepts WebSockets from any origin: requests must carry the
+// token, which pages of other origins do not have.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Handler returns the API:
+//
+//	POST   /sessions                  start a session: {"workdir": "..."}, optional
+//	GET    /sessions                  list the sessions
+//	GET    /sessions/{id}             describe a session
+//	DELETE /sessions/{id}             end a session
+//	POST   /sessions/{id}/messages    send a message: {"text": "..."}
+//	POST   /sessions/{id}/answer      answer the prompt the session waits on
+//	POST   /sessions/{id}/interrupt   stop the turn in progress
+//	GET    /sessions/{id}/events      the events after ?after=seq
+//	GET    /sessions/{id}/tool-calls  the tool calls and their results
+//	GET    /sessions/{id}/ws          a WebSocket streaming the events
+//
+// Every request needs the token.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sessions", s.handleCreate)
+	mux.HandleFunc("GET /sessions", s.handleList)
+	mux.HandleFunc("GET /sessions/{id}", s.withSession(s.handleInfo))
+	mux.HandleFunc("DELETE /sessions/{id}", s.withSession(s.handleDelete))
+	mux.HandleFunc("POST /sessions/{id}/messages", s.withSession(s.handleMessage))
+	mux.HandleFunc("POST /sessions/{id}/answer", s.withSession(s.handleAnswer))
+	mux.HandleFunc("POST /sessions/{id}/interrupt", s.withSession(s.handleInterrupt))
+	mux.HandleFunc("GET /sessions/{id}/events", s.withSession(s.handleEvents))
+	mux.HandleFunc("GET /sessions/{id}/tool-calls", s.withSession(s.handleToolCalls))
+	mux.HandleFunc("GET /sessions/{id}/ws", s.withSession(s.handleWebSocket))
+
+	// Browser UIs may be served from another origin; the token, not the
+	// origin, is what is checked.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// withSession looks up the session of the request's {id}.
+func (s *Server) withSession(handler func(http.ResponseWriter, *http.Request, *session)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := s.session(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("no such session"))
+			return
+		}
+		handler(w, r, session)
+	}
+}
+
+// handleCreate starts a session in the directory of the body's "workdir",
+// relative to the server's, or without a body in the server's.
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Workdir string `json:"workdir"`
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(&body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, errors.New(`the body must be empty or {"workdir": "..."}`))
+		return
+	}
+	session, err := s.create(body.Workdir)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, session.info())
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	list := []Info{}
+	for _, session := range s.list() {
+		list = append(list, session.info())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request, session *session) {
+	writeJSON(w, http.StatusOK, session.info())
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, session *session) {
+	s.remove(session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request, session *session) {
+	text, ok := readText(w, r)
+	if !ok {
+		return
+	}
+	if err := session.send(text); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, session.info())
+}
+
+func (s *Server) handleAnswer(w http.ResponseWriter, r *http.Request, session *session) {
+	text, ok := readText(w, r)
+	if !ok {
+		return
+	}
+	if err := session.answer(text); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleInterrupt(w http.ResponseWriter, r *http.Request, session *session) {
+	session.interrupt()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request, session *session) {
+	after, ok := afterParam(w, r)
+	if !ok {
+		return
+	}
+	records, _ := session.since(after)
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (s *Server) handleToolCalls(w http.ResponseWriter, r *http.Request, session *session) {
+	writeJSON(w, http.StatusOK, session.calls())
+}
+
+// handleWebSocket sends the session's events after ?after=seq, all of them
+// by default, and then each new one as it happens, until the session ends.
+// The client may send the same requests as the REST API:
+// {"type": "message", "text": "..."}, {"type": "answer", "text": "..."}
+// and {"type": "interrupt"}. Those that fail are answered with an error
+// event.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, session *session) {
+	after, ok := afterParam(w, r)
+	if !ok {
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has replied.
+		return
+	}
+	defer conn.Close()
+
+	failures := make(chan error)
+	disconnected := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(disconnected)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var request struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			}
+			if err = json.Unmarshal(message, &request); err == nil {
+				switch request.Type {
+				case "message":
+					err = session.send(request.Text)
+				case "answer":
+					err = session.answer(request.Text)
+				case "interrupt":
+					session.interrupt()
+				default:
+					err = errors.New("unknown request type " + strconv.Quote(request.Type))
+				}
+			}
+			if err != nil {
+				select {
+				case failures <- err:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		records, changed := session.since(after)
+		for _, record := range records {
+			if err := conn.WriteJSON(record); err != nil {
+				return
+			}
+			after = record.Seq
+		}
+		select {
+		case <-changed:
+		case err := <-failures:
+			if conn.WriteJSON(events.Event{Type: typeError, Error: err.Error()}) != nil {
+				return
+			}
+		case <-session.closed:
+			// The events of the session's end may still be on their way.
+			records, _ := session.since(after)
+			for _, record := range records {
+				conn.WriteJSON(record)
+			}
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"))
+			return
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+// readText reads the text of a {"text": "..."} request body, replying with
+// an error when it cannot.
+func readText(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(`the body must be {"text": "..."}`))
+		return "", false
+	}
+	return body.Text, true
+}
+
+// afterParam reads the ?after=seq parameter, zero when missing.
+func afterParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("after")
+	if value == "" {
+		return 0, true
+	}
+	after, err := strconv.Atoi(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("after must be the seq of an event"))
+		return 0, false
+	}
+	return after, true
+}
+
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, errClosed):
+		return http.StatusGone
+	case errors.Is(err, errQueueFull):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errNoPrompt):
+		return http.StatusConflict
+	case errors.Is(err, errBadWorkdir):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,266 @@
+// Package server serves agent sessions over HTTP, so that a browser-based
+// UI can drive the same agent as the terminal. Sessions are created and
+// sent messages through a REST API, and their events, the same as those of
+// --output json, are streamed over a WebSocket.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code-editing-agent/internal/agent"
+	"code-editing-agent/internal/events"
+	"code-editing-agent/internal/tools"
+)
+
+// shutdownTimeout is how long stopping the server waits for requests and
+// turns in progress.
+const shutdownTimeout = 10 * time.Second
+
+// Server runs the sessions of an HTTP server.
+//
+// Every session has its own agent, and with it its own conversation, tool
+// registry and budget, its own working directory, and its own approvals
+// and checkpoints. But the tools share
+// the process: its working directory, stdout and the prompts that ask for
+// approval. So sessions take turns at the workspace: a session holds the
+// floor while it runs tools and commands or reads files, in its working
+// directory, which the process changes to, and the others wait. It gives
+// the floor up while its agent waits for the model, so the sessions' turns
+// run at the same time. Prompts and output go to the session holding the
+// floor.
+type Server struct {
+	// NewAgent makes the agent of a new session working in the directory
+	// workdir, which reads its messages with getUserMessage. It is called
+	// with workdir as the working directory.
+	NewAgent func(workdir string, getUserMessage func() (string, bool)) (*agent.Agent, error)
+	// Workdir is the working directory of sessions that do not ask for one,
+	// against which the directories they ask for are resolved.
+	Workdir string
+	// OnClose is called with the agent of a session that has ended, such
+	// as to save its conversation.
+	OnClose func(*agent.Agent)
+	// Token is the secret clients send to use the API, in an
+	// "Authorization: Bearer" header or, for WebSockets from a browser, a
+	// token query parameter.
+	Token string
+
+	capture *events.Capture
+	// ctx is the context of the sessions' agents.
+	ctx context.Context
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	// active is the session holding floor.
+	active *session
+	floor  sync.Mutex
+	wg     sync.WaitGroup
+}
+
+// ListenAndServe serves the API on addr until ctx is done, then ends the
+// sessions. Output printed outside the sessions' turns goes to stdout.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if s.Token == "" {
+		return errors.New("a token is required")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.ctx = ctx
+	s.sessions = map[string]*session{}
+	s.capture, err = events.StartCapture(s.output)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	defer s.capture.Close()
+	fmt.Fprintf(s.capture.Stdout(), "Serving sessions on http://%s\n", listener.Addr())
+
+	httpServer := &http.Server{Handler: s.Handler()}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+	err = httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-stopped
+		err = nil
+	}
+
+	s.mu.Lock()
+	for _, session := range s.sessions {
+		session.close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Ask asks the user of the session holding the floor, for tools.AskUser.
+// Without one, the answer is no.
+func (s *Server) Ask(question string) (string, bool) {
+	s.mu.Lock()
+	session := s.active
+	s.mu.Unlock()
+	if session == nil {
+		return "", false
+	}
+	return session.ask(question)
+}
+
+// output sends captured output to the session holding the floor.
+func (s *Server) output(text string) {
+	s.mu.Lock()
+	session := s.active
+	s.mu.Unlock()
+	if session == nil {
+		fmt.Fprint(s.capture.Stdout(), text)
+		return
+	}
+	session.record(events.Event{Type: events.TypeOutput, Text: text})
+}
+
+// take waits for the floor and gives it to session, in its working
+// directory. A session whose directory has gone is ended.
+func (s *Server) take(session *session) {
+	s.floor.Lock()
+	s.mu.Lock()
+	s.active = session
+	s.mu.Unlock()
+	if err := os.Chdir(session.workdir); err != nil {
+		session.record(events.Event{Type: events.TypeOutput, Text: fmt.Sprintf("Error: %v; the session ends.\n", err)})
+		session.close()
+	}
+	tools.UseSession(session.toolSession)
+	if session.agent != nil {
+		tools.Subtasks = session.agent
+	}
+}
+
+// release gives up the floor, once the output printed so far has reached
+// the session holding it.
+func (s *Server) release() {
+	s.capture.Sync()
+	s.mu.Lock()
+	s.active = nil
+	s.mu.Unlock()
+	s.floor.Unlock()
+}
+
+// create starts a new session working in workdir, or in s.Workdir when
+// it is empty.
+func (s *Server) create(workdir string) (*session, error) {
+	workdir, err := s.workdir(workdir)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	session := newSession(s, id, workdir)
+	session.Lock()
+	session.agent, err = s.NewAgent(workdir, session.nextMessage)
+	session.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	session.agent.SetDisplay(session)
+	session.agent.SetWorkspaceLock(session)
+
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		session.run(s.ctx)
+	}()
+	return session, nil
+}
+
+// workdir returns the absolute path of the directory dir, resolved against
+// s.Workdir.
+func (s *Server) workdir(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.Workdir, dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errBadWorkdir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%w: %s is not a directory", errBadWorkdir, dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+func (s *Server) session(id string) (*session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	return session, ok
+}
+
+// list returns the sessions, oldest first.
+func (s *Server) list() []*session {
+	s.mu.Lock()
+	list := make([]*session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		list = append(list, session)
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].created.Before(list[j].created) })
+	return list
+}
+
+// remove ends a session and forgets it.
+func (s *Server) remove(session *session) {
+	s.mu.Lock()
+	delete(s.sessions, session.id)
+	s.mu.Unlock()
+	session.close()
+}
+
+// authorized reports whether the request carries the token.
+func (s *Server) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, _ = strings.CutPrefix(header, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// NewToken returns a random token for Server.Token.
+func NewToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to make a token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to make a session ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
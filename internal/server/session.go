@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"code-editing-agent/internal/agent"
+	"code-editing-agent/internal/events"
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/tools"
+)
+
+// maxQueued is how many messages a session holds while its agent is busy.
+const maxQueued = 16
+
+// maxEvents is how many of a session's latest events are kept for clients
+// that connect late or poll.
+const maxEvents = 10000
+
+// Session states.
+const (
+	// StateIdle waits for a message.
+	StateIdle = "idle"
+	// StateWorking runs a turn, or waits for another session's turn to end.
+	StateWorking = "working"
+	// StateWaiting waits for the answer to a prompt.
+	StateWaiting = "waiting"
+	// StateClosed has ended, with /exit or an error.
+	StateClosed = "closed"
+)
+
+var (
+	errClosed    = errors.New("the session has ended")
+	errQueueFull = errors.New("too many messages are waiting for the session")
+	errNoPrompt  = errors.New("the session is not waiting for an answer")
+	// errBadWorkdir is a working directory asked for that cannot be used.
+	errBadWorkdir = errors.New("invalid working directory")
+)
+
+// Record is an event of a session with its place in the session's events.
+type Record struct {
+	Seq int `json:"seq"`
+	events.Event
+}
+
+// ToolCall is a tool call made in a session, and its result once it has
+// finished.
+type ToolCall struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Input    json.RawMessage `json:"input,omitempty"`
+	Status   string          `json:"status"`
+	Output   string          `json:"output,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished *time.Time      `json:"finished,omitempty"`
+}
+
+// Info describes a session.
+type Info struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Workdir string    `json:"workdir"`
+	State   string    `json:"state"`
+	// Prompt is the question the session waits to have answered.
+	Prompt    string          `json:"prompt,omitempty"`
+	Queued    int             `json:"queued"`
+	Events    int             `json:"events"`
+	ToolCalls int             `json:"tool_calls"`
+	Usage     *llm.UsageTotal `json:"usage,omitempty"`
+}
+
+// answer is the reply to a prompt; ok is false when the prompt was
+// cancelled.
+type answer struct {
+	text string
+	ok   bool
+}
+
+// session is a conversation with its own agent. It shows the conversation
+// as events, with the methods of Emitter.
+type session struct {
+	events.Emitter
+
+	id      string
+	created time.Time
+	workdir string
+	server  *Server
+	agent   *agent.Agent
+	// toolSession is the session's own state of the tools: its approvals,
+	// checkpoints and start.
+	toolSession *tools.Session
+
+	messages  chan string
+	answers   chan answer
+	closed    chan struct{}
+	closeOnce sync.Once
+	// holding is whether the session holds the server's floor. Only the
+	// goroutine holding or taking the floor uses it.
+	holding bool
+
+	mu        sync.Mutex
+	state     string
+	prompt    string
+	records   []Record
+	seq       int
+	changed   chan struct{}
+	toolCalls []ToolCall
+	usage     *llm.UsageTotal
+}
+
+func newSession(server *Server, id, workdir string) *session {
+	s := &session{
+		id:          id,
+		created:     time.Now(),
+		workdir:     workdir,
+		server:      server,
+		toolSession: tools.NewSession(id),
+		messages:    make(chan string, maxQueued),
+		answers:     make(chan answer, 1),
+		closed:      make(chan struct{}),
+		state:       StateWorking,
+		changed:     make(chan struct{}),
+	}
+	s.Emitter = s.publish
+	return s
+}
+
+// run runs the agent until the session is closed or the agent stops. The
+// agent greets the user before asking for the first message, so it starts
+// with the floor.
+func (s *session) run(ctx context.Context) {
+	s.Lock()
+	err := s.agent.Run(ctx)
+	if err != nil {
+		s.publish(events.Event{Type: events.TypeOutput, Text: "Error: " + err.Error()})
+	}
+	// The session is saved in its own working directory.
+	if !s.holding {
+		s.Lock()
+	}
+	if s.server.OnClose != nil {
+		s.server.OnClose(s.agent)
+	}
+	s.Unlock()
+	s.mu.Lock()
+	s.state = StateClosed
+	s.mu.Unlock()
+	s.close()
+}
+
+// nextMessage gives the agent the next message, letting other sessions run
+// their turns while it waits.
+func (s *session) nextMessage() (string, bool) {
+	if s.holding {
+		s.Unlock()
+	}
+	s.setState(StateIdle)
+	select {
+	case text := <-s.messages:
+		s.setState(StateWorking)
+		s.Lock()
+		select {
+		case <-s.closed:
+			// Closed while another session had the floor.
+			return "", false
+		default:
+		}
+		return text, true
+	case <-s.closed:
+		return "", false
+	}
+}
+
+// Lock takes the server's floor for the session, in its working directory.
+// With Unlock, it is the lock the agent gives up while it waits for the
+// model.
+func (s *session) Lock() {
+	s.server.take(s)
+	s.holding = true
+}
+
+// Unlock gives up the floor.
+func (s *session) Unlock() {
+	s.holding = false
+	s.server.release()
+}
+
+// ask shows a prompt and waits for the answer.
+func (s *session) ask(question string) (string, bool) {
+	prompt := events.StripColors(question)
+	s.mu.Lock()
+	s.state, s.prompt = StateWaiting, prompt
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.state, s.prompt = StateWorking, ""
+		s.mu.Unlock()
+	}()
+	s.publish(events.Event{Type: events.TypePrompt, Text: prompt})
+	select {
+	case a := <-s.answers:
+		return a.text, a.ok
+	case <-s.closed:
+		return "", false
+	}
+}
+
+// send queues a message for the agent.
+func (s *session) send(text string) error {
+	select {
+	case <-s.closed:
+		return errClosed
+	default:
+	}
+	select {
+	case s.messages <- text:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// answer answers the prompt the session waits on.
+func (s *session) answer(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != StateWaiting {
+		return errNoPrompt
+	}
+	select {
+	case s.answers <- answer{text: text, ok: true}:
+		return nil
+	default:
+		// Answered already.
+		return errNoPrompt
+	}
+}
+
+// interrupt stops the turn in progress, declining any prompt it waits on.
+func (s *session) interrupt() {
+	s.agent.Interrupt()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == StateWaiting {
+		select {
+		case s.answers <- answer{}:
+		default:
+		}
+	}
+}
+
+// close ends the session: the agent stops once its turn is interrupted.
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	if s.agent != nil {
+		s.agent.Interrupt()
+	}
+}
+
+func (s *session) setState(state string) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+// publish adds an event after the output printed before it.
+func (s *session) publish(event events.Event) {
+	s.server.capture.Sync()
+	s.record(event)
+}
+
+// record adds an event and wakes the clients waiting for it.
+func (s *session) record(event events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	s.records = append(s.records, Record{Seq: s.seq, Event: event})
+	if len(s.records) > maxEvents {
+		s.records = s.records[len(s.records)-maxEvents:]
+	}
+	switch event.Type {
+	case events.TypeToolCall:
+		input := event.Input
+		if input == nil {
+			input, _ = json.Marshal(event.Text)
+		}
+		s.toolCalls = append(s.toolCalls, ToolCall{ID: event.ID, Name: event.Name, Input: input, Status: "running", Started: time.Now()})
+	case events.TypeToolResult:
+		for i := len(s.toolCalls) - 1; i >= 0; i-- {
+			call := &s.toolCalls[i]
+			if call.ID != event.ID || call.Finished != nil {
+				continue
+			}
+			now := time.Now()
+			call.Finished = &now
+			call.Output, call.Error = event.Output, event.Error
+			call.Status = "failed"
+			if event.Success != nil && *event.Success {
+				call.Status = "succeeded"
+			}
+			break
+		}
+	case events.TypeUsage:
+		s.usage = event.Session
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// since returns the events after seq, and a channel closed when there are
+// more.
+func (s *session) since(seq int) ([]Record, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := len(s.records)
+	for i > 0 && s.records[i-1].Seq > seq {
+		i--
+	}
+	return append([]Record(nil), s.records[i:]...), s.changed
+}
+
+func (s *session) calls() []ToolCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ToolCall{}, s.toolCalls...)
+}
+
+func (s *session) info() Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Info{
+		ID:        s.id,
+		Created:   s.created,
+		Workdir:   s.workdir,
+		State:     s.state,
+		Prompt:    s.prompt,
+		Queued:    len(s.messages),
+		Events:    s.seq,
+		ToolCalls: len(s.toolCalls),
+		Usage:     s.usage,
+	}
+}
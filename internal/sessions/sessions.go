@@ -0,0 +1,120 @@
+// Package sessions keeps an index of the chat sessions held in a workspace:
+// a short title for each, when it started and was last active, the model
+// it used and what it cost, so that /sessions can list them.
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"code-editing-agent/internal/llm"
+)
+
+// DefaultPath is where the index is kept, relative to the workspace, next
+// to the conversations saved with /save.
+const DefaultPath = ".agent/sessions/index.json"
+
+// idFormat is the layout of the time a session started, which names it.
+const idFormat = "20060102-150405"
+
+// mu serializes changes to the index by the sessions of this process, such
+// as those of agent serve --http.
+var mu sync.Mutex
+
+// Entry describes a session.
+type Entry struct {
+	ID string `json:"id"`
+	// Title sums up the session in a few words, from its first prompt.
+	Title    string         `json:"title"`
+	Started  time.Time      `json:"started"`
+	Updated  time.Time      `json:"updated"`
+	Model    string         `json:"model"`
+	WorkDir  string         `json:"work_dir"`
+	Messages int            `json:"messages"`
+	Usage    llm.UsageTotal `json:"usage"`
+}
+
+// New returns the entry of a session starting now.
+func New(model, workDir string) Entry {
+	now := time.Now()
+	// Sessions started within the same second, by several processes or by
+	// one serving many, differ in the suffix.
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return Entry{
+		ID:      now.Format(idFormat) + "-" + hex.EncodeToString(suffix),
+		Started: now,
+		Updated: now,
+		Model:   model,
+		WorkDir: workDir,
+	}
+}
+
+// Load reads the index at path, oldest session first. A missing index is
+// empty.
+func Load(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session index: %w", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to read session index %s: %w", path, err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Started.Before(entries[j].Started) })
+	return entries, nil
+}
+
+// Record adds e to the index at path, or replaces the entry with its ID.
+func Record(path string, e Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+	entries, err := Load(path)
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range entries {
+		if entries[i].ID == e.ID {
+			entries[i], found = e, true
+			break
+		}
+	}
+	if !found {
+		entries = append(entries, e)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	// Titles come from the user's prompts; keep them out of commits.
+	ignore := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		os.WriteFile(ignore, []byte("*\n"), 0644)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session index: %w", err)
+	}
+	// Written aside and renamed, so an interrupted write does not lose the
+	// index.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write session index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write session index: %w", err)
+	}
+	return nil
+}
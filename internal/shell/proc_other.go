@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package shell
+
+import "os/exec"
+
+// killGroup leaves cmd to be killed on its own, which is all other systems
+// offer without more machinery.
+func killGroup(cmd *exec.Cmd) {}
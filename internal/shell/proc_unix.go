@@ -0,0 +1,18 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup makes cmd run in a process group of its own that is killed as a
+// whole, so that the processes a shell started do not outlive it when the
+// command times out or is interrupted.
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
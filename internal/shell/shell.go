@@ -0,0 +1,192 @@
+// Package shell runs external commands for tools, echoing their output to
+// the terminal while it is produced so long builds and test runs are not
+// silent.
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// waitDelay is how long to wait for output to drain after a command exits
+// or is killed.
+const waitDelay = 5 * time.Second
+
+// Output receives the live output of running commands. Set it to io.Discard
+// to run silently.
+var Output io.Writer = os.Stdout
+
+var (
+	runningMu sync.Mutex
+	running   = map[*exec.Cmd]context.CancelFunc{}
+)
+
+// Interrupt kills every command still running, for when the user presses
+// Ctrl-C. The commands return as if they had failed.
+func Interrupt() {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	for _, cancel := range running {
+		cancel()
+	}
+}
+
+// Result is the outcome of a finished command.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	Combined string
+	ExitCode int
+	Duration time.Duration
+	TimedOut bool
+}
+
+// Run executes name with args in dir (the working directory when empty),
+// streaming its output to Output and collecting it into the Result. A
+// non-zero exit status is reported through Result.ExitCode, not as an error;
+// err is only set when the command could not be run at all.
+func Run(ctx context.Context, dir string, name string, args ...string) (Result, error) {
+	return RunFiltered(ctx, dir, nil, name, args...)
+}
+
+// RunFiltered is Run with the live output passed through filter, which
+// receives complete lines, for commands whose output is meant for machines
+// rather than people. The Result holds the unfiltered output.
+func RunFiltered(ctx context.Context, dir string, filter func(line string) string, name string, args ...string) (Result, error) {
+	return run(ctx, dir, nil, filter, name, args...)
+}
+
+// RunInput is Run with stdin fed to the command's standard input.
+func RunInput(ctx context.Context, dir string, stdin []byte, name string, args ...string) (Result, error) {
+	return run(ctx, dir, bytes.NewReader(stdin), nil, name, args...)
+}
+
+func run(ctx context.Context, dir string, stdin io.Reader, filter func(line string) string, name string, args ...string) (Result, error) {
+	var stdout, stderr bytes.Buffer
+	combined := &lockedBuffer{}
+	live := &linePrefixer{w: Output, prefix: "\u001b[90m  │ ", suffix: "\u001b[0m", filter: filter}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, name, args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	killGroup(cmd)
+	cmd.Stdout = io.MultiWriter(&stdout, combined, live)
+	cmd.Stderr = io.MultiWriter(&stderr, combined, live)
+	// Background processes started by the command can keep its output pipes
+	// open after it is killed; stop waiting for them shortly after.
+	cmd.WaitDelay = waitDelay
+
+	runningMu.Lock()
+	running[cmd] = cancel
+	runningMu.Unlock()
+	defer func() {
+		runningMu.Lock()
+		delete(running, cmd)
+		runningMu.Unlock()
+	}()
+
+	start := time.Now()
+	err := cmd.Run()
+	live.Flush()
+
+	result := Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Combined: combined.String(),
+		Duration: time.Since(start),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	if err != nil && !result.TimedOut {
+		return result, err
+	}
+	if result.TimedOut {
+		result.ExitCode = -1
+	}
+	return result, nil
+}
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent writes of stdout
+// and stderr.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// linePrefixer writes complete lines to w, each wrapped in prefix and suffix,
+// so output from the command is visually set apart from the agent's own.
+// Lines are passed through filter first, when set; it may drop a line by
+// returning "" or turn it into several.
+type linePrefixer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	prefix  string
+	suffix  string
+	filter  func(line string) string
+	pending []byte
+}
+
+func (l *linePrefixer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = append(l.pending, p...)
+	for {
+		i := bytes.IndexByte(l.pending, '\n')
+		if i < 0 {
+			break
+		}
+		l.writeLine(string(bytes.TrimRight(l.pending[:i], "\r")))
+		l.pending = l.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+func (l *linePrefixer) writeLine(line string) {
+	if l.filter == nil {
+		io.WriteString(l.w, l.prefix+line+l.suffix+"\n")
+		return
+	}
+	filtered := strings.TrimSuffix(l.filter(line), "\n")
+	if filtered == "" {
+		return
+	}
+	for _, part := range strings.Split(filtered, "\n") {
+		io.WriteString(l.w, l.prefix+part+l.suffix+"\n")
+	}
+}
+
+// Flush writes any final line that did not end in a newline.
+func (l *linePrefixer) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) > 0 {
+		l.writeLine(string(l.pending))
+		l.pending = nil
+	}
+}
@@ -0,0 +1,181 @@
+// Package templates keeps named prompts, such as "add tests for a file",
+// that the user sends with /template instead of typing them out. A template
+// is text with {{name}} variables filled in from the command's arguments.
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultDir is where the workspace's templates are kept, one Markdown file
+// per template named after it, relative to the workspace.
+const DefaultDir = ".agent/templates"
+
+// variablePattern matches a {{name}} variable.
+var variablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// Builtin are the templates every session has; templates of the same name
+// in the config or the workspace replace them.
+var Builtin = map[string]string{
+	"tests": `Add tests for {{file}}. Follow the conventions of this project's existing tests: where they
+live, the framework and helpers they use, and their style. Cover the main behavior and the edge
+cases, then run the tests and fix any failures.`,
+	"commit-message": `Write a commit message for the staged changes, or for all uncommitted changes if nothing is
+staged: a summary line of at most 72 characters, a blank line, and a short explanation of why the
+change was made. Only show the message; do not commit.`,
+	"explain-error": `Explain this error: what it means, where in the code it comes from and why. Suggest a fix,
+but do not change any files yet.
+
+{{error}}`,
+}
+
+// Template is a named prompt.
+type Template struct {
+	Name string
+	Text string
+	// Source is where the template comes from: "built-in", "config" or
+	// the path of its file.
+	Source string
+}
+
+// Load returns the built-in templates, replaced by configured ones and then
+// by the files in dir, sorted by name. dir may be empty or missing.
+func Load(dir string, configured map[string]string) ([]Template, error) {
+	byName := map[string]Template{}
+	for name, text := range Builtin {
+		byName[name] = Template{Name: name, Text: text, Source: "built-in"}
+	}
+	for name, text := range configured {
+		byName[name] = Template{Name: name, Text: text, Source: "config"}
+	}
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read templates: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read template: %w", err)
+			}
+			name := strings.TrimSuffix(entry.Name(), ".md")
+			byName[name] = Template{Name: name, Text: string(content), Source: path}
+		}
+	}
+
+	list := make([]Template, 0, len(byName))
+	for _, t := range byName {
+		if strings.TrimSpace(t.Text) == "" {
+			// An empty template turns off one of the same name.
+			continue
+		}
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Find returns the template called name.
+func Find(list []Template, name string) (Template, bool) {
+	for _, t := range list {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// Variables lists the variables of the template in the order they first
+// appear.
+func (t Template) Variables() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range variablePattern.FindAllStringSubmatch(t.Text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Usage shows the arguments the template takes, e.g. "<file>".
+func (t Template) Usage() string {
+	var parts []string
+	for _, name := range t.Variables() {
+		parts = append(parts, "<"+name+">")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Expand fills in the template's variables from args. An argument of the
+// form name=value sets that variable; the others fill the remaining
+// variables in order, the last one taking all the words left. Words left
+// over by a template without variables are added to its end.
+func (t Template) Expand(args []string) (string, error) {
+	variables := t.Variables()
+	values := map[string]string{}
+	var positional []string
+	for _, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok && containsString(variables, name) {
+			values[name] = value
+			continue
+		}
+		positional = append(positional, arg)
+	}
+
+	var unset []string
+	for _, name := range variables {
+		if _, ok := values[name]; !ok {
+			unset = append(unset, name)
+		}
+	}
+	for i, name := range unset {
+		if len(positional) == 0 {
+			break
+		}
+		if i == len(unset)-1 {
+			values[name] = strings.Join(positional, " ")
+			positional = nil
+			break
+		}
+		values[name], positional = positional[0], positional[1:]
+	}
+
+	var missing []string
+	for _, name := range variables {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing %s; usage: /template %s %s", strings.Join(missing, ", "), t.Name, t.Usage())
+	}
+
+	text := variablePattern.ReplaceAllStringFunc(t.Text, func(match string) string {
+		return values[variablePattern.FindStringSubmatch(match)[1]]
+	})
+	text = strings.TrimSpace(text)
+	if len(positional) > 0 {
+		text += "\n\n" + strings.Join(positional, " ")
+	}
+	return text, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- ApplyPatch Tool ---
+
+var ApplyPatchDefinition = ToolDefinition{
+	Name: "apply_patch",
+	Description: `Apply a unified diff (as produced by diff -u or git diff) to one or more files.
+
+Use this for multi-hunk or multi-file edits in a single call. Each file section starts with
+"--- a/path" and "+++ b/path" headers; use /dev/null as the old path to create a file and as the
+new path to delete one. Hunks are placed near the line numbers in their @@ headers, tolerating
+shifted lines, whitespace differences and a little stale context, so the counts in the headers
+need not be exact. Hunks that cannot be placed are reported and left out; the rest are applied.
+Returns a unified diff of what actually changed.
+`,
+	InputSchema: withDryRun(GenerateSchema[ApplyPatchInput]()),
+	Function:    ApplyPatch,
+	Category:    CategoryWrite,
+	Preview:     PreviewApplyPatch,
+}
+
+type ApplyPatchInput struct {
+	Patch string `json:"patch" jsonschema_description:"The unified diff to apply."`
+}
+
+// patchedFile is the planned outcome of a patch for one file.
+type patchedFile struct {
+	patch      filePatch
+	oldContent string
+	newContent string
+	mode       os.FileMode
+	failed     []patchHunk
+}
+
+func ApplyPatch(ctx context.Context, input json.RawMessage) (string, error) {
+	patchInput := ApplyPatchInput{}
+	err := json.Unmarshal(input, &patchInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse apply_patch input: %w", err)
+	}
+
+	files, err := planPatch(patchInput.Patch)
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+	var submoduleNotes strings.Builder
+	applied := 0
+	for _, f := range files {
+		if len(f.failed) == len(f.patch.Hunks) {
+			continue
+		}
+		applied++
+		for _, path := range []string{f.patch.OldPath, f.patch.NewPath} {
+			if path == "" {
+				continue
+			}
+			paths = append(paths, path)
+			note, err := checkSubmoduleEdit(path)
+			if err != nil {
+				return "", err
+			}
+			submoduleNotes.WriteString(note)
+		}
+	}
+	if applied == 0 {
+		return "", fmt.Errorf("no hunk of the patch applies:\n%s", formatFailedHunks(files))
+	}
+
+	err = checkpointFiles("apply_patch", paths...)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if len(f.failed) == len(f.patch.Hunks) {
+			continue
+		}
+		err := writePatchedFile(f)
+		if err != nil {
+			// Leave the tree as we found it rather than half-patched.
+			if _, restoreErr := Checkpoints.Undo(1); restoreErr != nil {
+				return "", fmt.Errorf("%v; rollback failed: %w", err, restoreErr)
+			}
+			return "", fmt.Errorf("%w; all changes rolled back", err)
+		}
+	}
+
+	diff := patchDiff(files)
+	fmt.Printf("\u001b[92mPatch success\u001b[0m: Patched %d file(s)\n", applied)
+	printDiff("apply_patch", diff)
+	result := fmt.Sprintf("Patched %d file(s):\n%s", applied, diff)
+	if failed := formatFailedHunks(files); failed != "" {
+		result += "\nThese hunks could not be placed and were NOT applied:\n" + failed
+	}
+	return result + submoduleNotes.String(), nil
+}
+
+// PreviewApplyPatch renders the changes a patch would make.
+func PreviewApplyPatch(input json.RawMessage) (string, error) {
+	patchInput := ApplyPatchInput{}
+	err := json.Unmarshal(input, &patchInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse apply_patch input: %w", err)
+	}
+	files, err := planPatch(patchInput.Patch)
+	if err != nil {
+		return "", err
+	}
+
+	preview := ColorizeDiff(patchDiff(files))
+	if failed := formatFailedHunks(files); failed != "" {
+		preview += "\u001b[93mThese hunks do not apply and will be skipped:\u001b[0m\n" + failed
+	}
+	return preview, nil
+}
+
+// planPatch parses a patch and applies it in memory.
+func planPatch(text string) ([]patchedFile, error) {
+	patches, err := parsePatch(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []patchedFile
+	for _, p := range patches {
+		f := patchedFile{patch: p, mode: 0644}
+		if p.OldPath != "" {
+			info, err := os.Stat(p.OldPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s: %w", p.OldPath, err)
+			}
+			content, err := os.ReadFile(p.OldPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file %s: %w", p.OldPath, err)
+			}
+			f.oldContent = string(content)
+			f.mode = info.Mode().Perm()
+		} else if _, err := os.Stat(p.NewPath); err == nil {
+			return nil, fmt.Errorf("patch creates %s, which already exists", p.NewPath)
+		}
+
+		f.newContent, f.failed = applyPatchHunks(f.oldContent, p.Hunks)
+		if p.NewPath == "" && len(f.failed) == 0 && f.newContent != "" {
+			return nil, fmt.Errorf("patch deletes %s but does not remove all of its content", p.OldPath)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func writePatchedFile(f patchedFile) error {
+	p := f.patch
+	if p.NewPath == "" {
+		err := os.Remove(p.OldPath)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", p.OldPath, err)
+		}
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(p.NewPath), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	err = os.WriteFile(p.NewPath, []byte(f.newContent), f.mode)
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", p.NewPath, err)
+	}
+	if p.OldPath != "" && p.OldPath != p.NewPath {
+		err = os.Remove(p.OldPath)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s after renaming it to %s: %w", p.OldPath, p.NewPath, err)
+		}
+	}
+	return nil
+}
+
+// patchDiff is the combined diff of what a patch actually changes.
+func patchDiff(files []patchedFile) string {
+	var sb strings.Builder
+	for _, f := range files {
+		if len(f.failed) == len(f.patch.Hunks) {
+			continue
+		}
+		sb.WriteString(UnifiedDiff(f.patch.displayPath(), f.oldContent, f.newContent))
+	}
+	return sb.String()
+}
+
+// formatFailedHunks lists the hunks that could not be placed, per file.
+func formatFailedHunks(files []patchedFile) string {
+	var sb strings.Builder
+	for _, f := range files {
+		for _, h := range f.failed {
+			fmt.Fprintf(&sb, "%s: %s\n", f.patch.displayPath(), h.Header)
+			for _, l := range h.Lines {
+				sb.WriteByte(l.Kind)
+				sb.WriteString(l.Text)
+				sb.WriteByte('\n')
+			}
+		}
+	}
+	return sb.String()
+}
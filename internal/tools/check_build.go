@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/project"
+)
+
+const checkBuildTimeout = 5 * time.Minute
+
+// --- CheckBuild Tool ---
+
+var CheckBuildDefinition = ToolDefinition{
+	Name: "check_build",
+	Description: `Check that the project compiles, without running or testing it, and get back the compiler's errors.
+
+The command is chosen from the manifest files in 'workdir': go build ./... for go.mod, cargo check for
+Cargo.toml, tsc --noEmit for package.json with a tsconfig.json (npm run build otherwise), compileall for
+Python and mvn compile for pom.xml. Returns whether the check passed and each error with its file and
+line. Run it after a batch of edits, before running the tests.
+`,
+	InputSchema: GenerateSchema[CheckBuildInput](),
+	Function:    CheckBuild,
+	Category:    CategoryExecute,
+	Preview:     PreviewCheckBuild,
+	Timeout:     checkBuildTimeout + commandGrace,
+}
+
+type CheckBuildInput struct {
+	Workdir string `json:"workdir,omitempty" jsonschema_description:"The relative directory holding the project's manifest. Defaults to the current directory."`
+}
+
+func CheckBuild(ctx context.Context, input json.RawMessage) (string, error) {
+	checkInput := CheckBuildInput{}
+	err := json.Unmarshal(input, &checkInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse check_build input: %w", err)
+	}
+
+	report, err := VerifyBuild(ctx, checkInput.Workdir)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(report); err != nil {
+		return "", fmt.Errorf("failed to encode check_build result: %w", err)
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// PreviewCheckBuild shows the command a check_build call would run.
+func PreviewCheckBuild(input json.RawMessage) (string, error) {
+	checkInput := CheckBuildInput{}
+	err := json.Unmarshal(input, &checkInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse check_build input: %w", err)
+	}
+	p, dir, err := detectProject(checkInput.Workdir)
+	if err != nil {
+		return "", err
+	}
+	preview := fmt.Sprintf("\u001b[1m$ %s\u001b[0m\n", strings.Join(p.CheckCommand(dir), " "))
+	if checkInput.Workdir != "" {
+		preview += fmt.Sprintf("  (in %s)\n", checkInput.Workdir)
+	}
+	return preview, nil
+}
+
+// VerifyBuild checks that the project in workdir, the working directory
+// when empty, compiles. The check is stopped once ctx is done.
+func VerifyBuild(ctx context.Context, workdir string) (project.CheckReport, error) {
+	p, dir, err := detectProject(workdir)
+	if err != nil {
+		return project.CheckReport{}, err
+	}
+	fmt.Printf("\u001b[92mtool\u001b[0m: $ %s\n", strings.Join(p.CheckCommand(dir), " "))
+	return p.Check(ctx, workdir, checkBuildTimeout)
+}
+
+func detectProject(workdir string) (project.Project, string, error) {
+	dir := workdir
+	if dir == "" {
+		dir = "."
+	}
+	p, ok := project.Detect(dir)
+	if !ok {
+		return project.Project{}, "", fmt.Errorf("no go.mod, Cargo.toml, package.json, pyproject.toml, setup.py or pom.xml found in %s; use execute_shell to build the project", dir)
+	}
+	return p, dir, nil
+}
@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// minSimilarity is how alike lines must be to old_str to be offered as the
+// place to apply an edit whose old_str was not found.
+const minSimilarity = 0.7
+
+// maxMatchComparisons bounds the lines compared while looking for the
+// closest match, so a huge file does not hold up a failed edit.
+const maxMatchComparisons = 2_000_000
+
+// closeMatch is the run of lines in a file most like an old_str that does
+// not occur in it, usually because the file changed since it was read.
+type closeMatch struct {
+	// Line and EndLine are the first and last lines, counting from 1.
+	Line, EndLine int
+	// Start and End are the byte offsets of Text in the file.
+	Start, End int
+	Text       string
+	// Similarity runs from 0, nothing alike, to 1, the same but for
+	// whitespace at the ends of lines.
+	Similarity float64
+}
+
+func (m closeMatch) lines() string {
+	if m.Line == m.EndLine {
+		return fmt.Sprintf("line %d", m.Line)
+	}
+	return fmt.Sprintf("lines %d-%d", m.Line, m.EndLine)
+}
+
+// noMatchError is the error of an edit whose old_str is not in the file. It
+// carries the closest match, when one is alike enough, so the edit can be
+// applied there instead.
+type noMatchError struct {
+	path, oldStr string
+	content      string
+	match        closeMatch
+	found        bool
+	// declined is set when the user chose not to apply the edit at match.
+	declined bool
+}
+
+func (e *noMatchError) Error() string {
+	message := fmt.Sprintf("old_str '%s' not found in file %s", e.oldStr, e.path)
+	switch {
+	case !e.found:
+		return message
+	case e.declined:
+		return message + fmt.Sprintf("\nThe user chose not to apply the edit at the closest match, %s (%.0f%% similar):\n%s",
+			e.match.lines(), e.match.Similarity*100, e.match.Text)
+	}
+	return message + fmt.Sprintf("\nThe closest match is %s (%.0f%% similar):\n%s\n"+
+		"To apply the edit there, send it again with \"fuzzy_match_line\": %d, which replaces these lines with new_str, or use them as old_str.",
+		e.match.lines(), e.match.Similarity*100, e.match.Text, e.match.Line)
+}
+
+// newNoMatchError is the error of edit, whose old_str is not in content.
+func newNoMatchError(content string, edit EditFileInput) *noMatchError {
+	match, found := closestMatch(content, edit.OldStr)
+	return &noMatchError{path: edit.Path, oldStr: edit.OldStr, content: content, match: match, found: found}
+}
+
+// offerCloseMatch shows the user the change an edit whose old_str was not
+// found would make at the closest match, and returns the edit set to be
+// applied there if they agree.
+func offerCloseMatch(edit EditFileInput, noMatch *noMatchError) (EditFileInput, error) {
+	match := noMatch.match
+	changed := noMatch.content[:match.Start] + edit.NewStr + noMatch.content[match.End:]
+	fmt.Printf("\u001b[93mClosest match\u001b[0m: old_str was not found in %s; its closest match, %s, is %.0f%% similar. Applied there, the edit would make this change:\n",
+		edit.Path, match.lines(), match.Similarity*100)
+	fmt.Print(ColorizeDiff(UnifiedDiff(edit.Path, noMatch.content, changed)))
+	if !Confirm(fmt.Sprintf("Apply the edit at %s?", match.lines())) {
+		noMatch.declined = true
+		return edit, noMatch
+	}
+	edit.FuzzyMatchLine = match.Line
+	return edit, nil
+}
+
+// closestMatch finds the run of lines in content most like old, as many as
+// old has. It reports false when none is at least minSimilarity alike.
+func closestMatch(content, old string) (closeMatch, bool) {
+	lines, starts := splitFileLines(content)
+	want := strings.Split(strings.TrimSuffix(old, "\n"), "\n")
+	if len(want) > len(lines) || len(want)*(len(lines)-len(want)+1) > maxMatchComparisons {
+		return closeMatch{}, false
+	}
+	wantGrams := make([][]uint16, len(want))
+	for i, line := range want {
+		wantGrams[i] = bigrams(line)
+	}
+	lineGrams := make([][]uint16, len(lines))
+	for i, line := range lines {
+		lineGrams[i] = bigrams(line)
+	}
+
+	best, bestAt := 0.0, -1
+	for at := 0; at+len(want) <= len(lines); at++ {
+		score := windowSimilarity(lines[at:at+len(want)], lineGrams[at:at+len(want)], want, wantGrams)
+		if score > best {
+			best, bestAt = score, at
+		}
+	}
+	if bestAt < 0 || best < minSimilarity {
+		return closeMatch{}, false
+	}
+	return newCloseMatch(content, lines, starts, bestAt, len(want), old, best), true
+}
+
+// matchAt is the match of old starting on line, counting from 1, when it
+// is at least minSimilarity alike.
+func matchAt(content, old string, line int) (closeMatch, bool) {
+	lines, starts := splitFileLines(content)
+	want := strings.Split(strings.TrimSuffix(old, "\n"), "\n")
+	at := line - 1
+	if at < 0 || at+len(want) > len(lines) {
+		return closeMatch{}, false
+	}
+	wantGrams := make([][]uint16, len(want))
+	lineGrams := make([][]uint16, len(want))
+	for i := range want {
+		wantGrams[i] = bigrams(want[i])
+		lineGrams[i] = bigrams(lines[at+i])
+	}
+	score := windowSimilarity(lines[at:at+len(want)], lineGrams, want, wantGrams)
+	if score < minSimilarity {
+		return closeMatch{}, false
+	}
+	return newCloseMatch(content, lines, starts, at, len(want), old, score), true
+}
+
+// newCloseMatch is the match of the n lines of content from index at. It
+// takes in the newline after them when old ends with one.
+func newCloseMatch(content string, lines []string, starts []int, at, n int, old string, similarity float64) closeMatch {
+	last := at + n - 1
+	start, end := starts[at], starts[last]+len(lines[last])
+	if strings.HasSuffix(old, "\n") && end < len(content) {
+		end++
+	}
+	return closeMatch{
+		Line:       at + 1,
+		EndLine:    last + 1,
+		Start:      start,
+		End:        end,
+		Text:       content[start:end],
+		Similarity: similarity,
+	}
+}
+
+// splitFileLines splits content into lines without their newlines, with the
+// offset at which each starts.
+func splitFileLines(content string) ([]string, []int) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	starts := make([]int, len(lines))
+	offset := 0
+	for i, line := range lines {
+		starts[i] = offset
+		offset += len(line) + 1
+	}
+	return lines, starts
+}
+
+// windowSimilarity is how alike the lines got are to those wanted, the
+// similarity of each pair of lines weighted by their length.
+func windowSimilarity(got []string, gotGrams [][]uint16, want []string, wantGrams [][]uint16) float64 {
+	var total, weight float64
+	for i := range want {
+		a, b := strings.TrimSpace(got[i]), strings.TrimSpace(want[i])
+		w := float64(max(len(a), len(b), 1))
+		weight += w
+		if a == b {
+			total += w
+			continue
+		}
+		total += w * dice(gotGrams[i], wantGrams[i])
+	}
+	return total / weight
+}
+
+// bigrams are the sorted pairs of adjacent bytes of line, without the
+// whitespace at its ends.
+func bigrams(line string) []uint16 {
+	line = strings.TrimSpace(line)
+	if len(line) < 2 {
+		return nil
+	}
+	grams := make([]uint16, len(line)-1)
+	for i := range grams {
+		grams[i] = uint16(line[i])<<8 | uint16(line[i+1])
+	}
+	sort.Slice(grams, func(i, j int) bool { return grams[i] < grams[j] })
+	return grams
+}
+
+// dice is the Sørensen-Dice coefficient of two sorted bigram lists: twice
+// the bigrams they share over the bigrams of both.
+func dice(a, b []uint16) float64 {
+	if len(a)+len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			shared++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
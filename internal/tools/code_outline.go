@@ -0,0 +1,439 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultOutlineFiles = 200
+	// maxOutlineSize bounds the outline returned, like read_file's limit.
+	maxOutlineSize = 48 * 1024
+	// maxOutlineLine bounds a single signature.
+	maxOutlineLine = 200
+)
+
+// --- CodeOutline Tool ---
+
+var CodeOutlineDefinition = ToolDefinition{
+	Name: "code_outline",
+	Description: `List the declarations of the source files under a path without their bodies: packages, types
+with their fields and methods, functions with their signatures, constants and variables.
+
+Each declaration is prefixed with its line number, so a file can then be read with read_file around
+that line. Go files are parsed exactly; Python, JavaScript/TypeScript, Rust, Java, Kotlin, C# and Ruby
+files are outlined from their declaration lines. Use this first to find your way around a project
+instead of reading every file. Files ignored by .gitignore or .agentignore are skipped.
+`,
+	InputSchema: GenerateSchema[CodeOutlineInput](),
+	Function:    CodeOutline,
+	Category:    CategoryRead,
+}
+
+type CodeOutlineInput struct {
+	Path         string `json:"path,omitempty" jsonschema_description:"The relative file or directory to outline. Defaults to the current directory."`
+	Glob         string `json:"glob,omitempty" jsonschema_description:"Only outline files matching this glob, e.g. *.go or internal/**/*.ts."`
+	ExportedOnly bool   `json:"exported_only,omitempty" jsonschema_description:"Only list exported (public) declarations."`
+	MaxFiles     int    `json:"max_files,omitempty" jsonschema_description:"The maximum number of files to outline. Defaults to 200."`
+}
+
+// outlineEntry is a declaration in a file's outline.
+type outlineEntry struct {
+	line int
+	// depth indents members under their type.
+	depth int
+	text  string
+}
+
+func CodeOutline(ctx context.Context, input json.RawMessage) (string, error) {
+	outlineInput := CodeOutlineInput{}
+	err := json.Unmarshal(input, &outlineInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse code_outline input: %w", err)
+	}
+	root := outlineInput.Path
+	if root == "" {
+		root = "."
+	}
+	maxFiles := outlineInput.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultOutlineFiles
+	}
+	var globRe *regexp.Regexp
+	if outlineInput.Glob != "" {
+		globRe, err = compileGlob(outlineInput.Glob)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	files, err := outlineFiles(ctx, root, globRe, outlineInput.Glob)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return fmt.Sprintf("No source files found in %s.", root), nil
+	}
+
+	var sb strings.Builder
+	shown := 0
+	for _, path := range files {
+		if shown == maxFiles || sb.Len() > maxOutlineSize {
+			break
+		}
+		header, entries, err := outlineFile(path, outlineInput.ExportedOnly)
+		if err != nil {
+			fmt.Fprintf(&sb, "%s: %v\n", filepath.ToSlash(path), err)
+			shown++
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		sb.WriteString(filepath.ToSlash(path))
+		if header != "" {
+			sb.WriteString(" (" + header + ")")
+		}
+		sb.WriteString("\n")
+		for _, e := range entries {
+			fmt.Fprintf(&sb, "%5d: %s%s\n", e.line, strings.Repeat("  ", e.depth), e.text)
+		}
+		shown++
+	}
+	if shown < len(files) {
+		fmt.Fprintf(&sb, "(Outlined %d of %d files; narrow 'path' or 'glob' to see the rest.)\n", shown, len(files))
+	}
+	return sb.String(), nil
+}
+
+// outlineFiles lists the files under root that can be outlined, sorted,
+// skipping what list_files would skip.
+func outlineFiles(ctx context.Context, root string, globRe *regexp.Regexp, glob string) ([]string, error) {
+	return sourceFiles(ctx, root, func(path, relPath string) bool {
+		return outlineLanguage(path) != "" && (globRe == nil || matchGlob(globRe, glob, relPath))
+	})
+}
+
+// ProjectFiles lists the files under root, sorted, leaving out those that
+// are ignored, dependencies, submodules and the agent's own directories.
+func ProjectFiles(root string) ([]string, error) {
+	return sourceFiles(context.Background(), root, func(path, relPath string) bool { return true })
+}
+
+// sourceFiles lists the files under root accepted by keep, sorted, skipping
+// ignored files, dependencies, submodules and the agent's own directories.
+// A root that is a file is returned as it is. The walk stops with ctx's
+// error once ctx is done.
+func sourceFiles(ctx context.Context, root string, keep func(path, relPath string) bool) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+
+	ignore := newIgnoreMatcher(root)
+	declared := gitmodulePaths()
+	var files []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			ignore.enter(relPath)
+			return nil
+		}
+		if d.IsDir() {
+			if isAgentDir(d.Name()) || d.Name() == "node_modules" || d.Name() == "vendor" ||
+				isSubmoduleDir(path, declared) || ignore.ignored(relPath, true) {
+				return filepath.SkipDir
+			}
+			ignore.enter(relPath)
+			return nil
+		}
+		if !d.Type().IsRegular() || ignore.ignored(relPath, false) || !keep(path, relPath) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// outlineLanguage names the outliner for path, or "" if there is none.
+func outlineLanguage(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return "go"
+	case ".py":
+		return "python"
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx":
+		return "javascript"
+	case ".rs":
+		return "rust"
+	case ".java", ".kt", ".cs":
+		return "java"
+	case ".rb":
+		return "ruby"
+	}
+	return ""
+}
+
+// outlineFile returns a header for path, such as its package, and its
+// declarations.
+func outlineFile(path string, exportedOnly bool) (string, []outlineEntry, error) {
+	language := outlineLanguage(path)
+	if language == "go" {
+		return outlineGo(path, exportedOnly)
+	}
+	entries, err := outlineByPatterns(path, linePatterns[language], exportedOnly)
+	return "", entries, err
+}
+
+// outlineGo parses a Go file and lists its declarations as Go would print
+// them, without function bodies.
+func outlineGo(path string, exportedOnly bool) (string, []outlineEntry, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+	if err != nil && file == nil {
+		return "", nil, err
+	}
+	// A file with syntax errors is still outlined as far as it parsed.
+	node := func(n ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, n)
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
+	visible := func(name string) bool { return !exportedOnly || ast.IsExported(name) }
+
+	var entries []outlineEntry
+	add := func(pos token.Pos, depth int, text string) {
+		if len(text) > maxOutlineLine {
+			text = text[:maxOutlineLine] + " ..."
+		}
+		entries = append(entries, outlineEntry{line: line(pos), depth: depth, text: text})
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !visible(d.Name.Name) {
+				continue
+			}
+			if exportedOnly && d.Recv != nil && len(d.Recv.List) > 0 && !ast.IsExported(receiverType(d.Recv.List[0].Type)) {
+				continue
+			}
+			signature := *d
+			signature.Body = nil
+			signature.Doc = nil
+			add(d.Pos(), 0, node(&signature))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if !visible(s.Name.Name) {
+						continue
+					}
+					outlineGoType(s, d.Tok, exportedOnly, add, node)
+				case *ast.ValueSpec:
+					var names []string
+					for _, name := range s.Names {
+						if visible(name.Name) && name.Name != "_" {
+							names = append(names, name.Name)
+						}
+					}
+					if len(names) == 0 {
+						continue
+					}
+					text := d.Tok.String() + " " + strings.Join(names, ", ")
+					if s.Type != nil {
+						text += " " + node(s.Type)
+					}
+					add(s.Pos(), 0, text)
+				}
+			}
+		}
+	}
+	return "package " + file.Name.Name, entries, nil
+}
+
+// outlineGoType lists a type with the fields of a struct or the methods of
+// an interface under it.
+func outlineGoType(s *ast.TypeSpec, tok token.Token, exportedOnly bool, add func(token.Pos, int, string), node func(ast.Node) string) {
+	name := s.Name.Name
+	if s.TypeParams != nil {
+		name += node(s.TypeParams)
+	}
+	var fields *ast.FieldList
+	kind := ""
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		fields, kind = t.Fields, "struct"
+	case *ast.InterfaceType:
+		fields, kind = t.Methods, "interface"
+	}
+	if fields == nil {
+		assign := " "
+		if s.Assign.IsValid() {
+			assign = " = "
+		}
+		add(s.Pos(), 0, tok.String()+" "+name+assign+node(s.Type))
+		return
+	}
+
+	add(s.Pos(), 0, tok.String()+" "+name+" "+kind)
+	for _, field := range fields.List {
+		text := node(field.Type)
+		if len(field.Names) > 0 {
+			var names []string
+			for _, n := range field.Names {
+				if !exportedOnly || ast.IsExported(n.Name) {
+					names = append(names, n.Name)
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			if fn, ok := field.Type.(*ast.FuncType); ok && kind == "interface" {
+				// Print interface methods as Name(args) results.
+				text = strings.TrimPrefix(node(fn), "func")
+				add(field.Pos(), 1, names[0]+text)
+				continue
+			}
+			text = strings.Join(names, ", ") + " " + text
+		}
+		add(field.Pos(), 1, text)
+	}
+}
+
+// receiverType returns the name of a method's receiver type.
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(t.X)
+	case *ast.IndexExpr:
+		return receiverType(t.X)
+	case *ast.IndexListExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// linePatterns match the lines that declare something, per language. The
+// name is the last submatch, so exported_only can inspect it.
+var linePatterns = map[string][]*regexp.Regexp{
+	"python": {
+		regexp.MustCompile(`^\s*class\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`),
+	},
+	"javascript": {
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`),
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?(?:interface|type|enum)\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let)\s+(\w+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:\([^)]*\)|\w+)\s*(?::[^=]+)?=>`),
+		regexp.MustCompile(`^\s+(?:(?:public|private|protected|static|readonly|async|get|set)\s+)*(\w+)\s*\([^)]*\)\s*(?::\s*[^{;]+)?\{\s*$`),
+	},
+	"rust": {
+		regexp.MustCompile(`^\s*(?:pub(?:\([\w:]+\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"\w+"\s+)?fn\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:pub(?:\([\w:]+\))?\s+)?(?:struct|enum|trait|type|mod|union)\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:unsafe\s+)?(impl)\b`),
+	},
+	"java": {
+		regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|abstract|final|sealed|data|open|partial)\s+)*(?:class|interface|enum|record|object|struct)\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|abstract|final|synchronized|override|virtual|async|suspend|open)\s+)+[\w<>\[\],.? ]*?\b(\w+)\s*\([^;]*$`),
+		regexp.MustCompile(`^\s*(?:(?:private|public|internal|override|suspend|inline)\s+)*fun\s+(?:<[^>]+>\s*)?(?:[\w.]+\.)?(\w+)`),
+	},
+	"ruby": {
+		regexp.MustCompile(`^\s*(?:class|module)\s+([\w:]+)`),
+		regexp.MustCompile(`^\s*def\s+(?:self\.)?(\w+[?!=]?)`),
+	},
+}
+
+// notDeclarations are words the looser patterns mistake for method names.
+var notDeclarations = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true,
+	"function": true, "new": true, "else": true, "do": true, "try": true, "with": true,
+}
+
+// outlineByPatterns lists the lines of path matching one of patterns.
+func outlineByPatterns(path string, patterns []*regexp.Regexp, exportedOnly bool) ([]outlineEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []outlineEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		for _, re := range patterns {
+			m := re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			name := m[len(m)-1]
+			if notDeclarations[name] || (exportedOnly && !exportedName(path, line, name)) {
+				break
+			}
+			indent := len(line) - len(strings.TrimLeft(line, " \t"))
+			text := strings.TrimRight(strings.TrimSpace(line), "{:")
+			text = strings.TrimSpace(text)
+			if len(text) > maxOutlineLine {
+				text = text[:maxOutlineLine] + " ..."
+			}
+			depth := 0
+			if indent > 0 {
+				depth = 1
+			}
+			entries = append(entries, outlineEntry{line: n, depth: depth, text: text})
+			break
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// exportedName guesses whether a declaration is public from its language's
+// conventions.
+func exportedName(path, line, name string) bool {
+	switch outlineLanguage(path) {
+	case "python", "ruby":
+		return !strings.HasPrefix(name, "_")
+	case "javascript":
+		// Top-level declarations are public when exported, class members
+		// unless marked private.
+		if line == strings.TrimLeft(line, " \t") {
+			return strings.HasPrefix(line, "export")
+		}
+		return !strings.Contains(line, "private ")
+	case "rust":
+		// An impl block is listed when its type is; its methods say pub.
+		return name == "impl" || strings.HasPrefix(strings.TrimSpace(line), "pub")
+	}
+	return !strings.Contains(line, "private ")
+}
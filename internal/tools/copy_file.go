@@ -0,0 +1,320 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- CopyFile Tool ---
+
+var CopyFileDefinition = ToolDefinition{
+	Name: "copy_file",
+	Description: `Copy a file or an entire directory to a new location.
+
+Directories are copied recursively. Missing parent directories of 'destination' are created.
+If 'destination' already exists the copy is refused unless 'overwrite' is true, and it can never be
+a directory that contains 'source'.
+Use this instead of reading and re-creating files when duplicating existing code.
+`,
+	InputSchema: GenerateSchema[CopyFileInput](),
+	Function:    CopyFile,
+	Category:    CategoryWrite,
+	Preview:     PreviewCopyFile,
+}
+
+type CopyFileInput struct {
+	Source      string `json:"source" jsonschema_description:"The relative path of the file or directory to copy."`
+	Destination string `json:"destination" jsonschema_description:"The relative path to copy to."`
+	Overwrite   bool   `json:"overwrite,omitempty" jsonschema_description:"Replace the destination if it already exists. Defaults to false."`
+}
+
+// plannedCopy is a validated copy and the files it touches.
+type plannedCopy struct {
+	src, dst string
+	info     os.FileInfo
+	// exists is set when the copy replaces the destination, removing the
+	// files listed in replaced.
+	exists   bool
+	dstIsDir bool
+	replaced []string
+	// targets lists every file the copy may overwrite or create.
+	targets []string
+	count   int
+}
+
+func CopyFile(ctx context.Context, input json.RawMessage) (string, error) {
+	copyFileInput := CopyFileInput{}
+	err := json.Unmarshal(input, &copyFileInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse copy_file input: %w", err)
+	}
+
+	c, err := planCopy(copyFileInput)
+	if err != nil {
+		return "", err
+	}
+	submoduleNote, err := checkSubmoduleEdit(c.dst)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkpointFiles(fmt.Sprintf("copy_file %s -> %s", filepath.ToSlash(c.src), filepath.ToSlash(c.dst)), c.targets...)
+	if err != nil {
+		return "", err
+	}
+	count, err := copyIntoPlace(c)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("\u001b[92mCopy success\u001b[0m: %s -> %s\n", c.src, c.dst)
+	return fmt.Sprintf("Copied %d file(s) from %s to %s", count, filepath.ToSlash(c.src), filepath.ToSlash(c.dst)) + submoduleNote, nil
+}
+
+// PreviewCopyFile describes a copy, and the files it replaces.
+func PreviewCopyFile(input json.RawMessage) (string, error) {
+	copyFileInput := CopyFileInput{}
+	err := json.Unmarshal(input, &copyFileInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse copy_file input: %w", err)
+	}
+	c, err := planCopy(copyFileInput)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\u001b[93mCopy\u001b[0m %s -> %s (%d file(s))\n", filepath.ToSlash(c.src), filepath.ToSlash(c.dst), c.count)
+	switch {
+	case c.exists && !c.dstIsDir && !c.info.IsDir():
+		// A file replaced by another shows how it changes.
+		oldContent, err := os.ReadFile(c.dst)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %s: %w", c.dst, err)
+		}
+		newContent, err := os.ReadFile(c.src)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %s: %w", c.src, err)
+		}
+		sb.WriteString(ColorizeDiff(UnifiedDiff(filepath.ToSlash(c.dst), string(oldContent), string(newContent))))
+	case c.exists && !c.dstIsDir:
+		fmt.Fprintf(&sb, "\u001b[91mReplaces\u001b[0m the existing file %s\n", filepath.ToSlash(c.dst))
+	case c.exists:
+		fmt.Fprintf(&sb, "\u001b[91mReplaces\u001b[0m the existing %s and the %d file(s) in it:\n", filepath.ToSlash(c.dst), len(c.replaced))
+		for i, file := range c.replaced {
+			if i == maxDeletePreviewFiles {
+				fmt.Fprintf(&sb, "  ... and %d more\n", len(c.replaced)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "  %s\n", filepath.ToSlash(file))
+		}
+	}
+	return sb.String(), nil
+}
+
+func planCopy(copyFileInput CopyFileInput) (plannedCopy, error) {
+	var c plannedCopy
+	if copyFileInput.Source == "" || copyFileInput.Destination == "" {
+		return c, fmt.Errorf("source and destination cannot be empty")
+	}
+	c.src = filepath.Clean(copyFileInput.Source)
+	c.dst = filepath.Clean(copyFileInput.Destination)
+	if c.src == c.dst {
+		return c, fmt.Errorf("source and destination cannot be the same path")
+	}
+
+	info, err := os.Stat(c.src)
+	if err != nil {
+		return c, fmt.Errorf("failed to stat source %s: %w", c.src, err)
+	}
+	c.info = info
+
+	// Replacing a directory that holds the source would delete it, and
+	// copying a directory into itself would never end.
+	absSrc, err := filepath.Abs(c.src)
+	if err != nil {
+		return c, err
+	}
+	absDst, err := filepath.Abs(c.dst)
+	if err != nil {
+		return c, err
+	}
+	if rel, err := filepath.Rel(absDst, absSrc); err == nil && !outsideDir(rel) {
+		return c, fmt.Errorf("cannot copy %s to %s, which contains it", c.src, c.dst)
+	}
+	if info.IsDir() {
+		if rel, err := filepath.Rel(absSrc, absDst); err == nil && !outsideDir(rel) {
+			return c, fmt.Errorf("cannot copy directory %s into itself", c.src)
+		}
+	}
+
+	dstInfo, err := os.Stat(c.dst)
+	switch {
+	case err == nil && !copyFileInput.Overwrite:
+		return c, fmt.Errorf("destination %s already exists; set overwrite to true to replace it", c.dst)
+	case err == nil:
+		c.exists = true
+		c.dstIsDir = dstInfo.IsDir()
+		c.replaced, err = regularFilesUnder(c.dst)
+		if err != nil {
+			return c, fmt.Errorf("failed to scan destination %s: %w", c.dst, err)
+		}
+	case !os.IsNotExist(err):
+		return c, fmt.Errorf("failed to stat destination %s: %w", c.dst, err)
+	}
+
+	c.targets, err = copyTargets(c.src, c.dst, info.IsDir())
+	if err != nil {
+		return c, err
+	}
+	c.count = 1
+	if info.IsDir() {
+		files, err := regularFilesUnder(c.src)
+		if err != nil {
+			return c, fmt.Errorf("failed to scan source %s: %w", c.src, err)
+		}
+		c.count = len(files)
+	}
+	return c, nil
+}
+
+// copyIntoPlace copies to a temporary path beside the destination and
+// renames the copy into place, so an existing destination is only removed
+// once the copy is complete.
+func copyIntoPlace(c plannedCopy) (int, error) {
+	parent := filepath.Dir(c.dst)
+	err := os.MkdirAll(parent, 0755)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(parent, ".copy-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmp := filepath.Join(tmpDir, filepath.Base(c.dst))
+
+	count := 1
+	if c.info.IsDir() {
+		count, err = copyDir(c.src, tmp)
+	} else {
+		err = copyRegularFile(c.src, tmp, c.info.Mode())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if c.exists {
+		err = os.RemoveAll(c.dst)
+		if err != nil {
+			return 0, fmt.Errorf("failed to remove existing destination %s: %w", c.dst, err)
+		}
+	}
+	err = os.Rename(tmp, c.dst)
+	if err != nil {
+		return 0, fmt.Errorf("failed to move the copy to %s: %w", c.dst, err)
+	}
+	return count, nil
+}
+
+// copyTargets lists the files a copy may overwrite or create: every file
+// already under dst and the destination of every file under src.
+func copyTargets(src, dst string, isDir bool) ([]string, error) {
+	var targets []string
+	err := filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			targets = append(targets, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan destination %s: %w", dst, err)
+	}
+	if !isDir {
+		return append(targets, dst), nil
+	}
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, filepath.Join(dst, relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan source %s: %w", src, err)
+	}
+	return targets, nil
+}
+
+func copyDir(src, dst string) (int, error) {
+	count := 0
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			// Symlinks, sockets and devices are skipped rather than followed.
+			return nil
+		}
+		count++
+		return copyRegularFile(path, target, info.Mode())
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to copy directory %s: %w", src, err)
+	}
+	return count, nil
+}
+
+func copyRegularFile(src, dst string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
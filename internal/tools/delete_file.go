@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxDeletePreviewFiles bounds how many files a delete preview lists.
+const maxDeletePreviewFiles = 20
+
+// --- DeleteFile Tool ---
+
+var DeleteFileDefinition = ToolDefinition{
+	Name: "delete_file",
+	Description: `Delete a file, or a directory with everything in it, from the workspace.
+
+Directories are only deleted when 'recursive' is true. Paths outside the workspace, the
+workspace root and the .git and .agent directories are refused. The deleted files are
+checkpointed, so undo_last_edit brings them back.
+Use this to remove files made obsolete by a refactor; search for references to them first.
+`,
+	InputSchema: withDryRun(GenerateSchema[DeleteFileInput]()),
+	Function:    DeleteFile,
+	Category:    CategoryWrite,
+	Preview:     PreviewDeleteFile,
+}
+
+type DeleteFileInput struct {
+	Path      string `json:"path" jsonschema_description:"The relative path of the file or directory to delete."`
+	Recursive bool   `json:"recursive,omitempty" jsonschema_description:"Allow deleting a directory and everything in it. Defaults to false."`
+}
+
+func DeleteFile(ctx context.Context, input json.RawMessage) (string, error) {
+	deleteInput := DeleteFileInput{}
+	err := json.Unmarshal(input, &deleteInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse delete_file input: %w", err)
+	}
+
+	path, files, err := planDelete(deleteInput)
+	if err != nil {
+		return "", err
+	}
+	submoduleNote, err := checkSubmoduleEdit(path)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkpointFiles("delete_file "+path, files...)
+	if err != nil {
+		return "", err
+	}
+	err = os.RemoveAll(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete %s: %w", path, err)
+	}
+
+	fmt.Printf("\u001b[92mDelete success\u001b[0m: Deleted %s\n", path)
+	return fmt.Sprintf("Deleted %s (%d file(s))", filepath.ToSlash(path), len(files)) + submoduleNote, nil
+}
+
+// PreviewDeleteFile shows what a delete would remove: the lines of a file,
+// or the files of a directory.
+func PreviewDeleteFile(input json.RawMessage) (string, error) {
+	deleteInput := DeleteFileInput{}
+	err := json.Unmarshal(input, &deleteInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse delete_file input: %w", err)
+	}
+	path, files, err := planDelete(deleteInput)
+	if err != nil {
+		return "", err
+	}
+
+	if len(files) == 1 && files[0] == path {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		return ColorizeDiff(UnifiedDiff(filepath.ToSlash(path), string(content), "")), nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\u001b[91mDelete\u001b[0m %s and the %d file(s) in it:\n", filepath.ToSlash(path), len(files))
+	for i, file := range files {
+		if i == maxDeletePreviewFiles {
+			fmt.Fprintf(&sb, "  ... and %d more\n", len(files)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "  %s\n", filepath.ToSlash(file))
+	}
+	return sb.String(), nil
+}
+
+// planDelete validates a delete and lists the files it removes.
+func planDelete(deleteInput DeleteFileInput) (string, []string, error) {
+	path, err := workspacePath(deleteInput.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.IsDir() && !deleteInput.Recursive {
+		return "", nil, fmt.Errorf("%s is a directory; set recursive to true to delete it with everything in it", path)
+	}
+
+	files, err := regularFilesUnder(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+	return path, files, nil
+}
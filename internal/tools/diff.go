@@ -0,0 +1,341 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change.
+const diffContextLines = 3
+
+// maxDiffEdits bounds the work done by the Myers search. Inputs that differ
+// by more lines than this are reported as a whole-block replacement.
+const maxDiffEdits = 2000
+
+// diffOp is a single line of a line-based diff. Kind is ' ' for context,
+// '-' for a removed line and '+' for an added line. Line keeps its trailing
+// newline, if any, so that a missing final newline shows up as a change.
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// Hunk is a contiguous group of changes plus surrounding context lines.
+// Start positions are 1-based, as in unified diff headers.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	ops      []diffOp
+}
+
+// splitLines splits text into lines that keep their "\n" terminator.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a minimal line diff between a and b.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// myersDiff implements the greedy O(ND) algorithm from Myers' "An O(ND)
+// Difference Algorithm and Its Variations".
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(a, b)
+	}
+
+	// v[k] holds the furthest x reached on diagonal k; trace[d] keeps the
+	// diagonals -d..d as they were before round d, for backtracking.
+	v := map[int]int{1: 0}
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && d <= maxDiffEdits; d++ {
+		snapshot := make([]int, 2*d+1)
+		for k := -d; k <= d; k++ {
+			snapshot[k+d] = v[k]
+		}
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1] < v[k+1]) {
+				x = v[k+1]
+			} else {
+				x = v[k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return replaceAll(a, b)
+	}
+
+	var reversed []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		at := func(k int) int {
+			if k < -d || k > d {
+				return 0
+			}
+			return trace[d][k+d]
+		}
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffOp{'+', b[y-1]})
+				y--
+			} else {
+				reversed = append(reversed, diffOp{'-', a[x-1]})
+				x--
+			}
+		}
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+func replaceAll(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+// makeHunks groups diff operations into hunks with the given context size.
+func makeHunks(ops []diffOp, context int) []Hunk {
+	var hunks []Hunk
+	oldLine, newLine := 1, 1
+	i := 0
+	for i < len(ops) {
+		if ops[i].Kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Back up over leading context.
+		start := i
+		for start > 0 && i-start < context && ops[start-1].Kind == ' ' {
+			start--
+		}
+		hunk := Hunk{OldStart: oldLine - (i - start), NewStart: newLine - (i - start)}
+
+		// Extend until we see more than 2*context unchanged lines in a row.
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != ' ' {
+				end++
+				continue
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].Kind == ' ' {
+				run++
+			}
+			if end+run == len(ops) || run > 2*context {
+				end += min(run, context)
+				break
+			}
+			end += run
+		}
+
+		hunk.ops = ops[start:end]
+		for _, op := range hunk.ops {
+			if op.Kind != '+' {
+				hunk.OldLines++
+			}
+			if op.Kind != '-' {
+				hunk.NewLines++
+			}
+		}
+		for _, op := range ops[i:end] {
+			if op.Kind != '+' {
+				oldLine++
+			}
+			if op.Kind != '-' {
+				newLine++
+			}
+		}
+		hunks = append(hunks, hunk)
+		i = end
+	}
+	return hunks
+}
+
+// header renders the hunk's @@ line.
+func (h Hunk) header() string {
+	oldStart, newStart := h.OldStart, h.NewStart
+	if h.OldLines == 0 {
+		oldStart--
+	}
+	if h.NewLines == 0 {
+		newStart--
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, h.OldLines, newStart, h.NewLines)
+}
+
+// String renders the hunk in unified diff format.
+func (h Hunk) String() string {
+	var sb strings.Builder
+	sb.WriteString(h.header())
+	for _, op := range h.ops {
+		sb.WriteByte(op.Kind)
+		sb.WriteString(op.Line)
+		if !strings.HasSuffix(op.Line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
+
+// UnifiedDiff returns a unified diff between the old and new content of a
+// file, or an empty string if they are identical.
+func UnifiedDiff(path, oldContent, newContent string) string {
+	hunks := makeHunks(diffLines(splitLines(oldContent), splitLines(newContent)), diffContextLines)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+	for _, h := range hunks {
+		sb.WriteString(h.String())
+	}
+	return sb.String()
+}
+
+// SideBySideDiff renders the changes between the old and new content of a
+// file in two columns of numbered lines, the old one on the left, fitting
+// width. As with diff -y, changed lines are marked |, removed lines < and
+// added lines >. It returns an empty string if the contents are identical.
+func SideBySideDiff(path, oldContent, newContent string, width int) string {
+	hunks := makeHunks(diffLines(splitLines(oldContent), splitLines(newContent)), diffContextLines)
+	if len(hunks) == 0 {
+		return ""
+	}
+	column := max((width-3)/2, 20)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+	for _, h := range hunks {
+		sb.WriteString(h.header())
+		oldLine, newLine := h.OldStart, h.NewStart
+		for i := 0; i < len(h.ops); {
+			if h.ops[i].Kind == ' ' {
+				writeSideBySide(&sb, column, oldLine, h.ops[i].Line, ' ', newLine, h.ops[i].Line)
+				oldLine++
+				newLine++
+				i++
+				continue
+			}
+			// A run of changes pairs its removed lines with its added ones.
+			var removed, added []string
+			for ; i < len(h.ops) && h.ops[i].Kind != ' '; i++ {
+				if h.ops[i].Kind == '-' {
+					removed = append(removed, h.ops[i].Line)
+				} else {
+					added = append(added, h.ops[i].Line)
+				}
+			}
+			for j := 0; j < max(len(removed), len(added)); j++ {
+				switch {
+				case j >= len(added):
+					writeSideBySide(&sb, column, oldLine, removed[j], '<', 0, "")
+					oldLine++
+				case j >= len(removed):
+					writeSideBySide(&sb, column, 0, "", '>', newLine, added[j])
+					newLine++
+				default:
+					writeSideBySide(&sb, column, oldLine, removed[j], '|', newLine, added[j])
+					oldLine++
+					newLine++
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+// writeSideBySide writes a row of a side-by-side diff. A line number of 0
+// leaves its side empty.
+func writeSideBySide(sb *strings.Builder, column, oldLine int, oldText string, mark byte, newLine int, newText string) {
+	row := sideBySideCell(column, oldLine, oldText) + " " + string(mark) + " " + sideBySideCell(column, newLine, newText)
+	sb.WriteString(strings.TrimRight(row, " "))
+	sb.WriteByte('\n')
+}
+
+// sideBySideCell renders a numbered line cut or padded to width, with tabs
+// expanded so the columns line up.
+func sideBySideCell(width, number int, text string) string {
+	if number == 0 {
+		return strings.Repeat(" ", width)
+	}
+	text = strings.TrimRight(text, "\r\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	runes := []rune(fmt.Sprintf("%5d %s", number, text))
+	if len(runes) > width {
+		runes = append(runes[:width-1], '…')
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
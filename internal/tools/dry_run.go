@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/invopop/jsonschema"
+)
+
+// DryRun makes every tool that changes files show what it would change
+// instead of changing it, for the whole session. A single call can ask for
+// the same with its dry_run parameter.
+var DryRun bool
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// withDryRun adds the dry_run parameter to the input schema of a tool that
+// changes files and can preview the change.
+func withDryRun(schema map[string]interface{}) map[string]interface{} {
+	properties, ok := schema["properties"].(interface {
+		Set(key string, value *jsonschema.Schema) (*jsonschema.Schema, bool)
+	})
+	if ok {
+		properties.Set("dry_run", &jsonschema.Schema{
+			Type:        "boolean",
+			Description: "Only show the changes this call would make, without making them. Defaults to false.",
+		})
+	}
+	return schema
+}
+
+// handlesDryRun reports whether tool has a dry_run parameter of its own,
+// rather than one added by withDryRun, and so makes its dry runs itself.
+func handlesDryRun(tool ToolDefinition) bool {
+	if tool.Preview != nil {
+		return false
+	}
+	schema, ok := tool.InputSchema.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	properties, ok := schema["properties"].(interface {
+		Get(key string) (*jsonschema.Schema, bool)
+	})
+	if !ok {
+		return false
+	}
+	_, ok = properties.Get("dry_run")
+	return ok
+}
+
+// IsDryRun reports whether a call to tool should only show what it would
+// change, because of DryRun or the call's dry_run parameter. Only tools in
+// CategoryWrite are affected; commands still run.
+func IsDryRun(tool ToolDefinition, input json.RawMessage) bool {
+	if tool.Category != CategoryWrite {
+		return false
+	}
+	if DryRun {
+		return true
+	}
+	var call struct {
+		DryRun bool `json:"dry_run"`
+	}
+	return json.Unmarshal(input, &call) == nil && call.DryRun
+}
+
+// RunDry previews a call to tool without running it. It returns the preview
+// as shown to the user and the result for the model. Tools with a dry_run
+// parameter of their own are run with it set; other tools without a
+// preview are not run at all.
+func RunDry(ctx context.Context, tool ToolDefinition, input json.RawMessage) (shown string, result string, err error) {
+	if handlesDryRun(tool) {
+		var args map[string]json.RawMessage
+		if err := json.Unmarshal(input, &args); err != nil || args == nil {
+			args = map[string]json.RawMessage{}
+		}
+		args["dry_run"] = json.RawMessage("true")
+		input, err = json.Marshal(args)
+		if err != nil {
+			return "", "", err
+		}
+		result, err = tool.Function(ctx, input)
+		return result, result, err
+	}
+
+	preview := tool.DryRunPreview
+	if preview == nil {
+		preview = tool.Preview
+	}
+	if preview == nil {
+		return "", "", fmt.Errorf("%s was not run: it cannot be previewed in a dry run", tool.Name)
+	}
+	shown, err = preview(input)
+	if err != nil {
+		return "", "", err
+	}
+	if shown == "" {
+		return "", fmt.Sprintf("Dry run: %s was not run; it would not change any files.", tool.Name), nil
+	}
+	result = fmt.Sprintf("Dry run: %s was not run and nothing was changed; later calls see the files as they were. It would have made these changes:\n%s",
+		tool.Name, ansiPattern.ReplaceAllString(shown, ""))
+	return shown, result, nil
+}
@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- EditFiles Tool ---
+
+var EditFilesDefinition = ToolDefinition{
+	Name: "edit_files",
+	Description: `Make several edits across one or more files as a single change that either fully applies or
+not at all.
+
+Each edit replaces 'old_str' with 'new_str' in its file, like edit_file, including its
+'expected_occurrences' and 'replace_all' checks; edits to the same file are applied in order, each
+to the result of the previous one. Every edit is checked before anything is written, and if
+writing any file fails all files are restored. An empty 'old_str' creates a file that does not
+exist yet. Returns a unified diff per file. Use this for changes that must land together, such as
+renaming a function and its callers.
+`,
+	InputSchema: withDryRun(GenerateSchema[EditFilesInput]()),
+	Function:    EditFiles,
+	Category:    CategoryWrite,
+	Preview:     PreviewEditFiles,
+}
+
+type EditFilesInput struct {
+	Edits []EditFileInput `json:"edits" jsonschema_description:"The edits to make, in order."`
+}
+
+// plannedFile is the outcome of the edits to one file, computed before
+// anything is written.
+type plannedFile struct {
+	path       string
+	oldContent string
+	newContent string
+	exists     bool
+}
+
+func EditFiles(ctx context.Context, input json.RawMessage) (string, error) {
+	editFilesInput := EditFilesInput{}
+	err := json.Unmarshal(input, &editFilesInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse edit_files input: %w", err)
+	}
+
+	files, err := planEdits(editFilesInput.Edits)
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+	var submoduleNotes strings.Builder
+	for _, f := range files {
+		paths = append(paths, f.path)
+		note, err := checkSubmoduleEdit(f.path)
+		if err != nil {
+			return "", err
+		}
+		submoduleNotes.WriteString(note)
+	}
+
+	err = checkpointFiles("edit_files", paths...)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		err := writePlannedFile(f)
+		if err != nil {
+			// Leave the tree as we found it rather than half-edited.
+			if _, restoreErr := Checkpoints.Undo(1); restoreErr != nil {
+				return "", fmt.Errorf("%v; rollback failed: %w", err, restoreErr)
+			}
+			return "", fmt.Errorf("%w; all changes rolled back", err)
+		}
+	}
+
+	diff := plannedDiff(files)
+	fmt.Printf("\u001b[92mEdit success\u001b[0m: Edited %d file(s)\n", len(files))
+	printDiff("edit_files", diff)
+	return fmt.Sprintf("Edited %d file(s) with %d edit(s):\n%s", len(files), len(editFilesInput.Edits), diff) + submoduleNotes.String() +
+		runPostEditHooks(paths...), nil
+}
+
+// PreviewEditFiles renders the combined diff an edit_files call would make.
+func PreviewEditFiles(input json.RawMessage) (string, error) {
+	editFilesInput := EditFilesInput{}
+	err := json.Unmarshal(input, &editFilesInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse edit_files input: %w", err)
+	}
+	files, err := planEdits(editFilesInput.Edits)
+	if err != nil {
+		return "", err
+	}
+	return ColorizeDiff(plannedDiff(files)), nil
+}
+
+// planEdits applies edits in memory, failing on the first one that does not
+// apply, and returns the files they change in the order first edited.
+func planEdits(edits []EditFileInput) ([]*plannedFile, error) {
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("edits cannot be empty")
+	}
+
+	var files []*plannedFile
+	byPath := map[string]*plannedFile{}
+	for i, edit := range edits {
+		err := validateEdit(edit)
+		if err != nil {
+			return nil, fmt.Errorf("edit %d: %w", i+1, err)
+		}
+		key := filepath.Clean(edit.Path)
+		f := byPath[key]
+		if f == nil {
+			f = &plannedFile{path: edit.Path}
+			content, err := os.ReadFile(edit.Path)
+			switch {
+			case err == nil:
+				f.oldContent, f.exists = string(content), true
+			case !os.IsNotExist(err):
+				return nil, fmt.Errorf("edit %d: failed to read file %s: %w", i+1, edit.Path, err)
+			case edit.OldStr != "":
+				return nil, fmt.Errorf("edit %d: file %s does not exist; use an empty old_str to create it", i+1, edit.Path)
+			}
+			f.newContent = f.oldContent
+			byPath[key] = f
+			files = append(files, f)
+		}
+
+		f.newContent, _, err = replaceOccurrences(f.newContent, edit)
+		if err != nil {
+			return nil, fmt.Errorf("edit %d: %w", i+1, err)
+		}
+	}
+	return files, nil
+}
+
+func writePlannedFile(f *plannedFile) error {
+	if dir := filepath.Dir(f.path); !f.exists && dir != "." {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	err := os.WriteFile(f.path, []byte(f.newContent), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// plannedDiff is the combined diff of the planned files.
+func plannedDiff(files []*plannedFile) string {
+	var sb strings.Builder
+	for _, f := range files {
+		sb.WriteString(UnifiedDiff(f.path, f.oldContent, f.newContent))
+	}
+	return sb.String()
+}
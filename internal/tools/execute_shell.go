@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+const (
+	defaultShellTimeout = 120 * time.Second
+	maxShellTimeout     = 10 * time.Minute
+	// commandGrace is how much longer than their own limit the agent waits
+	// for tools that run commands, in case a killed process does not exit.
+	commandGrace = 30 * time.Second
+	// maxShellOutput is how much of each output stream is returned to the
+	// model; the end of the output is kept since that is where errors are.
+	maxShellOutput = 8000
+)
+
+// --- ExecuteShell Tool ---
+
+var ExecuteShellDefinition = ToolDefinition{
+	Name: "execute_shell",
+	Description: `Run a shell command in the workspace, for example to build the project or run its tests.
+
+Returns a JSON object with the command's exit_code, stdout, stderr, duration_ms and whether it timed_out.
+A non-zero exit code is not a tool failure; read stderr to find out what went wrong. Long output is
+truncated to its last part. The command runs with 'sh -c' (cmd /C on Windows) and is killed after
+'timeout_seconds' (default 120, at most 600).
+`,
+	InputSchema: GenerateSchema[ExecuteShellInput](),
+	Function:    ExecuteShell,
+	Category:    CategoryExecute,
+	Preview:     PreviewExecuteShell,
+	Timeout:     maxShellTimeout + commandGrace,
+}
+
+type ExecuteShellInput struct {
+	Command        string `json:"command" jsonschema_description:"The shell command to run, e.g. go test ./..."`
+	Workdir        string `json:"workdir,omitempty" jsonschema_description:"The relative directory to run the command in. Defaults to the current directory."`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" jsonschema_description:"How long the command may run before it is killed. Defaults to 120, at most 600."`
+}
+
+type ExecuteShellResult struct {
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMS int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out"`
+}
+
+func ExecuteShell(ctx context.Context, input json.RawMessage) (string, error) {
+	shellInput := ExecuteShellInput{}
+	err := json.Unmarshal(input, &shellInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse execute_shell input: %w", err)
+	}
+	if shellInput.Command == "" {
+		return "", fmt.Errorf("command cannot be empty")
+	}
+
+	timeout := defaultShellTimeout
+	if shellInput.TimeoutSeconds > 0 {
+		timeout = time.Duration(shellInput.TimeoutSeconds) * time.Second
+	}
+	if timeout > maxShellTimeout {
+		timeout = maxShellTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name, args := "sh", []string{"-c", shellInput.Command}
+	if runtime.GOOS == "windows" {
+		name, args = "cmd", []string{"/C", shellInput.Command}
+	}
+
+	fmt.Printf("\u001b[92mtool\u001b[0m: $ %s\n", shellInput.Command)
+	result, err := shell.Run(ctx, shellInput.Workdir, name, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to run %q: %w", shellInput.Command, err)
+	}
+
+	// Commands are full of <, > and &; keep them readable for the model.
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(ExecuteShellResult{
+		Command:    shellInput.Command,
+		ExitCode:   result.ExitCode,
+		Stdout:     tailOutput(result.Stdout, maxShellOutput),
+		Stderr:     tailOutput(result.Stderr, maxShellOutput),
+		DurationMS: result.Duration.Milliseconds(),
+		TimedOut:   result.TimedOut,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode execute_shell result: %w", err)
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// PreviewExecuteShell shows the command an execute_shell call would run.
+func PreviewExecuteShell(input json.RawMessage) (string, error) {
+	shellInput := ExecuteShellInput{}
+	err := json.Unmarshal(input, &shellInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse execute_shell input: %w", err)
+	}
+	preview := fmt.Sprintf("\u001b[1m$ %s\u001b[0m\n", shellInput.Command)
+	if shellInput.Workdir != "" {
+		preview += fmt.Sprintf("  (in %s)\n", shellInput.Workdir)
+	}
+	return preview, nil
+}
+
+// tailOutput keeps the last limit bytes of output, noting how much was cut.
+func tailOutput(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	return fmt.Sprintf("[%d bytes truncated]\n%s", len(output)-limit, output[len(output)-limit:])
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+const (
+	defaultExternalTimeout = 60 * time.Second
+	// maxExternalOutput is how much of an external tool's output is
+	// returned to the model.
+	maxExternalOutput = 16000
+)
+
+// toolNamePattern is what the model APIs accept as a tool name.
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ExternalTool is a tool implemented by an executable rather than built in,
+// so teams can add their own tools without recompiling the agent. The
+// executable receives the call's arguments as a JSON object on stdin and
+// writes the result for the model to stdout; a non-zero exit status fails
+// the call, with stderr as the error.
+type ExternalTool struct {
+	Name        string
+	Description string
+	Command     string
+	Args        []string
+	// Schema is the JSON schema of the arguments; by default the tool takes
+	// none.
+	Schema map[string]interface{}
+	// Category is CategoryExecute unless set. Calls to tools in other
+	// categories than CategoryRead are shown to the user for approval.
+	Category Category
+	Timeout  time.Duration
+}
+
+// NewExternalTool returns the definition of the tool t describes. It fails
+// when t is incomplete or its command cannot be found.
+func NewExternalTool(t ExternalTool) (ToolDefinition, error) {
+	if !toolNamePattern.MatchString(t.Name) {
+		return ToolDefinition{}, fmt.Errorf("invalid tool name %q: use up to 64 letters, digits, _ and -", t.Name)
+	}
+	if strings.TrimSpace(t.Description) == "" {
+		return ToolDefinition{}, fmt.Errorf("tool %s has no description", t.Name)
+	}
+	path, err := exec.LookPath(t.Command)
+	if err != nil {
+		return ToolDefinition{}, fmt.Errorf("tool %s: %w", t.Name, err)
+	}
+	t.Command = path
+	switch t.Category {
+	case "":
+		t.Category = CategoryExecute
+	case CategoryRead, CategoryWrite, CategoryExecute:
+	default:
+		return ToolDefinition{}, fmt.Errorf("tool %s has unknown category %q (expected read, write or execute)", t.Name, t.Category)
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = defaultExternalTimeout
+	}
+	schema := t.Schema
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+
+	tool := ToolDefinition{
+		Name:        t.Name,
+		Description: t.Description,
+		InputSchema: schema,
+		Function:    t.run,
+		Category:    t.Category,
+		Timeout:     t.Timeout,
+	}
+	if t.Category != CategoryRead {
+		tool.Preview = t.preview
+	}
+	return tool, nil
+}
+
+func (t ExternalTool) run(ctx context.Context, input json.RawMessage) (string, error) {
+	if len(input) == 0 {
+		input = json.RawMessage("{}")
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	fmt.Printf("\u001b[92mtool\u001b[0m: $ %s\n", t.commandLine())
+	result, err := shell.RunInput(ctx, "", input, t.Command, t.Args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", t.Name, err)
+	}
+	if result.TimedOut {
+		return "", fmt.Errorf("%s did not finish within %s", t.Name, t.Timeout)
+	}
+	if result.ExitCode != 0 {
+		message := strings.TrimSpace(result.Stderr)
+		if message == "" {
+			message = strings.TrimSpace(result.Stdout)
+		}
+		return "", fmt.Errorf("%s exited with status %d: %s", t.Name, result.ExitCode, tailOutput(message, maxShellOutput))
+	}
+	output := strings.TrimSpace(result.Stdout)
+	if len(output) > maxExternalOutput {
+		output = fmt.Sprintf("%s\n[%d bytes truncated]", output[:maxExternalOutput], len(output)-maxExternalOutput)
+	}
+	return output, nil
+}
+
+// preview shows the command a call would run and the arguments it would
+// receive.
+func (t ExternalTool) preview(input json.RawMessage) (string, error) {
+	arguments, err := json.MarshalIndent(json.RawMessage(input), "  ", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s input: %w", t.Name, err)
+	}
+	return fmt.Sprintf("\u001b[1m$ %s\u001b[0m\n  with %s\n", t.commandLine(), arguments), nil
+}
+
+func (t ExternalTool) commandLine() string {
+	return strings.Join(append([]string{t.Command}, t.Args...), " ")
+}
@@ -0,0 +1,448 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	fetchTimeout = 20 * time.Second
+	// maxFetchDownload bounds how much of a response is read at all.
+	maxFetchDownload = 2 << 20
+	// defaultFetchMaxBytes bounds the text returned when the model does not
+	// ask for less.
+	defaultFetchMaxBytes = 32 * 1024
+	maxFetchRedirects    = 5
+)
+
+// FetchDomains are the domains fetch_url may download from in addition to
+// defaultFetchDomains; "*" allows any domain. Subdomains of a listed domain
+// are allowed too.
+var FetchDomains []string
+
+// defaultFetchDomains are documentation and package sites, which is what the
+// model needs to read while editing code.
+var defaultFetchDomains = []string{
+	"pkg.go.dev", "go.dev", "golang.org",
+	"docs.python.org", "pypi.org", "readthedocs.io", "readthedocs.org",
+	"developer.mozilla.org", "nodejs.org", "npmjs.com", "typescriptlang.org",
+	"docs.rs", "doc.rust-lang.org", "crates.io",
+	"docs.oracle.com", "learn.microsoft.com", "kotlinlang.org", "ruby-doc.org",
+	"github.com", "raw.githubusercontent.com", "gitlab.com",
+	"stackoverflow.com", "en.wikipedia.org",
+}
+
+// --- FetchURL Tool ---
+
+var FetchURLDefinition = ToolDefinition{
+	Name: "fetch_url",
+	Description: `Download a web page or API response, e.g. library documentation, and return it as text.
+
+HTML pages are converted to Markdown-like text without scripts, styles and navigation; JSON and
+other text is returned as it is. Only http and https URLs on allowed domains can be fetched:
+documentation and package sites such as pkg.go.dev, docs.python.org, developer.mozilla.org,
+docs.rs and github.com, plus the domains the user configured. The text is cut off after
+'max_bytes'; use 'offset' to read further.
+`,
+	InputSchema: GenerateSchema[FetchURLInput](),
+	Function:    FetchURL,
+	Category:    CategoryRead,
+	Timeout:     fetchTimeout + 5*time.Second,
+}
+
+type FetchURLInput struct {
+	URL      string `json:"url" jsonschema_description:"The http or https URL to download."`
+	Offset   int    `json:"offset,omitempty" jsonschema_description:"The byte of the converted text to start from, to continue a page that was cut off."`
+	MaxBytes int    `json:"max_bytes,omitempty" jsonschema_description:"The most bytes of text to return. Defaults to 32768."`
+}
+
+func FetchURL(ctx context.Context, input json.RawMessage) (string, error) {
+	fetchInput := FetchURLInput{}
+	err := json.Unmarshal(input, &fetchInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse fetch_url input: %w", err)
+	}
+	target, err := url.Parse(strings.TrimSpace(fetchInput.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return "", fmt.Errorf("%q is not an http or https URL", fetchInput.URL)
+	}
+	if err := checkFetchDomain(target); err != nil {
+		return "", err
+	}
+
+	client := &http.Client{
+		Timeout: fetchTimeout,
+		// Redirects must stay on allowed domains too.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkFetchDomain(req.URL)
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "code-editing-agent")
+	req.Header.Set("Accept", "text/html, text/markdown, text/plain, application/json;q=0.9, */*;q=0.5")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchDownload+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", target, err)
+	}
+	truncated := len(body) > maxFetchDownload
+	if truncated {
+		body = body[:maxFetchDownload]
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var text string
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		text, err = htmlToText(body, resp.Request.URL)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", target, err)
+		}
+	case strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") || mediaType == "" || mediaType == "application/javascript":
+		text = string(body)
+	default:
+		return "", fmt.Errorf("%s is %s, not text", target, mediaType)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (HTTP %d, %s)\n\n", resp.Request.URL, resp.StatusCode, mediaType)
+	sb.WriteString(pageOf(text, fetchInput.Offset, fetchInput.MaxBytes))
+	if truncated {
+		fmt.Fprintf(&sb, "\n(The response was cut off after %d bytes.)\n", maxFetchDownload)
+	}
+	return sb.String(), nil
+}
+
+// checkFetchDomain fails unless u is on an allowed domain.
+func checkFetchDomain(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range append(defaultFetchDomains, FetchDomains...) {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+		if domain == "*" || host == domain || strings.HasSuffix(host, "."+domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not an allowed domain for fetch_url; the user can allow it with fetch_domains in the config", host)
+}
+
+// pageOf returns the part of text from offset, cut off after maxBytes with
+// a note on how to continue.
+func pageOf(text string, offset, maxBytes int) string {
+	if maxBytes <= 0 {
+		maxBytes = defaultFetchMaxBytes
+	}
+	if offset < 0 || offset > len(text) {
+		offset = len(text)
+	}
+	text = text[offset:]
+	if len(text) <= maxBytes {
+		return text
+	}
+	return fmt.Sprintf("%s\n(Output cut off at %d bytes of %d; continue with offset=%d.)\n", text[:maxBytes], maxBytes, len(text)+offset, offset+maxBytes)
+}
+
+// skippedElements hold no text worth reading.
+var skippedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Svg: true,
+	atom.Iframe: true, atom.Nav: true, atom.Footer: true, atom.Form: true, atom.Button: true,
+	atom.Head: true,
+}
+
+var (
+	trailingSpace = regexp.MustCompile(`[ \t]+\n`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText converts an HTML page to Markdown-like text: headings, lists,
+// links, code and tables are kept recognizable and everything that is not
+// content is dropped. The page's main or article element is preferred over
+// the whole body.
+func htmlToText(page []byte, base *url.URL) (string, error) {
+	doc, err := html.Parse(strings.NewReader(string(page)))
+	if err != nil {
+		return "", err
+	}
+	root := findElement(doc, atom.Main)
+	if root == nil {
+		root = findElement(doc, atom.Article)
+	}
+	if root == nil {
+		root = doc
+	}
+
+	c := &htmlConverter{base: base}
+	if title := findElement(doc, atom.Title); title != nil {
+		if text := strings.TrimSpace(textOf(title)); text != "" {
+			c.sb.WriteString("Title: " + text + "\n\n")
+		}
+	}
+	c.walk(root)
+	text := trailingSpace.ReplaceAllString(c.sb.String(), "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text) + "\n", nil
+}
+
+type htmlConverter struct {
+	sb   strings.Builder
+	base *url.URL
+	pre  int
+	list []int // per open list, the next number of an ordered one or 0
+}
+
+func (c *htmlConverter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+	if skippedElements[n.DataAtom] || hiddenElement(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		c.block()
+		c.sb.WriteString(strings.Repeat("#", level) + " ")
+		c.children(n)
+		c.block()
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Aside,
+		atom.Blockquote, atom.Dl, atom.Figure, atom.Details, atom.Summary:
+		c.block()
+		c.children(n)
+		c.block()
+	case atom.Br:
+		c.sb.WriteString("\n")
+	case atom.Hr:
+		c.block()
+		c.sb.WriteString("---")
+		c.block()
+	case atom.Pre:
+		c.block()
+		c.sb.WriteString("```\n")
+		c.pre++
+		c.children(n)
+		c.pre--
+		if !strings.HasSuffix(c.sb.String(), "\n") {
+			c.sb.WriteString("\n")
+		}
+		c.sb.WriteString("```")
+		c.block()
+	case atom.Code, atom.Kbd, atom.Samp:
+		if c.pre > 0 {
+			c.children(n)
+			return
+		}
+		c.sb.WriteString("`")
+		c.children(n)
+		c.sb.WriteString("`")
+	case atom.Strong, atom.B:
+		c.sb.WriteString("**")
+		c.children(n)
+		c.sb.WriteString("**")
+	case atom.Em, atom.I:
+		c.sb.WriteString("_")
+		c.children(n)
+		c.sb.WriteString("_")
+	case atom.A:
+		href := attr(n, "href")
+		text := strings.TrimSpace(textOf(n))
+		if href == "" || text == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+			c.children(n)
+			return
+		}
+		if u, err := c.base.Parse(href); err == nil {
+			href = u.String()
+		}
+		c.sb.WriteString("[")
+		c.children(n)
+		c.sb.WriteString("](" + href + ")")
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			c.sb.WriteString("[image: " + alt + "]")
+		}
+	case atom.Ul, atom.Ol:
+		next := 0
+		if n.DataAtom == atom.Ol {
+			next = 1
+		}
+		// Nested lists continue their item instead of starting a block.
+		nested := len(c.list) > 0
+		c.list = append(c.list, next)
+		if nested {
+			c.line()
+		} else {
+			c.block()
+		}
+		c.children(n)
+		c.list = c.list[:len(c.list)-1]
+		if nested {
+			c.line()
+		} else {
+			c.block()
+		}
+	case atom.Li:
+		c.line()
+		indent := strings.Repeat("  ", max(len(c.list)-1, 0))
+		marker := "- "
+		if len(c.list) > 0 && c.list[len(c.list)-1] > 0 {
+			marker = fmt.Sprintf("%d. ", c.list[len(c.list)-1])
+			c.list[len(c.list)-1]++
+		}
+		c.sb.WriteString(indent + marker)
+		c.children(n)
+		c.line()
+	case atom.Dt:
+		c.line()
+		c.children(n)
+		c.line()
+	case atom.Dd:
+		c.line()
+		c.sb.WriteString(": ")
+		c.children(n)
+		c.line()
+	case atom.Table:
+		c.block()
+		c.children(n)
+		c.block()
+	case atom.Tr:
+		c.line()
+		c.sb.WriteString("|")
+		c.children(n)
+		c.line()
+	case atom.Td, atom.Th:
+		c.sb.WriteString(" " + strings.Join(strings.Fields(textOf(n)), " ") + " |")
+	default:
+		c.children(n)
+	}
+}
+
+func (c *htmlConverter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(child)
+	}
+}
+
+// text writes a text node, with its whitespace collapsed outside <pre>.
+func (c *htmlConverter) text(data string) {
+	if c.pre > 0 {
+		c.sb.WriteString(data)
+		return
+	}
+	collapsed := strings.Join(strings.Fields(data), " ")
+	if collapsed == "" {
+		if data != "" && !c.atLineStart() && !strings.HasSuffix(c.sb.String(), " ") {
+			c.sb.WriteString(" ")
+		}
+		return
+	}
+	if startsWithSpace(data) && !c.atLineStart() && !strings.HasSuffix(c.sb.String(), " ") {
+		c.sb.WriteString(" ")
+	}
+	c.sb.WriteString(collapsed)
+	if endsWithSpace(data) {
+		c.sb.WriteString(" ")
+	}
+}
+
+// line starts a new line unless one was just started.
+func (c *htmlConverter) line() {
+	if !c.atLineStart() {
+		c.sb.WriteString("\n")
+	}
+}
+
+// block separates a block from what surrounds it with a blank line.
+func (c *htmlConverter) block() {
+	c.line()
+	c.sb.WriteString("\n")
+}
+
+func (c *htmlConverter) atLineStart() bool {
+	s := strings.TrimRight(c.sb.String(), " ")
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r\f", rune(s[0]))
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r\f", rune(s[len(s)-1]))
+}
+
+// hiddenElement reports elements marked as not shown.
+func hiddenElement(n *html.Node) bool {
+	if _, hidden := attrOK(n, "hidden"); hidden {
+		return true
+	}
+	return attr(n, "aria-hidden") == "true"
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	if n.Type == html.ElementNode && skippedElements[n.DataAtom] {
+		return ""
+	}
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		sb.WriteString(textOf(child))
+	}
+	return sb.String()
+}
+
+func attr(n *html.Node, name string) string {
+	value, _ := attrOK(n, name)
+	return value
+}
+
+func attrOK(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/tools"
+)
+
+// --- GitCheckout Tool ---
+
+var GitCheckoutDefinition = tools.ToolDefinition{
+	Name: "git_checkout",
+	Description: `Switch to a branch, or create a new branch and switch to it.
+
+Set 'create' to start a new branch, from 'start_point' if given or from the current commit otherwise.
+Uncommitted changes are carried over when they do not conflict; otherwise the checkout fails and
+the changes can be committed or set aside with git_stash first.
+`,
+	InputSchema: tools.GenerateSchema[GitCheckoutInput](),
+	Function:    GitCheckout,
+	Category:    tools.CategoryWrite,
+}
+
+type GitCheckoutInput struct {
+	Branch     string `json:"branch" jsonschema_description:"The branch to switch to or create."`
+	Create     bool   `json:"create,omitempty" jsonschema_description:"Create the branch instead of switching to an existing one."`
+	StartPoint string `json:"start_point,omitempty" jsonschema_description:"The commit or branch a new branch starts from. Only used with create."`
+}
+
+func GitCheckout(ctx context.Context, input json.RawMessage) (string, error) {
+	checkoutInput := GitCheckoutInput{}
+	err := json.Unmarshal(input, &checkoutInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_checkout input: %w", err)
+	}
+	err = checkArg("branch", checkoutInput.Branch)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"checkout"}
+	if checkoutInput.Create {
+		args = append(args, "-b", checkoutInput.Branch)
+		if checkoutInput.StartPoint != "" {
+			err = checkArg("start_point", checkoutInput.StartPoint)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, checkoutInput.StartPoint)
+		}
+	} else {
+		args = append(args, checkoutInput.Branch)
+	}
+	// The trailing -- makes git treat the branch as a revision, never a path.
+	args = append(args, "--")
+
+	_, err = RunContext(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := RunContext(ctx, "log", "-1", "--format=%h %s")
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mCheckout success\u001b[0m: %s\n", checkoutInput.Branch)
+	return fmt.Sprintf("Switched to branch %s at %s", checkoutInput.Branch, strings.TrimSpace(head)), nil
+}
@@ -0,0 +1,66 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/tools"
+)
+
+// --- GitCommit Tool ---
+
+var GitCommitDefinition = tools.ToolDefinition{
+	Name: "git_commit",
+	Description: `Commit changes to the given files.
+
+Only the listed files are staged and committed; other changes in the working tree, staged or not,
+are left alone. List every file you created, modified or deleted for the task. Write a message with
+a short summary line, a blank line, and an explanation of why the change was made if it is not obvious.
+`,
+	InputSchema: tools.GenerateSchema[GitCommitInput](),
+	Function:    GitCommit,
+	Category:    tools.CategoryWrite,
+}
+
+type GitCommitInput struct {
+	Message string   `json:"message" jsonschema_description:"The commit message."`
+	Files   []string `json:"files" jsonschema_description:"The relative paths of the files to commit."`
+}
+
+func GitCommit(ctx context.Context, input json.RawMessage) (string, error) {
+	commitInput := GitCommitInput{}
+	err := json.Unmarshal(input, &commitInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_commit input: %w", err)
+	}
+	if strings.TrimSpace(commitInput.Message) == "" {
+		return "", fmt.Errorf("message cannot be empty")
+	}
+	if len(commitInput.Files) == 0 {
+		return "", fmt.Errorf("files cannot be empty; list the files to commit")
+	}
+
+	// --all also stages deletions of the listed files.
+	args := append([]string{"add", "--all", "--"}, commitInput.Files...)
+	_, err = RunContext(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	// Committing with paths commits only those paths, even if other
+	// changes are staged.
+	args = append([]string{"commit", "--message", commitInput.Message, "--"}, commitInput.Files...)
+	_, err = RunContext(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	summary, err := RunContext(ctx, "log", "-1", "--stat", "--format=%h %s")
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mCommit success\u001b[0m: %s\n", strings.SplitN(summary, "\n", 2)[0])
+	return "Committed " + strings.TrimSpace(summary), nil
+}
@@ -0,0 +1,394 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"code-editing-agent/internal/project"
+	"code-editing-agent/internal/tools"
+)
+
+// maxBuildOutput is how much of the build log is returned to the model.
+const maxBuildOutput = 4000
+
+// conflict is one region delimited by conflict markers in a file.
+type conflict struct {
+	StartLine   int // 1-based line of the <<<<<<< marker
+	EndLine     int // 1-based line of the >>>>>>> marker
+	OursLabel   string
+	Ours        string
+	Base        string
+	HasBase     bool
+	Theirs      string
+	TheirsLabel string
+}
+
+// --- FindConflicts Tool ---
+
+var FindConflictsDefinition = tools.ToolDefinition{
+	Name: "find_conflicts",
+	Description: `Find unresolved merge conflicts.
+
+Without a path, lists every file git reports as conflicted. With a path, shows each conflict in that
+file numbered from 1, with "ours", "theirs" and the common merge base side by side.
+Use resolve_conflicts to apply a resolution.
+`,
+	InputSchema: tools.GenerateSchema[FindConflictsInput](),
+	Function:    FindConflicts,
+	Category:    tools.CategoryRead,
+}
+
+type FindConflictsInput struct {
+	Path string `json:"path,omitempty" jsonschema_description:"The relative path of a conflicted file. Leave empty to list all conflicted files."`
+}
+
+func FindConflicts(ctx context.Context, input json.RawMessage) (string, error) {
+	findInput := FindConflictsInput{}
+	err := json.Unmarshal(input, &findInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse find_conflicts input: %w", err)
+	}
+
+	if findInput.Path == "" {
+		files, err := conflictedFiles(ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(files) == 0 {
+			return "No conflicted files.", nil
+		}
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d conflicted file(s):\n", len(files))
+		for _, f := range files {
+			content, err := os.ReadFile(f)
+			if err != nil {
+				fmt.Fprintf(&sb, "%s: unreadable (%v)\n", f, err)
+				continue
+			}
+			fmt.Fprintf(&sb, "%s: %d conflict(s)\n", f, len(parseConflicts(string(content))))
+		}
+		return sb.String(), nil
+	}
+
+	conflicts, err := loadConflicts(ctx, findInput.Path)
+	if err != nil {
+		return "", err
+	}
+	if len(conflicts) == 0 {
+		return fmt.Sprintf("No conflict markers in %s.", findInput.Path), nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %d conflict(s)\n", findInput.Path, len(conflicts))
+	for i, c := range conflicts {
+		fmt.Fprintf(&sb, "\n=== conflict %d (lines %d-%d) ===\n", i+1, c.StartLine, c.EndLine)
+		fmt.Fprintf(&sb, "--- ours (%s) ---\n%s", c.OursLabel, c.Ours)
+		if c.HasBase {
+			fmt.Fprintf(&sb, "--- base ---\n%s", c.Base)
+		} else {
+			sb.WriteString("--- base ---\n(unavailable)\n")
+		}
+		fmt.Fprintf(&sb, "--- theirs (%s) ---\n%s", c.TheirsLabel, c.Theirs)
+	}
+	return sb.String(), nil
+}
+
+// --- ResolveConflicts Tool ---
+
+var ResolveConflictsDefinition = tools.ToolDefinition{
+	Name: "resolve_conflicts",
+	Description: `Resolve merge conflicts in one file.
+
+Each resolution picks a conflict by its number from find_conflicts and a choice: "ours", "theirs",
+"base", "both" (ours followed by theirs) or "custom" with the merged text in 'content'.
+The user reviews the resulting diff before it is written. Once no markers remain the file is staged,
+and when the last conflicted file is resolved the project build is run to verify the result.
+`,
+	InputSchema: tools.GenerateSchema[ResolveConflictsInput](),
+	Function:    ResolveConflicts,
+	Category:    tools.CategoryWrite,
+}
+
+type ResolveConflictsInput struct {
+	Path        string       `json:"path" jsonschema_description:"The relative path of the conflicted file."`
+	Resolutions []Resolution `json:"resolutions" jsonschema_description:"How to resolve each conflict in the file."`
+}
+
+type Resolution struct {
+	Index   int    `json:"index" jsonschema_description:"The 1-based conflict number reported by find_conflicts."`
+	Choice  string `json:"choice" jsonschema:"enum=ours,enum=theirs,enum=base,enum=both,enum=custom" jsonschema_description:"Which side to keep."`
+	Content string `json:"content,omitempty" jsonschema_description:"The merged text when choice is custom."`
+}
+
+func ResolveConflicts(ctx context.Context, input json.RawMessage) (string, error) {
+	resolveInput := ResolveConflictsInput{}
+	err := json.Unmarshal(input, &resolveInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse resolve_conflicts input: %w", err)
+	}
+	if resolveInput.Path == "" {
+		return "", fmt.Errorf("path cannot be empty")
+	}
+	if len(resolveInput.Resolutions) == 0 {
+		return "", fmt.Errorf("resolutions cannot be empty")
+	}
+
+	info, err := os.Stat(resolveInput.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", resolveInput.Path, err)
+	}
+	raw, err := os.ReadFile(resolveInput.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", resolveInput.Path, err)
+	}
+	oldContent := string(raw)
+	conflicts, err := loadConflicts(ctx, resolveInput.Path)
+	if err != nil {
+		return "", err
+	}
+	if len(conflicts) == 0 {
+		return "", fmt.Errorf("no conflict markers in %s", resolveInput.Path)
+	}
+
+	replacements := map[int]string{}
+	for _, r := range resolveInput.Resolutions {
+		if r.Index < 1 || r.Index > len(conflicts) {
+			return "", fmt.Errorf("conflict %d does not exist; %s has %d conflict(s)", r.Index, resolveInput.Path, len(conflicts))
+		}
+		c := conflicts[r.Index-1]
+		switch r.Choice {
+		case "ours":
+			replacements[r.Index-1] = c.Ours
+		case "theirs":
+			replacements[r.Index-1] = c.Theirs
+		case "both":
+			replacements[r.Index-1] = c.Ours + c.Theirs
+		case "base":
+			if !c.HasBase {
+				return "", fmt.Errorf("merge base for conflict %d is unavailable", r.Index)
+			}
+			replacements[r.Index-1] = c.Base
+		case "custom":
+			content := r.Content
+			if content != "" && !strings.HasSuffix(content, "\n") {
+				content += "\n"
+			}
+			replacements[r.Index-1] = content
+		default:
+			return "", fmt.Errorf("invalid choice %q for conflict %d", r.Choice, r.Index)
+		}
+	}
+
+	newContent := applyResolutions(oldContent, conflicts, replacements)
+	diff := tools.UnifiedDiff(resolveInput.Path, oldContent, newContent)
+	fmt.Print(tools.ColorizeDiff(diff))
+	if !tools.Confirm(fmt.Sprintf("Apply this resolution to %s?", resolveInput.Path)) {
+		return "", fmt.Errorf("resolution for %s rejected by the user", resolveInput.Path)
+	}
+
+	err = tools.CheckpointFiles("resolve_conflicts "+resolveInput.Path, resolveInput.Path)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(resolveInput.Path, []byte(newContent), info.Mode().Perm())
+	if err != nil {
+		return "", fmt.Errorf("failed to write to file %s: %w", resolveInput.Path, err)
+	}
+
+	var sb strings.Builder
+	remaining := len(conflicts) - len(replacements)
+	if remaining > 0 {
+		fmt.Fprintf(&sb, "Resolved %d conflict(s) in %s; %d remain.\n", len(replacements), resolveInput.Path, remaining)
+		return sb.String(), nil
+	}
+
+	_, err = RunContext(ctx, "add", "--", resolveInput.Path)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mResolve success\u001b[0m: %s\n", resolveInput.Path)
+	fmt.Fprintf(&sb, "All conflicts in %s resolved and staged.\n", resolveInput.Path)
+
+	files, err := conflictedFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(&sb, "%d conflicted file(s) remain: %s\n", len(files), strings.Join(files, ", "))
+		return sb.String(), nil
+	}
+
+	sb.WriteString("No conflicted files remain. ")
+	sb.WriteString(verifyBuild(ctx))
+	return sb.String(), nil
+}
+
+// verifyBuild runs the project build and summarizes the outcome.
+func verifyBuild(ctx context.Context) string {
+	p, ok := project.Detect(".")
+	if !ok {
+		return "No build system detected, so the build was not verified."
+	}
+
+	fmt.Printf("\u001b[92mtool\u001b[0m: verifying build with %s\n", strings.Join(p.BuildCommand, " "))
+	output, err := p.Build(ctx)
+	if len(output) > maxBuildOutput {
+		output = "...\n" + output[len(output)-maxBuildOutput:]
+	}
+	if err != nil {
+		return fmt.Sprintf("Build verification failed: %v\n%s", err, output)
+	}
+	return fmt.Sprintf("Build verification succeeded (%s).", strings.Join(p.BuildCommand, " "))
+}
+
+// conflictedFiles lists the files git reports as unmerged.
+func conflictedFiles(ctx context.Context) ([]string, error) {
+	out, err := RunContext(ctx, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(strings.TrimSpace(out), "\n") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// loadConflicts parses the conflicts in a file and, when the markers do not
+// carry the merge base, fills it in from git's index stages.
+func loadConflicts(ctx context.Context, path string) ([]conflict, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	conflicts := parseConflicts(string(content))
+	if len(conflicts) == 0 || conflicts[0].HasBase {
+		return conflicts, nil
+	}
+
+	merged, err := mergeWithBase(ctx, path)
+	if err != nil {
+		return conflicts, nil // the base is a nice-to-have
+	}
+	withBase := parseConflicts(merged)
+	if len(withBase) != len(conflicts) {
+		return conflicts, nil
+	}
+	for i := range conflicts {
+		conflicts[i].Base = withBase[i].Base
+		conflicts[i].HasBase = withBase[i].HasBase
+	}
+	return conflicts, nil
+}
+
+// mergeWithBase re-runs the three-way merge of a conflicted file from the
+// index stages in diff3 style, so each conflict includes the base text.
+func mergeWithBase(ctx context.Context, path string) (string, error) {
+	dir, err := os.MkdirTemp("", "agent-merge-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	var files []string
+	for stage, name := range []string{"base", "ours", "theirs"} {
+		content, err := RunContext(ctx, "show", fmt.Sprintf(":%d:%s", stage+1, filepath.ToSlash(path)))
+		if err != nil {
+			return "", err
+		}
+		file := filepath.Join(dir, name)
+		err = os.WriteFile(file, []byte(content), 0600)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+
+	// merge-file exits with the number of conflicts, so a positive exit
+	// status is expected here.
+	cmd := exec.CommandContext(ctx, "git", "merge-file", "-p", "--diff3", files[1], files[0], files[2])
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() > 0) {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// parseConflicts finds conflict regions delimited by git's markers.
+func parseConflicts(content string) []conflict {
+	const (
+		outside = iota
+		inOurs
+		inBase
+		inTheirs
+	)
+
+	var conflicts []conflict
+	var cur conflict
+	state := outside
+	for i, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case state == outside && isMarker(trimmed, "<<<<<<<"):
+			cur = conflict{StartLine: i + 1, OursLabel: markerLabel(trimmed)}
+			state = inOurs
+		case state == inOurs && isMarker(trimmed, "|||||||"):
+			cur.HasBase = true
+			state = inBase
+		case (state == inOurs || state == inBase) && isMarker(trimmed, "======="):
+			state = inTheirs
+		case state == inTheirs && isMarker(trimmed, ">>>>>>>"):
+			cur.EndLine = i + 1
+			cur.TheirsLabel = markerLabel(trimmed)
+			conflicts = append(conflicts, cur)
+			state = outside
+		case state == inOurs:
+			cur.Ours += line
+		case state == inBase:
+			cur.Base += line
+		case state == inTheirs:
+			cur.Theirs += line
+		}
+	}
+	return conflicts
+}
+
+// applyResolutions replaces the resolved conflict regions with their new text.
+func applyResolutions(content string, conflicts []conflict, replacements map[int]string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var sb strings.Builder
+	next := 0
+	for i, c := range conflicts {
+		text, ok := replacements[i]
+		if !ok {
+			continue
+		}
+		for ; next < c.StartLine-1; next++ {
+			sb.WriteString(lines[next])
+		}
+		sb.WriteString(text)
+		next = c.EndLine
+	}
+	for ; next < len(lines); next++ {
+		sb.WriteString(lines[next])
+	}
+	return sb.String()
+}
+
+func isMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+func markerLabel(line string) string {
+	return strings.TrimSpace(line[7:])
+}
@@ -0,0 +1,49 @@
+// Package git provides tools that drive the git command line on behalf of
+// the model: inspecting and committing changes, conflict resolution,
+// stashing and history rewriting.
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Run executes git with the given arguments in the working directory and
+// returns its standard output. Arguments are handed to the process directly,
+// never through a shell, so model-supplied values cannot inject commands.
+func Run(args ...string) (string, error) {
+	return RunContext(context.Background(), args...)
+}
+
+// RunContext is Run, killing git once ctx is done. Tools run git with it,
+// so that stopping a call or its timeout stops git too.
+func RunContext(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return stdout.String(), fmt.Errorf("git %s failed: %s (%w)", args[0], msg, err)
+	}
+	return stdout.String(), nil
+}
+
+// checkArg rejects model-supplied values that git would parse as options.
+func checkArg(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s cannot be empty", name)
+	}
+	if strings.HasPrefix(value, "-") {
+		return fmt.Errorf("invalid %s %q: must not start with '-'", name, value)
+	}
+	return nil
+}
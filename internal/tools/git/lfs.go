@@ -0,0 +1,64 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"code-editing-agent/internal/tools"
+)
+
+// --- GitLFSPull Tool ---
+
+var GitLFSPullDefinition = tools.ToolDefinition{
+	Name: "git_lfs_pull",
+	Description: `Download the content of a single Git LFS object that read_file reported as not downloaded.
+
+LFS objects are often large binaries; only pull one when its contents are genuinely needed.
+`,
+	InputSchema: tools.GenerateSchema[GitLFSPullInput](),
+	Function:    GitLFSPull,
+	Category:    tools.CategoryWrite,
+}
+
+type GitLFSPullInput struct {
+	Path string `json:"path" jsonschema_description:"The relative path of the LFS pointer file to download."`
+}
+
+func GitLFSPull(ctx context.Context, input json.RawMessage) (string, error) {
+	pullInput := GitLFSPullInput{}
+	err := json.Unmarshal(input, &pullInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_lfs_pull input: %w", err)
+	}
+	err = checkArg("path", pullInput.Path)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(pullInput.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", pullInput.Path, err)
+	}
+	ptr, ok := tools.ParseLFSPointer(content)
+	if !ok {
+		return fmt.Sprintf("%s is not an LFS pointer; its content is already available.", pullInput.Path), nil
+	}
+
+	fmt.Printf("\u001b[92mtool\u001b[0m: downloading LFS object %s (%s)\n", pullInput.Path, tools.FormatSize(ptr.Size))
+	_, err = RunContext(ctx, "lfs", "pull", "--include="+filepath.ToSlash(pullInput.Path), "--exclude=")
+	if err != nil {
+		return "", err
+	}
+
+	content, err = os.ReadFile(pullInput.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", pullInput.Path, err)
+	}
+	if _, ok := tools.ParseLFSPointer(content); ok {
+		return "", fmt.Errorf("git lfs pull finished but %s is still a pointer; the object may be missing on the remote", pullInput.Path)
+	}
+	return fmt.Sprintf("Downloaded %s (%s). It can now be read with read_file.", pullInput.Path, tools.FormatSize(int64(len(content)))), nil
+}
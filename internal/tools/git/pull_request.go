@@ -0,0 +1,397 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/github"
+	"code-editing-agent/internal/gitlab"
+	"code-editing-agent/internal/tools"
+)
+
+// prTimeout bounds pushing the branch and talking to the API.
+const prTimeout = 2 * time.Minute
+
+// PullRequests configures create_pr; it is set from the config.
+var PullRequests PullRequestSettings
+
+// PullRequestSettings are the tokens create_pr opens pull requests with,
+// in place of GITHUB_TOKEN and GITLAB_TOKEN, and its defaults.
+type PullRequestSettings struct {
+	GitHubToken string
+	GitLabToken string
+	// Base is the branch pull requests are opened against, the
+	// repository's default branch when empty.
+	Base string
+	// Draft opens every pull request as a draft.
+	Draft bool
+}
+
+// --- CreatePR Tool ---
+
+var CreatePRDefinition = tools.ToolDefinition{
+	Name: "create_pr",
+	Description: `Push the current branch and open a pull request for it on GitHub, or a merge request on GitLab.
+
+Commit the changes first with git_commit, on a branch of their own (create one with git_checkout). Give a
+title that sums up the change in one short line, and a description of what was changed in this session and
+why, how it was tested and what a reviewer should look at. Without them, they are made from the commits.
+When a pull request from the branch is already open, the branch is pushed and its URL returned.
+`,
+	InputSchema: tools.GenerateSchema[CreatePRInput](),
+	Function:    CreatePR,
+	Preview:     PreviewCreatePR,
+	Category:    tools.CategoryWrite,
+	Timeout:     prTimeout,
+}
+
+type CreatePRInput struct {
+	Title  string `json:"title,omitempty" jsonschema_description:"The title of the pull request: one short line summing up the change."`
+	Body   string `json:"body,omitempty" jsonschema_description:"The description, in Markdown: what was changed and why, and how it was tested."`
+	Base   string `json:"base,omitempty" jsonschema_description:"The branch to merge into. Defaults to the repository's default branch."`
+	Draft  bool   `json:"draft,omitempty" jsonschema_description:"Open the pull request as a draft."`
+	Remote string `json:"remote,omitempty" jsonschema_description:"The remote to push to and open the pull request on. Defaults to origin."`
+}
+
+// prPlan is what a create_pr call will do.
+type prPlan struct {
+	input  CreatePRInput
+	remote string
+	branch string
+	// base is empty when it is to be looked up as the default branch.
+	base string
+	// host and project name the repository, such as github.com and
+	// owner/repo, or gitlab.com and group/subgroup/project.
+	host    string
+	project string
+	gitlab  bool
+}
+
+func (p prPlan) kind() string {
+	if p.gitlab {
+		return "merge request"
+	}
+	return "pull request"
+}
+
+func planPR(ctx context.Context, input json.RawMessage) (prPlan, error) {
+	var plan prPlan
+	err := json.Unmarshal(input, &plan.input)
+	if err != nil {
+		return plan, fmt.Errorf("failed to parse create_pr input: %w", err)
+	}
+	plan.remote = plan.input.Remote
+	if plan.remote == "" {
+		plan.remote = "origin"
+	}
+	if err := checkArg("remote", plan.remote); err != nil {
+		return plan, err
+	}
+	plan.base = plan.input.Base
+	if plan.base == "" {
+		plan.base = PullRequests.Base
+	}
+	if plan.base != "" {
+		if err := checkArg("base", plan.base); err != nil {
+			return plan, err
+		}
+	}
+
+	branch, err := RunContext(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return plan, err
+	}
+	plan.branch = strings.TrimSpace(branch)
+	if plan.branch == "HEAD" {
+		return plan, fmt.Errorf("HEAD is detached; create a branch for the changes with git_checkout first")
+	}
+	remoteURL, err := RunContext(ctx, "remote", "get-url", plan.remote)
+	if err != nil {
+		return plan, err
+	}
+	plan.host, plan.project, err = parseRemote(strings.TrimSpace(remoteURL))
+	if err != nil {
+		return plan, err
+	}
+	plan.gitlab = strings.Contains(plan.host, "gitlab")
+	if !plan.gitlab && strings.Count(plan.project, "/") != 1 {
+		return plan, fmt.Errorf("cannot tell the GitHub repository from the remote %s", strings.TrimSpace(remoteURL))
+	}
+
+	// The remote's HEAD names its default branch, when it was fetched.
+	if plan.base == "" {
+		if head, err := RunContext(ctx, "symbolic-ref", "--short", "refs/remotes/"+plan.remote+"/HEAD"); err == nil {
+			plan.base = strings.TrimPrefix(strings.TrimSpace(head), plan.remote+"/")
+		}
+	}
+	if plan.base == plan.branch {
+		return plan, fmt.Errorf("the current branch is %s, the base of the %s; commit the changes on a new branch (git_checkout with create) first", plan.branch, plan.kind())
+	}
+	return plan, nil
+}
+
+var scpRemote = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):(.+)$`)
+
+// parseRemote returns the host and repository path of a remote's URL, such
+// as git@github.com:owner/repo.git or https://gitlab.com/group/project.
+func parseRemote(remote string) (string, string, error) {
+	var host, path string
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid remote URL %s: %w", remote, err)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if m := scpRemote.FindStringSubmatch(remote); m != nil {
+		host, path = m[1], m[2]
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("cannot tell the repository from the remote %s", remote)
+	}
+	return host, path, nil
+}
+
+func CreatePR(ctx context.Context, input json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, prTimeout)
+	defer cancel()
+	plan, err := planPR(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	host, err := newForge(plan)
+	if err != nil {
+		return "", err
+	}
+	if plan.base == "" {
+		plan.base, err = host.defaultBranch(ctx)
+		if err != nil {
+			return "", err
+		}
+		if plan.base == plan.branch {
+			return "", fmt.Errorf("the current branch is %s, the base of the %s; commit the changes on a new branch (git_checkout with create) first", plan.branch, plan.kind())
+		}
+	}
+	subjects, stat, known := branchChanges(ctx, plan.remote, plan.base)
+	if known && len(subjects) == 0 {
+		return "", fmt.Errorf("%s has no commits that are not on %s; commit the changes with git_commit first", plan.branch, plan.base)
+	}
+	title, body := describeChanges(plan.input.Title, plan.input.Body, plan.branch, subjects, stat)
+	draft := plan.input.Draft || PullRequests.Draft
+
+	push := []string{"push", "--set-upstream", plan.remote, "HEAD:refs/heads/" + plan.branch}
+	fmt.Printf("\u001b[92mtool\u001b[0m: $ git %s\n", strings.Join(push, " "))
+	if _, err := RunContext(ctx, push...); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	existing, err := host.openFrom(ctx, plan.branch)
+	if err != nil {
+		return "", fmt.Errorf("pushed %s to %s, but %w", plan.branch, plan.remote, err)
+	}
+	if existing != nil {
+		fmt.Printf("\u001b[92mPushed\u001b[0m: the %s is already open at %s\n", plan.kind(), existing.url)
+		fmt.Fprintf(&sb, "Pushed %s to %s. The %s from it, #%d, was already open; its title and description are unchanged: %s",
+			plan.branch, plan.remote, plan.kind(), existing.number, existing.url)
+	} else {
+		created, err := host.create(ctx, plan.branch, plan.base, title, body, draft)
+		if err != nil {
+			return "", fmt.Errorf("pushed %s to %s, but %w", plan.branch, plan.remote, err)
+		}
+		state := ""
+		if draft {
+			state = "draft "
+		}
+		fmt.Printf("\u001b[92mOpened %s\u001b[0m: %s\n", plan.kind(), created.url)
+		fmt.Fprintf(&sb, "Pushed %s to %s and opened %s%s #%d into %s: %s",
+			plan.branch, plan.remote, state, plan.kind(), created.number, plan.base, created.url)
+	}
+	if status, err := RunContext(ctx, "status", "--porcelain"); err == nil && strings.TrimSpace(status) != "" {
+		sb.WriteString("\nThe working tree has uncommitted changes, which are not part of it.")
+	}
+	return sb.String(), nil
+}
+
+// forge is the API of the host a pull request is opened on.
+type forge interface {
+	defaultBranch(ctx context.Context) (string, error)
+	// openFrom returns the pull request open from branch, or nil.
+	openFrom(ctx context.Context, branch string) (*pullRequest, error)
+	create(ctx context.Context, branch, base, title, body string, draft bool) (*pullRequest, error)
+}
+
+// pullRequest is a pull or merge request, by its number in the repository.
+type pullRequest struct {
+	number int
+	url    string
+}
+
+func newForge(plan prPlan) (forge, error) {
+	if plan.gitlab {
+		client := gitlab.NewClient(plan.host, PullRequests.GitLabToken)
+		if client.Token == "" {
+			return nil, fmt.Errorf("there is no GitLab token: set GITLAB_TOKEN or pull_requests.gitlab_token in the config")
+		}
+		return gitlabForge{client: client, project: plan.project}, nil
+	}
+	client := github.NewClient()
+	if PullRequests.GitHubToken != "" {
+		client.Token = PullRequests.GitHubToken
+	}
+	if plan.host != "github.com" {
+		// GitHub Enterprise serves its API under /api/v3.
+		client.BaseURL = "https://" + plan.host + "/api/v3"
+	}
+	if client.Token == "" {
+		return nil, fmt.Errorf("there is no GitHub token: set GITHUB_TOKEN or pull_requests.github_token in the config")
+	}
+	owner, repo, _ := strings.Cut(plan.project, "/")
+	return githubForge{client: client, owner: owner, repo: repo}, nil
+}
+
+type githubForge struct {
+	client      *github.Client
+	owner, repo string
+}
+
+func (f githubForge) defaultBranch(ctx context.Context) (string, error) {
+	return f.client.DefaultBranch(ctx, f.owner, f.repo)
+}
+
+func (f githubForge) openFrom(ctx context.Context, branch string) (*pullRequest, error) {
+	pr, err := f.client.OpenPullRequest(ctx, f.owner, f.repo, branch)
+	if err != nil || pr == nil {
+		return nil, err
+	}
+	return &pullRequest{number: pr.Number, url: pr.URL}, nil
+}
+
+func (f githubForge) create(ctx context.Context, branch, base, title, body string, draft bool) (*pullRequest, error) {
+	pr, err := f.client.CreatePullRequest(ctx, f.owner, f.repo, github.NewPullRequest{
+		Title: title, Head: branch, Base: base, Body: body, Draft: draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pullRequest{number: pr.Number, url: pr.URL}, nil
+}
+
+type gitlabForge struct {
+	client  *gitlab.Client
+	project string
+}
+
+func (f gitlabForge) defaultBranch(ctx context.Context) (string, error) {
+	return f.client.DefaultBranch(ctx, f.project)
+}
+
+func (f gitlabForge) openFrom(ctx context.Context, branch string) (*pullRequest, error) {
+	mr, err := f.client.OpenMergeRequest(ctx, f.project, branch)
+	if err != nil || mr == nil {
+		return nil, err
+	}
+	return &pullRequest{number: mr.IID, url: mr.URL}, nil
+}
+
+func (f gitlabForge) create(ctx context.Context, branch, base, title, body string, draft bool) (*pullRequest, error) {
+	// GitLab opens merge requests whose title starts with "Draft:" as
+	// drafts.
+	if draft && !strings.HasPrefix(strings.ToLower(title), "draft:") {
+		title = "Draft: " + title
+	}
+	mr, err := f.client.CreateMergeRequest(ctx, f.project, gitlab.NewMergeRequest{
+		SourceBranch: branch, TargetBranch: base, Title: title, Description: body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pullRequest{number: mr.IID, url: mr.URL}, nil
+}
+
+// branchChanges returns the subjects of the commits on HEAD that are not on
+// the remote's base branch, oldest first, and the summary of the files they
+// change. It reports false when the base branch was never fetched.
+func branchChanges(ctx context.Context, remote, base string) ([]string, string, bool) {
+	upstream := remote + "/" + base
+	log, err := RunContext(ctx, "log", "--reverse", "--format=%s", upstream+"..HEAD")
+	if err != nil {
+		return nil, "", false
+	}
+	stat, _ := RunContext(ctx, "diff", "--stat", upstream+"...HEAD")
+	var subjects []string
+	for _, line := range strings.Split(strings.TrimSpace(log), "\n") {
+		if line != "" {
+			subjects = append(subjects, line)
+		}
+	}
+	return subjects, strings.TrimRight(stat, "\n"), true
+}
+
+// describeChanges fills in the title and body the model left out from the
+// branch's commits: the title of a single commit is its subject, and the
+// body lists the commits and the files changed.
+func describeChanges(title, body, branch string, subjects []string, stat string) (string, string) {
+	if strings.TrimSpace(title) == "" {
+		switch len(subjects) {
+		case 0:
+			title = branch
+		case 1:
+			title = subjects[0]
+		default:
+			title = strings.NewReplacer("-", " ", "_", " ", "/", ": ").Replace(branch)
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		var sb strings.Builder
+		if len(subjects) > 1 {
+			sb.WriteString("Commits:\n\n")
+			for _, subject := range subjects {
+				sb.WriteString("- " + subject + "\n")
+			}
+			sb.WriteString("\n")
+		}
+		if stat != "" {
+			sb.WriteString("```\n" + stat + "\n```\n")
+		}
+		body = strings.TrimSuffix(sb.String(), "\n")
+	}
+	return title, body
+}
+
+// PreviewCreatePR shows the push and the pull request a call would make.
+func PreviewCreatePR(input json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	plan, err := planPR(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	base := plan.base
+	if base == "" {
+		base = "the default branch"
+	}
+	draft := ""
+	if plan.input.Draft || PullRequests.Draft {
+		draft = "draft "
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\u001b[1m$ git push --set-upstream %s HEAD:refs/heads/%s\u001b[0m\n", plan.remote, plan.branch)
+	fmt.Fprintf(&sb, "Open a %s%s on %s/%s from %s into %s\n", draft, plan.kind(), plan.host, plan.project, plan.branch, base)
+	title := plan.input.Title
+	if strings.TrimSpace(title) == "" {
+		title = "(made from the commits)"
+	}
+	fmt.Fprintf(&sb, "  Title: %s\n", title)
+	if body := strings.TrimSpace(plan.input.Body); body != "" {
+		for _, line := range strings.Split(body, "\n") {
+			sb.WriteString("  │ " + line + "\n")
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,412 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code-editing-agent/internal/tools"
+)
+
+// sequenceStateFile lives in the git directory and tracks a rebase or
+// cherry-pick driven by these tools, so it survives between tool calls.
+const sequenceStateFile = "agent-sequence.json"
+
+// sequence is a history rewrite in progress. Both rebases and cherry-picks
+// are replayed one commit at a time with `git cherry-pick`, which lets the
+// user approve every rewritten commit before the next one is applied.
+type sequence struct {
+	Kind             string   `json:"kind"` // "rebase" or "cherry-pick"
+	Branch           string   `json:"branch"`
+	OrigHead         string   `json:"orig_head"`
+	Onto             string   `json:"onto,omitempty"`
+	Todo             []string `json:"todo"`
+	Done             []string `json:"done"`
+	AwaitingApproval bool     `json:"awaiting_approval"`
+}
+
+// --- GitRebase Tool ---
+
+var GitRebaseDefinition = tools.ToolDefinition{
+	Name: "git_rebase",
+	Description: `Rebase the current branch onto another branch or commit, one commit at a time.
+
+Each commit is replayed onto 'onto' and the user approves every rewritten commit before the next
+one is applied. When a commit conflicts, the rebase pauses: resolve with find_conflicts and
+resolve_conflicts, then call git_continue. Use git_abort to restore the branch. Merge commits are
+not replayed. The working tree must be clean.
+`,
+	InputSchema: tools.GenerateSchema[GitRebaseInput](),
+	Function:    GitRebase,
+	Category:    tools.CategoryWrite,
+}
+
+type GitRebaseInput struct {
+	Onto string `json:"onto" jsonschema_description:"The branch or commit to rebase onto, e.g. main or origin/main."`
+}
+
+func GitRebase(ctx context.Context, input json.RawMessage) (string, error) {
+	rebaseInput := GitRebaseInput{}
+	err := json.Unmarshal(input, &rebaseInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_rebase input: %w", err)
+	}
+	err = checkArg("onto", rebaseInput.Onto)
+	if err != nil {
+		return "", err
+	}
+
+	seq, err := newSequence(ctx, "rebase")
+	if err != nil {
+		return "", err
+	}
+	if seq.Branch == "" {
+		return "", fmt.Errorf("cannot rebase a detached HEAD; check out a branch first")
+	}
+
+	onto, err := RunContext(ctx, "rev-parse", "--verify", rebaseInput.Onto+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	seq.Onto = strings.TrimSpace(onto)
+
+	commits, err := RunContext(ctx, "rev-list", "--reverse", "--no-merges", seq.Onto+".."+seq.OrigHead)
+	if err != nil {
+		return "", err
+	}
+	seq.Todo = strings.Fields(commits)
+	if len(seq.Todo) == 0 {
+		return fmt.Sprintf("%s is already up to date with %s; nothing to rebase.", seq.Branch, rebaseInput.Onto), nil
+	}
+
+	_, err = RunContext(ctx, "checkout", "--quiet", "--detach", seq.Onto)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mRebase\u001b[0m: replaying %d commit(s) of %s onto %s\n", len(seq.Todo), seq.Branch, rebaseInput.Onto)
+	return advanceSequence(ctx, seq)
+}
+
+// --- GitCherryPick Tool ---
+
+var GitCherryPickDefinition = tools.ToolDefinition{
+	Name: "git_cherry_pick",
+	Description: `Apply existing commits onto the current branch, one at a time.
+
+The user approves every new commit before the next one is applied. When a commit conflicts, the
+cherry-pick pauses: resolve with find_conflicts and resolve_conflicts, then call git_continue.
+Use git_abort to return the branch to where it was. The working tree must be clean.
+`,
+	InputSchema: tools.GenerateSchema[GitCherryPickInput](),
+	Function:    GitCherryPick,
+	Category:    tools.CategoryWrite,
+}
+
+type GitCherryPickInput struct {
+	Commits []string `json:"commits" jsonschema_description:"Commits to apply, oldest first (hashes, tags or ranges like A..B)."`
+}
+
+func GitCherryPick(ctx context.Context, input json.RawMessage) (string, error) {
+	pickInput := GitCherryPickInput{}
+	err := json.Unmarshal(input, &pickInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_cherry_pick input: %w", err)
+	}
+	if len(pickInput.Commits) == 0 {
+		return "", fmt.Errorf("commits cannot be empty")
+	}
+
+	seq, err := newSequence(ctx, "cherry-pick")
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range pickInput.Commits {
+		err = checkArg("commit", c)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(c, "..") {
+			out, err := RunContext(ctx, "rev-list", "--reverse", "--no-merges", c)
+			if err != nil {
+				return "", err
+			}
+			seq.Todo = append(seq.Todo, strings.Fields(out)...)
+			continue
+		}
+		out, err := RunContext(ctx, "rev-parse", "--verify", c+"^{commit}")
+		if err != nil {
+			return "", err
+		}
+		seq.Todo = append(seq.Todo, strings.TrimSpace(out))
+	}
+	if len(seq.Todo) == 0 {
+		return "", fmt.Errorf("no commits to cherry-pick")
+	}
+
+	fmt.Printf("\u001b[92mCherry-pick\u001b[0m: applying %d commit(s)\n", len(seq.Todo))
+	return advanceSequence(ctx, seq)
+}
+
+// --- GitContinue Tool ---
+
+var GitContinueDefinition = tools.ToolDefinition{
+	Name: "git_continue",
+	Description: `Continue a rebase or cherry-pick started with git_rebase or git_cherry_pick.
+
+Call it after resolving conflicts, or after changing files to amend a commit the user did not approve.
+Any uncommitted changes are folded into the current commit before it is shown to the user again.
+`,
+	InputSchema: tools.GenerateSchema[GitContinueInput](),
+	Function:    GitContinue,
+	Category:    tools.CategoryWrite,
+}
+
+type GitContinueInput struct{}
+
+func GitContinue(ctx context.Context, input json.RawMessage) (string, error) {
+	seq, err := loadSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	return advanceSequence(ctx, seq)
+}
+
+// --- GitAbort Tool ---
+
+var GitAbortDefinition = tools.ToolDefinition{
+	Name:        "git_abort",
+	Description: "Abort a rebase or cherry-pick started with git_rebase or git_cherry_pick and restore the branch to its original state.",
+	InputSchema: tools.GenerateSchema[GitAbortInput](),
+	Function:    GitAbort,
+	Category:    tools.CategoryWrite,
+}
+
+type GitAbortInput struct{}
+
+func GitAbort(ctx context.Context, input json.RawMessage) (string, error) {
+	seq, err := loadSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if pickInProgress(ctx) {
+		_, err = RunContext(ctx, "cherry-pick", "--abort")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if seq.Kind == "rebase" {
+		_, err = RunContext(ctx, "checkout", "--quiet", "--force", seq.Branch)
+	} else {
+		_, err = RunContext(ctx, "reset", "--quiet", "--hard", seq.OrigHead)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = clearSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mAbort success\u001b[0m: %s restored to %s\n", seq.Kind, shortHash(seq.OrigHead))
+	return fmt.Sprintf("Aborted %s; HEAD restored to %s.", seq.Kind, shortHash(seq.OrigHead)), nil
+}
+
+// newSequence checks that no other operation is running and the tree is
+// clean, and records where HEAD started.
+func newSequence(ctx context.Context, kind string) (*sequence, error) {
+	if _, err := loadSequence(ctx); err == nil {
+		return nil, fmt.Errorf("a rebase or cherry-pick is already in progress; use git_continue or git_abort")
+	}
+	status, err := RunContext(ctx, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(status) != "" {
+		return nil, fmt.Errorf("working tree has uncommitted changes; commit them or use git_stash first")
+	}
+
+	head, err := RunContext(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	branch, _ := RunContext(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+	return &sequence{
+		Kind:     kind,
+		Branch:   strings.TrimSpace(branch),
+		OrigHead: strings.TrimSpace(head),
+	}, nil
+}
+
+// advanceSequence replays commits until the sequence finishes, hits a
+// conflict, or the user declines a rewritten commit.
+func advanceSequence(ctx context.Context, seq *sequence) (string, error) {
+	var log strings.Builder
+	for {
+		err := saveSequence(ctx, seq)
+		if err != nil {
+			return "", err
+		}
+
+		if pickInProgress(ctx) {
+			files, err := conflictedFiles(ctx)
+			if err != nil {
+				return "", err
+			}
+			if len(files) > 0 {
+				return pauseSequence(ctx, seq, &log, fmt.Sprintf(
+					"Commit %s conflicts in: %s. Resolve them with find_conflicts/resolve_conflicts, then call git_continue.",
+					shortHash(seq.Todo[0]), strings.Join(files, ", ")))
+			}
+			if _, err := RunContext(ctx, "diff", "--cached", "--quiet"); err == nil {
+				// The commit's changes are already present; there is nothing to rewrite.
+				_, err = RunContext(ctx, "cherry-pick", "--skip")
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&log, "%s skipped (already applied)\n", shortHash(seq.Todo[0]))
+				seq.Done = append(seq.Done, seq.Todo[0])
+				seq.Todo = seq.Todo[1:]
+				continue
+			}
+			_, err = RunContext(ctx, "-c", "core.editor=true", "cherry-pick", "--continue")
+			if err != nil {
+				return "", err
+			}
+			seq.AwaitingApproval = true
+		}
+
+		if seq.AwaitingApproval {
+			status, err := RunContext(ctx, "status", "--porcelain", "--untracked-files=no")
+			if err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(status) != "" {
+				_, err = RunContext(ctx, "commit", "--quiet", "--all", "--amend", "--no-edit")
+				if err != nil {
+					return "", err
+				}
+			}
+
+			summary, err := RunContext(ctx, "show", "--stat", "--format=%h %s", "HEAD")
+			if err != nil {
+				return "", err
+			}
+			fmt.Printf("\u001b[93mRewritten commit\u001b[0m (from %s):\n%s", shortHash(seq.Todo[0]), summary)
+			if !tools.Confirm("Keep this commit and continue?") {
+				return pauseSequence(ctx, seq, &log, fmt.Sprintf(
+					"The user did not approve the rewritten commit for %s. Change files and call git_continue to amend it, or call git_abort.",
+					shortHash(seq.Todo[0])))
+			}
+
+			head, err := RunContext(ctx, "rev-parse", "HEAD")
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&log, "%s -> %s\n", shortHash(seq.Todo[0]), shortHash(strings.TrimSpace(head)))
+			seq.Done = append(seq.Done, seq.Todo[0])
+			seq.Todo = seq.Todo[1:]
+			seq.AwaitingApproval = false
+		}
+
+		if len(seq.Todo) == 0 {
+			return finishSequence(ctx, seq, &log)
+		}
+
+		_, err = RunContext(ctx, "cherry-pick", "--allow-empty", seq.Todo[0])
+		if err != nil && !pickInProgress(ctx) {
+			return "", err
+		}
+		seq.AwaitingApproval = err == nil
+	}
+}
+
+func pauseSequence(ctx context.Context, seq *sequence, log *strings.Builder, reason string) (string, error) {
+	err := saveSequence(ctx, seq)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s paused with %d commit(s) applied and %d remaining.\n%s%s",
+		seq.Kind, len(seq.Done), len(seq.Todo), log.String(), reason), nil
+}
+
+func finishSequence(ctx context.Context, seq *sequence, log *strings.Builder) (string, error) {
+	if seq.Kind == "rebase" {
+		_, err := RunContext(ctx, "checkout", "--quiet", "-B", seq.Branch)
+		if err != nil {
+			return "", err
+		}
+	}
+	err := clearSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92m%s success\u001b[0m: %d commit(s) applied\n", seq.Kind, len(seq.Done))
+	return fmt.Sprintf("%s finished: %d commit(s) applied.\n%s", seq.Kind, len(seq.Done), log.String()), nil
+}
+
+func pickInProgress(ctx context.Context) bool {
+	_, err := RunContext(ctx, "rev-parse", "--verify", "--quiet", "CHERRY_PICK_HEAD")
+	return err == nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
+func sequencePath(ctx context.Context) (string, error) {
+	dir, err := RunContext(ctx, "rev-parse", "--git-dir")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(strings.TrimSpace(dir), sequenceStateFile), nil
+}
+
+func loadSequence(ctx context.Context) (*sequence, error) {
+	path, err := sequencePath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no rebase or cherry-pick started by git_rebase/git_cherry_pick is in progress")
+	}
+	seq := &sequence{}
+	err = json.Unmarshal(data, seq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return seq, nil
+}
+
+func saveSequence(ctx context.Context, seq *sequence) error {
+	path, err := sequencePath(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(seq, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func clearSequence(ctx context.Context) error {
+	path, err := sequencePath(ctx)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/tools"
+)
+
+// --- GitStash Tool ---
+
+var GitStashDefinition = tools.ToolDefinition{
+	Name: "git_stash",
+	Description: `Set aside uncommitted local changes with 'git stash push'.
+
+Use this before starting a task when the working tree has unrelated changes, so your own diffs stay
+clean, and restore them afterward with git_stash_pop. Optionally limit the stash to specific paths.
+`,
+	InputSchema: tools.GenerateSchema[GitStashInput](),
+	Function:    GitStash,
+	Category:    tools.CategoryWrite,
+}
+
+type GitStashInput struct {
+	Message          string   `json:"message,omitempty" jsonschema_description:"A description stored with the stash."`
+	IncludeUntracked bool     `json:"include_untracked,omitempty" jsonschema_description:"Also stash untracked files."`
+	Paths            []string `json:"paths,omitempty" jsonschema_description:"Only stash changes to these relative paths."`
+}
+
+func GitStash(ctx context.Context, input json.RawMessage) (string, error) {
+	stashInput := GitStashInput{}
+	err := json.Unmarshal(input, &stashInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_stash input: %w", err)
+	}
+
+	status, err := RunContext(ctx, "status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(status) == "" {
+		return "Working tree is clean; nothing to stash.", nil
+	}
+
+	args := []string{"stash", "push"}
+	if stashInput.IncludeUntracked {
+		args = append(args, "--include-untracked")
+	}
+	if stashInput.Message != "" {
+		args = append(args, "--message", stashInput.Message)
+	}
+	if len(stashInput.Paths) > 0 {
+		args = append(args, "--")
+		args = append(args, stashInput.Paths...)
+	}
+
+	out, err := RunContext(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	list, err := RunContext(ctx, "stash", "list")
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mStash success\u001b[0m: %s\n", strings.TrimSpace(out))
+	return fmt.Sprintf("%s\nStashes:\n%s", strings.TrimSpace(out), list), nil
+}
+
+// --- GitStashPop Tool ---
+
+var GitStashPopDefinition = tools.ToolDefinition{
+	Name: "git_stash_pop",
+	Description: `Restore stashed changes with 'git stash pop' and drop the stash.
+
+Defaults to the most recent stash. If the restored changes conflict with the working tree, the stash
+is kept and the conflicts can be inspected with find_conflicts.
+`,
+	InputSchema: tools.GenerateSchema[GitStashPopInput](),
+	Function:    GitStashPop,
+	Category:    tools.CategoryWrite,
+}
+
+type GitStashPopInput struct {
+	Index int `json:"index,omitempty" jsonschema_description:"Which stash to restore, as in stash@{index}. Defaults to 0, the most recent."`
+}
+
+func GitStashPop(ctx context.Context, input json.RawMessage) (string, error) {
+	popInput := GitStashPopInput{}
+	err := json.Unmarshal(input, &popInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_stash_pop input: %w", err)
+	}
+	if popInput.Index < 0 {
+		return "", fmt.Errorf("index cannot be negative")
+	}
+
+	list, err := RunContext(ctx, "stash", "list")
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(list) == "" {
+		return "", fmt.Errorf("there are no stashes to pop")
+	}
+
+	out, err := RunContext(ctx, "stash", "pop", fmt.Sprintf("stash@{%d}", popInput.Index))
+	if err != nil {
+		files, listErr := conflictedFiles(ctx)
+		if listErr == nil && len(files) > 0 {
+			return "", fmt.Errorf("stash@{%d} conflicts with the working tree and was kept; conflicted files: %s",
+				popInput.Index, strings.Join(files, ", "))
+		}
+		return "", err
+	}
+
+	fmt.Printf("\u001b[92mStash pop success\u001b[0m: stash@{%d}\n", popInput.Index)
+	return strings.TrimSpace(out), nil
+}
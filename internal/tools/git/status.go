@@ -0,0 +1,165 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/tools"
+)
+
+// maxDiffOutput is how much of a diff is returned to the model.
+const maxDiffOutput = 20000
+
+// --- GitStatus Tool ---
+
+var GitStatusDefinition = tools.ToolDefinition{
+	Name: "git_status",
+	Description: `Show the current branch and which files are staged, modified, untracked or conflicted.
+
+Use this before committing to see exactly what changed, and after editing to check that only the
+intended files were touched.
+`,
+	InputSchema: tools.GenerateSchema[GitStatusInput](),
+	Function:    GitStatus,
+	Category:    tools.CategoryRead,
+}
+
+type GitStatusInput struct{}
+
+func GitStatus(ctx context.Context, input json.RawMessage) (string, error) {
+	out, err := RunContext(ctx, "status", "--porcelain=v1", "--branch", "--untracked-files=all")
+	if err != nil {
+		return "", err
+	}
+
+	var branch string
+	var staged, unstaged, untracked, conflicted []string
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if len(line) < 3 {
+			continue
+		}
+		if strings.HasPrefix(line, "## ") {
+			branch = strings.TrimPrefix(line, "## ")
+			continue
+		}
+		x, y, path := line[0], line[1], line[3:]
+		switch {
+		case x == '?' && y == '?':
+			untracked = append(untracked, path)
+		case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+			conflicted = append(conflicted, path)
+		default:
+			if x != ' ' {
+				staged = append(staged, fmt.Sprintf("%s %s", statusName(x), path))
+			}
+			if y != ' ' {
+				unstaged = append(unstaged, fmt.Sprintf("%s %s", statusName(y), path))
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Branch: %s\n", branch)
+	if len(staged)+len(unstaged)+len(untracked)+len(conflicted) == 0 {
+		sb.WriteString("Working tree is clean.\n")
+		return sb.String(), nil
+	}
+	for _, group := range []struct {
+		title string
+		files []string
+	}{
+		{"Conflicted", conflicted},
+		{"Staged", staged},
+		{"Not staged", unstaged},
+		{"Untracked", untracked},
+	} {
+		if len(group.files) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s:\n", group.title)
+		for _, f := range group.files {
+			fmt.Fprintf(&sb, "  %s\n", f)
+		}
+	}
+	return sb.String(), nil
+}
+
+// statusName spells out a porcelain status letter.
+func statusName(code byte) string {
+	switch code {
+	case 'M':
+		return "modified:"
+	case 'A':
+		return "added:   "
+	case 'D':
+		return "deleted: "
+	case 'R':
+		return "renamed: "
+	case 'C':
+		return "copied:  "
+	case 'T':
+		return "typechange:"
+	}
+	return string(code) + ":"
+}
+
+// --- GitDiff Tool ---
+
+var GitDiffDefinition = tools.ToolDefinition{
+	Name: "git_diff",
+	Description: `Show changes as a unified diff.
+
+By default shows unstaged changes in the working tree. Set 'staged' to see what would be committed,
+or 'ref' to compare the working tree with a commit or branch. Limit the diff with 'paths', or set
+'stat' for a per-file summary of a large change.
+`,
+	InputSchema: tools.GenerateSchema[GitDiffInput](),
+	Function:    GitDiff,
+	Category:    tools.CategoryRead,
+}
+
+type GitDiffInput struct {
+	Paths  []string `json:"paths,omitempty" jsonschema_description:"Only show changes to these relative paths."`
+	Staged bool     `json:"staged,omitempty" jsonschema_description:"Show staged changes instead of unstaged ones."`
+	Ref    string   `json:"ref,omitempty" jsonschema_description:"A commit, branch or tag to compare against, e.g. main or HEAD~1."`
+	Stat   bool     `json:"stat,omitempty" jsonschema_description:"Only show which files changed and how many lines."`
+}
+
+func GitDiff(ctx context.Context, input json.RawMessage) (string, error) {
+	diffInput := GitDiffInput{}
+	err := json.Unmarshal(input, &diffInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git_diff input: %w", err)
+	}
+
+	args := []string{"diff", "--no-color", "--no-ext-diff"}
+	if diffInput.Staged {
+		args = append(args, "--cached")
+	}
+	if diffInput.Stat {
+		args = append(args, "--stat")
+	}
+	if diffInput.Ref != "" {
+		err = checkArg("ref", diffInput.Ref)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, diffInput.Ref)
+	}
+	args = append(args, "--")
+	args = append(args, diffInput.Paths...)
+
+	out, err := RunContext(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(out) == "" {
+		return "No changes.", nil
+	}
+	if len(out) > maxDiffOutput {
+		out = out[:maxDiffOutput] + fmt.Sprintf("\n[diff truncated, %d more bytes; narrow it with paths or use stat]", len(out)-maxDiffOutput)
+	}
+	return out, nil
+}
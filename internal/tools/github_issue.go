@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/github"
+)
+
+// --- GitHubIssue Tool ---
+
+var GitHubIssueDefinition = ToolDefinition{
+	Name: "github_issue",
+	Description: `Fetch a GitHub issue or pull request: its title, state, labels, description and comments.
+
+Use it when the user refers to an issue ("fix issue #42", a github.com URL) before working on it,
+so you start from what was reported. "#42" or "42" is an issue of the workspace's repository,
+taken from its origin remote; name another repository as "owner/repo#42" or with the issue's URL.
+`,
+	InputSchema: GenerateSchema[GitHubIssueInput](),
+	Function:    GitHubIssue,
+	Category:    CategoryRead,
+}
+
+type GitHubIssueInput struct {
+	Issue string `json:"issue" jsonschema_description:"The issue: its URL, owner/repo#42, or #42 for the workspace's repository."`
+}
+
+func GitHubIssue(ctx context.Context, input json.RawMessage) (string, error) {
+	issueInput := GitHubIssueInput{}
+	err := json.Unmarshal(input, &issueInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse github_issue input: %w", err)
+	}
+	if strings.TrimSpace(issueInput.Issue) == "" {
+		return "", fmt.Errorf("issue cannot be empty")
+	}
+	ref, err := github.ParseRef(ctx, issueInput.Issue)
+	if err != nil {
+		return "", err
+	}
+	issue, err := github.NewClient().Issue(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return issue.Markdown(), nil
+}
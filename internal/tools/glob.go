@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// compileGlob turns a glob pattern into an anchored regular expression that
+// matches slash-separated paths. '**' matches across directories, '*' matches
+// within a single path segment and '?' matches one character. Every wildcard
+// becomes a capture group so callers can reuse the matched text.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			// "**/" also matches zero directories, so "**/x" matches "x".
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+				sb.WriteString("((?:.*/)?)")
+			} else {
+				sb.WriteString("(.*)")
+			}
+		case c == '*':
+			sb.WriteString("([^/]*)")
+		case c == '?':
+			sb.WriteString("([^/])")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// matchGlob reports whether the relative path matches the glob pattern.
+// Patterns without a slash are matched against the base name only, so "*.go"
+// finds Go files at any depth.
+func matchGlob(re *regexp.Regexp, pattern, relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if !strings.Contains(pattern, "/") {
+		return re.MatchString(path.Base(relPath))
+	}
+	return re.MatchString(relPath)
+}
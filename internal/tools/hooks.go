@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+const (
+	formatTimeout = 30 * time.Second
+	// maxFormatOutput bounds the formatter output passed on to the model.
+	maxFormatOutput = 2000
+)
+
+// PostEditHook runs on a file a tool has just written and returns a note
+// for the model, or "" when there is nothing to tell.
+type PostEditHook func(path string) string
+
+// PostEditHooks run, in order, on every file that edit_file, edit_files and
+// write_file write; their notes are added to the tool's result.
+var PostEditHooks []PostEditHook
+
+// runPostEditHooks runs the hooks on each of paths and returns their notes.
+func runPostEditHooks(paths ...string) string {
+	var notes strings.Builder
+	for _, path := range paths {
+		for _, hook := range PostEditHooks {
+			if note := hook(path); note != "" {
+				notes.WriteString("\n" + note)
+			}
+		}
+	}
+	return notes.String()
+}
+
+// FormatHook returns a hook that runs a formatter on edited files.
+// formatters maps file extensions such as ".go" (the dot is optional) to a
+// command such as "gofmt -w", which is run with the file's path appended.
+// When the formatter changes the file the model gets the diff, since its
+// next edit must match the formatted text; when it fails, its errors.
+func FormatHook(formatters map[string]string) PostEditHook {
+	byExt := map[string]string{}
+	for ext, command := range formatters {
+		byExt["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = command
+	}
+	return func(path string) string {
+		command := strings.Fields(byExt[strings.ToLower(filepath.Ext(path))])
+		if len(command) == 0 {
+			return ""
+		}
+		name := strings.Join(command, " ")
+		before, err := os.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), formatTimeout)
+		defer cancel()
+		result, err := shell.Run(ctx, "", command[0], append(command[1:], path)...)
+		if err != nil {
+			return fmt.Sprintf("Could not run formatter %s: %v", name, err)
+		}
+		if result.TimedOut || result.ExitCode != 0 {
+			fmt.Printf("\u001b[93mFormat\u001b[0m: %s failed on %s\n", name, path)
+			return fmt.Sprintf("Formatter %s failed on %s (the file is written, but probably has errors to fix):\n%s",
+				name, path, tailOutput(strings.TrimSpace(result.Combined), maxFormatOutput))
+		}
+
+		after, err := os.ReadFile(path)
+		if err != nil || string(after) == string(before) {
+			return ""
+		}
+		fmt.Printf("\u001b[90mFormatted %s with %s\u001b[0m\n", path, name)
+		return fmt.Sprintf("Formatter %s then changed %s; edit the formatted text from now on:\n%s",
+			name, path, UnifiedDiff(path, string(before), string(after)))
+	}
+}
@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFiles are the files whose patterns hide paths from listings:
+// Git's own and one for paths only the agent should skip.
+var ignoreFiles = []string{".gitignore", ".agentignore"}
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	// base is the slash-separated directory holding the ignore file, or ""
+	// for the top directory.
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// anchored patterns contain a slash and match the path relative to
+	// base; the others match the name at any depth.
+	anchored bool
+}
+
+// ignoreMatcher applies the ignore files found while walking a tree, with
+// the semantics of .gitignore: the last matching rule wins, "!" re-includes,
+// a trailing "/" matches only directories and a pattern with a slash is
+// relative to the directory of its file.
+type ignoreMatcher struct {
+	root string
+	// prefix is root relative to the workspace when root is below it, so
+	// that the ignore files of root's ancestors apply too.
+	prefix string
+	rules  []ignoreRule
+}
+
+// newIgnoreMatcher returns a matcher for a walk of root that already knows
+// the ignore files of root's ancestors up to the workspace root.
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	m := &ignoreMatcher{root: root}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return m
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return m
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil || outsideDir(rel) || rel == "." {
+		return m
+	}
+
+	m.prefix = filepath.ToSlash(rel)
+	parts := strings.Split(m.prefix, "/")
+	for i := range parts {
+		dir := filepath.Join(append([]string{cwd}, parts[:i]...)...)
+		m.rules = append(m.rules, readIgnoreRules(dir, strings.Join(parts[:i], "/"))...)
+	}
+	return m
+}
+
+// IgnoredPath reports whether path, relative to the workspace, is hidden by
+// the ignore files that apply to it.
+func IgnoredPath(path string, isDir bool) bool {
+	m := newIgnoreMatcher(filepath.Dir(path))
+	m.enter(".")
+	return m.ignored(filepath.Base(path), isDir)
+}
+
+// enter loads the ignore files of dir, a directory of the walk given
+// relative to its root.
+func (m *ignoreMatcher) enter(dir string) {
+	base := path.Join(m.prefix, filepath.ToSlash(dir))
+	if base == "." {
+		base = ""
+	}
+	m.rules = append(m.rules, readIgnoreRules(filepath.Join(m.root, dir), base)...)
+}
+
+// ignored reports whether relPath, relative to the walk's root, is hidden
+// by the rules loaded so far.
+func (m *ignoreMatcher) ignored(relPath string, isDir bool) bool {
+	full := path.Join(m.prefix, filepath.ToSlash(relPath))
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		target := full
+		if rule.base != "" {
+			if !strings.HasPrefix(full, rule.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(full, rule.base+"/")
+		}
+		if !rule.anchored {
+			target = path.Base(target)
+		}
+		if rule.re.MatchString(target) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// readIgnoreRules parses the ignore files in dir.
+func readIgnoreRules(dir, base string) []ignoreRule {
+	var rules []ignoreRule
+	for _, name := range ignoreFiles {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+				rules = append(rules, rule)
+			}
+		}
+		file.Close()
+	}
+	return rules
+}
+
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	re, err := compileGlob(line)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lfsPointerPrefix starts every Git LFS pointer file.
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// maxLFSPointerSize is the largest size a pointer file can have per the spec.
+const maxLFSPointerSize = 1024
+
+// LFSPointer is the metadata stored in a Git LFS pointer file in place of
+// the real content.
+type LFSPointer struct {
+	OID  string
+	Size int64
+}
+
+// ParseLFSPointer reports whether content is a Git LFS pointer and, if so,
+// returns the object it points to.
+func ParseLFSPointer(content []byte) (LFSPointer, bool) {
+	if len(content) > maxLFSPointerSize || !bytes.HasPrefix(content, []byte(lfsPointerPrefix)) {
+		return LFSPointer{}, false
+	}
+
+	var ptr LFSPointer
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "oid":
+			ptr.OID = value
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return LFSPointer{}, false
+			}
+			ptr.Size = size
+		}
+	}
+	return ptr, ptr.OID != ""
+}
+
+// String describes the object for the model instead of the raw pointer text.
+func (p LFSPointer) String() string {
+	return fmt.Sprintf("Git LFS object, %s, not downloaded (%s)", FormatSize(p.Size), p.OID)
+}
+
+// FormatSize renders a byte count in human-readable units.
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
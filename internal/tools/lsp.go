@@ -0,0 +1,362 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/lsp"
+)
+
+const (
+	// lspTimeout bounds a language server request, including starting the
+	// server, which loads the project and can take a while the first time.
+	lspTimeout = 60 * time.Second
+	// maxReferences bounds how many references find_references lists.
+	maxReferences = 200
+)
+
+// LanguageServers starts and talks to the language servers the code
+// intelligence tools ask. The tools are only offered when this is set.
+var LanguageServers *lsp.Manager
+
+// SymbolPositionInput names a symbol by where it appears, as the code
+// intelligence tools take it.
+type SymbolPositionInput struct {
+	Path   string `json:"path" jsonschema_description:"The relative path of the file the symbol appears in."`
+	Line   int    `json:"line" jsonschema_description:"The line the symbol appears on, from 1."`
+	Symbol string `json:"symbol" jsonschema_description:"The symbol's name as written on that line."`
+	Column int    `json:"column,omitempty" jsonschema_description:"The byte column the symbol starts at, from 1, when its name appears more than once on the line."`
+}
+
+// --- GotoDefinition Tool ---
+
+var GotoDefinitionDefinition = ToolDefinition{
+	Name: "goto_definition",
+	Description: `Find where a symbol is defined, using the language server of the file's language (gopls for Go,
+pyright for Python, typescript-language-server for TypeScript and JavaScript, rust-analyzer for Rust).
+
+Name the symbol by a file and line where it is used and its name. Returns the definitions as
+path:line:column with the line's text; definitions outside the workspace, such as in the standard
+library or dependencies, are given by absolute path. Prefer this to searching for the name when it
+is common or defined in several places.
+`,
+	InputSchema: GenerateSchema[SymbolPositionInput](),
+	Function:    GotoDefinition,
+	Category:    CategoryRead,
+}
+
+func GotoDefinition(ctx context.Context, input json.RawMessage) (string, error) {
+	in, client, pos, err := symbolRequest("goto_definition", input)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, lspTimeout)
+	defer cancel()
+	locations, err := client.Definition(ctx, in.Path, pos)
+	if err != nil {
+		return "", err
+	}
+	if len(locations) == 0 {
+		return fmt.Sprintf("%s could not find the definition of %s.", client.Name(), in.Symbol), nil
+	}
+	return formatLocations(locations, len(locations)), nil
+}
+
+// --- FindReferences Tool ---
+
+var FindReferencesDefinition = ToolDefinition{
+	Name: "find_references",
+	Description: `Find every use of a symbol across the workspace, using the language server of the file's language.
+
+Name the symbol by a file and line where it is declared or used and its name. Unlike a text search,
+only uses of that very symbol are found: a field or local variable of the same name elsewhere is
+not. Returns path:line:column with the line's text for each reference, the declaration included,
+sorted by file; at most 200 are listed.
+`,
+	InputSchema: GenerateSchema[SymbolPositionInput](),
+	Function:    FindReferences,
+	Category:    CategoryRead,
+}
+
+func FindReferences(ctx context.Context, input json.RawMessage) (string, error) {
+	in, client, pos, err := symbolRequest("find_references", input)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, lspTimeout)
+	defer cancel()
+	locations, err := client.References(ctx, in.Path, pos, true)
+	if err != nil {
+		return "", err
+	}
+	if len(locations) == 0 {
+		return fmt.Sprintf("%s found no references to %s.", client.Name(), in.Symbol), nil
+	}
+	return formatLocations(locations, maxReferences), nil
+}
+
+// --- HoverDocs Tool ---
+
+var HoverDocsDefinition = ToolDefinition{
+	Name: "hover_docs",
+	Description: `Show the type, signature and documentation of a symbol, as an editor shows on hover, using the
+language server of the file's language.
+
+Name the symbol by a file and line where it appears and its name. Useful to learn what a function
+from another package or a dependency takes and returns without reading its source.
+`,
+	InputSchema: GenerateSchema[SymbolPositionInput](),
+	Function:    HoverDocs,
+	Category:    CategoryRead,
+}
+
+func HoverDocs(ctx context.Context, input json.RawMessage) (string, error) {
+	in, client, pos, err := symbolRequest("hover_docs", input)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, lspTimeout)
+	defer cancel()
+	text, err := client.Hover(ctx, in.Path, pos)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Sprintf("%s has no information about %s.", client.Name(), in.Symbol), nil
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// --- Diagnostics Tool ---
+
+var DiagnosticsDefinition = ToolDefinition{
+	Name: "diagnostics",
+	Description: `List the compile errors and warnings a language server reports for a file, as an editor would
+underline them, without building or running anything.
+
+Returns path:line:column: severity: message for each, errors first. Use it after editing a file to
+check the change type-checks.
+`,
+	InputSchema: GenerateSchema[DiagnosticsInput](),
+	Function:    Diagnostics,
+	Category:    CategoryRead,
+}
+
+type DiagnosticsInput struct {
+	Path string `json:"path" jsonschema_description:"The relative path of the file to check."`
+}
+
+func Diagnostics(ctx context.Context, input json.RawMessage) (string, error) {
+	diagnosticsInput := DiagnosticsInput{}
+	err := json.Unmarshal(input, &diagnosticsInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse diagnostics input: %w", err)
+	}
+	client, err := languageServer(diagnosticsInput.Path)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, lspTimeout)
+	defer cancel()
+	diagnostics, err := client.Diagnostics(ctx, diagnosticsInput.Path)
+	if err != nil {
+		return "", err
+	}
+	if len(diagnostics) == 0 {
+		return fmt.Sprintf("%s reports no problems in %s.", client.Name(), diagnosticsInput.Path), nil
+	}
+
+	// Servers may leave the severity out, which means an error.
+	severity := func(d lsp.Diagnostic) int {
+		if d.Severity == 0 {
+			return lsp.SeverityError
+		}
+		return d.Severity
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if severity(a) != severity(b) {
+			return severity(a) < severity(b)
+		}
+		return a.Range.Start.Line < b.Range.Start.Line
+	})
+	lines := fileLines(diagnosticsInput.Path)
+	var sb strings.Builder
+	for _, d := range diagnostics {
+		line, column := d.Range.Start.Line, d.Range.Start.Character
+		if line < len(lines) {
+			column = lsp.ByteColumn(lines[line], column)
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d: %s: %s", diagnosticsInput.Path, line+1, column+1, d.SeverityName(), strings.TrimSpace(d.Message))
+		if d.Source != "" {
+			fmt.Fprintf(&sb, " (%s)", d.Source)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// symbolRequest parses the input of a tool that asks about a symbol and
+// returns the server of its file and the symbol's position there.
+func symbolRequest(tool string, input json.RawMessage) (SymbolPositionInput, *lsp.Client, lsp.Position, error) {
+	in := SymbolPositionInput{}
+	if err := json.Unmarshal(input, &in); err != nil {
+		return in, nil, lsp.Position{}, fmt.Errorf("failed to parse %s input: %w", tool, err)
+	}
+	if in.Symbol == "" {
+		return in, nil, lsp.Position{}, fmt.Errorf("symbol cannot be empty")
+	}
+	if in.Line <= 0 {
+		return in, nil, lsp.Position{}, fmt.Errorf("line must be 1 or more")
+	}
+	pos, err := symbolPosition(in)
+	if err != nil {
+		return in, nil, lsp.Position{}, err
+	}
+	client, err := languageServer(in.Path)
+	if err != nil {
+		return in, nil, lsp.Position{}, err
+	}
+	return in, client, pos, nil
+}
+
+func languageServer(path string) (*lsp.Client, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path cannot be empty")
+	}
+	if LanguageServers == nil {
+		return nil, fmt.Errorf("language servers are not available in this session")
+	}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lspTimeout)
+	defer cancel()
+	return LanguageServers.Client(ctx, path)
+}
+
+// symbolPosition finds where the symbol starts on its line, as a server
+// position.
+func symbolPosition(in SymbolPositionInput) (lsp.Position, error) {
+	lines := fileLines(in.Path)
+	if lines == nil {
+		if _, err := os.Stat(in.Path); err != nil {
+			return lsp.Position{}, err
+		}
+	}
+	if in.Line > len(lines) {
+		return lsp.Position{}, fmt.Errorf("%s has only %d lines", in.Path, len(lines))
+	}
+	text := lines[in.Line-1]
+
+	var starts []int
+	for i := 0; ; {
+		j := strings.Index(text[i:], in.Symbol)
+		if j < 0 {
+			break
+		}
+		start := i + j
+		end := start + len(in.Symbol)
+		if (start == 0 || !isWordByte(text[start-1])) && (end == len(text) || !isWordByte(text[end])) {
+			starts = append(starts, start)
+		}
+		i = start + 1
+	}
+	if len(starts) == 0 {
+		return lsp.Position{}, fmt.Errorf("%s does not appear on line %d of %s", in.Symbol, in.Line, in.Path)
+	}
+	start := starts[0]
+	if in.Column > 0 {
+		found := false
+		for _, s := range starts {
+			if s == in.Column-1 {
+				start, found = s, true
+			}
+		}
+		if !found {
+			return lsp.Position{}, fmt.Errorf("%s does not start at %s:%d:%d", in.Symbol, in.Path, in.Line, in.Column)
+		}
+	}
+	return lsp.Position{Line: in.Line - 1, Character: lsp.UTF16Column(text, start)}, nil
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '$' || b >= 0x80 ||
+		'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// fileLines returns the lines of path, or nil if it cannot be read.
+func fileLines(path string) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+}
+
+// formatLocations lists locations as path:line:column with the line's
+// text, at most limit of them.
+func formatLocations(locations []lsp.Location, limit int) string {
+	cwd, _ := os.Getwd()
+	type location struct {
+		path         string
+		line, column int
+	}
+	var found []location
+	seen := map[location]bool{}
+	for _, l := range locations {
+		path, err := lsp.URIPath(l.URI)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(cwd, path); err == nil && !outsideDir(rel) {
+			path = rel
+		}
+		loc := location{path: path, line: l.Range.Start.Line, column: l.Range.Start.Character}
+		if !seen[loc] {
+			seen[loc] = true
+			found = append(found, loc)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.column < b.column
+	})
+
+	var sb strings.Builder
+	lines := map[string][]string{}
+	for i, loc := range found {
+		if i == limit {
+			fmt.Fprintf(&sb, "... and %d more\n", len(found)-limit)
+			break
+		}
+		if _, ok := lines[loc.path]; !ok {
+			lines[loc.path] = fileLines(loc.path)
+		}
+		text, column := "", loc.column
+		if fileText := lines[loc.path]; loc.line < len(fileText) {
+			text = fileText[loc.line]
+			column = lsp.ByteColumn(text, loc.column)
+			text = strings.TrimSpace(text)
+			if len(text) > maxSnippetSize {
+				text = text[:maxSnippetSize] + " ..."
+			}
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d: %s\n", loc.path, loc.line+1, column+1, text)
+	}
+	return sb.String()
+}
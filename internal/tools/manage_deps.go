@@ -0,0 +1,207 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/shell"
+)
+
+const (
+	depsTimeout = 5 * time.Minute
+	// maxDepsOutput bounds the module list or graph returned to the model.
+	maxDepsOutput = 16000
+)
+
+// moduleQueryPattern matches a module path with an optional @version
+// query, such as github.com/google/uuid@v1.6.0 or golang.org/x/text@none,
+// and nothing go get would take as a flag.
+var moduleQueryPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._~/+-]*(@[A-Za-z0-9._~/+-]+)?$`)
+
+// --- ManageDeps Tool ---
+
+var ManageDepsDefinition = ToolDefinition{
+	Name: "manage_deps",
+	Description: `Manage the dependencies of a Go module without shell access.
+
+Actions:
+- get: add, upgrade or downgrade the 'modules' with go get, e.g. github.com/google/uuid or
+  github.com/google/uuid@v1.6.0; module@none removes one. Returns go get's output and the change to go.mod.
+- tidy: run go mod tidy, adding missing requirements and removing unused ones, and return the change to go.mod.
+- list: list the modules in the build with their versions (go list -m all).
+- graph: the module requirement graph (go mod graph), one "module requirement" pair per line; with 'modules',
+  only the lines mentioning them.
+
+Use get to add a library before importing it, and tidy after removing imports. get and tidy can be undone with
+undo_last_edit.
+`,
+	InputSchema: GenerateSchema[ManageDepsInput](),
+	Function:    ManageDeps,
+	Category:    CategoryExecute,
+	Preview:     PreviewManageDeps,
+	Timeout:     depsTimeout + commandGrace,
+}
+
+type ManageDepsInput struct {
+	Action  string   `json:"action" jsonschema:"enum=get,enum=tidy,enum=list,enum=graph" jsonschema_description:"What to do: get, tidy, list or graph."`
+	Modules []string `json:"modules,omitempty" jsonschema_description:"For get, the modules to add, upgrade or remove, each with an optional @version; for graph, the modules to show the requirements of."`
+	Workdir string   `json:"workdir,omitempty" jsonschema_description:"The relative directory holding go.mod. Defaults to the current directory."`
+}
+
+func ManageDeps(ctx context.Context, input json.RawMessage) (string, error) {
+	depsInput, command, err := depsCommand(input)
+	if err != nil {
+		return "", err
+	}
+	dir := depsInput.Workdir
+	ctx, cancel := context.WithTimeout(ctx, depsTimeout)
+	defer cancel()
+
+	var before []byte
+	changes := depsInput.Action == "get" || depsInput.Action == "tidy"
+	if changes {
+		err = checkpointFiles("manage_deps "+strings.Join(command[1:], " "),
+			filepath.Join(dir, "go.mod"), filepath.Join(dir, "go.sum"))
+		if err != nil {
+			return "", err
+		}
+		before, _ = os.ReadFile(filepath.Join(dir, "go.mod"))
+	}
+
+	fmt.Printf("\u001b[92mtool\u001b[0m: $ %s\n", strings.Join(command, " "))
+	var filter func(line string) string
+	if !changes {
+		// Module lists are long and for the model only.
+		filter = func(string) string { return "" }
+	}
+	result, err := shell.RunFiltered(ctx, dir, filter, command[0], command[1:]...)
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", strings.Join(command, " "), err)
+	}
+	if result.TimedOut {
+		return "", fmt.Errorf("%s did not finish within %s", strings.Join(command, " "), depsTimeout)
+	}
+	output := strings.TrimSpace(result.Combined)
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("%s exited with status %d:\n%s", strings.Join(command, " "), result.ExitCode, tailOutput(output, maxShellOutput))
+	}
+
+	if !changes {
+		// Stderr only has progress, such as modules being downloaded.
+		output = strings.TrimSpace(result.Stdout)
+		if depsInput.Action == "graph" && len(depsInput.Modules) > 0 {
+			output = filterGraph(output, depsInput.Modules)
+		}
+		if output == "" {
+			return "No modules found.", nil
+		}
+		if len(output) > maxDepsOutput {
+			output = fmt.Sprintf("%s\n[%d bytes truncated]", output[:maxDepsOutput], len(output)-maxDepsOutput)
+		}
+		return output, nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "$ %s\n", strings.Join(command, " "))
+	if output != "" {
+		sb.WriteString(tailOutput(output, maxShellOutput) + "\n")
+	}
+	goMod := filepath.Join(dir, "go.mod")
+	after, err := os.ReadFile(goMod)
+	if err != nil {
+		return "", fmt.Errorf("failed to read go.mod: %w", err)
+	}
+	if string(after) == string(before) {
+		sb.WriteString("go.mod is unchanged.")
+	} else {
+		sb.WriteString("\n" + UnifiedDiff(filepath.ToSlash(goMod), string(before), string(after)))
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// PreviewManageDeps shows the command a get or tidy call would run. Calls
+// that only list modules need no approval.
+func PreviewManageDeps(input json.RawMessage) (string, error) {
+	depsInput, command, err := depsCommand(input)
+	if err != nil {
+		return "", err
+	}
+	if depsInput.Action != "get" && depsInput.Action != "tidy" {
+		return "", nil
+	}
+	preview := fmt.Sprintf("\u001b[1m$ %s\u001b[0m\n", strings.Join(command, " "))
+	if depsInput.Workdir != "" {
+		preview += fmt.Sprintf("  (in %s)\n", depsInput.Workdir)
+	}
+	return preview, nil
+}
+
+// depsCommand parses a manage_deps call and returns the go command it runs.
+func depsCommand(input json.RawMessage) (ManageDepsInput, []string, error) {
+	depsInput := ManageDepsInput{}
+	err := json.Unmarshal(input, &depsInput)
+	if err != nil {
+		return depsInput, nil, fmt.Errorf("failed to parse manage_deps input: %w", err)
+	}
+	if depsInput.Workdir != "" && !filepath.IsLocal(depsInput.Workdir) {
+		return depsInput, nil, fmt.Errorf("%s is outside the workspace", depsInput.Workdir)
+	}
+	dir := depsInput.Workdir
+	if dir == "" {
+		dir = "."
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+		return depsInput, nil, fmt.Errorf("no go.mod found in %s; manage_deps only manages Go modules", dir)
+	}
+	for _, module := range depsInput.Modules {
+		if !moduleQueryPattern.MatchString(module) {
+			return depsInput, nil, fmt.Errorf("invalid module %q: expected a module path with an optional @version", module)
+		}
+	}
+
+	switch depsInput.Action {
+	case "get":
+		if len(depsInput.Modules) == 0 {
+			return depsInput, nil, fmt.Errorf("get needs the modules to add")
+		}
+		return depsInput, append([]string{"go", "get"}, depsInput.Modules...), nil
+	case "tidy":
+		return depsInput, []string{"go", "mod", "tidy"}, nil
+	case "list":
+		return depsInput, []string{"go", "list", "-m", "all"}, nil
+	case "graph":
+		return depsInput, []string{"go", "mod", "graph"}, nil
+	}
+	return depsInput, nil, fmt.Errorf("unknown action %q (expected get, tidy, list or graph)", depsInput.Action)
+}
+
+// filterGraph keeps the lines of go mod graph's output that mention one of
+// modules, with or without a version.
+func filterGraph(graph string, modules []string) string {
+	var lines []string
+	for _, line := range strings.Split(graph, "\n") {
+		for _, field := range strings.Fields(line) {
+			path, _, _ := strings.Cut(field, "@")
+			if containsModule(modules, path) {
+				lines = append(lines, line)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func containsModule(modules []string, path string) bool {
+	for _, module := range modules {
+		if name, _, _ := strings.Cut(module, "@"); name == path {
+			return true
+		}
+	}
+	return false
+}
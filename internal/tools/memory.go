@@ -0,0 +1,78 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/memory"
+)
+
+// --- Remember Tool ---
+
+var RememberDefinition = ToolDefinition{
+	Name: "remember",
+	Description: `Remember a fact about this project for future sessions, where it is part of your instructions.
+
+Use it when the user asks you to remember something ("remember that we use table-driven tests"), or for
+a lasting fact you had to work out that future sessions would need, such as where something lives ("the
+API server lives in cmd/api") or how to run it. Keep each fact to one short, self-contained sentence.
+Do not remember what the code itself says, the task at hand, or anything secret.
+`,
+	InputSchema: GenerateSchema[RememberInput](),
+	Function:    Remember,
+	Category:    CategoryWrite,
+}
+
+type RememberInput struct {
+	Fact string `json:"fact" jsonschema_description:"The fact to remember, in one sentence."`
+}
+
+func Remember(ctx context.Context, input json.RawMessage) (string, error) {
+	rememberInput := RememberInput{}
+	err := json.Unmarshal(input, &rememberInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse remember input: %w", err)
+	}
+	added, err := memory.Remember(memory.DefaultPath, rememberInput.Fact)
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		return "This fact was already remembered.", nil
+	}
+	fmt.Printf("\u001b[92mRemembered\u001b[0m: %s\n", strings.Join(strings.Fields(rememberInput.Fact), " "))
+	return fmt.Sprintf("Remembered in %s; future sessions will know it.", memory.DefaultPath), nil
+}
+
+// --- Forget Tool ---
+
+var ForgetDefinition = ToolDefinition{
+	Name: "forget",
+	Description: `Forget a fact remembered about this project, when the user asks you to or it is no longer true.
+
+Give the fact as it appears under "Memories" in your instructions, or a part of it that only that fact contains.
+`,
+	InputSchema: GenerateSchema[ForgetInput](),
+	Function:    Forget,
+	Category:    CategoryWrite,
+}
+
+type ForgetInput struct {
+	Fact string `json:"fact" jsonschema_description:"The fact to forget, or a part of it that no other fact contains."`
+}
+
+func Forget(ctx context.Context, input json.RawMessage) (string, error) {
+	forgetInput := ForgetInput{}
+	err := json.Unmarshal(input, &forgetInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse forget input: %w", err)
+	}
+	removed, err := memory.Forget(memory.DefaultPath, forgetInput.Fact)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mForgot\u001b[0m: %s\n", removed)
+	return "Forgot: " + removed, nil
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// --- MoveFile Tool ---
+
+var MoveFileDefinition = ToolDefinition{
+	Name: "move_file",
+	Description: `Move or rename a single file or directory within the workspace.
+
+'destination' is the new path, not a directory to move into. Missing parent directories are
+created. An existing destination file is only replaced when 'overwrite' is true; an existing
+directory is never replaced. Both paths must be inside the workspace. The move is checkpointed,
+so undo_last_edit reverses it.
+References to the old path (imports, build files) are not updated; search for and fix them
+afterwards. To rename many files by pattern use rename_files.
+`,
+	InputSchema: withDryRun(GenerateSchema[MoveFileInput]()),
+	Function:    MoveFile,
+	Category:    CategoryWrite,
+	Preview:     PreviewMoveFile,
+}
+
+type MoveFileInput struct {
+	Source      string `json:"source" jsonschema_description:"The relative path of the file or directory to move."`
+	Destination string `json:"destination" jsonschema_description:"The relative path it should have afterwards."`
+	Overwrite   bool   `json:"overwrite,omitempty" jsonschema_description:"Replace the destination file if it already exists. Defaults to false."`
+}
+
+// plannedMove is a validated move and the files it touches.
+type plannedMove struct {
+	src, dst string
+	replaces bool
+	// touched lists every file the move removes, creates or replaces.
+	touched []string
+	count   int
+}
+
+func MoveFile(ctx context.Context, input json.RawMessage) (string, error) {
+	moveInput := MoveFileInput{}
+	err := json.Unmarshal(input, &moveInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse move_file input: %w", err)
+	}
+
+	move, err := planMove(moveInput)
+	if err != nil {
+		return "", err
+	}
+	var submoduleNotes string
+	for _, path := range []string{move.src, move.dst} {
+		note, err := checkSubmoduleEdit(path)
+		if err != nil {
+			return "", err
+		}
+		submoduleNotes += note
+	}
+
+	err = checkpointFiles(fmt.Sprintf("move_file %s -> %s", filepath.ToSlash(move.src), filepath.ToSlash(move.dst)), move.touched...)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(move.dst), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	err = os.Rename(move.src, move.dst)
+	if err != nil {
+		return "", fmt.Errorf("failed to move %s to %s: %w", move.src, move.dst, err)
+	}
+
+	fmt.Printf("\u001b[92mMove success\u001b[0m: %s -> %s\n", move.src, move.dst)
+	return fmt.Sprintf("Moved %s to %s (%d file(s))", filepath.ToSlash(move.src), filepath.ToSlash(move.dst), move.count) + submoduleNotes, nil
+}
+
+// PreviewMoveFile describes a move.
+func PreviewMoveFile(input json.RawMessage) (string, error) {
+	moveInput := MoveFileInput{}
+	err := json.Unmarshal(input, &moveInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse move_file input: %w", err)
+	}
+	move, err := planMove(moveInput)
+	if err != nil {
+		return "", err
+	}
+
+	preview := fmt.Sprintf("\u001b[93mMove\u001b[0m %s -> %s (%d file(s))\n", filepath.ToSlash(move.src), filepath.ToSlash(move.dst), move.count)
+	if move.replaces {
+		preview += fmt.Sprintf("\u001b[91mReplaces\u001b[0m the existing %s\n", filepath.ToSlash(move.dst))
+	}
+	return preview, nil
+}
+
+func planMove(moveInput MoveFileInput) (plannedMove, error) {
+	var move plannedMove
+	src, err := workspacePath(moveInput.Source)
+	if err != nil {
+		return move, err
+	}
+	dst, err := workspacePath(moveInput.Destination)
+	if err != nil {
+		return move, err
+	}
+	if src == dst {
+		return move, fmt.Errorf("source and destination cannot be the same path")
+	}
+	move.src, move.dst = src, dst
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return move, fmt.Errorf("failed to stat source %s: %w", src, err)
+	}
+	if info.IsDir() {
+		rel, err := filepath.Rel(src, dst)
+		if err == nil && !outsideDir(rel) {
+			return move, fmt.Errorf("cannot move directory %s into itself", src)
+		}
+	}
+
+	dstInfo, err := os.Lstat(dst)
+	switch {
+	case err == nil && dstInfo.IsDir():
+		return move, fmt.Errorf("destination %s is an existing directory; give the full new path instead", dst)
+	case err == nil && !moveInput.Overwrite:
+		return move, fmt.Errorf("destination %s already exists; set overwrite to true to replace it", dst)
+	case err == nil:
+		if info.IsDir() {
+			return move, fmt.Errorf("cannot replace file %s with directory %s", dst, src)
+		}
+		move.replaces = true
+		move.touched = append(move.touched, dst)
+	case !os.IsNotExist(err):
+		return move, fmt.Errorf("failed to stat destination %s: %w", dst, err)
+	}
+
+	files, err := regularFilesUnder(src)
+	if err != nil {
+		return move, fmt.Errorf("failed to scan %s: %w", src, err)
+	}
+	move.count = len(files)
+	for _, file := range files {
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return move, err
+		}
+		move.touched = append(move.touched, file, filepath.Join(dst, rel))
+	}
+	return move, nil
+}
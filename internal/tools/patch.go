@@ -0,0 +1,317 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxPatchFuzz is how many context lines at either end of a hunk may be
+// ignored when its full context cannot be found, like patch's --fuzz.
+const maxPatchFuzz = 2
+
+// filePatch is the part of a unified diff that changes one file. OldPath is
+// empty when the file is created and NewPath is empty when it is deleted.
+type filePatch struct {
+	OldPath string
+	NewPath string
+	Hunks   []patchHunk
+}
+
+// patchHunk is one @@ section of a unified diff.
+type patchHunk struct {
+	Header   string
+	OldStart int
+	Lines    []patchLine
+}
+
+// patchLine is a line of a hunk: ' ' for context, '-' for a removed line and
+// '+' for an added one, without its newline.
+type patchLine struct {
+	Kind      byte
+	Text      string
+	NoNewline bool
+}
+
+// parsePatch reads a unified diff, as produced by diff -u or git diff.
+// Lines outside file sections (commit messages, "diff --git", "index") are
+// ignored.
+func parsePatch(text string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var patches []filePatch
+	var current *filePatch
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			patches = append(patches, filePatch{
+				OldPath: patchPath(line[4:]),
+				NewPath: patchPath(lines[i+1][4:]),
+			})
+			current = &patches[len(patches)-1]
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk %q before any --- / +++ file header", i+1, line)
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			i = next - 1
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers (--- a/path, +++ b/path) found in patch")
+	}
+	for _, p := range patches {
+		if p.OldPath == "" && p.NewPath == "" {
+			return nil, fmt.Errorf("patch has a file section without a path")
+		}
+		if len(p.Hunks) == 0 {
+			return nil, fmt.Errorf("patch for %s has no hunks", p.displayPath())
+		}
+	}
+	return patches, nil
+}
+
+// parseHunk reads the hunk starting at lines[start] and returns it with the
+// index of the first line after it. Line counts in the header are not
+// trusted, since hand-written patches often get them wrong; the hunk ends
+// at the next hunk or file header.
+func parseHunk(lines []string, start int) (patchHunk, int, error) {
+	header := lines[start]
+	hunk := patchHunk{Header: header}
+	fields := strings.Fields(header)
+	if len(fields) >= 2 && strings.HasPrefix(fields[1], "-") {
+		startText, _, _ := strings.Cut(fields[1][1:], ",")
+		hunk.OldStart, _ = strconv.Atoi(startText)
+	}
+
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "diff ") ||
+			(strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")) {
+			break
+		}
+		if strings.HasPrefix(line, `\`) {
+			if n := len(hunk.Lines); n > 0 {
+				hunk.Lines[n-1].NoNewline = true
+			}
+			continue
+		}
+		if line == "" {
+			// Editors and models often strip the space of empty context lines.
+			if i == len(lines)-1 {
+				break
+			}
+			hunk.Lines = append(hunk.Lines, patchLine{Kind: ' '})
+			continue
+		}
+		switch line[0] {
+		case ' ', '-', '+':
+			hunk.Lines = append(hunk.Lines, patchLine{Kind: line[0], Text: line[1:]})
+		default:
+			// Anything else ends the hunk, e.g. trailing commentary.
+			return finishHunk(hunk, i)
+		}
+	}
+	return finishHunk(hunk, i)
+}
+
+func finishHunk(hunk patchHunk, next int) (patchHunk, int, error) {
+	// Trailing blank lines are usually the end of the patch text rather
+	// than context.
+	for n := len(hunk.Lines); n > 0 && hunk.Lines[n-1].Kind == ' ' && hunk.Lines[n-1].Text == ""; n-- {
+		hunk.Lines = hunk.Lines[:n-1]
+	}
+	changed := false
+	for _, l := range hunk.Lines {
+		if l.Kind != ' ' {
+			changed = true
+		}
+	}
+	if !changed {
+		return hunk, next, fmt.Errorf("hunk %q changes nothing", hunk.Header)
+	}
+	return hunk, next, nil
+}
+
+// patchPath extracts the file path from a ---/+++ header, dropping the
+// a/ or b/ prefix and any timestamp. /dev/null becomes "".
+func patchPath(header string) string {
+	path, _, _ := strings.Cut(header, "\t")
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+func (p filePatch) displayPath() string {
+	if p.NewPath != "" {
+		return p.NewPath
+	}
+	return p.OldPath
+}
+
+// applyPatchHunks applies hunks to content and returns the result with the
+// hunks that could not be placed. Each hunk is looked for near where its
+// header says it belongs, first exactly, then ignoring whitespace, then
+// ignoring up to maxPatchFuzz context lines at each end.
+func applyPatchHunks(content string, hunks []patchHunk) (string, []patchHunk) {
+	eol := "\n"
+	if strings.Contains(content, "\r\n") {
+		eol = "\r\n"
+	}
+	finalNewline := content == "" || strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	var failed []patchHunk
+	delta := 0
+	for _, hunk := range hunks {
+		at, trimmed, ok := locateHunk(lines, hunk, hunk.OldStart-1+delta)
+		if !ok {
+			failed = append(failed, hunk)
+			continue
+		}
+
+		var replacement []string
+		cursor := at
+		newEndsWithoutNewline := false
+		for _, l := range trimmed.Lines {
+			switch l.Kind {
+			case ' ':
+				// Keep the file's own context line, which may differ in
+				// whitespace from the patch.
+				replacement = append(replacement, lines[cursor])
+				cursor++
+			case '-':
+				cursor++
+			case '+':
+				replacement = append(replacement, l.Text)
+			}
+			if l.Kind != '-' {
+				newEndsWithoutNewline = l.NoNewline
+			}
+		}
+		if cursor == len(lines) {
+			finalNewline = !newEndsWithoutNewline
+		}
+
+		rest := append([]string{}, lines[cursor:]...)
+		lines = append(append(lines[:at], replacement...), rest...)
+		delta += len(replacement) - (cursor - at)
+	}
+
+	if len(lines) == 0 {
+		return "", failed
+	}
+	result := strings.Join(lines, eol)
+	if finalNewline {
+		result += eol
+	}
+	return result, failed
+}
+
+// locateHunk finds where hunk applies in lines, searching outward from
+// expected. It returns the position and the hunk as matched, which has
+// fewer context lines when fuzz was needed.
+func locateHunk(lines []string, hunk patchHunk, expected int) (int, patchHunk, bool) {
+	normalizers := []func(string) string{
+		func(s string) string { return s },
+		func(s string) string { return strings.TrimRight(s, " \t") },
+		func(s string) string { return strings.Join(strings.Fields(s), " ") },
+	}
+	for fuzz := 0; fuzz <= maxPatchFuzz; fuzz++ {
+		trimmed, ok := trimContext(hunk, fuzz)
+		if !ok {
+			break
+		}
+		var old []string
+		for _, l := range trimmed.Lines {
+			if l.Kind != '+' {
+				old = append(old, l.Text)
+			}
+		}
+		if len(old) == 0 {
+			if fuzz > 0 {
+				// Without context there is nothing left to anchor on.
+				break
+			}
+			// A pure insertion goes after line OldStart.
+			at := expected + 1
+			if at > len(lines) {
+				at = len(lines)
+			}
+			if at < 0 {
+				at = 0
+			}
+			return at, trimmed, true
+		}
+		for _, normalize := range normalizers {
+			if at, ok := findLines(lines, old, expected, normalize); ok {
+				return at, trimmed, true
+			}
+		}
+	}
+	return 0, hunk, false
+}
+
+// trimContext drops up to fuzz context lines from each end of hunk. It
+// fails when nothing but changes would be left to anchor the hunk.
+func trimContext(hunk patchHunk, fuzz int) (patchHunk, bool) {
+	if fuzz == 0 {
+		return hunk, true
+	}
+	lead, trail := 0, 0
+	for lead < fuzz && lead < len(hunk.Lines) && hunk.Lines[lead].Kind == ' ' {
+		lead++
+	}
+	for trail < fuzz && trail < len(hunk.Lines)-lead && hunk.Lines[len(hunk.Lines)-1-trail].Kind == ' ' {
+		trail++
+	}
+	if lead == 0 && trail == 0 {
+		return hunk, false
+	}
+	trimmed := hunk
+	trimmed.Lines = hunk.Lines[lead : len(hunk.Lines)-trail]
+	return trimmed, true
+}
+
+// findLines returns the position of want in lines closest to expected,
+// comparing lines after normalize.
+func findLines(lines, want []string, expected int, normalize func(string) string) (int, bool) {
+	matches := func(at int) bool {
+		if at < 0 || at+len(want) > len(lines) {
+			return false
+		}
+		for i, w := range want {
+			if normalize(lines[at+i]) != normalize(w) {
+				return false
+			}
+		}
+		return true
+	}
+	if expected < 0 {
+		expected = 0
+	}
+	for d := 0; d <= len(lines); d++ {
+		if matches(expected - d) {
+			return expected - d, true
+		}
+		if d > 0 && matches(expected+d) {
+			return expected + d, true
+		}
+	}
+	return 0, false
+}
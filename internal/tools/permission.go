@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"code-editing-agent/internal/policy"
+)
+
+// AutoApprove skips every approval prompt, for scripted runs.
+var AutoApprove bool
+
+// Policy is the session's approval policy. The agent applies it to every
+// call; the tools check it again for each file they are about to change.
+var Policy *policy.Policy
+
+// always are the tools approved by the configuration and flags, in every
+// session.
+var (
+	alwaysMu sync.Mutex
+	always   = map[string]bool{}
+)
+
+// Approved reports whether tool may run without asking: everything is
+// approved with AutoApprove, and a tool is when it is configured to be or
+// once the user chose "always" in the session.
+func Approved(tool string) bool {
+	if AutoApprove {
+		return true
+	}
+	alwaysMu.Lock()
+	configured := always[tool]
+	alwaysMu.Unlock()
+	return configured || current.approved(tool)
+}
+
+// ApproveAlways lets tool run without asking in every session, as the
+// configuration and flags say.
+func ApproveAlways(tool string) {
+	alwaysMu.Lock()
+	defer alwaysMu.Unlock()
+	always[tool] = true
+}
+
+// RequestApproval shows preview and asks the user whether tool may run.
+// Answering "always" approves the tool for the rest of the session. Without
+// an interactive user everything is approved.
+func RequestApproval(tool, preview string) bool {
+	if AskUser == nil || Approved(tool) {
+		return true
+	}
+	return askApproval(tool, preview, true)
+}
+
+// ConfirmApproval shows preview and asks the user whether tool may run
+// this once, even when it is approved for the session, as the approval
+// policy requires for writes to some paths. Without an interactive user
+// the call is refused.
+func ConfirmApproval(tool, preview string) bool {
+	if AskUser == nil {
+		return false
+	}
+	return askApproval(tool, preview, false)
+}
+
+// ConfirmWrites is ConfirmApproval for a call that writes paths, which the
+// approval policy asks for. Once the user approves, the tools do not ask
+// again for them while the call runs.
+func ConfirmWrites(tool, preview string, paths []string) bool {
+	if !ConfirmApproval(tool, preview) {
+		return false
+	}
+	current.confirm(paths)
+	return true
+}
+
+// BeginCall tells the tools the agent is about to run tool, so they can
+// ask the user about the files it writes under paths the approval policy
+// asks for. The function returned ends the call.
+func BeginCall(tool string) func() {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	call, confirmed := current.call, current.confirmed
+	current.call, current.confirmed = tool, nil
+	s := current
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.call, s.confirmed = call, confirmed
+	}
+}
+
+// confirmWrites asks the user whether the running call may write paths,
+// which the approval policy asks for, unless they already approved it when
+// the call was named. It is asked even for tools approved for the session.
+func confirmWrites(description string, paths []string) bool {
+	tool, left := current.unconfirmed(paths)
+	if len(left) == 0 {
+		return true
+	}
+	if tool == "" {
+		tool = description
+	}
+	var preview strings.Builder
+	preview.WriteString("  The approval policy asks before these files are written:\n")
+	for _, path := range left {
+		fmt.Fprintf(&preview, "    %s\n", filepath.ToSlash(path))
+	}
+	if !ConfirmApproval(tool, preview.String()) {
+		return false
+	}
+	current.confirm(left)
+	return true
+}
+
+func askApproval(tool, preview string, offerAlways bool) bool {
+	fmt.Printf("\u001b[93mApprove\u001b[0m: %s wants to run\n", tool)
+	fmt.Print(preview)
+	if !strings.HasSuffix(preview, "\n") {
+		fmt.Println()
+	}
+	question := fmt.Sprintf("Allow %s? [y]es, [n]o: ", tool)
+	if offerAlways {
+		question = fmt.Sprintf("Allow %s? [y]es, [n]o, [a]lways for this session: ", tool)
+	}
+	for {
+		answer, ok := AskUser(question)
+		if !ok {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "a", "always":
+			if offerAlways {
+				current.approveAlways(tool)
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code-editing-agent/internal/policy"
+)
+
+// askPolicy sets up a workspace in a temporary directory whose approval
+// policy asks before anything under protected/ is written, with tool
+// approved for the session. It returns how many times the user was asked,
+// each answered with *answer.
+func askPolicy(t *testing.T, tool string, answer *string) *int {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("protected", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("protected", "a.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := policy.New(nil, []policy.PathRule{{Pattern: "/protected", Write: policy.Ask}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := current
+	UseSession(NewSession(""))
+	Policy = p
+	current.approveAlways(tool)
+	asked := 0
+	AskUser = func(string) (string, bool) {
+		asked++
+		return *answer, true
+	}
+	t.Cleanup(func() {
+		UseSession(previous)
+		Policy = nil
+		AskUser = nil
+	})
+	return &asked
+}
+
+func readProtected(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("protected", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAskRuleApplyPatch(t *testing.T) {
+	answer := "n"
+	asked := askPolicy(t, "apply_patch", &answer)
+	input, _ := json.Marshal(ApplyPatchInput{Patch: "--- a/protected/a.txt\n+++ b/protected/a.txt\n@@ -1 +1 @@\n-one\n+two\n"})
+
+	if _, err := ApplyPatch(context.Background(), input); err == nil {
+		t.Error("ApplyPatch wrote a file under an ask rule the user declined")
+	}
+	if *asked != 1 || readProtected(t) != "one\n" {
+		t.Errorf("declined: asked %d time(s), file %q; want asked once and the file unchanged", *asked, readProtected(t))
+	}
+
+	answer = "y"
+	if _, err := ApplyPatch(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if *asked != 2 || readProtected(t) != "two\n" {
+		t.Errorf("approved: asked %d time(s), file %q; want asked again and the file patched", *asked, readProtected(t))
+	}
+}
+
+func TestAskRuleSearchReplace(t *testing.T) {
+	answer := "n"
+	asked := askPolicy(t, "search_replace", &answer)
+	input, _ := json.Marshal(SearchReplaceInput{Glob: "*.txt", Find: "one", Replace: "two"})
+
+	if _, err := SearchReplace(context.Background(), input); err == nil {
+		t.Error("SearchReplace wrote a file under an ask rule the user declined")
+	}
+	if *asked != 1 || readProtected(t) != "one\n" {
+		t.Errorf("declined: asked %d time(s), file %q; want asked once and the file unchanged", *asked, readProtected(t))
+	}
+
+	answer = "y"
+	if _, err := SearchReplace(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if *asked != 2 || readProtected(t) != "two\n" {
+		t.Errorf("approved: asked %d time(s), file %q; want asked again and the file changed", *asked, readProtected(t))
+	}
+}
+
+func TestAskRuleConfirmedWithCall(t *testing.T) {
+	answer := "y"
+	asked := askPolicy(t, "write_file", &answer)
+	input, _ := json.Marshal(WriteFileInput{Path: "protected/a.txt", Content: "two\n", Overwrite: true})
+
+	// The agent asks when the call names the file; the tool does not ask
+	// again.
+	end := BeginCall("write_file")
+	if !ConfirmWrites("write_file", "", []string{"protected/a.txt"}) {
+		t.Fatal("ConfirmWrites refused an approved write")
+	}
+	if _, err := WriteFile(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	end()
+	if *asked != 1 || readProtected(t) != "two\n" {
+		t.Errorf("asked %d time(s), file %q; want asked once and the file written", *asked, readProtected(t))
+	}
+
+	// The next call is asked about it again.
+	input, _ = json.Marshal(WriteFileInput{Path: "protected/a.txt", Content: "three\n", Overwrite: true})
+	if _, err := WriteFile(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if *asked != 2 {
+		t.Errorf("asked %d time(s) after the call ended, want 2", *asked)
+	}
+}
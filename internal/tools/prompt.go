@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AskUser prints a prompt and returns the user's answer. It is wired to the
+// terminal by main; when nil, tools run without asking anything.
+var AskUser func(prompt string) (string, bool)
+
+// Confirm asks the user a yes/no question. Without an interactive user the
+// answer is always yes.
+func Confirm(question string) bool {
+	if AskUser == nil {
+		return true
+	}
+	for {
+		answer, ok := AskUser(question + " [y/n]: ")
+		if !ok {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// ColorizeDiff renders a unified diff with removed lines in red and added
+// lines in green.
+func ColorizeDiff(diff string) string {
+	var sb strings.Builder
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			sb.WriteString("\u001b[96m" + text + "\u001b[0m\n")
+		case strings.HasPrefix(line, "--- a/"), strings.HasPrefix(line, "+++ b/"):
+			sb.WriteString("\u001b[1m" + text + "\u001b[0m\n")
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString("\u001b[91m" + text + "\u001b[0m\n")
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString("\u001b[92m" + text + "\u001b[0m\n")
+		default:
+			sb.WriteString(line)
+		}
+	}
+	return sb.String()
+}
+
+// reviewHunks lets the user approve or reject each hunk of a multi-hunk
+// change, like `git add -p`. It returns the content with only the approved
+// hunks applied and the hunks that were rejected. Single-hunk changes and
+// non-interactive sessions are approved as a whole.
+func reviewHunks(path, oldContent, newContent string) (string, []Hunk) {
+	oldLines := splitLines(oldContent)
+	hunks := makeHunks(diffLines(oldLines, splitLines(newContent)), diffContextLines)
+	if AskUser == nil || len(hunks) < 2 {
+		return newContent, nil
+	}
+
+	fmt.Printf("\u001b[93mReview\u001b[0m: %d hunks in %s\n", len(hunks), path)
+	accepted := make([]bool, len(hunks))
+	decideRest := -1 // -1 undecided, 0 reject the rest, 1 accept the rest
+	for i, h := range hunks {
+		if decideRest >= 0 {
+			accepted[i] = decideRest == 1
+			continue
+		}
+
+		fmt.Print(ColorizeDiff(h.String()))
+		for {
+			answer, ok := AskUser(fmt.Sprintf("Apply hunk %d/%d? [y]es, [n]o, [a]ll remaining, [q]uit (reject remaining): ", i+1, len(hunks)))
+			if !ok {
+				answer = "q"
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				accepted[i] = true
+			case "n", "no":
+			case "a", "all":
+				accepted[i] = true
+				decideRest = 1
+			case "q", "quit":
+				decideRest = 0
+			default:
+				continue
+			}
+			break
+		}
+	}
+
+	var rejected []Hunk
+	for i, h := range hunks {
+		if !accepted[i] {
+			rejected = append(rejected, h)
+		}
+	}
+	return applyHunks(oldLines, hunks, accepted), rejected
+}
+
+// applyHunks rebuilds a file from its old lines, applying only the accepted hunks.
+func applyHunks(oldLines []string, hunks []Hunk, accepted []bool) string {
+	var sb strings.Builder
+	next := 0 // index of the next old line to copy
+	for i, h := range hunks {
+		for ; next < h.OldStart-1; next++ {
+			sb.WriteString(oldLines[next])
+		}
+		for _, op := range h.ops {
+			if op.Kind == ' ' || (accepted[i] && op.Kind == '+') || (!accepted[i] && op.Kind == '-') {
+				sb.WriteString(op.Line)
+			}
+		}
+		next += h.OldLines
+	}
+	for ; next < len(oldLines); next++ {
+		sb.WriteString(oldLines[next])
+	}
+	return sb.String()
+}
+
+// formatRejectedHunks describes rejected hunks so the model knows what was not applied.
+func formatRejectedHunks(path string, rejected []Hunk) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The user rejected %d hunk(s) in %s; these changes were NOT applied:\n", len(rejected), path)
+	for _, h := range rejected {
+		sb.WriteString(h.String())
+	}
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry holds the tools the agent can offer to the model, in the order
+// they are offered. Each can be switched off and on again while the agent
+// runs; a disabled tool is neither offered nor run. It is safe for
+// concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	tools    []ToolDefinition
+	disabled map[string]bool
+}
+
+// NewRegistry returns a registry holding list, every tool enabled.
+func NewRegistry(list ...ToolDefinition) *Registry {
+	r := &Registry{disabled: map[string]bool{}}
+	for _, tool := range list {
+		r.Register(tool)
+	}
+	return r
+}
+
+// Register adds tool, enabled, or replaces the tool of the same name,
+// keeping its place and whether it is enabled.
+func (r *Registry) Register(tool ToolDefinition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.tools {
+		if existing.Name == tool.Name {
+			r.tools[i] = tool
+			return
+		}
+	}
+	r.tools = append(r.tools, tool)
+}
+
+// Unregister removes the tool called name and reports whether there was
+// one.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, tool := range r.tools {
+		if tool.Name == name {
+			r.tools = append(r.tools[:i:i], r.tools[i+1:]...)
+			delete(r.disabled, name)
+			return true
+		}
+	}
+	return false
+}
+
+// SetEnabled switches the tool called name on or off.
+func (r *Registry) SetEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tool := range r.tools {
+		if tool.Name == name {
+			if enabled {
+				delete(r.disabled, name)
+			} else {
+				r.disabled[name] = true
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no tool called %s", name)
+}
+
+// IsEnabled reports whether the tool called name is registered and enabled.
+func (r *Registry) IsEnabled(name string) bool {
+	_, ok := r.Lookup(name)
+	return ok
+}
+
+// Lookup returns the tool called name if it is registered and enabled.
+func (r *Registry) Lookup(name string) (ToolDefinition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.disabled[name] {
+		return ToolDefinition{}, false
+	}
+	for _, tool := range r.tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return ToolDefinition{}, false
+}
+
+// Clone returns a registry of the same tools, each enabled or not as in r,
+// whose tools are then switched on and off independently of r's.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := &Registry{tools: append([]ToolDefinition{}, r.tools...), disabled: map[string]bool{}}
+	for name := range r.disabled {
+		clone.disabled[name] = true
+	}
+	return clone
+}
+
+// All returns every registered tool, enabled or not.
+func (r *Registry) All() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]ToolDefinition{}, r.tools...)
+}
+
+// Enabled returns the tools offered to the model.
+func (r *Registry) Enabled() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var enabled []ToolDefinition
+	for _, tool := range r.tools {
+		if !r.disabled[tool.Name] {
+			enabled = append(enabled, tool)
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,238 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// --- RenameFiles Tool ---
+
+var RenameFilesDefinition = ToolDefinition{
+	Name: "rename_files",
+	Description: `Rename many files at once using a glob pattern and a replacement pattern.
+
+Wildcards ('**', '*', '?') in 'pattern' capture text which is substituted, in order, into the
+wildcards of 'replacement'. For example pattern "*_test.js" with replacement "*.test.ts"
+renames src/foo_test.js to src/foo.test.ts. Patterns without a '/' match file names at any depth;
+patterns with a '/' match the full path relative to 'path'.
+
+All renames are validated before any file is moved, and everything is rolled back if one fails.
+Use 'dry_run' to preview the renames without touching the disk.
+`,
+	InputSchema: GenerateSchema[RenameFilesInput](),
+	Function:    RenameFiles,
+	Category:    CategoryWrite,
+}
+
+type RenameFilesInput struct {
+	Pattern     string `json:"pattern" jsonschema_description:"Glob pattern selecting the files to rename, e.g. *_test.js or src/**/*.jsx."`
+	Replacement string `json:"replacement" jsonschema_description:"New name pattern with the same wildcards in the same order, e.g. *.test.ts."`
+	Path        string `json:"path,omitempty" jsonschema_description:"The relative directory to search in. Defaults to the current directory."`
+	DryRun      bool   `json:"dry_run,omitempty" jsonschema_description:"Only report the planned renames without applying them."`
+}
+
+type renameOp struct {
+	From string
+	To   string
+}
+
+func RenameFiles(ctx context.Context, input json.RawMessage) (string, error) {
+	renameInput := RenameFilesInput{}
+	err := json.Unmarshal(input, &renameInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rename_files input: %w", err)
+	}
+	if renameInput.Pattern == "" || renameInput.Replacement == "" {
+		return "", fmt.Errorf("pattern and replacement cannot be empty")
+	}
+
+	root := "."
+	if renameInput.Path != "" {
+		root = renameInput.Path
+	}
+
+	ops, err := planRenames(root, renameInput.Pattern, renameInput.Replacement)
+	if err != nil {
+		return "", err
+	}
+	if len(ops) == 0 {
+		return "", fmt.Errorf("no files match pattern %s in %s", renameInput.Pattern, root)
+	}
+
+	var sb strings.Builder
+	for _, op := range ops {
+		fmt.Fprintf(&sb, "%s -> %s\n", filepath.ToSlash(op.From), filepath.ToSlash(op.To))
+	}
+
+	if renameInput.DryRun {
+		return fmt.Sprintf("Dry run: %d file(s) would be renamed\n%s", len(ops), sb.String()), nil
+	}
+
+	submoduleNote, err := checkSubmoduleEdit(root)
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+	for _, op := range ops {
+		paths = append(paths, op.From, op.To)
+	}
+	err = checkpointFiles(fmt.Sprintf("rename_files %s -> %s", renameInput.Pattern, renameInput.Replacement), paths...)
+	if err != nil {
+		return "", err
+	}
+
+	err = applyRenames(ops)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("\u001b[92mRename success\u001b[0m: Renamed %d file(s)\n", len(ops))
+	return fmt.Sprintf("Renamed %d file(s)\n%s", len(ops), sb.String()) + submoduleNote, nil
+}
+
+func planRenames(root, pattern, replacement string) ([]renameOp, error) {
+	re, err := compileGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() != len(globWildcards(replacement)) {
+		return nil, fmt.Errorf("pattern %q has %d wildcard(s) but replacement %q has %d",
+			pattern, re.NumSubexp(), replacement, len(globWildcards(replacement)))
+	}
+	baseOnly := !strings.Contains(pattern, "/")
+	declared := gitmodulePaths()
+
+	var ops []renameOp
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Submodules are separate repositories; only touch them when asked to explicitly.
+			if isAgentDir(info.Name()) || (p != root && isSubmoduleDir(p, declared)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		subject := relPath
+		if baseOnly {
+			subject = path.Base(relPath)
+		}
+		m := re.FindStringSubmatch(subject)
+		if m == nil {
+			return nil
+		}
+
+		newName := expandGlob(replacement, m[1:])
+		if baseOnly {
+			newName = path.Join(path.Dir(relPath), newName)
+		}
+		if newName == relPath {
+			return nil
+		}
+		ops = append(ops, renameOp{
+			From: filepath.Join(root, filepath.FromSlash(relPath)),
+			To:   filepath.Join(root, filepath.FromSlash(newName)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].From < ops[j].From })
+
+	sources := map[string]bool{}
+	for _, op := range ops {
+		sources[op.From] = true
+	}
+	targets := map[string]string{}
+	for _, op := range ops {
+		if other, ok := targets[op.To]; ok {
+			return nil, fmt.Errorf("both %s and %s would be renamed to %s", other, op.From, op.To)
+		}
+		targets[op.To] = op.From
+		if sources[op.To] {
+			return nil, fmt.Errorf("%s would be renamed onto %s, which is itself being renamed", op.From, op.To)
+		}
+		if _, err := os.Lstat(op.To); err == nil {
+			return nil, fmt.Errorf("cannot rename %s: destination %s already exists", op.From, op.To)
+		}
+	}
+	return ops, nil
+}
+
+// applyRenames performs every rename or none of them: on the first failure
+// the renames already done are undone in reverse order.
+func applyRenames(ops []renameOp) error {
+	for i, op := range ops {
+		err := os.MkdirAll(filepath.Dir(op.To), 0755)
+		if err == nil {
+			err = os.Rename(op.From, op.To)
+		}
+		if err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if rbErr := os.Rename(ops[j].To, ops[j].From); rbErr != nil {
+					return fmt.Errorf("failed to rename %s: %v; rollback of %s also failed: %w", op.From, err, ops[j].To, rbErr)
+				}
+			}
+			return fmt.Errorf("failed to rename %s to %s, all renames rolled back: %w", op.From, op.To, err)
+		}
+	}
+	return nil
+}
+
+// globWildcards returns the wildcard tokens of a pattern in order of appearance.
+func globWildcards(pattern string) []string {
+	var tokens []string
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			tokens = append(tokens, "**/")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			tokens = append(tokens, "**")
+			i++
+		case pattern[i] == '*' || pattern[i] == '?':
+			tokens = append(tokens, pattern[i:i+1])
+		}
+	}
+	return tokens
+}
+
+// expandGlob substitutes captured values into the wildcards of pattern.
+func expandGlob(pattern string, captures []string) string {
+	var sb strings.Builder
+	n := 0
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString(captures[n])
+			n++
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(captures[n])
+			n++
+			i++
+		case pattern[i] == '*' || pattern[i] == '?':
+			sb.WriteString(captures[n])
+			n++
+		default:
+			sb.WriteByte(pattern[i])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,930 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRenameNotes bounds how many clashes or files a rename_symbol message
+// lists.
+const maxRenameNotes = 10
+
+// implicitMethods are method names the standard library looks for on any
+// value, such as String for fmt.
+var implicitMethods = map[string]struct{}{
+	"String": {}, "GoString": {}, "Format": {}, "Error": {}, "Unwrap": {}, "Is": {}, "As": {},
+	"MarshalJSON": {}, "UnmarshalJSON": {}, "MarshalText": {}, "UnmarshalText": {},
+	"MarshalYAML": {}, "UnmarshalYAML": {}, "ServeHTTP": {},
+}
+
+// modulePattern matches the module directive of a go.mod file.
+var modulePattern = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+
+// --- RenameSymbol Tool ---
+
+var RenameSymbolDefinition = ToolDefinition{
+	Name: "rename_symbol",
+	Description: `Rename a Go identifier (a function, type, method, field, variable or constant) everywhere it is
+used in the module, using the type checker instead of text replacement.
+
+Name the symbol by a file and line where it appears, its declaration or any use, and its current
+name; 'column' picks one when the name occurs more than once on the line. Only references to that
+symbol change: a local variable of the same name in another function, or a field of another struct,
+is left alone. The rename is refused when the new name would clash with or be shadowed by another
+declaration, when an exported symbol used by other packages would become unexported, and when a
+method satisfies an interface, which would need both renamed (use edit_files for that). Test files
+are included. Files excluded by build constraints on this platform are not checked; those that
+mention the name are listed. Comments and strings are not changed. Returns a unified diff per file.
+`,
+	InputSchema: withDryRun(GenerateSchema[RenameSymbolInput]()),
+	Function:    RenameSymbol,
+	Category:    CategoryWrite,
+	Preview:     PreviewRenameSymbol,
+}
+
+type RenameSymbolInput struct {
+	Path    string `json:"path" jsonschema_description:"The relative path of a Go file where the symbol is declared or used."`
+	Line    int    `json:"line" jsonschema_description:"The line of that file the symbol appears on, from 1."`
+	Column  int    `json:"column,omitempty" jsonschema_description:"The byte column the symbol starts at, from 1, when its name appears more than once on the line."`
+	Symbol  string `json:"symbol" jsonschema_description:"The current name of the symbol."`
+	NewName string `json:"new_name" jsonschema_description:"The new name."`
+}
+
+// symbolRename is a rename worked out before anything is written.
+type symbolRename struct {
+	kind  string
+	files []*plannedFile
+	refs  int
+	// notes tell the model what the rename could not check.
+	notes string
+}
+
+func RenameSymbol(ctx context.Context, input json.RawMessage) (string, error) {
+	renameInput := RenameSymbolInput{}
+	err := json.Unmarshal(input, &renameInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rename_symbol input: %w", err)
+	}
+
+	rename, err := planSymbolRename(renameInput)
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+	var submoduleNotes strings.Builder
+	for _, f := range rename.files {
+		paths = append(paths, f.path)
+		note, err := checkSubmoduleEdit(f.path)
+		if err != nil {
+			return "", err
+		}
+		submoduleNotes.WriteString(note)
+	}
+
+	err = checkpointFiles("rename_symbol", paths...)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range rename.files {
+		err := writePlannedFile(f)
+		if err != nil {
+			if _, restoreErr := Checkpoints.Undo(1); restoreErr != nil {
+				return "", fmt.Errorf("%v; rollback failed: %w", err, restoreErr)
+			}
+			return "", fmt.Errorf("%w; all changes rolled back", err)
+		}
+	}
+
+	diff := plannedDiff(rename.files)
+	fmt.Printf("\u001b[92mRename success\u001b[0m: Renamed %s to %s in %d file(s)\n", renameInput.Symbol, renameInput.NewName, len(rename.files))
+	printDiff("rename_symbol", diff)
+	return fmt.Sprintf("Renamed %s %s to %s: %d reference(s) in %d file(s):\n%s", rename.kind, renameInput.Symbol, renameInput.NewName, rename.refs, len(rename.files), diff) +
+		rename.notes + submoduleNotes.String() + runPostEditHooks(paths...), nil
+}
+
+// PreviewRenameSymbol renders the combined diff a rename_symbol call would
+// make.
+func PreviewRenameSymbol(input json.RawMessage) (string, error) {
+	renameInput := RenameSymbolInput{}
+	err := json.Unmarshal(input, &renameInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rename_symbol input: %w", err)
+	}
+	rename, err := planSymbolRename(renameInput)
+	if err != nil {
+		return "", err
+	}
+	return ColorizeDiff(plannedDiff(rename.files)), nil
+}
+
+// planSymbolRename type-checks the module holding the file named in the
+// input and works out the files the rename changes.
+func planSymbolRename(in RenameSymbolInput) (*symbolRename, error) {
+	if in.Path == "" || in.Symbol == "" || in.NewName == "" {
+		return nil, fmt.Errorf("path, symbol and new_name cannot be empty")
+	}
+	if in.Line < 1 {
+		return nil, fmt.Errorf("line must be 1 or more")
+	}
+	if !token.IsIdentifier(in.NewName) || in.NewName == "_" {
+		return nil, fmt.Errorf("%q is not a valid Go identifier", in.NewName)
+	}
+	if in.NewName == in.Symbol {
+		return nil, fmt.Errorf("the symbol is already called %s", in.Symbol)
+	}
+	path, err := workspacePath(in.Path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".go" {
+		return nil, fmt.Errorf("rename_symbol only renames Go symbols; %s is not a Go file", in.Path)
+	}
+
+	m, err := loadGoModule(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := m.objectAt(path, in.Line, in.Column, in.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkRenamable(obj, in.Symbol); err != nil {
+		return nil, err
+	}
+	m.checkUsers(obj)
+
+	targets := m.targets(obj)
+	refs := m.references(targets, in.Symbol)
+	if err := m.checkClashes(obj, refs, in.NewName); err != nil {
+		return nil, err
+	}
+	rename, err := m.apply(refs, in.Symbol, in.NewName)
+	if err != nil {
+		return nil, err
+	}
+	rename.kind = objectKind(obj)
+	rename.notes = m.notes(in.Symbol)
+	if _, ok := implicitMethods[in.Symbol]; ok && rename.kind == "method" {
+		rename.notes += fmt.Sprintf("\nNote: packages such as fmt and encoding/json call %s methods by name, through interfaces the module may not mention; check nothing relied on it.\n", in.Symbol)
+	}
+	return rename, nil
+}
+
+// goModule is the Go module a rename looks through, parsed and type-checked
+// package by package with the standard library's importers for packages
+// from outside it.
+type goModule struct {
+	fset *token.FileSet
+	// root is the module's directory in the workspace and path its import
+	// path.
+	root string
+	path string
+
+	packages map[string]*goPackage
+	external types.Importer
+	checking map[string]bool
+	// checked are the results of type-checking, test variants included,
+	// and own their packages.
+	checked []*checkedPackage
+	own     map[*types.Package]bool
+	files   map[string]*ast.File
+	// excluded are the files left out by build constraints.
+	excluded []string
+	errors   []error
+}
+
+// goPackage is the files of a package directory.
+type goPackage struct {
+	files  []*ast.File
+	tests  []*ast.File
+	xtests []*ast.File
+	types  *types.Package
+	// done is set once the package and its tests are checked.
+	done bool
+}
+
+type checkedPackage struct {
+	pkg   *types.Package
+	info  *types.Info
+	files []*ast.File
+}
+
+// symbolRef is an identifier that refers to the symbol being renamed.
+type symbolRef struct {
+	id *ast.Ident
+	c  *checkedPackage
+	// def is set where the identifier declares the symbol.
+	def types.Object
+}
+
+// externalImporter imports with the first importer that succeeds: compiled
+// export data is quick, parsing the source works without the go command.
+type externalImporter []types.Importer
+
+func (e externalImporter) Import(path string) (pkg *types.Package, err error) {
+	for _, imp := range e {
+		if pkg, err = imp.Import(path); err == nil {
+			return pkg, nil
+		}
+	}
+	return nil, err
+}
+
+// exportImporter imports the module's dependencies from the export data the
+// go command compiles for them, as listed by go list.
+func exportImporter(fset *token.FileSet, root string) types.Importer {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-export", "-deps", "-test", "-f", "{{.ImportPath}}\t{{.Export}}", "./...")
+	cmd.Dir = root
+	out, _ := cmd.Output()
+
+	exports := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		// Test variants are listed as "path [path.test]".
+		path, export, ok := strings.Cut(line, "\t")
+		if ok && export != "" && !strings.Contains(path, " ") {
+			exports[path] = export
+		}
+	}
+	return importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		export, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(export)
+	})
+}
+
+// findGoModule returns the directory of the go.mod file governing file and
+// the module's import path.
+func findGoModule(file string) (dir, path string, err error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", "", err
+	}
+	for dir = filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		content, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			m := modulePattern.FindSubmatch(content)
+			if m == nil {
+				return "", "", fmt.Errorf("%s has no module directive", filepath.Join(dir, "go.mod"))
+			}
+			return dir, string(m[1]), nil
+		}
+		if filepath.Dir(dir) == dir {
+			return "", "", fmt.Errorf("%s is not in a Go module: no go.mod found", file)
+		}
+	}
+}
+
+// loadGoModule parses the Go files of the module holding file. Packages are
+// type-checked as the rename needs them. A module reaching outside the
+// workspace is only looked at inside it.
+func loadGoModule(file string) (*goModule, error) {
+	modDir, modPath, err := findGoModule(file)
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the workspace: %w", err)
+	}
+	root, err := filepath.Rel(cwd, modDir)
+	if err != nil {
+		return nil, err
+	}
+	if outsideDir(root) {
+		rel, _ := filepath.Rel(modDir, cwd)
+		root, modPath = ".", modPath+"/"+filepath.ToSlash(rel)
+	}
+
+	fset := token.NewFileSet()
+	m := &goModule{
+		fset:     fset,
+		root:     root,
+		path:     modPath,
+		packages: map[string]*goPackage{},
+		external: externalImporter{exportImporter(fset, root), importer.Default(), importer.ForCompiler(fset, "source", nil)},
+		checking: map[string]bool{},
+		own:      map[*types.Package]bool{},
+		files:    map[string]*ast.File{},
+	}
+
+	nested := map[string]bool{}
+	paths, err := sourceFiles(context.Background(), root, func(path, relPath string) bool {
+		return strings.HasSuffix(path, ".go") && !m.skipDir(filepath.Dir(path), nested)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		dir, name := filepath.Split(path)
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			m.excluded = append(m.excluded, path)
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("cannot rename while a file does not parse: %w", err)
+		}
+		m.files[path] = f
+
+		importPath := m.importPath(filepath.Dir(path))
+		p := m.packages[importPath]
+		if p == nil {
+			p = &goPackage{}
+			m.packages[importPath] = p
+		}
+		switch {
+		case !strings.HasSuffix(name, "_test.go"):
+			p.files = append(p.files, f)
+		case strings.HasSuffix(f.Name.Name, "_test"):
+			p.xtests = append(p.xtests, f)
+		default:
+			p.tests = append(p.tests, f)
+		}
+	}
+
+	return m, nil
+}
+
+// checkPackage type-checks the package path with its tests, once.
+func (m *goModule) checkPackage(path string) {
+	p := m.packages[path]
+	if p == nil || p.done {
+		return
+	}
+	p.done = true
+	if len(p.files) > 0 {
+		m.Import(path)
+	}
+	if len(p.tests) > 0 {
+		m.check(path, append(append([]*ast.File{}, p.files...), p.tests...))
+	}
+	if len(p.xtests) > 0 {
+		m.check(path+"_test", p.xtests)
+	}
+}
+
+// checkUsers type-checks the packages that can refer to obj: its own and,
+// when it is exported, those importing it, directly or not.
+func (m *goModule) checkUsers(obj types.Object) {
+	declared := strings.TrimSuffix(obj.Pkg().Path(), "_test")
+	m.checkPackage(declared)
+	if !obj.Exported() {
+		return
+	}
+
+	importers := map[string][]string{}
+	for path, p := range m.packages {
+		for _, f := range append(append(append([]*ast.File{}, p.files...), p.tests...), p.xtests...) {
+			for _, spec := range f.Imports {
+				imported := strings.Trim(spec.Path.Value, "`\"")
+				importers[imported] = append(importers[imported], path)
+			}
+		}
+	}
+	users := []string{declared}
+	seen := map[string]bool{declared: true}
+	for len(users) > 0 {
+		path := users[0]
+		users = users[1:]
+		for _, user := range importers[path] {
+			if !seen[user] {
+				seen[user] = true
+				users = append(users, user)
+			}
+		}
+	}
+
+	var paths []string
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		m.checkPackage(path)
+	}
+}
+
+// skipDir reports whether the files in dir are not part of the module: test
+// data, directories the go command ignores and nested modules.
+func (m *goModule) skipDir(dir string, nested map[string]bool) bool {
+	skip, ok := nested[dir]
+	if ok {
+		return skip
+	}
+	rel, _ := filepath.Rel(m.root, dir)
+	if rel != "." {
+		name := filepath.Base(dir)
+		_, err := os.Stat(filepath.Join(dir, "go.mod"))
+		skip = err == nil || name == "testdata" || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") ||
+			m.skipDir(filepath.Dir(dir), nested)
+	}
+	nested[dir] = skip
+	return skip
+}
+
+// importPath returns the import path of the package in dir.
+func (m *goModule) importPath(dir string) string {
+	rel, _ := filepath.Rel(m.root, dir)
+	if rel == "." {
+		return m.path
+	}
+	return m.path + "/" + filepath.ToSlash(rel)
+}
+
+// Import type-checks the module's packages from their source, once, and
+// leaves the others to the external importers.
+func (m *goModule) Import(path string) (*types.Package, error) {
+	p, ok := m.packages[path]
+	if !ok || len(p.files) == 0 {
+		return m.external.Import(path)
+	}
+	if p.types != nil {
+		return p.types, nil
+	}
+	if m.checking[path] {
+		return nil, fmt.Errorf("import cycle through %s", path)
+	}
+	m.checking[path] = true
+	p.types = m.check(path, p.files)
+	return p.types, nil
+}
+
+// check type-checks files as the package path. Type errors are recorded and
+// the check goes on, so code that does type-check is still resolved.
+func (m *goModule) check(path string, files []*ast.File) *types.Package {
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		Implicits:  map[ast.Node]types.Object{},
+	}
+	conf := types.Config{
+		Importer:    m,
+		FakeImportC: true,
+		Error: func(err error) {
+			m.errors = append(m.errors, err)
+		},
+	}
+	pkg, _ := conf.Check(path, m.fset, files, info)
+	m.own[pkg] = true
+	m.checked = append(m.checked, &checkedPackage{pkg: pkg, info: info, files: files})
+	return pkg
+}
+
+// objectAt finds the identifier name on a line of file, starting at column
+// when given, and returns the object it declares or refers to.
+func (m *goModule) objectAt(file string, line, column int, name string) (types.Object, error) {
+	f := m.files[file]
+	if f == nil {
+		for _, excluded := range m.excluded {
+			if excluded == file {
+				return nil, fmt.Errorf("%s is excluded by build constraints on this platform; name the symbol where another file uses it", file)
+			}
+		}
+		return nil, fmt.Errorf("%s is not part of module %s", file, m.path)
+	}
+
+	m.checkPackage(m.importPath(filepath.Dir(file)))
+
+	var found *ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || found != nil || id.Name != name {
+			return found == nil
+		}
+		pos := m.fset.Position(id.Pos())
+		if pos.Line == line && (column <= 0 || pos.Column == column) {
+			found = id
+		}
+		return true
+	})
+	if found == nil {
+		if column > 0 {
+			return nil, fmt.Errorf("%s does not start at %s:%d:%d", name, file, line, column)
+		}
+		return nil, fmt.Errorf("%s does not appear on line %d of %s", name, line, file)
+	}
+	for _, c := range m.checked {
+		for _, cf := range c.files {
+			if cf != f {
+				continue
+			}
+			if obj := c.info.Defs[found]; obj != nil {
+				return obj, nil
+			}
+			if obj := c.info.Uses[found]; obj != nil {
+				return obj, nil
+			}
+			// A type switch guard declares a variable in every case.
+			for _, obj := range c.info.Implicits {
+				if obj.Pos() == found.Pos() {
+					return obj, nil
+				}
+			}
+		}
+	}
+	if found == f.Name {
+		return nil, fmt.Errorf("package names cannot be renamed with rename_symbol")
+	}
+	return nil, fmt.Errorf("%s at %s:%d could not be resolved; the code around it may not type-check", name, file, line)
+}
+
+// checkRenamable refuses symbols that are not the module's to rename.
+func (m *goModule) checkRenamable(obj types.Object, name string) error {
+	if obj.Pkg() == nil {
+		return fmt.Errorf("%s is predeclared by Go and cannot be renamed", name)
+	}
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		return fmt.Errorf("%s is an imported package; rename_symbol does not rename imports", name)
+	case *types.Func:
+		if obj.Parent() == obj.Pkg().Scope() && (name == "main" || name == "init") {
+			return fmt.Errorf("%s functions cannot be renamed", name)
+		}
+	}
+	if !m.own[obj.Pkg()] {
+		return fmt.Errorf("%s is declared in %s, outside module %s", name, obj.Pkg().Path(), m.path)
+	}
+	return nil
+}
+
+// targets returns the declaration positions that identify obj across the
+// packages and test variants it is checked in: a type's embedded fields are
+// renamed with it.
+func (m *goModule) targets(obj types.Object) map[token.Pos]bool {
+	targets := map[token.Pos]bool{obj.Pos(): true}
+	if _, ok := obj.(*types.TypeName); !ok {
+		return targets
+	}
+	for _, c := range m.checked {
+		for id, def := range c.info.Defs {
+			if v, ok := def.(*types.Var); ok && v.Embedded() {
+				if used := c.info.Uses[id]; used != nil && m.own[used.Pkg()] && used.Pos() == obj.Pos() {
+					targets[v.Pos()] = true
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// references returns the identifiers named name declaring or referring to
+// the targets, each once, in file order. Objects from outside the module
+// are never targets: their positions belong to other file sets.
+func (m *goModule) references(targets map[token.Pos]bool, name string) []symbolRef {
+	seen := map[token.Pos]bool{}
+	var refs []symbolRef
+	add := func(id *ast.Ident, c *checkedPackage, obj, def types.Object) {
+		if obj == nil || obj.Name() != name || !m.own[obj.Pkg()] || !targets[obj.Pos()] || seen[id.Pos()] {
+			return
+		}
+		seen[id.Pos()] = true
+		refs = append(refs, symbolRef{id: id, c: c, def: def})
+	}
+	for _, c := range m.checked {
+		for id, obj := range c.info.Defs {
+			add(id, c, obj, obj)
+		}
+		for id, obj := range c.info.Uses {
+			add(id, c, obj, nil)
+		}
+	}
+	// The variable of a type switch guard is declared once for every case,
+	// so the identifier declaring it maps to none of them.
+	for _, c := range m.checked {
+		for _, f := range c.files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && id.Name == name && targets[id.Pos()] && !seen[id.Pos()] {
+					seen[id.Pos()] = true
+					refs = append(refs, symbolRef{id: id, c: c})
+				}
+				return true
+			})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].id.Pos() < refs[j].id.Pos() })
+	return refs
+}
+
+// checkClashes refuses a rename that would change what the code means: a
+// name already declared in the same scope, a reference the new name would
+// resolve to something else at, a method set gaining a duplicate, an
+// exported symbol hidden from the packages using it, or a method that
+// satisfies an interface.
+func (m *goModule) checkClashes(obj types.Object, refs []symbolRef, newName string) error {
+	var clashes []string
+	clash := func(format string, args ...interface{}) {
+		if text := fmt.Sprintf(format, args...); len(clashes) < maxRenameNotes && !containsString(clashes, text) {
+			clashes = append(clashes, text)
+		}
+	}
+	// A field or method of the new name clashes once, whichever of the
+	// types it is reached through.
+	members := map[types.Object]bool{}
+	memberClash := func(t types.Type, pkg *types.Package) {
+		if other, _, _ := types.LookupFieldOrMethod(t, true, pkg, newName); other != nil && !members[other] {
+			members[other] = true
+			clash("%s already has %s %s, declared at %s", t, objectKind(other), newName, m.declaredAt(other))
+		}
+	}
+
+	selected := map[*ast.Ident]*ast.SelectorExpr{}
+	for _, c := range m.checked {
+		for sel := range c.info.Selections {
+			selected[sel.Sel] = sel
+		}
+		for _, f := range c.files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if _, seen := selected[sel.Sel]; !seen {
+						selected[sel.Sel] = nil
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	for _, ref := range refs {
+		if obj.Exported() && !token.IsExported(newName) && ref.c.pkg.Path() != obj.Pkg().Path() {
+			clash("%s is used by package %s at %s, which an unexported name would hide it from", obj.Name(), ref.c.pkg.Path(), m.position(ref.id.Pos()))
+		}
+		if sel, ok := selected[ref.id]; ok {
+			// A field or method: the type it is selected on must not have
+			// another one of the new name.
+			if sel != nil {
+				if s := ref.c.info.Selections[sel]; s != nil {
+					memberClash(s.Recv(), ref.c.pkg)
+				}
+			}
+			continue
+		}
+		if ref.def != nil && ref.def.Parent() != nil {
+			if other := ref.def.Parent().Lookup(newName); other != nil {
+				clash("%s is already declared in the same scope at %s", newName, m.declaredAt(other))
+			}
+		}
+		if obj.Parent() == nil {
+			continue
+		}
+		if scope := ref.c.pkg.Scope().Innermost(ref.id.Pos()); scope != nil {
+			if _, other := scope.LookupParent(newName, ref.id.Pos()); other != nil && other.Pos() != obj.Pos() && other.Parent() != types.Universe {
+				clash("at %s %s would refer to the %s declared at %s", m.position(ref.id.Pos()), newName, objectKind(other), m.declaredAt(other))
+			}
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *types.Var:
+		if obj.IsField() {
+			for _, c := range m.checked {
+				for _, tv := range c.info.Types {
+					if st, ok := tv.Type.Underlying().(*types.Struct); ok && structHasField(st, obj) {
+						memberClash(tv.Type, c.pkg)
+					}
+				}
+			}
+		}
+	case *types.Func:
+		if recv := obj.Type().(*types.Signature).Recv(); recv != nil {
+			memberClash(recv.Type(), obj.Pkg())
+			for _, text := range m.interfaceClashes(obj, recv.Type()) {
+				clash("%s", text)
+			}
+		}
+	}
+
+	// Shadowing a predeclared name only matters where the code uses it.
+	if obj.Parent() != nil && types.Universe.Lookup(newName) != nil {
+		for _, c := range m.checked {
+			if c.pkg.Path() != obj.Pkg().Path() {
+				continue
+			}
+			for id, used := range c.info.Uses {
+				if used.Parent() == types.Universe && used.Name() == newName {
+					clash("%s is predeclared and used at %s", newName, m.position(id.Pos()))
+					break
+				}
+			}
+		}
+	}
+
+	if len(clashes) > 0 {
+		return fmt.Errorf("cannot rename %s to %s:\n- %s", obj.Name(), newName, strings.Join(clashes, "\n- "))
+	}
+	return nil
+}
+
+// interfaceClashes lists the interfaces method satisfies for its receiver
+// type, or for an interface method the module's types implementing it,
+// since renaming only one side would break that.
+func (m *goModule) interfaceClashes(method *types.Func, recv types.Type) []string {
+	var named []*types.Named
+	var interfaces []types.Type
+	seen, seenInterfaces := map[types.Type]bool{}, map[types.Type]bool{}
+	for _, c := range m.checked {
+		scope := c.pkg.Scope()
+		for _, name := range scope.Names() {
+			if tn, ok := scope.Lookup(name).(*types.TypeName); ok && !tn.IsAlias() {
+				if n, ok := tn.Type().(*types.Named); ok && n.TypeParams().Len() == 0 && !seen[n] {
+					seen[n] = true
+					named = append(named, n)
+				}
+			}
+		}
+		for _, tv := range c.info.Types {
+			if iface, ok := tv.Type.Underlying().(*types.Interface); ok && iface.IsMethodSet() && !seenInterfaces[tv.Type] {
+				seenInterfaces[tv.Type] = true
+				interfaces = append(interfaces, tv.Type)
+			}
+		}
+	}
+
+	var clashes []string
+	if iface, ok := recv.Underlying().(*types.Interface); ok {
+		for _, n := range named {
+			if types.IsInterface(n) {
+				continue
+			}
+			if types.Implements(n, iface) || types.Implements(types.NewPointer(n), iface) {
+				clashes = append(clashes, fmt.Sprintf("%s implements %s; its %s method would have to be renamed too", n, recv, method.Name()))
+			}
+		}
+		return clashes
+	}
+
+	base := recv
+	if ptr, ok := recv.(*types.Pointer); ok {
+		base = ptr.Elem()
+	}
+	// Interface literals are only named when no named interface is found,
+	// as they are mostly the declarations of those.
+	var literal []string
+	for _, t := range interfaces {
+		iface := t.Underlying().(*types.Interface)
+		if types.Identical(t, base) || !hasMethod(iface, method.Name()) {
+			continue
+		}
+		if types.Implements(base, iface) || types.Implements(types.NewPointer(base), iface) {
+			text := fmt.Sprintf("%s satisfies %s through its %s method", base, t, method.Name())
+			if _, ok := t.(*types.Interface); ok {
+				literal = append(literal, text)
+			} else {
+				clashes = append(clashes, text)
+			}
+		}
+	}
+	if len(clashes) == 0 {
+		return literal
+	}
+	return clashes
+}
+
+// apply replaces every reference with the new name.
+func (m *goModule) apply(refs []symbolRef, oldName, newName string) (*symbolRename, error) {
+	offsets := map[string][]int{}
+	var paths []string
+	for _, ref := range refs {
+		file := m.fset.File(ref.id.Pos())
+		if _, ok := offsets[file.Name()]; !ok {
+			paths = append(paths, file.Name())
+		}
+		offsets[file.Name()] = append(offsets[file.Name()], file.Offset(ref.id.Pos()))
+	}
+	sort.Strings(paths)
+
+	rename := &symbolRename{refs: len(refs)}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		if _, err := workspacePath(path); err != nil {
+			return nil, err
+		}
+		f := &plannedFile{path: path, oldContent: string(content), exists: true}
+		fileOffsets := offsets[path]
+		sort.Sort(sort.Reverse(sort.IntSlice(fileOffsets)))
+		newContent := content
+		for _, offset := range fileOffsets {
+			if offset+len(oldName) > len(content) || string(content[offset:offset+len(oldName)]) != oldName {
+				return nil, fmt.Errorf("%s changed while it was being checked; try again", path)
+			}
+			newContent = append(append(append([]byte{}, newContent[:offset]...), newName...), newContent[offset+len(oldName):]...)
+		}
+		f.newContent = string(newContent)
+		rename.files = append(rename.files, f)
+	}
+	return rename, nil
+}
+
+// notes tells the model what the rename could not vouch for: files that
+// were not type-checked and type errors that may hide references.
+func (m *goModule) notes(name string) string {
+	var sb strings.Builder
+	word := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+	var mentions []string
+	for _, path := range m.excluded {
+		if content, err := os.ReadFile(path); err == nil && word.Match(content) {
+			mentions = append(mentions, path)
+		}
+	}
+	if len(mentions) > 0 {
+		if len(mentions) > maxRenameNotes {
+			mentions = append(mentions[:maxRenameNotes], "...")
+		}
+		fmt.Fprintf(&sb, "\nNot checked, because build constraints exclude them on this platform, but mentioning %s: %s. Rename it there with edit_file if they refer to the same symbol.\n", name, strings.Join(mentions, ", "))
+	}
+	if len(m.errors) > 0 {
+		fmt.Fprintf(&sb, "\nThe module has %d type error(s), such as: %v\nReferences in code that does not type-check may have been missed.\n", len(m.errors), m.errors[0])
+	}
+	return sb.String()
+}
+
+// declaredAt tells where obj is declared: a file and line in the module,
+// or the package outside it.
+func (m *goModule) declaredAt(obj types.Object) string {
+	if obj.Pkg() != nil && !m.own[obj.Pkg()] {
+		return "package " + obj.Pkg().Path()
+	}
+	return m.position(obj.Pos())
+}
+
+// position formats pos as file:line.
+func (m *goModule) position(pos token.Pos) string {
+	p := m.fset.Position(pos)
+	if !p.IsValid() {
+		return "an unknown position"
+	}
+	return fmt.Sprintf("%s:%d", filepath.ToSlash(p.Filename), p.Line)
+}
+
+// objectKind names the kind of symbol obj is.
+func objectKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		if obj.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "function"
+	case *types.TypeName:
+		return "type"
+	case *types.Const:
+		return "constant"
+	case *types.Label:
+		return "label"
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+	}
+	return "variable"
+}
+
+func structHasField(st *types.Struct, field *types.Var) bool {
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Pos() == field.Pos() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMethod(iface *types.Interface, name string) bool {
+	for i := 0; i < iface.NumMethods(); i++ {
+		if iface.Method(i).Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
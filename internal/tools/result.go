@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ToolResult is what the model receives for a tool call. Success is false
+// when the tool could not do what was asked; Error then says why.
+type ToolResult struct {
+	Success bool   `json:"success"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Succeeded returns a successful result carrying output.
+func Succeeded(output string) ToolResult {
+	return ToolResult{Success: true, Output: output}
+}
+
+// Failed returns a failed result carrying message.
+func Failed(message string) ToolResult {
+	return ToolResult{Success: false, Error: message}
+}
+
+// JSON serializes the result for the tool message sent to the model.
+func (r ToolResult) JSON() string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	// Diffs and commands are full of <, > and &; keep them readable.
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(r)
+	if err != nil {
+		return `{"success":false,"error":"failed to encode tool result"}`
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/project"
+)
+
+const lintTimeout = 5 * time.Minute
+
+// --- RunLinter Tool ---
+
+var RunLinterDefinition = ToolDefinition{
+	Name: "run_linter",
+	Description: `Run the project's linter and get back its findings as JSON.
+
+The linter is chosen from the manifest files in 'workdir': golangci-lint for go.mod, ESLint for package.json
+and Ruff for pyproject.toml or setup.py. It must be installed (ESLint in the project's node_modules). Returns
+whether the linter passed and each finding with its file, line, column, rule and message, at most 200 of
+them; 'total' counts them all. Use it to find and fix lint errors, then run it again to confirm they are gone.
+`,
+	InputSchema: GenerateSchema[RunLinterInput](),
+	Function:    RunLinter,
+	Category:    CategoryExecute,
+	Preview:     PreviewRunLinter,
+	Timeout:     lintTimeout + commandGrace,
+}
+
+type RunLinterInput struct {
+	Workdir string `json:"workdir,omitempty" jsonschema_description:"The relative directory holding the project's manifest. Defaults to the current directory."`
+	Target  string `json:"target,omitempty" jsonschema_description:"A file, directory or Go package pattern to lint, relative to workdir. Defaults to the whole project."`
+}
+
+func RunLinter(ctx context.Context, input json.RawMessage) (string, error) {
+	lintInput, p, dir, err := lintProject(input)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mtool\u001b[0m: $ %s\n", strings.Join(p.LintCommand(lintInput.Target), " "))
+	report, err := p.Lint(ctx, dir, lintInput.Target, lintTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(report); err != nil {
+		return "", fmt.Errorf("failed to encode run_linter result: %w", err)
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// PreviewRunLinter shows the command a run_linter call would run.
+func PreviewRunLinter(input json.RawMessage) (string, error) {
+	lintInput, p, _, err := lintProject(input)
+	if err != nil {
+		return "", err
+	}
+	preview := fmt.Sprintf("\u001b[1m$ %s\u001b[0m\n", strings.Join(p.LintCommand(lintInput.Target), " "))
+	if lintInput.Workdir != "" {
+		preview += fmt.Sprintf("  (in %s)\n", lintInput.Workdir)
+	}
+	return preview, nil
+}
+
+// lintProject parses a run_linter call and detects the project it lints.
+func lintProject(input json.RawMessage) (RunLinterInput, project.Project, string, error) {
+	lintInput := RunLinterInput{}
+	err := json.Unmarshal(input, &lintInput)
+	if err != nil {
+		return lintInput, project.Project{}, "", fmt.Errorf("failed to parse run_linter input: %w", err)
+	}
+	if lintInput.Workdir != "" && !filepath.IsLocal(lintInput.Workdir) {
+		return lintInput, project.Project{}, "", fmt.Errorf("%s is outside the workspace", lintInput.Workdir)
+	}
+	target := strings.TrimSuffix(lintInput.Target, "/...")
+	if lintInput.Target != "" && (strings.HasPrefix(lintInput.Target, "-") || (target != "." && !filepath.IsLocal(target))) {
+		return lintInput, project.Project{}, "", fmt.Errorf("invalid target %q: expected a path in the project", lintInput.Target)
+	}
+	p, dir, err := detectProject(lintInput.Workdir)
+	if err != nil {
+		return lintInput, project.Project{}, "", err
+	}
+	if p.LintCommand("") == nil {
+		return lintInput, project.Project{}, "", fmt.Errorf("no linter known for %s projects; use execute_shell to lint the project", p.Type)
+	}
+	return lintInput, p, dir, nil
+}
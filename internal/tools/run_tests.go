@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/project"
+)
+
+const (
+	defaultTestTimeout = 5 * time.Minute
+	maxTestTimeout     = 20 * time.Minute
+)
+
+// --- RunTests Tool ---
+
+var RunTestsDefinition = ToolDefinition{
+	Name: "run_tests",
+	Description: `Run the project's tests and get back how many passed, failed and were skipped, with the output of each failing test.
+
+The test framework is detected from the manifest files in 'workdir': go.mod (go test), Cargo.toml (cargo test),
+package.json (npm test), pyproject.toml or setup.py (pytest) and pom.xml (maven). Use 'target' to run a single
+package, directory or file (e.g. ./internal/tools or tests/test_api.py) and 'filter' to run only the tests whose
+names match (go test -run, pytest -k, cargo test <filter>, jest/vitest -t, maven -Dtest). Run the tests after
+changing code to check the change. Failing tests are not a tool failure; when the code does not even compile,
+'output' holds the end of what the test command printed.
+`,
+	InputSchema: GenerateSchema[RunTestsInput](),
+	Function:    RunTests,
+	Category:    CategoryExecute,
+	Preview:     PreviewRunTests,
+	Timeout:     maxTestTimeout + commandGrace,
+}
+
+type RunTestsInput struct {
+	Workdir        string `json:"workdir,omitempty" jsonschema_description:"The relative directory holding the project's manifest. Defaults to the current directory."`
+	Target         string `json:"target,omitempty" jsonschema_description:"A package, directory or file to limit the run to."`
+	Filter         string `json:"filter,omitempty" jsonschema_description:"Only run tests whose names match this pattern."`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" jsonschema_description:"How long the tests may run before they are killed. Defaults to 300, at most 1200."`
+}
+
+func RunTests(ctx context.Context, input json.RawMessage) (string, error) {
+	runTestsInput := RunTestsInput{}
+	err := json.Unmarshal(input, &runTestsInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse run_tests input: %w", err)
+	}
+
+	p, command, err := testCommand(runTestsInput)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := defaultTestTimeout
+	if runTestsInput.TimeoutSeconds > 0 {
+		timeout = time.Duration(runTestsInput.TimeoutSeconds) * time.Second
+	}
+	if timeout > maxTestTimeout {
+		timeout = maxTestTimeout
+	}
+
+	fmt.Printf("\u001b[92mtool\u001b[0m: $ %s\n", strings.Join(command, " "))
+	report, err := p.Test(ctx, runTestsInput.Workdir, runTestsInput.Target, runTestsInput.Filter, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(report); err != nil {
+		return "", fmt.Errorf("failed to encode run_tests result: %w", err)
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// PreviewRunTests shows the test command a run_tests call would run.
+func PreviewRunTests(input json.RawMessage) (string, error) {
+	runTestsInput := RunTestsInput{}
+	err := json.Unmarshal(input, &runTestsInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse run_tests input: %w", err)
+	}
+	_, command, err := testCommand(runTestsInput)
+	if err != nil {
+		return "", err
+	}
+	preview := fmt.Sprintf("\u001b[1m$ %s\u001b[0m\n", strings.Join(command, " "))
+	if runTestsInput.Workdir != "" {
+		preview += fmt.Sprintf("  (in %s)\n", runTestsInput.Workdir)
+	}
+	return preview, nil
+}
+
+// testCommand detects the project in the input's workdir and returns the
+// command that runs its tests.
+func testCommand(input RunTestsInput) (project.Project, []string, error) {
+	dir := input.Workdir
+	if dir == "" {
+		dir = "."
+	}
+	p, ok := project.Detect(dir)
+	if !ok {
+		return project.Project{}, nil, fmt.Errorf("no go.mod, Cargo.toml, package.json, pyproject.toml, setup.py or pom.xml found in %s; use execute_shell to run the tests", dir)
+	}
+	command, err := p.TestCommand(input.Target, input.Filter)
+	if err != nil {
+		return project.Project{}, nil, err
+	}
+	return p, command, nil
+}
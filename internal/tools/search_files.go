@@ -0,0 +1,212 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultSearchResults = 100
+	maxSearchResults     = 1000
+	// maxSnippetSize bounds how much of a matching line is returned.
+	maxSnippetSize = 200
+	// maxSearchFileSize skips files too large to be source code.
+	maxSearchFileSize = 10 << 20
+)
+
+// --- SearchFiles Tool ---
+
+var SearchFilesDefinition = ToolDefinition{
+	Name: "search_files",
+	Description: `Search file contents across the workspace, like grep.
+
+'pattern' is a literal string unless 'regex' is true, in which case it is a Go regular expression.
+Returns one match per line as path:line: text, sorted by path. Use 'glob' to limit the search to
+some files (e.g. *.go) and 'max_results' to bound the output. Binary files, .git and git submodules
+are skipped. Prefer this over reading many files when looking for where a symbol is defined or used.
+`,
+	InputSchema: GenerateSchema[SearchFilesInput](),
+	Function:    SearchFiles,
+	Category:    CategoryRead,
+}
+
+type SearchFilesInput struct {
+	Pattern         string `json:"pattern" jsonschema_description:"The literal text or regular expression to search for."`
+	Regex           bool   `json:"regex,omitempty" jsonschema_description:"Treat 'pattern' as a regular expression."`
+	CaseInsensitive bool   `json:"case_insensitive,omitempty" jsonschema_description:"Ignore case when matching."`
+	Glob            string `json:"glob,omitempty" jsonschema_description:"Only search files matching this glob, e.g. *.go or internal/**/*.ts."`
+	Path            string `json:"path,omitempty" jsonschema_description:"The relative directory to search in. Defaults to the current directory."`
+	MaxResults      int    `json:"max_results,omitempty" jsonschema_description:"The maximum number of matches to return. Defaults to 100."`
+}
+
+type searchMatch struct {
+	path string
+	line int
+	text string
+}
+
+func SearchFiles(ctx context.Context, input json.RawMessage) (string, error) {
+	searchInput := SearchFilesInput{}
+	err := json.Unmarshal(input, &searchInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse search_files input: %w", err)
+	}
+	if searchInput.Pattern == "" {
+		return "", fmt.Errorf("pattern cannot be empty")
+	}
+
+	root := "."
+	if searchInput.Path != "" {
+		root = searchInput.Path
+	}
+	maxResults := searchInput.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultSearchResults
+	}
+	if maxResults > maxSearchResults {
+		maxResults = maxSearchResults
+	}
+
+	expr := searchInput.Pattern
+	if !searchInput.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if searchInput.CaseInsensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex %q: %w", searchInput.Pattern, err)
+	}
+
+	var globRe *regexp.Regexp
+	if searchInput.Glob != "" {
+		globRe, err = compileGlob(searchInput.Glob)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// One goroutine walks the tree while a pool of workers scans files.
+	paths := make(chan string, 256)
+	var mu sync.Mutex
+	var matches []searchMatch
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				found := searchFile(path, re)
+				if len(found) > 0 {
+					mu.Lock()
+					matches = append(matches, found...)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	declared := gitmodulePaths()
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// An entry that cannot be read, such as a directory the user
+			// has no permission for, is left out of the search.
+			if path == root {
+				return err
+			}
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if isAgentDir(d.Name()) || (path != root && isSubmoduleDir(path, declared)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if globRe != nil {
+			relPath, err := filepath.Rel(root, path)
+			if err != nil || !matchGlob(globRe, searchInput.Glob, relPath) {
+				return nil
+			}
+		}
+		paths <- path
+		return nil
+	})
+	close(paths)
+	wg.Wait()
+	if err != nil {
+		return "", fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	if len(matches) == 0 {
+		return fmt.Sprintf("No matches for %q.", searchInput.Pattern), nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].path != matches[j].path {
+			return matches[i].path < matches[j].path
+		}
+		return matches[i].line < matches[j].line
+	})
+
+	var sb strings.Builder
+	for i, m := range matches {
+		if i == maxResults {
+			fmt.Fprintf(&sb, "[%d more matches not shown; narrow the search or raise max_results]\n", len(matches)-maxResults)
+			break
+		}
+		fmt.Fprintf(&sb, "%s:%d: %s\n", filepath.ToSlash(m.path), m.line, m.text)
+	}
+	return sb.String(), nil
+}
+
+// searchFile returns the lines of a text file that match re. Unreadable,
+// binary and Git LFS pointer files yield nothing.
+func searchFile(path string, re *regexp.Regexp) []searchMatch {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxSearchFileSize {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(content, 0) >= 0 {
+		return nil
+	}
+	if _, ok := ParseLFSPointer(content); ok {
+		return nil
+	}
+
+	var found []searchMatch
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if !re.MatchString(text) {
+			continue
+		}
+		text = strings.TrimSpace(text)
+		if len(text) > maxSnippetSize {
+			text = text[:maxSnippetSize] + "..."
+		}
+		found = append(found, searchMatch{path: path, line: line, text: text})
+	}
+	return found
+}
@@ -0,0 +1,209 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// --- SearchReplace Tool ---
+
+var SearchReplaceDefinition = ToolDefinition{
+	Name: "search_replace",
+	Description: `Replace text across every file matching a glob pattern in one operation.
+
+'find' is a literal string unless 'regex' is true, in which case it is a Go regular expression and
+'replace' may reference capture groups as $1, ${name}, etc.
+Returns the number of replacements per file and a combined unified diff.
+The whole operation can be reverted with undo_last_edit.
+`,
+	InputSchema: GenerateSchema[SearchReplaceInput](),
+	Function:    SearchReplace,
+	Category:    CategoryWrite,
+}
+
+type SearchReplaceInput struct {
+	Glob    string `json:"glob" jsonschema_description:"Glob pattern selecting files, e.g. *.go or internal/**/*.ts."`
+	Find    string `json:"find" jsonschema_description:"The literal text or regular expression to search for."`
+	Replace string `json:"replace" jsonschema_description:"The replacement text."`
+	Regex   bool   `json:"regex,omitempty" jsonschema_description:"Treat 'find' as a regular expression."`
+	Path    string `json:"path,omitempty" jsonschema_description:"The relative directory to search in. Defaults to the current directory."`
+	DryRun  bool   `json:"dry_run,omitempty" jsonschema_description:"Report the changes without writing them."`
+}
+
+type fileReplacement struct {
+	path       string
+	count      int
+	oldContent []byte
+	newContent []byte
+	mode       os.FileMode
+}
+
+func SearchReplace(ctx context.Context, input json.RawMessage) (string, error) {
+	srInput := SearchReplaceInput{}
+	err := json.Unmarshal(input, &srInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse search_replace input: %w", err)
+	}
+	if srInput.Glob == "" || srInput.Find == "" {
+		return "", fmt.Errorf("glob and find cannot be empty")
+	}
+
+	root := "."
+	if srInput.Path != "" {
+		root = srInput.Path
+	}
+
+	globRe, err := compileGlob(srInput.Glob)
+	if err != nil {
+		return "", err
+	}
+	var findRe *regexp.Regexp
+	if srInput.Regex {
+		findRe, err = regexp.Compile(srInput.Find)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex %q: %w", srInput.Find, err)
+		}
+	}
+
+	countMatches := func(content string) int {
+		if findRe != nil {
+			return len(findRe.FindAllStringIndex(content, -1))
+		}
+		return strings.Count(content, srInput.Find)
+	}
+
+	declared := gitmodulePaths()
+	var changes []fileReplacement
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Submodules are separate repositories; only touch them when asked to explicitly.
+			if isAgentDir(info.Name()) || (path != root && isSubmoduleDir(path, declared)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !matchGlob(globRe, srInput.Glob, relPath) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			return nil // binary file
+		}
+		if _, ok := ParseLFSPointer(content); ok {
+			return nil
+		}
+
+		count := countMatches(string(content))
+		var newContent string
+		if findRe != nil {
+			newContent = findRe.ReplaceAllString(string(content), srInput.Replace)
+		} else {
+			newContent = strings.ReplaceAll(string(content), srInput.Find, srInput.Replace)
+		}
+		if count == 0 || newContent == string(content) {
+			return nil
+		}
+
+		changes = append(changes, fileReplacement{
+			path:       path,
+			count:      count,
+			oldContent: content,
+			newContent: []byte(newContent),
+			mode:       info.Mode(),
+		})
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+	if len(changes) == 0 {
+		return "", fmt.Errorf("no matches for %q in files matching %s", srInput.Find, srInput.Glob)
+	}
+
+	var submoduleNote string
+	var rejectedNotes strings.Builder
+	if !srInput.DryRun {
+		submoduleNote, err = checkSubmoduleEdit(root)
+		if err != nil {
+			return "", err
+		}
+
+		// Matches in rejected hunks are back in the reviewed content, so
+		// they are taken off the count; files left unchanged are dropped.
+		var approved []fileReplacement
+		for _, c := range changes {
+			reviewed, rejected := reviewHunks(filepath.ToSlash(c.path), string(c.oldContent), string(c.newContent))
+			if len(rejected) > 0 {
+				c.count = max(c.count-(countMatches(reviewed)-countMatches(string(c.newContent))), 1)
+				c.newContent = []byte(reviewed)
+				rejectedNotes.WriteString(formatRejectedHunks(filepath.ToSlash(c.path), rejected))
+			}
+			if !bytes.Equal(c.newContent, c.oldContent) {
+				approved = append(approved, c)
+			}
+		}
+		if len(approved) == 0 {
+			return "", fmt.Errorf("replacements rejected by the user: %s", rejectedNotes.String())
+		}
+		changes = approved
+	}
+
+	var summary, diff strings.Builder
+	total := 0
+	for _, c := range changes {
+		total += c.count
+		fmt.Fprintf(&summary, "%s: %d\n", filepath.ToSlash(c.path), c.count)
+		diff.WriteString(UnifiedDiff(filepath.ToSlash(c.path), string(c.oldContent), string(c.newContent)))
+	}
+
+	if srInput.DryRun {
+		return fmt.Sprintf("Dry run: %d replacement(s) in %d file(s) would be made\n%s\n%s",
+			total, len(changes), summary.String(), diff.String()), nil
+	}
+
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.path)
+	}
+	err = checkpointFiles(fmt.Sprintf("search_replace %q -> %q in %s", srInput.Find, srInput.Replace, srInput.Glob), paths...)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range changes {
+		err := os.WriteFile(c.path, c.newContent, c.mode.Perm())
+		if err != nil {
+			// Leave the tree as we found it rather than half-replaced.
+			if _, restoreErr := Checkpoints.Undo(1); restoreErr != nil {
+				return "", fmt.Errorf("failed to write %s: %v; rollback failed: %w", c.path, err, restoreErr)
+			}
+			return "", fmt.Errorf("failed to write %s, all changes rolled back: %w", c.path, err)
+		}
+	}
+
+	fmt.Printf("\u001b[92mReplace success\u001b[0m: %d replacement(s) in %d file(s)\n", total, len(changes))
+	result := fmt.Sprintf("Made %d replacement(s) in %d file(s)\n%s\n%s", total, len(changes), summary.String(), diff.String())
+	if rejectedNotes.Len() > 0 {
+		result += "\n" + rejectedNotes.String()
+	}
+	return result + submoduleNote, nil
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code-editing-agent/internal/index"
+)
+
+const (
+	defaultSemanticResults = 8
+	maxSemanticResults     = 30
+	// maxSnippetLines bounds how much of each matching chunk is shown.
+	maxSnippetLines = 25
+)
+
+// SemanticIndex is the embeddings index searched by semantic_search. The
+// tool is only offered when the provider can embed text and this is set.
+var SemanticIndex *index.Index
+
+// indexedExtensions are the kinds of files semantic_search looks through:
+// source code and documentation.
+var indexedExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".mjs": true, ".cjs": true, ".ts": true, ".tsx": true,
+	".rs": true, ".java": true, ".kt": true, ".cs": true, ".rb": true, ".php": true, ".swift": true, ".scala": true,
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".m": true, ".sh": true, ".sql": true,
+	".proto": true, ".md": true, ".rst": true, ".txt": true, ".yaml": true, ".yml": true, ".toml": true,
+	".html": true, ".css": true, ".vue": true, ".svelte": true,
+}
+
+// --- SemanticSearch Tool ---
+
+var SemanticSearchDefinition = ToolDefinition{
+	Name: "semantic_search",
+	Description: `Search the workspace's source files by meaning, using embeddings, to find code related to a
+description when the exact names are not known, e.g. "where are API requests retried" or "parsing of the
+config file".
+
+Returns the most similar chunks of files as path:start-end with a similarity score and the first lines of
+each chunk. Files are indexed on first use and re-indexed as they change, so the first search in a large
+project takes a while. Use search_files instead when you know the text to look for.
+`,
+	InputSchema: GenerateSchema[SemanticSearchInput](),
+	Function:    SemanticSearch,
+	Category:    CategoryRead,
+}
+
+type SemanticSearchInput struct {
+	Query      string `json:"query" jsonschema_description:"A description of the code to find, in natural language."`
+	Path       string `json:"path,omitempty" jsonschema_description:"Only search files under this relative directory."`
+	MaxResults int    `json:"max_results,omitempty" jsonschema_description:"The maximum number of chunks to return. Defaults to 8, at most 30."`
+}
+
+func SemanticSearch(ctx context.Context, input json.RawMessage) (string, error) {
+	searchInput := SemanticSearchInput{}
+	err := json.Unmarshal(input, &searchInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse semantic_search input: %w", err)
+	}
+	if strings.TrimSpace(searchInput.Query) == "" {
+		return "", fmt.Errorf("query cannot be empty")
+	}
+	if SemanticIndex == nil {
+		return "", fmt.Errorf("semantic search needs a provider with an embeddings endpoint")
+	}
+	maxResults := searchInput.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultSemanticResults
+	}
+	if maxResults > maxSemanticResults {
+		maxResults = maxSemanticResults
+	}
+
+	// The whole workspace is kept indexed, whatever the path searched.
+	files, err := sourceFiles(ctx, ".", func(path, relPath string) bool {
+		return indexedExtensions[strings.ToLower(filepath.Ext(path))]
+	})
+	if err != nil {
+		return "", err
+	}
+	_, err = SemanticIndex.Update(ctx, files, func(files, chunks int) {
+		fmt.Printf("\u001b[90mIndexing %d file(s), %d chunk(s)...\u001b[0m\n", files, chunks)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var keep func(string) bool
+	if searchInput.Path != "" && filepath.Clean(searchInput.Path) != "." {
+		prefix := filepath.ToSlash(filepath.Clean(searchInput.Path)) + "/"
+		keep = func(path string) bool { return strings.HasPrefix(path, prefix) }
+	}
+	results, err := SemanticIndex.Search(ctx, searchInput.Query, maxResults, keep)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No matching code found.", nil
+	}
+
+	var sb strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&sb, "%s:%d-%d (score %.2f)\n", r.Path, r.StartLine, r.EndLine, r.Score)
+		sb.WriteString(snippet(r.Path, r.StartLine, r.EndLine))
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// snippet returns the numbered lines start to end of path, cut off after
+// maxSnippetLines.
+func snippet(path string, start, end int) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan() && n <= end; n++ {
+		if n < start {
+			continue
+		}
+		if n >= start+maxSnippetLines {
+			fmt.Fprintf(&sb, "   ... (%d more lines)\n", end-n+1)
+			break
+		}
+		line := scanner.Text()
+		if len(line) > maxSnippetSize {
+			line = line[:maxSnippetSize] + " ..."
+		}
+		fmt.Fprintf(&sb, "%6d\t%s\n", n, line)
+	}
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code-editing-agent/internal/checkpoint"
+)
+
+// Session is what the tools keep for one session: the tools the user
+// approved for the rest of it, its checkpoints and when it began. A
+// process has one session, except the HTTP server, whose sessions take
+// turns at the tools and switch to their own with UseSession.
+type Session struct {
+	checkpoints *checkpoint.Store
+	start       time.Time
+
+	mu     sync.Mutex
+	always map[string]bool
+	// call is the tool the agent is running, and confirmed the files the
+	// user approved it writing although the approval policy asks for them.
+	call      string
+	confirmed map[string]bool
+}
+
+// NewSession starts the state of a session. A non-empty id tells its
+// checkpoints apart from those of the other sessions of the process.
+func NewSession(id string) *Session {
+	start := time.Now()
+	store := checkpoint.NewStore(checkpoint.DefaultDir).StartedAt(start)
+	if id != "" {
+		store = store.ForSession(id)
+	}
+	return &Session{checkpoints: store, start: start, always: map[string]bool{}}
+}
+
+// current is the session the tools run for.
+var current = NewSession("")
+
+// Checkpoints records the state of every file before a tool changes it,
+// for the current session.
+var Checkpoints = current.checkpoints
+
+// UseSession makes the tools run for s from now on, until it is called
+// again with another session.
+func UseSession(s *Session) {
+	current = s
+	Checkpoints = s.checkpoints
+}
+
+// approved reports whether the user chose "always" for tool in the
+// session.
+func (s *Session) approved(tool string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.always[tool]
+}
+
+// approveAlways lets tool run without asking for the rest of the session.
+func (s *Session) approveAlways(tool string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.always[tool] = true
+}
+
+// confirm records that the user approved the running call writing paths.
+func (s *Session) confirm(paths []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.confirmed == nil {
+		s.confirmed = map[string]bool{}
+	}
+	for _, path := range paths {
+		s.confirmed[writeKey(path)] = true
+	}
+}
+
+// unconfirmed returns the running call's tool and those of paths the user
+// has not approved it writing, each once.
+func (s *Session) unconfirmed(paths []string) (string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var left []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		key := writeKey(path)
+		if !s.confirmed[key] && !seen[key] {
+			seen[key] = true
+			left = append(left, path)
+		}
+	}
+	return s.call, left
+}
+
+// writeKey names the file at path the same way whether path is relative
+// or absolute.
+func writeKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultSubtaskTokens = 100_000
+	maxSubtaskTokens     = 500_000
+)
+
+// SubtaskRunner runs a task with a separate conversation and returns the
+// summary the model ends it with.
+type SubtaskRunner interface {
+	// RunSubtask works on task using only the named tools, or the read-only
+	// ones when none are named, and stops once maxTokens prompt and
+	// completion tokens have been used or ctx is done.
+	RunSubtask(ctx context.Context, task string, toolNames []string, maxTokens int) (string, error)
+}
+
+// Subtasks runs the tasks handed out by spawn_task. The tool is only offered
+// when it is set.
+var Subtasks SubtaskRunner
+
+// --- SpawnTask Tool ---
+
+var SpawnTaskDefinition = ToolDefinition{
+	Name: "spawn_task",
+	Description: `Hand a focused sub-task to a helper agent that works in a separate conversation and returns
+only its summary, e.g. "find all usages of Config.Retry and say which ones set MaxAttempts".
+
+Use this for research that would otherwise fill the conversation with file contents and search
+results. The helper sees none of this conversation, so describe the task completely, including
+what the summary should contain. It uses the read-only tools unless 'tools' names others, and
+stops when it has used 'max_tokens' tokens.
+`,
+	InputSchema: GenerateSchema[SpawnTaskInput](),
+	Function:    SpawnTask,
+	// The helper's tools may ask for approval, so it does not run alongside
+	// other tool calls.
+	Category: CategoryExecute,
+}
+
+type SpawnTaskInput struct {
+	Task      string   `json:"task" jsonschema_description:"The complete description of the sub-task and of what to report back."`
+	Tools     []string `json:"tools,omitempty" jsonschema_description:"The names of the tools the helper may use. Defaults to the read-only tools."`
+	MaxTokens int      `json:"max_tokens,omitempty" jsonschema_description:"The most prompt and completion tokens the helper may use. Defaults to 100000, at most 500000."`
+}
+
+func SpawnTask(ctx context.Context, input json.RawMessage) (string, error) {
+	spawnInput := SpawnTaskInput{}
+	err := json.Unmarshal(input, &spawnInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse spawn_task input: %w", err)
+	}
+	if strings.TrimSpace(spawnInput.Task) == "" {
+		return "", fmt.Errorf("task cannot be empty")
+	}
+	if Subtasks == nil {
+		return "", fmt.Errorf("sub-tasks are not available")
+	}
+	maxTokens := spawnInput.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultSubtaskTokens
+	}
+	if maxTokens > maxSubtaskTokens {
+		maxTokens = maxSubtaskTokens
+	}
+	return Subtasks.RunSubtask(ctx, spawnInput.Task, spawnInput.Tools, maxTokens)
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitmodulePaths returns the submodule paths declared in ./.gitmodules.
+func gitmodulePaths() map[string]bool {
+	paths := map[string]bool{}
+	f, err := os.Open(".gitmodules")
+	if err != nil {
+		return paths
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok && strings.TrimSpace(key) == "path" {
+			paths[filepath.Clean(strings.TrimSpace(value))] = true
+		}
+	}
+	return paths
+}
+
+// isSubmoduleDir reports whether dir is the root of a separate repository
+// nested in the workspace: a declared submodule or any directory with its
+// own .git entry.
+func isSubmoduleDir(dir string, declared map[string]bool) bool {
+	dir = filepath.Clean(dir)
+	if dir == "." {
+		return false
+	}
+	if declared[dir] {
+		return true
+	}
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// submoduleContaining returns the submodule that contains path, if any.
+func submoduleContaining(path string) (string, bool) {
+	path = filepath.Clean(path)
+	if filepath.IsAbs(path) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", false
+		}
+		rel, err := filepath.Rel(cwd, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return "", false
+		}
+		path = rel
+	}
+
+	declared := gitmodulePaths()
+	for dir := filepath.Dir(path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if isSubmoduleDir(dir, declared) {
+			return dir, true
+		}
+	}
+	if isSubmoduleDir(path, declared) {
+		return path, true
+	}
+	return "", false
+}
+
+// checkSubmoduleEdit asks the user before a tool writes inside a submodule,
+// since such changes belong to a different repository. It returns a note
+// for the tool result when the user goes ahead.
+func checkSubmoduleEdit(path string) (string, error) {
+	submodule, ok := submoduleContaining(path)
+	if !ok {
+		return "", nil
+	}
+
+	fmt.Printf("\u001b[93mWarning\u001b[0m: %s is inside git submodule %s, which is a separate repository\n", path, submodule)
+	if !Confirm(fmt.Sprintf("Modify %s inside submodule %s anyway?", path, submodule)) {
+		return "", fmt.Errorf("refused to modify %s: it is inside git submodule %s", path, submodule)
+	}
+	return fmt.Sprintf("\nNote: %s is inside git submodule %s; commit this change in that repository, not the parent.", path, submodule), nil
+}
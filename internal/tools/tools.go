@@ -1,12 +1,21 @@
 package tools
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
-	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/invopop/jsonschema"
 )
@@ -16,49 +25,337 @@ type ToolDefinition struct {
 	Name        string
 	Description string
 	InputSchema interface{}
-	Function    func(input json.RawMessage) (string, error)
+	Category    Category
+	// Function runs a call. It should give up once ctx is done, which
+	// happens when the user interrupts the turn or the call runs out of
+	// time.
+	Function func(ctx context.Context, input json.RawMessage) (string, error)
+	// Preview, when set, describes what a call would do (a diff, a
+	// command) so the user can approve it before it runs. An empty preview
+	// means the tool asks for approval itself.
+	Preview func(input json.RawMessage) (string, error)
+	// DryRunPreview, when set, replaces Preview in dry runs, which show
+	// the whole change even where Preview leaves some of it to the tool.
+	DryRunPreview func(input json.RawMessage) (string, error)
+	// Timeout bounds how long a call may run once it is approved. Zero
+	// uses the agent's default for read-only tools and no limit for the
+	// others, which may stop to ask the user something.
+	Timeout time.Duration
+}
+
+// Category classifies what a tool is able to do to the workspace.
+type Category string
+
+const (
+	CategoryRead    Category = "read"    // only inspects files and repository state
+	CategoryWrite   Category = "write"   // modifies files or repository state
+	CategoryExecute Category = "execute" // runs arbitrary commands
+)
+
+// ReadOnly limits the session to tools in CategoryRead: calls to any other
+// tool are refused, whether or not it is offered to the model.
+var ReadOnly bool
+
+// ReadOnlyTools returns the tools in list that cannot modify the workspace.
+func ReadOnlyTools(list []ToolDefinition) []ToolDefinition {
+	var readOnly []ToolDefinition
+	for _, tool := range list {
+		if tool.Category == CategoryRead {
+			readOnly = append(readOnly, tool)
+		}
+	}
+	return readOnly
 }
 
 // --- ReadFile Tool ---
 
+// defaultReadMaxBytes bounds how much of a file read_file returns when the
+// model does not ask for less.
+const defaultReadMaxBytes = 32 * 1024
+
+// defaultMaxReadFileSize is the largest file read_file reads whole when
+// MaxReadFileSize is not set.
+const defaultMaxReadFileSize = 1 << 20
+
+// MaxReadFileSize is the largest file, in bytes, that read_file reads
+// whole; larger ones are read a line range or their tail at a time. Zero
+// means the default of 1MB. main sets it from the config.
+var MaxReadFileSize int64
+
+// sniffSize is how much of a file is looked at to tell whether it is
+// binary.
+const sniffSize = 8 * 1024
+
+// previewLines is how many lines from each end of a file too large to read
+// whole are shown when no range is asked for.
+const previewLines = 10
+
 var ReadFileDefinition = ToolDefinition{
-	Name:        "read_file",
-	Description: "Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.",
+	Name: "read_file",
+	Description: `Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.
+
+Lines are returned numbered, each prefixed with its line number and a tab, which are not part of
+the file: leave them out of edit_file's old_str. The first line of the output gives the range
+shown and the file's total line count. Large files are cut off after 'max_bytes'; use
+'start_line' and 'end_line' to page through them or to read just the part you need, or 'tail'
+for the end of a log. Files over the size limit (1MB by default) are only read in such parts,
+and binary files such as images and archives are refused.
+`,
 	InputSchema: GenerateSchema[ReadFileInput](),
 	Function:    ReadFile,
+	Category:    CategoryRead,
 }
 
 type ReadFileInput struct {
-	Path string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
+	Path      string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
+	StartLine int    `json:"start_line,omitempty" jsonschema_description:"The first line to return, counting from 1. Defaults to 1."`
+	EndLine   int    `json:"end_line,omitempty" jsonschema_description:"The last line to return, inclusive. Defaults to the end of the file."`
+	MaxBytes  int    `json:"max_bytes,omitempty" jsonschema_description:"The most bytes of file content to return. Defaults to 32768."`
+	Tail      int    `json:"tail,omitempty" jsonschema_description:"Return only this many lines from the end of the file, e.g. the latest entries of a log. Not used with start_line and end_line."`
 }
 
-func ReadFile(input json.RawMessage) (string, error) {
+func ReadFile(ctx context.Context, input json.RawMessage) (string, error) {
 	readFileInput := ReadFileInput{}
 	err := json.Unmarshal(input, &readFileInput)
 	if err != nil {
 		return "", err
 	}
-	content, err := os.ReadFile(readFileInput.Path)
+	if readFileInput.Tail > 0 && (readFileInput.StartLine > 0 || readFileInput.EndLine > 0) {
+		return "", fmt.Errorf("use either tail or start_line and end_line, not both")
+	}
+	file, err := os.Open(readFileInput.Path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
 	if err != nil {
 		return "", err
 	}
-	return string(content), nil
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory; use list_files to see what is in it", readFileInput.Path)
+	}
+
+	// The start of the file tells whether it is text.
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+	if ptr, ok := ParseLFSPointer(head); ok && int64(n) == info.Size() {
+		return fmt.Sprintf("%s: %s. Use git_lfs_pull to download it if its contents are really needed.", readFileInput.Path, ptr), nil
+	}
+	if kind := binaryKind(head); kind != "" {
+		return fmt.Sprintf("%s is a binary file (%s, %s); read_file only reads text. Use a command that understands the format if its contents are really needed.",
+			readFileInput.Path, kind, FormatSize(info.Size())), nil
+	}
+
+	limit := MaxReadFileSize
+	if limit <= 0 {
+		limit = defaultMaxReadFileSize
+	}
+	if info.Size() <= limit {
+		rest, err := io.ReadAll(file)
+		if err != nil {
+			return "", err
+		}
+		content := string(append(head, rest...))
+		lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+		if content == "" {
+			lines = nil
+		}
+		return numberLines(readFileInput, lines, 1, len(lines))
+	}
+
+	// Larger files are scanned a line at a time, keeping only the lines
+	// asked for.
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if readFileInput.StartLine > 0 || readFileInput.EndLine > 0 || readFileInput.Tail > 0 {
+		return readLines(file, readFileInput)
+	}
+	preview := readFileInput
+	preview.EndLine = previewLines
+	beginning, err := readLines(file, preview)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	preview = ReadFileInput{Path: readFileInput.Path, MaxBytes: readFileInput.MaxBytes, Tail: previewLines}
+	end, err := readLines(file, preview)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s is %s, over the %s that read_file reads whole. Read it in parts with start_line and end_line or tail, or find what you need with search_files. Its first and last lines:\n%s...\n%s",
+		readFileInput.Path, FormatSize(info.Size()), FormatSize(limit), beginning, end), nil
+}
+
+// binaryKind returns the type of the data a file starts with, such as
+// "image/png", or "" when it is text.
+func binaryKind(head []byte) string {
+	kind := http.DetectContentType(head)
+	if bytes.IndexByte(head, 0) >= 0 {
+		if strings.HasPrefix(kind, "text/") {
+			return "application/octet-stream"
+		}
+		return kind
+	}
+	if strings.HasPrefix(kind, "text/") {
+		return ""
+	}
+	return kind
+}
+
+// readLines numbers the lines of a file too large to read whole that
+// readFileInput asks for, reading it a line at a time.
+func readLines(r io.Reader, readFileInput ReadFileInput) (string, error) {
+	start := max(readFileInput.StartLine, 1)
+	maxBytes := readFileInput.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultReadMaxBytes
+	}
+	reader := bufio.NewReader(r)
+	var kept []string
+	first, total, size := 0, 0, 0
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			if err != io.EOF {
+				return "", err
+			}
+			break
+		}
+		total++
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case readFileInput.Tail > 0:
+			kept = append(kept, line)
+			if len(kept) > readFileInput.Tail {
+				kept = kept[1:]
+			}
+		case total >= start && (readFileInput.EndLine <= 0 || total <= readFileInput.EndLine) && size <= maxBytes:
+			// One line past max_bytes is kept so that the output says it
+			// was cut off.
+			if first == 0 {
+				first = total
+			}
+			kept = append(kept, line)
+			size += len(line) + 1
+		}
+		if err != nil {
+			break
+		}
+	}
+	if readFileInput.Tail > 0 {
+		first = total - len(kept) + 1
+	}
+	return numberLines(readFileInput, kept, first, total)
+}
+
+// numberLines returns the requested lines of a file, numbered, under a
+// header giving the range and the total line count. lines holds the
+// file's lines from line first on, at least those requested, and total is
+// how many the file has.
+func numberLines(readFileInput ReadFileInput, lines []string, first, total int) (string, error) {
+	start := readFileInput.StartLine
+	if start <= 0 {
+		start = 1
+	}
+	end := readFileInput.EndLine
+	if end <= 0 || end > total {
+		end = total
+	}
+	if readFileInput.Tail > 0 {
+		start = max(total-readFileInput.Tail+1, 1)
+	}
+	if total == 0 {
+		return fmt.Sprintf("%s is empty.", readFileInput.Path), nil
+	}
+	if start > total {
+		return "", fmt.Errorf("start_line %d is past the end of %s, which has %d lines", start, readFileInput.Path, total)
+	}
+	if end < start {
+		return "", fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+	maxBytes := readFileInput.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultReadMaxBytes
+	}
+
+	var body strings.Builder
+	size := 0
+	last := start - 1
+	for i := start; i <= end && i-first < len(lines); i++ {
+		line := lines[i-first]
+		if size+len(line)+1 > maxBytes && i > start {
+			break
+		}
+		// The first line is always shown, if need be cut short itself.
+		if len(line) > maxBytes {
+			line = line[:maxBytes] + fmt.Sprintf(" ... (%d more bytes on this line)", len(line)-maxBytes)
+		}
+		size += len(line) + 1
+		fmt.Fprintf(&body, "%6d\t%s\n", i, line)
+		last = i
+	}
+
+	header := fmt.Sprintf("%s: lines %d-%d of %d\n", readFileInput.Path, start, last, total)
+	if last < end {
+		return header + body.String() + fmt.Sprintf("(Output cut off at %d bytes; continue with start_line=%d.)\n", maxBytes, last+1), nil
+	}
+	return header + body.String(), nil
 }
 
 // --- ListFiles Tool ---
 
+// defaultListMaxResults bounds how many entries list_files returns when the
+// model does not ask for a different limit.
+const defaultListMaxResults = 500
+
 var ListFilesDefinition = ToolDefinition{
-	Name:        "list_files",
-	Description: "List files and directories at a given path. If no path is provided, lists files in the current directory.",
+	Name: "list_files",
+	Description: `List files and directories at a given path. If no path is provided, lists files in the current directory.
+
+Returns an indented tree, two spaces per level, directories first. Directories end in "/" and
+show how many files they hold and their total size, counting files below max_depth that are not
+listed; files show their size. Paths ignored by .gitignore or .agentignore files, and the .git
+directory, are left out unless include_ignored is set. Git submodules are marked with
+"(git submodule)" and their contents are not listed unless include_submodules is set. Start
+with a small 'max_depth' to get an overview of a large tree, and use 'glob' to list only
+matching files; at most 'max_results' entries are returned, followed by a note when the
+listing was cut off.
+`,
 	InputSchema: GenerateSchema[ListFilesInput](),
 	Function:    ListFiles,
+	Category:    CategoryRead,
 }
 
 type ListFilesInput struct {
-	Path string `json:"path" jsonschema_description:"The relative path of a directory in the working directory."`
+	Path              string `json:"path" jsonschema_description:"The relative path of a directory in the working directory."`
+	IncludeSubmodules bool   `json:"include_submodules,omitempty" jsonschema_description:"Also list the contents of git submodules."`
+	MaxDepth          int    `json:"max_depth,omitempty" jsonschema_description:"How many directory levels to list; 1 lists only the direct contents of path, with totals for each directory. Defaults to no limit."`
+	Glob              string `json:"glob,omitempty" jsonschema_description:"Only list files matching this glob, e.g. *.go or src/**/*.ts, and the directories holding them."`
+	MaxResults        int    `json:"max_results,omitempty" jsonschema_description:"The most entries to return. Defaults to 500."`
+	IncludeIgnored    bool   `json:"include_ignored,omitempty" jsonschema_description:"Also list paths ignored by .gitignore and .agentignore."`
 }
 
-func ListFiles(input json.RawMessage) (string, error) {
+// fileNode is an entry of the tree list_files returns.
+type fileNode struct {
+	name     string
+	dir      bool
+	note     string
+	depth    int
+	size     int64
+	files    int
+	parent   *fileNode
+	children []*fileNode
+}
+
+func ListFiles(ctx context.Context, input json.RawMessage) (string, error) {
 	listFilesInput := ListFilesInput{}
 	err := json.Unmarshal(input, &listFilesInput)
 	if err != nil {
@@ -69,36 +366,128 @@ func ListFiles(input json.RawMessage) (string, error) {
 	if listFilesInput.Path != "" {
 		dir = listFilesInput.Path
 	}
+	var glob *regexp.Regexp
+	if listFilesInput.Glob != "" {
+		glob, err = compileGlob(listFilesInput.Glob)
+		if err != nil {
+			return "", err
+		}
+	}
+	maxResults := listFilesInput.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultListMaxResults
+	}
 
-	var files []string
+	// The whole tree is walked, below max_depth too, so that directories
+	// can show what they hold.
+	declared := gitmodulePaths()
+	ignore := newIgnoreMatcher(dir)
+	root := &fileNode{dir: true}
+	dirs := map[string]*fileNode{".": root}
 	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		relPath, err := filepath.Rel(dir, path)
 		if err != nil {
 			return err
 		}
-		if relPath != "." {
+		if relPath == "." {
+			if !listFilesInput.IncludeIgnored {
+				ignore.enter(relPath)
+			}
+			return nil
+		}
+
+		if info.IsDir() && isAgentDir(info.Name()) {
+			// Git's internals and the agent's checkpoints are not part of
+			// the project.
+			return filepath.SkipDir
+		}
+		if !listFilesInput.IncludeIgnored && ignore.ignored(relPath, info.IsDir()) {
 			if info.IsDir() {
-				files = append(files, relPath+"/")
-			} else {
-				files = append(files, relPath)
+				return filepath.SkipDir
 			}
+			return nil
+		}
+		parent := dirs[filepath.Dir(relPath)]
+		node := &fileNode{name: info.Name(), dir: info.IsDir(), depth: parent.depth + 1, parent: parent}
+		if info.IsDir() {
+			parent.children = append(parent.children, node)
+			if !listFilesInput.IncludeSubmodules && isSubmoduleDir(path, declared) {
+				node.note = "git submodule"
+				return filepath.SkipDir
+			}
+			dirs[relPath] = node
+			if !listFilesInput.IncludeIgnored {
+				ignore.enter(relPath)
+			}
+			return nil
+		}
+		if glob != nil && !matchGlob(glob, listFilesInput.Glob, relPath) {
+			return nil
+		}
+		node.size = info.Size()
+		parent.children = append(parent.children, node)
+		for d := parent; d != nil; d = d.parent {
+			d.files++
+			d.size += node.size
 		}
 		return nil
 	})
-
 	if err != nil {
 		return "", err
 	}
 
-	result, err := json.Marshal(files)
-	if err != nil {
-		return "", err
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %d file(s), %s\n", filepath.ToSlash(dir), root.files, FormatSize(root.size))
+	shown, total := 0, 0
+	var render func(node *fileNode)
+	render = func(node *fileNode) {
+		sort.SliceStable(node.children, func(i, j int) bool {
+			a, b := node.children[i], node.children[j]
+			if a.dir != b.dir {
+				return a.dir
+			}
+			return a.name < b.name
+		})
+		for _, child := range node.children {
+			if listFilesInput.MaxDepth > 0 && child.depth > listFilesInput.MaxDepth {
+				return
+			}
+			if glob != nil && child.dir && child.files == 0 {
+				// Directories without matching files are left out.
+				continue
+			}
+			total++
+			if shown < maxResults {
+				shown++
+				indent := strings.Repeat("  ", child.depth-1)
+				switch {
+				case child.note != "":
+					fmt.Fprintf(&sb, "%s%s/ (%s)\n", indent, child.name, child.note)
+				case child.dir && child.files == 0:
+					fmt.Fprintf(&sb, "%s%s/ (empty)\n", indent, child.name)
+				case child.dir:
+					fmt.Fprintf(&sb, "%s%s/ (%d file(s), %s)\n", indent, child.name, child.files, FormatSize(child.size))
+				default:
+					fmt.Fprintf(&sb, "%s%s %s\n", indent, child.name, FormatSize(child.size))
+				}
+			}
+			if child.dir {
+				render(child)
+			}
+		}
 	}
+	render(root)
 
-	return string(result), nil
+	if total > shown {
+		fmt.Fprintf(&sb, "(Showing %d of %d entries; narrow the listing with path, max_depth or glob, or raise max_results.)\n", shown, total)
+	}
+	return sb.String(), nil
 }
 
 // --- EditFile Tool ---
@@ -109,63 +498,251 @@ var EditFileDefinition = ToolDefinition{
 
 Replaces 'old_str' with 'new_str' in the given file. 'old_str' and 'new_str' MUST be different from each other.
 
+'old_str' must occur exactly once unless 'expected_occurrences' says how many times it occurs or
+'replace_all' is set; otherwise the edit fails and lists the lines where it was found, so include
+enough surrounding lines to pick out the one to change.
+
+If 'old_str' is not found, usually because the file changed since you read it, the error shows the
+closest match in the file and how similar it is. To apply the edit there, send it again with
+'fuzzy_match_line' set to the line given; otherwise read the file again.
+
 If the file specified with path doesn't exist, it will be created.
+Returns the lines changed and a unified diff of the change so you can check exactly what was modified.
 `,
-	InputSchema: GenerateSchema[EditFileInput](),
-	Function:    EditFile,
+	InputSchema:   withDryRun(GenerateSchema[EditFileInput]()),
+	Function:      EditFile,
+	Category:      CategoryWrite,
+	Preview:       PreviewEditFile,
+	DryRunPreview: DiffEditFile,
 }
 
 type EditFileInput struct {
 	Path   string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
 	OldStr string `json:"old_str" jsonschema_description:"The string to be replaced."`
 	NewStr string `json:"new_str" jsonschema_description:"The string to replace with."`
+	// ExpectedOccurrences and ReplaceAll guard against replacing more than
+	// was meant to, which a short old_str easily does.
+	ExpectedOccurrences int  `json:"expected_occurrences,omitempty" jsonschema_description:"How many times old_str occurs in the file; all of them are replaced. Defaults to 1."`
+	ReplaceAll          bool `json:"replace_all,omitempty" jsonschema_description:"Replace every occurrence of old_str, however many there are."`
+	// FuzzyMatchLine applies the edit at the closest match suggested when
+	// old_str was not found.
+	FuzzyMatchLine int `json:"fuzzy_match_line,omitempty" jsonschema_description:"Apply the edit at the closest match to old_str starting on this line, as suggested when old_str was not found; the lines matched are replaced with new_str."`
 }
 
-func EditFile(input json.RawMessage) (string, error) {
+func EditFile(ctx context.Context, input json.RawMessage) (string, error) {
 	editFileInput := EditFileInput{}
 	err := json.Unmarshal(input, &editFileInput)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse edit_file input: %w", err)
 	}
 
+	err = validateEdit(editFileInput)
+	if err != nil {
+		return "", err
+	}
+
+	submoduleNote, err := checkSubmoduleEdit(editFileInput.Path)
+	if err != nil {
+		return "", err
+	}
+
+	oldContent, newContent, lines, exists, err := planEdit(editFileInput)
+	// When old_str is not found, the user can have the edit applied at the
+	// closest match instead.
+	var noMatch *noMatchError
+	if errors.As(err, &noMatch) && noMatch.found && AskUser != nil {
+		editFileInput, err = offerCloseMatch(editFileInput, noMatch)
+		if err == nil {
+			oldContent, newContent, lines, exists, err = planEdit(editFileInput)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		err = checkpointFiles("edit_file "+editFileInput.Path, editFileInput.Path)
+		if err != nil {
+			return "", err
+		}
+		result, createErr := createNewFile(editFileInput.Path, editFileInput.NewStr)
+		if createErr != nil {
+			return "", createErr
+		}
+		fmt.Printf("\u001b[92mEdit success\u001b[0m: Created new file %s\n", editFileInput.Path)
+		diff := UnifiedDiff(editFileInput.Path, "", newContent)
+		printDiff("edit_file", diff)
+		return result + "\n" + diff + submoduleNote + runPostEditHooks(editFileInput.Path), nil
+	}
+
+	// Multi-hunk edits are reviewed hunk by hunk unless the user already
+	// allowed every edit.
+	var rejected []Hunk
+	if !Approved("edit_file") {
+		newContent, rejected = reviewHunks(editFileInput.Path, oldContent, newContent)
+	}
+	if newContent == oldContent {
+		if len(rejected) > 0 {
+			return "", fmt.Errorf("edit to %s rejected by the user: %s", editFileInput.Path, formatRejectedHunks(editFileInput.Path, rejected))
+		}
+		return "", fmt.Errorf("edit to %s made no change: the file already has new_str there", editFileInput.Path)
+	}
+
+	err = checkpointFiles("edit_file "+editFileInput.Path, editFileInput.Path)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(editFileInput.Path, []byte(newContent), 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write to file %s: %w", editFileInput.Path, err)
+	}
+
+	fmt.Printf("\u001b[92mEdit success\u001b[0m: Updated file %s\n", editFileInput.Path)
+	diff := UnifiedDiff(editFileInput.Path, oldContent, newContent)
+	printDiff("edit_file", diff)
+	hookNotes := runPostEditHooks(editFileInput.Path)
+	if len(rejected) > 0 {
+		return "File partially edited. Applied:\n" + diff + formatRejectedHunks(editFileInput.Path, rejected) + submoduleNote + hookNotes, nil
+	}
+	return fmt.Sprintf("File successfully edited; replaced on line(s) %s:\n", formatLines(lines)) + diff + submoduleNote + hookNotes, nil
+}
+
+// printDiff shows the diff of a change a tool applied, unless the user
+// already saw it while approving the change.
+func printDiff(tool, diff string) {
+	if AskUser == nil || Approved(tool) {
+		fmt.Print(ColorizeDiff(diff))
+	}
+}
+
+// PreviewEditFile renders the diff an edit_file call would make. Edits with
+// several hunks return no preview since EditFile reviews them one by one.
+func PreviewEditFile(input json.RawMessage) (string, error) {
+	_, oldContent, newContent, err := planEditInput(input)
+	if err != nil {
+		return "", err
+	}
+	hunks := makeHunks(diffLines(splitLines(oldContent), splitLines(newContent)), diffContextLines)
+	if len(hunks) > 1 {
+		return "", nil
+	}
+	return DiffEditFile(input)
+}
+
+// DiffEditFile renders the whole diff an edit_file call would make, for
+// dry runs.
+func DiffEditFile(input json.RawMessage) (string, error) {
+	editFileInput, oldContent, newContent, err := planEditInput(input)
+	if err != nil {
+		return "", err
+	}
+	return ColorizeDiff(UnifiedDiff(editFileInput.Path, oldContent, newContent)), nil
+}
+
+// planEditInput is planEdit for the input of an edit_file call.
+func planEditInput(input json.RawMessage) (editFileInput EditFileInput, oldContent, newContent string, err error) {
+	err = json.Unmarshal(input, &editFileInput)
+	if err != nil {
+		return editFileInput, "", "", fmt.Errorf("failed to parse edit_file input: %w", err)
+	}
+	err = validateEdit(editFileInput)
+	if err != nil {
+		return editFileInput, "", "", err
+	}
+	oldContent, newContent, _, _, err = planEdit(editFileInput)
+	return editFileInput, oldContent, newContent, err
+}
+
+func validateEdit(editFileInput EditFileInput) error {
 	if editFileInput.Path == "" {
-		return "", fmt.Errorf("path cannot be empty")
+		return fmt.Errorf("path cannot be empty")
 	}
 	if editFileInput.OldStr == editFileInput.NewStr {
-		return "", fmt.Errorf("old_str and new_str cannot be identical")
+		return fmt.Errorf("old_str and new_str cannot be identical")
 	}
+	return nil
+}
 
+// planEdit computes the file contents before and after an edit and the
+// lines it changes. exists is false when the edit creates a new file.
+func planEdit(editFileInput EditFileInput) (oldContent, newContent string, lines []int, exists bool, err error) {
 	content, err := os.ReadFile(editFileInput.Path)
 	if err != nil {
 		if os.IsNotExist(err) && editFileInput.OldStr == "" {
-			result, createErr := createNewFile(editFileInput.Path, editFileInput.NewStr)
-			if createErr != nil {
-				return "", createErr
-			}
-			fmt.Printf("\u001b[92mEdit success\u001b[0m: Created new file %s\n", editFileInput.Path)
-			return result, nil
+			return "", editFileInput.NewStr, nil, false, nil
 		}
-		return "", fmt.Errorf("failed to read file %s: %w", editFileInput.Path, err)
+		return "", "", nil, false, fmt.Errorf("failed to read file %s: %w", editFileInput.Path, err)
 	}
 
-	oldContent := string(content)
-	newContent := strings.Replace(oldContent, editFileInput.OldStr, editFileInput.NewStr, -1)
+	oldContent = string(content)
+	newContent, lines, err = replaceOccurrences(oldContent, editFileInput)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	return oldContent, newContent, lines, true, nil
+}
+
+// replaceOccurrences replaces old_str in content as the edit asks, checking
+// how often it occurs, and returns the lines, counting from 1, on which the
+// replaced occurrences start.
+func replaceOccurrences(content string, edit EditFileInput) (string, []int, error) {
+	if edit.OldStr == "" {
+		if content != "" {
+			return "", nil, fmt.Errorf("old_str cannot be empty for %s, which already has content", edit.Path)
+		}
+		return edit.NewStr, []int{1}, nil
+	}
+	if edit.ExpectedOccurrences < 0 {
+		return "", nil, fmt.Errorf("expected_occurrences cannot be negative")
+	}
+	if edit.FuzzyMatchLine > 0 {
+		match, ok := matchAt(content, edit.OldStr, edit.FuzzyMatchLine)
+		if !ok {
+			return "", nil, fmt.Errorf("old_str is not like the lines from line %d of %s: read the file again and retry the edit with its current text", edit.FuzzyMatchLine, edit.Path)
+		}
+		return content[:match.Start] + edit.NewStr + content[match.End:], []int{match.Line}, nil
+	}
 
-	if oldContent == newContent && editFileInput.OldStr != "" {
-		return "", fmt.Errorf("old_str '%s' not found in file %s", editFileInput.OldStr, editFileInput.Path)
+	var lines []int
+	line, last := 1, 0
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], edit.OldStr)
+		if i < 0 {
+			break
+		}
+		line += strings.Count(content[last:offset+i], "\n")
+		last = offset + i
+		lines = append(lines, line)
+		offset += i + len(edit.OldStr)
 	}
 
-	err = os.WriteFile(editFileInput.Path, []byte(newContent), 0644)
-	if err != nil {
-		return "", fmt.Errorf("failed to write to file %s: %w", editFileInput.Path, err)
+	expected := edit.ExpectedOccurrences
+	if expected == 0 && !edit.ReplaceAll {
+		expected = 1
 	}
+	switch {
+	case len(lines) == 0:
+		return "", nil, newNoMatchError(content, edit)
+	case expected > 0 && len(lines) != expected:
+		return "", nil, fmt.Errorf("old_str occurs %d times in %s (lines %s) but %d was expected: include more surrounding lines to pick out the ones to change, or set replace_all to change them all",
+			len(lines), edit.Path, formatLines(lines), expected)
+	}
+	return strings.ReplaceAll(content, edit.OldStr, edit.NewStr), lines, nil
+}
 
-	fmt.Printf("\u001b[92mEdit success\u001b[0m: Updated file %s\n", editFileInput.Path)
-	return "File successfully edited", nil
+// formatLines lists line numbers for a message, e.g. "3, 17 and 40".
+func formatLines(lines []int) string {
+	parts := make([]string, len(lines))
+	for i, line := range lines {
+		parts[i] = strconv.Itoa(line)
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
 }
 
 func createNewFile(filePath, content string) (string, error) {
-	dir := path.Dir(filePath)
+	dir := filepath.Dir(filePath)
 	if dir != "." {
 		err := os.MkdirAll(dir, 0755)
 		if err != nil {
@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"code-editing-agent/internal/checkpoint"
+)
+
+// isAgentDir reports whether a directory belongs to Git or the agent itself
+// and should be left out of searches and bulk edits.
+func isAgentDir(name string) bool {
+	return name == ".git" || name == ".agent"
+}
+
+// --- UndoLastEdit Tool ---
+
+var UndoLastEditDefinition = ToolDefinition{
+	Name: "undo_last_edit",
+	Description: `Revert the most recent file changes made by the tools.
+
+Every call to edit_file, write_file, apply_patch, copy_file, move_file, delete_file, rename_files,
+search_replace and resolve_conflicts is checkpointed, and this restores the files it touched exactly
+as they were, removing files it created.
+Use 'count' to revert several operations at once, most recent first.
+Changes made by execute_shell or other git commands are not checkpointed.
+`,
+	InputSchema: GenerateSchema[UndoLastEditInput](),
+	Function:    UndoLastEdit,
+	Category:    CategoryWrite,
+}
+
+type UndoLastEditInput struct {
+	Count int `json:"count,omitempty" jsonschema_description:"How many operations to revert. Defaults to 1."`
+}
+
+func UndoLastEdit(ctx context.Context, input json.RawMessage) (string, error) {
+	undoInput := UndoLastEditInput{}
+	err := json.Unmarshal(input, &undoInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse undo_last_edit input: %w", err)
+	}
+
+	summary, err := Undo(undoInput.Count)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\u001b[92mUndo success\u001b[0m: %s", summary)
+	return summary, nil
+}
+
+// Undo reverts the last n checkpointed operations and describes what was
+// reverted.
+func Undo(n int) (string, error) {
+	undone, err := Checkpoints.Undo(n)
+	var sb strings.Builder
+	for _, cp := range undone {
+		fmt.Fprintf(&sb, "Reverted %s (%d file(s) restored)\n", cp.Description, len(cp.Files))
+	}
+	if err != nil {
+		if sb.Len() > 0 {
+			return "", fmt.Errorf("%sthen failed: %w", sb.String(), err)
+		}
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// checkpointFiles snapshots paths before a tool modifies them.
+// It is also where writes the approval policy forbids are refused, and
+// those it asks for are approved, since every tool that changes files
+// takes a checkpoint of them first.
+func checkpointFiles(description string, paths ...string) error {
+	ask, err := Policy.CheckWrite(paths...)
+	if err != nil {
+		return err
+	}
+	if len(ask) > 0 && !confirmWrites(description, ask) {
+		names := make([]string, len(ask))
+		for i, path := range ask {
+			names[i] = filepath.ToSlash(path)
+		}
+		return fmt.Errorf("the user declined writing %s, which the approval policy asks for", strings.Join(names, ", "))
+	}
+	err = Checkpoints.Save(description, paths...)
+	if err != nil {
+		return fmt.Errorf("refusing to modify files without a checkpoint: %w", err)
+	}
+	return nil
+}
+
+// CheckpointFiles is checkpointFiles for the tools of other packages, such
+// as resolve_conflicts, so their changes can be undone and reviewed too.
+func CheckpointFiles(description string, paths ...string) error {
+	return checkpointFiles(description, paths...)
+}
+
+// FileChange is a file the tools changed during the session.
+type FileChange struct {
+	Path string
+	// Status is "added", "modified" or "deleted".
+	Status string
+	// Diff is a unified diff from the file before the session's first
+	// change to it to the file now.
+	Diff           string
+	Added, Removed int
+	// Before and After are the contents of the file before and after the
+	// changes, empty when it did not exist.
+	Before, After []byte
+	original      checkpoint.File
+}
+
+// SessionChanges lists the files the tools changed during the session
+// that differ from how they were before the first change, sorted by path.
+// Changes made by shell commands are not checkpointed and not included.
+func SessionChanges() ([]FileChange, error) {
+	return ChangesBetween(current.start, time.Time{})
+}
+
+// ChangesBetween is SessionChanges for the changes the tools made from
+// start until end, such as those of an earlier session. A file changed
+// again after end is compared as it was then; a zero end compares the
+// files as they are now.
+func ChangesBetween(start, end time.Time) ([]FileChange, error) {
+	checkpoints, err := Checkpoints.List()
+	if err != nil {
+		return nil, err
+	}
+	originals := map[string]checkpoint.File{}
+	// later are the files as they were at end, for those changed since.
+	later := map[string]checkpoint.File{}
+	for _, cp := range checkpoints {
+		if cp.Time.Before(start) {
+			continue
+		}
+		for _, file := range cp.Files {
+			if !end.IsZero() && !cp.Time.Before(end) {
+				if _, seen := later[file.Path]; !seen {
+					later[file.Path] = file
+				}
+				continue
+			}
+			if _, seen := originals[file.Path]; !seen {
+				originals[file.Path] = file
+			}
+		}
+	}
+
+	var changes []FileChange
+	for path, original := range originals {
+		before, err := Checkpoints.Content(original)
+		if err != nil {
+			return nil, err
+		}
+		var after []byte
+		exists := true
+		if file, ok := later[path]; ok {
+			after, err = Checkpoints.Content(file)
+			if err != nil {
+				return nil, err
+			}
+			exists = file.Hash != ""
+		} else {
+			after, err = os.ReadFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			exists = err == nil
+		}
+		existed := original.Hash != ""
+		if existed == exists && bytes.Equal(before, after) {
+			continue
+		}
+
+		change := FileChange{Path: path, Status: "modified", Before: before, After: after, original: original}
+		switch {
+		case !existed:
+			change.Status = "added"
+		case !exists:
+			change.Status = "deleted"
+		}
+		display := filepath.ToSlash(path)
+		if bytes.IndexByte(before, 0) >= 0 || bytes.IndexByte(after, 0) >= 0 {
+			change.Diff = fmt.Sprintf("--- a/%s\n+++ b/%s\nBinary file %s\n", display, display, change.Status)
+		} else {
+			change.Diff = UnifiedDiff(display, string(before), string(after))
+		}
+		for _, line := range strings.Split(change.Diff, "\n") {
+			switch {
+			case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+			case strings.HasPrefix(line, "+"):
+				change.Added++
+			case strings.HasPrefix(line, "-"):
+				change.Removed++
+			}
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// RevertChanges puts the changed files back the way they were before the
+// session changed them. The revert is checkpointed itself, so it can be
+// undone.
+func RevertChanges(changes []FileChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	paths := make([]string, len(changes))
+	originals := make([]checkpoint.File, len(changes))
+	for i, change := range changes {
+		paths[i] = change.Path
+		originals[i] = change.original
+	}
+	err := checkpointFiles(fmt.Sprintf("review: revert %d file(s)", len(changes)), paths...)
+	if err != nil {
+		return err
+	}
+	return Checkpoints.Restore(originals...)
+}
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code-editing-agent/internal/websearch"
+)
+
+const (
+	defaultWebSearchResults = 5
+	maxWebSearchResults     = 10
+)
+
+// WebSearchEngine is the search engine behind web_search. The tool is only
+// offered when it is set.
+var WebSearchEngine websearch.Provider
+
+// --- WebSearch Tool ---
+
+var WebSearchDefinition = ToolDefinition{
+	Name: "web_search",
+	Description: `Search the web, e.g. for an error message, a library's API or recent changes to it that you do
+not know about.
+
+Returns the title, URL and snippet of each result. Read a result in full with fetch_url when its
+domain is allowed. Prefer the workspace's own code and docs when they answer the question.
+`,
+	InputSchema: GenerateSchema[WebSearchInput](),
+	Function:    WebSearch,
+	Category:    CategoryRead,
+}
+
+type WebSearchInput struct {
+	Query      string `json:"query" jsonschema_description:"What to search for."`
+	MaxResults int    `json:"max_results,omitempty" jsonschema_description:"The most results to return. Defaults to 5, at most 10."`
+}
+
+func WebSearch(ctx context.Context, input json.RawMessage) (string, error) {
+	searchInput := WebSearchInput{}
+	err := json.Unmarshal(input, &searchInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse web_search input: %w", err)
+	}
+	if strings.TrimSpace(searchInput.Query) == "" {
+		return "", fmt.Errorf("query cannot be empty")
+	}
+	if WebSearchEngine == nil {
+		return "", fmt.Errorf("web search is not configured")
+	}
+	maxResults := searchInput.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultWebSearchResults
+	}
+	if maxResults > maxWebSearchResults {
+		maxResults = maxWebSearchResults
+	}
+
+	results, err := WebSearchEngine.Search(ctx, searchInput.Query, maxResults)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No results found.", nil
+	}
+	var sb strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&sb, "%d. %s\n   %s\n", i+1, r.Title, r.URL)
+		if r.Snippet != "" {
+			fmt.Fprintf(&sb, "   %s\n", r.Snippet)
+		}
+	}
+	return sb.String(), nil
+}
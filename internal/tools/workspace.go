@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workspacePath checks that path lies inside the workspace, the current
+// directory, and returns it relative to the workspace. The workspace root
+// itself and the .git and .agent directories are refused, as are paths
+// that only escape the workspace through a symlinked directory.
+func workspacePath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path cannot be empty")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine the workspace: %w", err)
+	}
+
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(cwd, abs)
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil || outsideDir(rel) {
+		return "", fmt.Errorf("%s is outside the workspace", path)
+	}
+	if rel == "." {
+		return "", fmt.Errorf("%s is the workspace root", path)
+	}
+	first, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	if isAgentDir(first) {
+		return "", fmt.Errorf("%s belongs to %s, which tools may not modify", path, first)
+	}
+
+	// The file itself may be a symlink, which is fine to delete or move,
+	// but the directory holding it must really be inside the workspace.
+	realCwd, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the workspace: %w", err)
+	}
+	if realParent, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		parentRel, err := filepath.Rel(realCwd, realParent)
+		if err != nil || outsideDir(parentRel) {
+			return "", fmt.Errorf("%s is outside the workspace (through a symlink)", path)
+		}
+	}
+	return rel, nil
+}
+
+// outsideDir reports whether a path relative to a directory leaves it.
+func outsideDir(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// regularFilesUnder lists path if it is a regular file, or the regular
+// files below it if it is a directory. Symlinks are not followed.
+func regularFilesUnder(path string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// --- WriteFile Tool ---
+
+var WriteFileDefinition = ToolDefinition{
+	Name: "write_file",
+	Description: `Write the complete contents of a file, creating it or replacing what is there.
+
+Use this for new files and for files you are rewriting entirely; use edit_file to change part of a file.
+An existing file is only replaced when 'overwrite' is true, and missing parent directories are only
+created when 'create_dirs' is true. Returns a unified diff of the change.
+`,
+	InputSchema: withDryRun(GenerateSchema[WriteFileInput]()),
+	Function:    WriteFile,
+	Category:    CategoryWrite,
+	Preview:     PreviewWriteFile,
+}
+
+type WriteFileInput struct {
+	Path       string `json:"path" jsonschema_description:"The relative path of the file to write."`
+	Content    string `json:"content" jsonschema_description:"The complete new contents of the file."`
+	CreateDirs bool   `json:"create_dirs,omitempty" jsonschema_description:"Create missing parent directories. Defaults to false."`
+	Overwrite  bool   `json:"overwrite,omitempty" jsonschema_description:"Replace the file if it already exists. Defaults to false."`
+}
+
+func WriteFile(ctx context.Context, input json.RawMessage) (string, error) {
+	writeInput := WriteFileInput{}
+	err := json.Unmarshal(input, &writeInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse write_file input: %w", err)
+	}
+
+	oldContent, mode, err := planWrite(writeInput)
+	if err != nil {
+		return "", err
+	}
+	if oldContent == writeInput.Content && mode != 0 {
+		return fmt.Sprintf("%s already has this content; nothing to write", writeInput.Path), nil
+	}
+
+	submoduleNote, err := checkSubmoduleEdit(writeInput.Path)
+	if err != nil {
+		return "", err
+	}
+	err = checkpointFiles("write_file "+writeInput.Path, writeInput.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if writeInput.CreateDirs {
+		err = os.MkdirAll(filepath.Dir(writeInput.Path), 0755)
+		if err != nil {
+			return "", fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+	err = os.WriteFile(writeInput.Path, []byte(writeInput.Content), mode)
+	if err != nil {
+		return "", fmt.Errorf("failed to write file %s: %w", writeInput.Path, err)
+	}
+
+	fmt.Printf("\u001b[92mWrite success\u001b[0m: Wrote %d bytes to %s\n", len(writeInput.Content), writeInput.Path)
+	diff := UnifiedDiff(writeInput.Path, oldContent, writeInput.Content)
+	printDiff("write_file", diff)
+	return fmt.Sprintf("Wrote %d bytes to %s\n", len(writeInput.Content), writeInput.Path) + diff + submoduleNote +
+		runPostEditHooks(writeInput.Path), nil
+}
+
+// PreviewWriteFile renders the diff a write_file call would make.
+func PreviewWriteFile(input json.RawMessage) (string, error) {
+	writeInput := WriteFileInput{}
+	err := json.Unmarshal(input, &writeInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse write_file input: %w", err)
+	}
+	oldContent, _, err := planWrite(writeInput)
+	if err != nil {
+		return "", err
+	}
+	return ColorizeDiff(UnifiedDiff(writeInput.Path, oldContent, writeInput.Content)), nil
+}
+
+// planWrite checks that a write is allowed and returns the current content
+// and permissions of the file, or a zero mode when it does not exist yet.
+func planWrite(writeInput WriteFileInput) (oldContent string, mode os.FileMode, err error) {
+	if writeInput.Path == "" {
+		return "", 0, fmt.Errorf("path cannot be empty")
+	}
+
+	info, err := os.Stat(writeInput.Path)
+	if err == nil {
+		if info.IsDir() {
+			return "", 0, fmt.Errorf("%s is a directory", writeInput.Path)
+		}
+		if !writeInput.Overwrite {
+			return "", 0, fmt.Errorf("file %s already exists; set overwrite to true to replace it, or use edit_file to change part of it", writeInput.Path)
+		}
+		content, err := os.ReadFile(writeInput.Path)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read file %s: %w", writeInput.Path, err)
+		}
+		return string(content), info.Mode().Perm(), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", 0, fmt.Errorf("failed to stat %s: %w", writeInput.Path, err)
+	}
+
+	if !writeInput.CreateDirs {
+		dir := filepath.Dir(writeInput.Path)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return "", 0, fmt.Errorf("directory %s does not exist; set create_dirs to true to create it", dir)
+		}
+	}
+	return "", 0, nil
+}
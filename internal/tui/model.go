@@ -0,0 +1,439 @@
+package tui
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+
+	"code-editing-agent/internal/console"
+	"code-editing-agent/internal/mentions"
+	"code-editing-agent/internal/tools"
+)
+
+// inputHeight is the number of lines of the message editor.
+const inputHeight = 3
+
+// Messages sent by the agent's goroutine.
+type (
+	outputMsg        string
+	assistantTextMsg string
+	assistantDoneMsg struct{}
+	toolCallMsg      struct{ id, name, input string }
+	toolResultMsg    struct {
+		id     string
+		result tools.ToolResult
+	}
+	// waitingMsg means the agent is waiting for the next message.
+	waitingMsg struct{}
+	// promptMsg means a tool is waiting for an answer to the question.
+	promptMsg string
+	// execMsg asks for the terminal to be handed to cmd, such as an
+	// editor; its error is sent on done when it exits.
+	execMsg struct {
+		cmd  *exec.Cmd
+		done chan error
+	}
+)
+
+type model struct {
+	ui       *TUI
+	entries  []*entry
+	viewport viewport.Model
+	input    textarea.Model
+	spinner  spinner.Model
+	renderer *glamour.TermRenderer
+	width    int
+
+	busy      bool      // the agent is working on a message
+	busySince time.Time // when the agent started on it
+	prompt    string    // the question a tool is waiting on, if any
+	expanded  bool      // tool output is shown in full
+
+	history    []string
+	historyPos int
+	draft      string
+
+	suggestions  []string // the files Tab cycles through, once it was pressed
+	mentionStart int      // where the @path being completed starts
+	choice       int      // the suggestion Tab puts in next
+}
+
+// maxSuggestions is how many files are suggested for an @path, and
+// shownSuggestions how many of them the status line lists.
+const (
+	maxSuggestions   = 10
+	shownSuggestions = 5
+)
+
+func newModel(ui *TUI) *model {
+	ta := textarea.New()
+	ta.Placeholder = "Ask the agent to do something..."
+	ta.ShowLineNumbers = false
+	ta.Prompt = "┃ "
+	ta.CharLimit = 0
+	ta.SetHeight(inputHeight)
+	ta.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	ta.Focus()
+
+	m := &model{
+		ui:        ui,
+		viewport:  viewport.New(80, 20),
+		input:     ta,
+		spinner:   spinner.New(spinner.WithSpinner(spinner.Dot)),
+		busy:      true,
+		busySince: time.Now(),
+	}
+	if ui.History != nil {
+		m.history = ui.History.Entries()
+	}
+	m.historyPos = len(m.history)
+	return m
+}
+
+func (m *model) Init() tea.Cmd {
+	return tea.Batch(textarea.Blink, m.spinner.Tick)
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.resize(msg.Width, msg.Height)
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		// Running tools show their spinner and elapsed time in the
+		// conversation.
+		if m.toolRunning() {
+			m.refresh()
+		}
+		return m, cmd
+
+	case execMsg:
+		return m, tea.ExecProcess(msg.cmd, func(err error) tea.Msg {
+			msg.done <- err
+			return nil
+		})
+
+	case outputMsg:
+		m.appendOutput(string(msg))
+	case assistantTextMsg:
+		last := m.last()
+		if last == nil || last.kind != entryAssistant || last.done {
+			last = m.add(&entry{kind: entryAssistant})
+		}
+		last.text += string(msg)
+	case assistantDoneMsg:
+		if last := m.last(); last != nil && last.kind == entryAssistant {
+			last.done = true
+		}
+	case toolCallMsg:
+		m.add(&entry{kind: entryTool, id: msg.id, title: msg.name, text: msg.input, started: time.Now()})
+	case toolResultMsg:
+		for i := len(m.entries) - 1; i >= 0; i-- {
+			if e := m.entries[i]; e.kind == entryTool && e.id == msg.id {
+				result := msg.result
+				e.result = &result
+				e.done = true
+				break
+			}
+		}
+	case waitingMsg:
+		m.prompt = ""
+		m.busy = false
+		// A message sent while the agent was busy is picked up right away.
+		for _, e := range m.entries {
+			if e.queued {
+				e.queued = false
+				m.busy = true
+				m.busySince = time.Now()
+				break
+			}
+		}
+	case promptMsg:
+		m.prompt = string(msg)
+		// The question is usually about what the tool just printed.
+		for _, e := range m.entries {
+			if e.kind == entryTool && !e.done {
+				e.expanded = true
+			}
+		}
+	}
+	m.refresh()
+	return m, nil
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if text, bound := m.ui.bindings[msg.String()]; bound && m.prompt == "" {
+		m.send(text)
+		return nil
+	}
+
+	if msg.String() != "tab" {
+		m.suggestions = nil
+	}
+	switch msg.String() {
+	case "tab":
+		if m.prompt == "" && m.completeMention() {
+			return nil
+		}
+	case "ctrl+c":
+		if m.busy && m.ui.OnCancel != nil && m.cancel() {
+			return nil
+		}
+		return tea.Quit
+	case "enter":
+		m.submit()
+		return nil
+	case "ctrl+o":
+		m.expanded = !m.expanded
+		m.refresh()
+		return nil
+	case "pgup":
+		m.viewport.HalfPageUp()
+		return nil
+	case "pgdown":
+		m.viewport.HalfPageDown()
+		return nil
+	case "up":
+		if m.input.Line() == 0 && m.browse(-1) {
+			return nil
+		}
+	case "down":
+		if m.input.Line() == m.input.LineCount()-1 && m.browse(1) {
+			return nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return cmd
+}
+
+// cancel stops the agent's work, declining the question it is waiting on,
+// and reports whether there was anything to stop.
+func (m *model) cancel() bool {
+	if m.prompt != "" {
+		m.add(&entry{kind: entryOutput, text: m.prompt + " ^C"})
+		m.prompt = ""
+		select {
+		case m.ui.declined <- struct{}{}:
+		default:
+		}
+	}
+	if !m.ui.OnCancel() {
+		return false
+	}
+	m.refresh()
+	return true
+}
+
+// submit sends the editor's contents as an answer to the pending question
+// or as the next message.
+func (m *model) submit() {
+	text := m.input.Value()
+	if m.prompt != "" {
+		m.add(&entry{kind: entryOutput, text: m.prompt + " " + text})
+		m.prompt = ""
+		m.input.Reset()
+		select {
+		case m.ui.answers <- text:
+		default:
+		}
+		m.refresh()
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	m.input.Reset()
+	if m.ui.History != nil {
+		m.ui.History.Add(text)
+		m.history = m.ui.History.Entries()
+	}
+	m.historyPos = len(m.history)
+	m.send(text)
+}
+
+// send shows text as the user's message and hands it to the agent. While
+// the agent is busy the message waits for the next turn.
+func (m *model) send(text string) {
+	select {
+	case m.ui.messages <- text:
+	default:
+		return
+	}
+	m.add(&entry{kind: entryUser, text: text, queued: m.busy})
+	if !m.busy {
+		m.busy = true
+		m.busySince = time.Now()
+	}
+	m.refresh()
+}
+
+// completeMention replaces the @path at the end of the message with the
+// next file suggested for it, going through them on repeated Tabs. It
+// reports false when there is no mention to complete.
+func (m *model) completeMention() bool {
+	value := m.input.Value()
+	if m.suggestions == nil {
+		if m.ui.Complete == nil {
+			return false
+		}
+		start, query, ok := mentions.Token(value)
+		if !ok {
+			return false
+		}
+		m.suggestions = m.ui.Complete(query, maxSuggestions)
+		if len(m.suggestions) == 0 {
+			m.suggestions = nil
+			return false
+		}
+		m.mentionStart = start
+		m.choice = 0
+	}
+	m.input.SetValue(value[:m.mentionStart] + "@" + m.suggestions[m.choice%len(m.suggestions)])
+	m.choice++
+	return true
+}
+
+// mentionHint lists the files suggested for the @path at the end of the
+// message, for the status line.
+func (m *model) mentionHint() string {
+	if m.ui.Complete == nil || m.prompt != "" {
+		return ""
+	}
+	_, query, ok := mentions.Token(m.input.Value())
+	if !ok {
+		return ""
+	}
+	suggestions := m.suggestions
+	if suggestions == nil {
+		suggestions = m.ui.Complete(query, shownSuggestions)
+	}
+	if len(suggestions) == 0 {
+		return "no matching files"
+	}
+	if len(suggestions) > shownSuggestions {
+		suggestions = suggestions[:shownSuggestions]
+	}
+	return strings.Join(suggestions, "  ") + " · tab complete"
+}
+
+// browse steps through the message history and reports whether it moved.
+func (m *model) browse(step int) bool {
+	pos := m.historyPos + step
+	if pos < 0 || pos > len(m.history) {
+		return false
+	}
+	if m.historyPos == len(m.history) {
+		m.draft = m.input.Value()
+	}
+	m.historyPos = pos
+	if pos == len(m.history) {
+		m.input.SetValue(m.draft)
+	} else {
+		m.input.SetValue(m.history[pos])
+	}
+	return true
+}
+
+func (m *model) resize(width, height int) {
+	m.width = width
+	m.input.SetWidth(width)
+	m.viewport.Width = width
+	// Leave room for the status line and the editor.
+	m.viewport.Height = height - inputHeight - 1
+	if m.viewport.Height < 1 {
+		m.viewport.Height = 1
+	}
+	m.renderer, _ = glamour.NewTermRenderer(
+		glamour.WithStandardStyle(styles.DarkStyle),
+		glamour.WithWordWrap(width-2),
+	)
+	for _, e := range m.entries {
+		e.rendered = ""
+	}
+}
+
+func (m *model) add(e *entry) *entry {
+	m.entries = append(m.entries, e)
+	return e
+}
+
+func (m *model) last() *entry {
+	if len(m.entries) == 0 {
+		return nil
+	}
+	return m.entries[len(m.entries)-1]
+}
+
+// appendOutput adds printed text to the tool that is running, or shows it
+// on its own.
+func (m *model) appendOutput(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "")
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		e := m.entries[i]
+		if e.kind == entryTool && !e.done {
+			e.output += text
+			return
+		}
+		if e.kind != entryTool {
+			break
+		}
+	}
+	last := m.last()
+	if last == nil || last.kind != entryOutput {
+		last = m.add(&entry{kind: entryOutput})
+	}
+	last.text += text
+}
+
+// refresh re-renders the conversation, following new output when the view
+// was already at the bottom.
+// toolRunning reports whether a tool call shown is still running.
+func (m *model) toolRunning() bool {
+	for _, e := range m.entries {
+		if e.kind == entryTool && !e.done {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *model) refresh() {
+	follow := m.viewport.AtBottom()
+	m.viewport.SetContent(m.renderEntries())
+	if follow {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m *model) View() string {
+	return m.viewport.View() + "\n" + m.statusLine() + "\n" + m.input.View()
+}
+
+func (m *model) statusLine() string {
+	if hint := m.mentionHint(); hint != "" {
+		return dimStyle.Render("@ " + hint)
+	}
+	switch {
+	case m.prompt != "":
+		return promptStyle.Render(m.prompt)
+	case m.busy:
+		elapsed := console.Elapsed(time.Since(m.busySince))
+		return m.spinner.View() + dimStyle.Render(" Working for "+elapsed+"... (messages you send now are queued · ctrl+c stop)")
+	default:
+		return dimStyle.Render("enter send · alt+enter newline · ctrl+o tool output · pgup/pgdn scroll · ctrl+c quit")
+	}
+}
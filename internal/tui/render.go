@@ -0,0 +1,142 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"code-editing-agent/internal/console"
+	"code-editing-agent/internal/tools"
+)
+
+// maxExpandedLines bounds how much of a tool's output is shown expanded.
+const maxExpandedLines = 200
+
+// maxToolInputWidth bounds how much of a tool's input the header shows.
+const maxToolInputWidth = 100
+
+type entryKind int
+
+const (
+	entryUser entryKind = iota
+	entryAssistant
+	entryTool
+	entryOutput // anything printed outside a tool call
+)
+
+// entry is one block of the conversation.
+type entry struct {
+	kind   entryKind
+	text   string // message text, reply text or tool input
+	queued bool   // a user message waiting for the agent
+
+	done     bool   // the reply is complete or the tool has finished
+	rendered string // cached markdown rendering of a complete reply
+
+	id       string
+	title    string // tool name
+	output   string // what the tool printed while running
+	result   *tools.ToolResult
+	expanded bool      // output shown in full, e.g. a diff awaiting approval
+	started  time.Time // when the tool started
+}
+
+var (
+	userStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true)
+	assistantStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Bold(true)
+	toolStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	errorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	dimStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	promptStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+)
+
+func (m *model) renderEntries() string {
+	wrap := lipgloss.NewStyle().Width(m.width)
+	var blocks []string
+	for _, e := range m.entries {
+		switch e.kind {
+		case entryUser:
+			label := userStyle.Render("You")
+			if e.queued {
+				label += dimStyle.Render(" (queued)")
+			}
+			blocks = append(blocks, wrap.Render(label+": "+e.text))
+		case entryAssistant:
+			blocks = append(blocks, assistantStyle.Render("Assistant")+"\n"+m.renderReply(e))
+		case entryTool:
+			blocks = append(blocks, m.renderTool(e))
+		case entryOutput:
+			text := strings.TrimRight(e.text, "\n")
+			if text != "" {
+				blocks = append(blocks, wrap.Render(text))
+			}
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// renderReply shows a reply as plain text while it streams and as
+// highlighted markdown once complete.
+func (m *model) renderReply(e *entry) string {
+	if !e.done || m.renderer == nil {
+		return lipgloss.NewStyle().Width(m.width).Render(e.text)
+	}
+	if e.rendered == "" {
+		rendered, err := m.renderer.Render(e.text)
+		if err != nil {
+			rendered = e.text
+		}
+		e.rendered = strings.Trim(rendered, "\n")
+	}
+	return e.rendered
+}
+
+// renderTool shows a tool call as a header line and, when expanded, what it
+// printed. Failures are always shown.
+func (m *model) renderTool(e *entry) string {
+	status := m.spinner.View()
+	if e.result != nil {
+		status = toolStyle.Render("✓")
+		if !e.result.Success {
+			status = errorStyle.Render("✗")
+		}
+	}
+	input := strings.Join(strings.Fields(e.text), " ")
+	if len(input) > maxToolInputWidth {
+		input = input[:maxToolInputWidth] + "..."
+	}
+	header := fmt.Sprintf("%s %s %s", status, toolStyle.Render(e.title), dimStyle.Render(input))
+	if e.result == nil && !e.started.IsZero() {
+		header += dimStyle.Render(" (" + console.Elapsed(time.Since(e.started)) + ")")
+	}
+
+	output := strings.TrimRight(e.output, "\n")
+	if output == "" && e.result != nil && e.result.Success {
+		output = strings.TrimRight(e.result.Output, "\n")
+	}
+	var lines []string
+	if output != "" {
+		lines = strings.Split(output, "\n")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(header)
+	if m.expanded || e.expanded {
+		shown := lines
+		if len(shown) > maxExpandedLines {
+			shown = shown[len(shown)-maxExpandedLines:]
+			fmt.Fprintf(&sb, "\n  %s", dimStyle.Render(fmt.Sprintf("... %d earlier lines", len(lines)-maxExpandedLines)))
+		}
+		for _, line := range shown {
+			sb.WriteString("\n  " + line)
+		}
+	} else if len(lines) > 0 {
+		fmt.Fprintf(&sb, "\n  %s", dimStyle.Render(fmt.Sprintf("%d lines of output (ctrl+o to expand)", len(lines))))
+	}
+	if e.result != nil && !e.result.Success {
+		sb.WriteString("\n  " + errorStyle.Render(e.result.Error))
+	}
+	return sb.String()
+}
@@ -0,0 +1,210 @@
+// Package tui is the full-screen terminal interface of the agent: a
+// scrollable conversation, a multi-line input editor and collapsible tool
+// output, built on Bubble Tea.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"code-editing-agent/internal/input"
+	"code-editing-agent/internal/shell"
+	"code-editing-agent/internal/tools"
+)
+
+// TUI runs the interface and connects it to the agent, which runs on its
+// own goroutine and talks to the TUI through NextMessage, ReadLine and the
+// agent.Display methods.
+type TUI struct {
+	program  *tea.Program
+	messages chan string
+	answers  chan string
+	declined chan struct{}
+	done     chan struct{}
+
+	stdout   *os.File
+	pipe     *os.File
+	closing  bool
+	closeMu  sync.Mutex
+	bindings map[string]string
+
+	// History, when set, is browsed with Up and Down and receives every
+	// message sent.
+	History *input.History
+
+	// Complete, when set, suggests up to limit files for an @path being
+	// typed at the end of the message; Tab puts them in one after another.
+	Complete func(query string, limit int) []string
+
+	// OnInterrupt is called when the user quits with Ctrl-C. By default the
+	// terminal is restored and the process exits.
+	OnInterrupt func()
+
+	// OnCancel, when set, is called when Ctrl-C is pressed while the agent
+	// works. It reports whether the work was stopped; when it was not, the
+	// interface quits.
+	OnCancel func() bool
+}
+
+// New returns a TUI that is not running yet.
+func New() *TUI {
+	t := &TUI{
+		messages: make(chan string, 64),
+		answers:  make(chan string, 1),
+		declined: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		bindings: map[string]string{},
+	}
+	t.OnInterrupt = func() {
+		os.Exit(130)
+	}
+	return t
+}
+
+// Bind makes a key send text as if it had been typed as a message. Key names
+// look like "alt+r" or "ctrl+g".
+func (t *TUI) Bind(key, text string) {
+	t.bindings[key] = text
+}
+
+// Start takes over the terminal. Everything the agent and its tools print
+// to stdout from now on is shown in the conversation.
+func (t *TUI) Start() error {
+	t.stdout = os.Stdout
+	// Styles are decided for the real terminal, not the pipe below.
+	lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(t.stdout))
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture output: %w", err)
+	}
+	t.pipe = w
+	os.Stdout = w
+	shell.Output = w
+
+	t.program = tea.NewProgram(newModel(t), tea.WithAltScreen(), tea.WithOutput(t.stdout))
+	go func() {
+		_, err := t.program.Run()
+		t.restore()
+
+		// The agent is only told the interface stopped once OnInterrupt
+		// is done, so it cannot end the process first.
+		t.closeMu.Lock()
+		closing := t.closing
+		t.closeMu.Unlock()
+		if !closing {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			t.OnInterrupt()
+		}
+		close(t.done)
+	}()
+	go t.forward(r)
+	return nil
+}
+
+// Close ends the interface and gives the terminal back.
+func (t *TUI) Close() {
+	t.closeMu.Lock()
+	t.closing = true
+	t.closeMu.Unlock()
+	if t.program != nil {
+		t.program.Quit()
+		<-t.done
+	}
+}
+
+func (t *TUI) restore() {
+	os.Stdout = t.stdout
+	shell.Output = t.stdout
+	t.pipe.Close()
+}
+
+// forward shows captured output in the conversation.
+func (t *TUI) forward(r io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			t.send(outputMsg(buf[:n]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// send delivers msg to the interface unless it has already stopped.
+func (t *TUI) send(msg tea.Msg) {
+	select {
+	case <-t.done:
+	default:
+		t.program.Send(msg)
+	}
+}
+
+// NextMessage waits for the user's next message. It reports false once the
+// interface has stopped.
+func (t *TUI) NextMessage() (string, bool) {
+	t.send(waitingMsg{})
+	select {
+	case message := <-t.messages:
+		return message, true
+	case <-t.done:
+		return "", false
+	}
+}
+
+// ReadLine asks the user a question, such as an approval, and returns the
+// answer typed into the input box. It reports false when the user presses
+// Ctrl-C instead of answering.
+func (t *TUI) ReadLine(prompt string) (string, bool) {
+	t.send(promptMsg(strings.TrimSpace(prompt)))
+	select {
+	case answer := <-t.answers:
+		return answer, true
+	case <-t.declined:
+		return "", false
+	case <-t.done:
+		return "", false
+	}
+}
+
+// Edit opens text in the user's editor, suspending the interface until the
+// editor exits, and returns it as saved.
+func (t *TUI) Edit(text string) (string, error) {
+	return input.Edit(text, func(cmd *exec.Cmd) error {
+		done := make(chan error, 1)
+		t.send(execMsg{cmd: cmd, done: done})
+		select {
+		case err := <-done:
+			return err
+		case <-t.done:
+			return fmt.Errorf("the interface stopped")
+		}
+	})
+}
+
+func (t *TUI) AssistantText(text string) {
+	t.send(assistantTextMsg(text))
+}
+
+func (t *TUI) AssistantDone() {
+	t.send(assistantDoneMsg{})
+}
+
+func (t *TUI) ToolCall(id, name, input string) {
+	t.send(toolCallMsg{id: id, name: name, input: input})
+}
+
+func (t *TUI) ToolResult(id, name string, result tools.ToolResult) {
+	t.send(toolResultMsg{id: id, result: result})
+}
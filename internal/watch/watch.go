@@ -0,0 +1,155 @@
+// Package watch notices changes to the workspace made outside the agent,
+// such as edits in the user's editor, so the model can be told its view of
+// those files is stale.
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settle is how long events keep being attributed to the agent after its
+// tools finish, since the system delivers them with some delay.
+const settle = 300 * time.Millisecond
+
+// Watcher records the files changed under a directory while the agent is
+// not running tools.
+type Watcher struct {
+	root     string
+	skip     func(path string, isDir bool) bool
+	onChange func(path string)
+	fsw      *fsnotify.Watcher
+
+	mu        sync.Mutex
+	changed   map[string]bool
+	paused    int
+	resumedAt time.Time
+}
+
+// New watches root and every directory below it. skip, when set, leaves out
+// paths such as ignored build output; onChange, when set, is called with
+// each changed file, relative to root, as it is noticed, whether the agent
+// changed it or not.
+func New(root string, skip func(path string, isDir bool) bool, onChange func(path string)) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{root: root, skip: skip, onChange: onChange, fsw: fsw, changed: map[string]bool{}}
+	w.addTree(root)
+	go w.loop()
+	return w, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+// Pause attributes the changes that follow to the agent until Resume.
+func (w *Watcher) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused++
+}
+
+// Resume undoes a Pause.
+func (w *Watcher) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused > 0 {
+		w.paused--
+	}
+	w.resumedAt = time.Now()
+}
+
+// Changes returns the paths changed outside the agent since the last call,
+// relative to the root and sorted.
+func (w *Watcher) Changes() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var paths []string
+	for path := range w.changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	w.changed = map[string]bool{}
+	return paths
+}
+
+// addTree watches dir and the directories below it. Directories that cannot
+// be watched, for instance because of the system's limit on watches, are
+// passed over.
+func (w *Watcher) addTree(dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != w.root && w.skipped(path, true) {
+			return filepath.SkipDir
+		}
+		w.fsw.Add(path)
+		return nil
+	})
+}
+
+func (w *Watcher) skipped(path string, isDir bool) bool {
+	name := filepath.Base(path)
+	if isDir && (name == ".git" || name == ".agent" || name == "node_modules") {
+		return true
+	}
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return true
+	}
+	return w.skip != nil && w.skip(rel, isDir)
+}
+
+func (w *Watcher) loop() {
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case _, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+func (w *Watcher) handle(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+	isDir := false
+	if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+		isDir = true
+		if event.Has(fsnotify.Create) {
+			w.addTree(event.Name)
+		}
+	}
+	if isDir || w.skipped(event.Name, isDir) {
+		return
+	}
+
+	rel, _ := filepath.Rel(w.root, event.Name)
+	rel = filepath.ToSlash(rel)
+	if w.onChange != nil {
+		w.onChange(rel)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused == 0 && time.Since(w.resumedAt) >= settle {
+		w.changed[rel] = true
+	}
+}
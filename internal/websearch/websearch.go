@@ -0,0 +1,279 @@
+// Package websearch looks things up on the web through a search engine's
+// API, for questions the model cannot answer from the workspace, such as
+// unfamiliar error messages or recent API changes.
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const requestTimeout = 15 * time.Second
+
+// Result is one search hit.
+type Result struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+// Provider is a search engine.
+type Provider interface {
+	// Search returns up to count results for query, best first.
+	Search(ctx context.Context, query string, count int) ([]Result, error)
+}
+
+// New creates the provider called name: "brave", "serpapi" or
+// "duckduckgo". With no name, Brave or SerpAPI is used when its API key
+// (BRAVE_API_KEY, SERPAPI_API_KEY) is set, and DuckDuckGo, which needs no
+// key, otherwise.
+func New(name string) (Provider, error) {
+	client := &http.Client{Timeout: requestTimeout}
+	name = strings.ToLower(name)
+	if name == "" {
+		switch {
+		case os.Getenv("BRAVE_API_KEY") != "":
+			name = "brave"
+		case os.Getenv("SERPAPI_API_KEY") != "":
+			name = "serpapi"
+		default:
+			name = "duckduckgo"
+		}
+	}
+	switch name {
+	case "brave":
+		key := os.Getenv("BRAVE_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("BRAVE_API_KEY is not set")
+		}
+		return &Brave{APIKey: key, BaseURL: "https://api.search.brave.com", client: client}, nil
+	case "serpapi":
+		key := os.Getenv("SERPAPI_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("SERPAPI_API_KEY is not set")
+		}
+		return &SerpAPI{APIKey: key, BaseURL: "https://serpapi.com", client: client}, nil
+	case "duckduckgo":
+		return &DuckDuckGo{BaseURL: "https://html.duckduckgo.com", client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown web search provider %q (expected brave, serpapi or duckduckgo)", name)
+}
+
+// get sends a GET request and returns the body of a successful response.
+func get(ctx context.Context, client *http.Client, engine, rawURL string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", engine, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", engine, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(data))
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+		return nil, fmt.Errorf("%s returned HTTP %d: %s", engine, resp.StatusCode, message)
+	}
+	return data, nil
+}
+
+// Brave searches with the Brave Search API.
+type Brave struct {
+	APIKey  string
+	BaseURL string
+	client  *http.Client
+}
+
+type braveResponse struct {
+	Web struct {
+		Results []struct {
+			Title       string `json:"title"`
+			URL         string `json:"url"`
+			Description string `json:"description"`
+		} `json:"results"`
+	} `json:"web"`
+}
+
+func (b *Brave) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	params := url.Values{"q": {query}, "count": {fmt.Sprint(count)}, "text_decorations": {"false"}}
+	data, err := get(ctx, b.client, "Brave Search", b.BaseURL+"/res/v1/web/search?"+params.Encode(), http.Header{
+		"Accept":               {"application/json"},
+		"X-Subscription-Token": {b.APIKey},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out braveResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode Brave Search response: %w", err)
+	}
+	var results []Result
+	for _, r := range out.Web.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: stripTags(r.Description)})
+	}
+	return limit(results, count), nil
+}
+
+// SerpAPI searches Google through SerpAPI.
+type SerpAPI struct {
+	APIKey  string
+	BaseURL string
+	client  *http.Client
+}
+
+type serpResponse struct {
+	OrganicResults []struct {
+		Title   string `json:"title"`
+		Link    string `json:"link"`
+		Snippet string `json:"snippet"`
+	} `json:"organic_results"`
+	Error string `json:"error"`
+}
+
+func (s *SerpAPI) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	params := url.Values{"engine": {"google"}, "q": {query}, "num": {fmt.Sprint(count)}, "api_key": {s.APIKey}}
+	data, err := get(ctx, s.client, "SerpAPI", s.BaseURL+"/search.json?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out serpResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode SerpAPI response: %w", err)
+	}
+	if out.Error != "" && !strings.Contains(out.Error, "hasn't returned any results") {
+		return nil, fmt.Errorf("SerpAPI: %s", out.Error)
+	}
+	var results []Result
+	for _, r := range out.OrganicResults {
+		results = append(results, Result{Title: r.Title, URL: r.Link, Snippet: r.Snippet})
+	}
+	return limit(results, count), nil
+}
+
+// DuckDuckGo searches DuckDuckGo's HTML pages, which need no API key.
+type DuckDuckGo struct {
+	BaseURL string
+	client  *http.Client
+}
+
+func (d *DuckDuckGo) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	data, err := get(ctx, d.client, "DuckDuckGo", d.BaseURL+"/html/?"+url.Values{"q": {query}}.Encode(), http.Header{
+		"User-Agent": {"Mozilla/5.0 (compatible; code-editing-agent)"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DuckDuckGo results: %w", err)
+	}
+
+	// Each hit is a link of class result__a followed by a result__snippet.
+	var results []Result
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case hasClass(n, "result__a"):
+				href := attr(n, "href")
+				// Ads lead through a click tracker rather than to the page.
+				if !strings.Contains(href, "/y.js?") {
+					results = append(results, Result{Title: text(n), URL: duckDuckGoTarget(href)})
+				}
+				return
+			case hasClass(n, "result__snippet") && len(results) > 0:
+				results[len(results)-1].Snippet = text(n)
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return limit(results, count), nil
+}
+
+// duckDuckGoTarget returns the address a DuckDuckGo redirect link leads to.
+func duckDuckGoTarget(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	if target := u.Query().Get("uddg"); target != "" {
+		return target
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+func limit(results []Result, count int) []Result {
+	if len(results) > count {
+		return results[:count]
+	}
+	return results
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// text returns the text inside n with its whitespace collapsed.
+func text(n *html.Node) string {
+	var sb strings.Builder
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// stripTags removes the markup some engines put into snippets.
+func stripTags(s string) string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return s
+	}
+	return text(doc)
+}
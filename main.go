@@ -1,44 +1,818 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	openai "github.com/sashabaranov/go-openai"
+	"golang.org/x/term"
 
 	"code-editing-agent/internal/agent"
+	"code-editing-agent/internal/audit"
+	"code-editing-agent/internal/commands"
+	"code-editing-agent/internal/config"
+	"code-editing-agent/internal/console"
+	"code-editing-agent/internal/events"
+	"code-editing-agent/internal/github"
+	"code-editing-agent/internal/hooks"
+	"code-editing-agent/internal/index"
+	"code-editing-agent/internal/input"
+	"code-editing-agent/internal/llm"
+	"code-editing-agent/internal/log"
+	"code-editing-agent/internal/lsp"
+	"code-editing-agent/internal/markdown"
+	"code-editing-agent/internal/mentions"
+	"code-editing-agent/internal/policy"
+	"code-editing-agent/internal/redact"
+	"code-editing-agent/internal/sessions"
+	"code-editing-agent/internal/templates"
 	"code-editing-agent/internal/tools"
+	"code-editing-agent/internal/tools/git"
+	"code-editing-agent/internal/tui"
+	"code-editing-agent/internal/watch"
+	"code-editing-agent/internal/websearch"
 )
 
+// restoreConsole undoes console.Setup, passing on what has been printed.
+var restoreConsole = func() {}
+
+// startProgress shows what ag is waiting on below the output. The status is
+// taken down while the user's editor has the terminal, and at exit.
+func startProgress(ag *agent.Agent) {
+	status := console.NewStatus()
+	if err := status.Start(); err != nil {
+		warn("not showing progress: %v", err)
+		return
+	}
+	ag.SetProgress(status)
+	restore := restoreConsole
+	restoreConsole = func() {
+		status.Stop()
+		restore()
+	}
+	edit := commands.Editor
+	if edit == nil {
+		return
+	}
+	commands.Editor = func(text string) (string, error) {
+		status.Stop()
+		defer status.Start()
+		return edit(text)
+	}
+}
+
 func main() {
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Printf("Error loading .env file: %v\n", err)
+	// Windows consoles need to be told to show colors, or have them removed.
+	restoreConsole = console.Setup()
+	// restoreConsole may have more to undo by the time main returns.
+	defer func() { restoreConsole() }()
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		exit(serve(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "models" {
+		exit(listModels(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		exit(replay(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		exit(diffSession(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		exit(initNotes(os.Args[2:]))
+	}
+
+	autoApprove := flag.Bool("auto-approve", false, "Run file edits and shell commands without asking for approval")
+	providerFlag := flag.String("provider", "", "LLM provider: openai, azure, anthropic, gemini or ollama (overrides config and LLM_PROVIDER)")
+	modelFlag := flag.String("model", "", "Model name (overrides config and LLM_MODEL)")
+	baseURLFlag := flag.String("base-url", "", "Base URL of the model API (overrides config)")
+	maxTokensFlag := flag.Int("max-tokens", 0, "Maximum tokens per reply (overrides config)")
+	temperatureFlag := flag.Float64("temperature", -1, "Sampling temperature between 0 and 2 (overrides config)")
+	plain := flag.Bool("plain", false, "Use the line-based prompt instead of the full-screen interface")
+	prompt := flag.String("p", "", "Work on this prompt without interaction, print a report and exit")
+	allow := flag.String("allow", "", "Comma-separated tools that may run without approval in -p mode, e.g. edit_file,run_tests")
+	maxSteps := flag.Int("max-steps", agent.DefaultMaxSteps, "Maximum model requests in -p mode")
+	reportPath := flag.String("report", "", "Also write the -p mode report as JSON to this file")
+	dryRun := flag.Bool("dry-run", false, "Show the changes tools would make to files without making them")
+	readOnly := flag.Bool("read-only", false, "Offer only tools that read and search, refusing edits and commands, to explore a codebase safely")
+	verbose := flag.Bool("verbose", false, "Log the contents of requests, responses and tool calls, not only their timings")
+	autoVerify := flag.Bool("auto-verify", false, "Check the project still compiles after each batch of edits and show the model the errors")
+	noWatch := flag.Bool("no-watch", false, "Do not watch the workspace for changes made outside the agent")
+	outputFormat := flag.String("output", "text", "Output format: text, or json for newline-delimited JSON events on stdout with messages read from stdin")
+	workdir := flag.String("workdir", "", "Work on the project in this directory instead of the current one")
+	noMarkdown := flag.Bool("no-markdown", false, "Print replies as the model writes them instead of rendering their markdown")
+	issue := flag.String("issue", "", "Start by working on this GitHub issue: its URL, owner/repo#42, or #42 for the workspace's repository")
+	flag.Parse()
+
+	// The report goes where it was asked for, not into the workspace.
+	if *reportPath != "" {
+		*reportPath, _ = filepath.Abs(*reportPath)
+	}
+	if err := changeWorkdir(*workdir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(2)
 	}
 
-	client := openai.NewClient(os.Getenv("OPENAI_API_KEY"))
+	// In JSON mode stdout carries only events, so it is taken over before
+	// anything is printed.
+	var stream *events.Stream
+	switch *outputFormat {
+	case "text":
+	case "json":
+		var err error
+		stream, err = events.Start()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		defer stream.Close()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown --output %q: use text or json\n", *outputFormat)
+		exit(2)
+	}
+	tools.AutoApprove = *autoApprove
+	tools.DryRun = *dryRun
+	tools.ReadOnly = *readOnly
+	headless := *prompt != ""
+
+	// Requests and tool calls are logged under ~/.code-agent/logs.
+	if dir, err := config.Dir(); err == nil {
+		logDir := filepath.Join(dir, "logs")
+		closeLog, err := log.Open(logDir, *verbose)
+		if err != nil {
+			warn("not logging this session: %v", err)
+		} else {
+			defer closeLog()
+			if *verbose {
+				fmt.Printf("Logging requests, responses and tool calls to %s\n", logDir)
+			}
+		}
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	getUserMessage := func() (string, bool) {
-		if !scanner.Scan() {
+	// The full-screen interface needs a terminal on both ends; piped input
+	// and output get the line-based prompt. Without interaction, approvals
+	// not granted by flags or config are denied.
+	var ui *tui.TUI
+	var reader *input.Reader
+	var getUserMessage func() (string, bool)
+	switch {
+	case headless:
+		for _, name := range strings.Split(*allow, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				tools.ApproveAlways(name)
+			}
+		}
+		tools.AskUser = func(question string) (string, bool) {
+			fmt.Printf("%s\u001b[93mdenied\u001b[0m (running with -p; use --allow or --auto-approve)\n", question)
 			return "", false
 		}
-		return scanner.Text(), true
+	case stream != nil:
+		getUserMessage = stream.NextMessage
+		tools.AskUser = stream.ReadLine
+	case !*plain && console.Colors && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())):
+		ui = tui.New()
+		ui.History = loadHistory()
+		ui.Complete = mentions.NewCompleter(".").Complete
+		// Alt+R resends the previous prompt, same as typing /retry.
+		ui.Bind("alt+r", "/retry")
+		if err := ui.Start(); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			exit(1)
+		}
+		getUserMessage = ui.NextMessage
+		tools.AskUser = ui.ReadLine
+		commands.Editor = ui.Edit
+	default:
+		reader = input.NewReader()
+		defer reader.Close()
+		reader.Bind("alt+r", "/retry")
+		reader.History = loadHistory()
+		reader.Complete = mentions.NewCompleter(".").Complete
+		getUserMessage = func() (string, bool) {
+			line, ok := reader.NextMessage("\u001b[94mYou\u001b[0m: ")
+			if ok {
+				reader.History.Add(line)
+				// Anything typed while the agent works is queued for the next turn.
+				reader.StartQueueing()
+			}
+			return line, ok
+		}
+		tools.AskUser = reader.ReadLine
+		commands.Editor = reader.Edit
+	}
+	// fail gives the terminal back before reporting err, so the message is
+	// not lost with the interface.
+	fail := func(err error) {
+		if ui != nil {
+			ui.Close()
+		}
+		fmt.Printf("Error: %s\n", err.Error())
+		if stream != nil {
+			stream.Close()
+		}
+		exit(1)
+	}
+
+	// Until the user trusts the workspace, its contents could steer the model
+	// into damaging actions, so only tools that read are offered and its
+	// .agent.yaml, which could point the API key at another server, is
+	// ignored.
+	cwd, _ := os.Getwd()
+	trusted := trustWorkspace(cwd, headless && *autoApprove)
+	workspace := cwd
+	if !trusted {
+		workspace = ""
+	}
+	// The workspace's .env is read only once it is trusted too, since it
+	// could set OPENAI_BASE_URL or OLLAMA_HOST as well as the API keys.
+	if trusted {
+		if err := godotenv.Load(); err != nil {
+			fmt.Printf("Error loading .env file: %v\n", err)
+		}
 	}
 
-	toolsList := []tools.ToolDefinition{
+	// With --issue the session starts from the issue's text, which may
+	// need a GITHUB_TOKEN from .env. -p adds to it.
+	var issueText string
+	if *issue != "" {
+		text, err := issueMessage(*issue)
+		if err != nil {
+			fail(err)
+		}
+		issueText = text
+		if headless {
+			*prompt = issueText + "\n\n" + *prompt
+		}
+	}
+	if issueText != "" && !headless {
+		next := getUserMessage
+		getUserMessage = func() (string, bool) {
+			if issueText == "" {
+				return next()
+			}
+			text := issueText
+			issueText = ""
+			return text, true
+		}
+	}
+	cfg, err := config.Load(workspace)
+	if err != nil {
+		fail(err)
+	}
+
+	// Settings from the config files are overridden by the environment,
+	// which is overridden by flags.
+	llmConfig := newLLMConfig(cfg)
+	if *providerFlag != "" {
+		llmConfig.Provider = *providerFlag
+	}
+	if *modelFlag != "" {
+		llmConfig.Model = *modelFlag
+	}
+	if *baseURLFlag != "" {
+		llmConfig.BaseURL = *baseURLFlag
+	}
+	if *maxTokensFlag > 0 {
+		llmConfig.MaxTokens = *maxTokensFlag
+	}
+	if *temperatureFlag >= 0 {
+		llmConfig.Temperature = temperatureFlag
+	}
+	provider, err := newProvider(cfg, &llmConfig)
+	if err != nil {
+		fail(err)
+	}
+	registry := newRegistry(cfg, provider, llmConfig.Provider)
+	startLanguageServers(registry, cwd, cfg, trusted)
+	if tools.LanguageServers != nil {
+		defer tools.LanguageServers.Close()
+	}
+	if !trusted || tools.ReadOnly {
+		// Removed rather than disabled, so /tools cannot bring them back.
+		for _, tool := range registry.All() {
+			if tool.Category != tools.CategoryRead {
+				registry.Unregister(tool.Name)
+			}
+		}
+		if tools.ReadOnly {
+			fmt.Println("Read-only mode: only tools that read and search are enabled; edits and commands are refused.")
+		} else {
+			fmt.Println("Workspace not trusted: only read-only tools are enabled for this session.")
+		}
+	}
+	if tools.DryRun {
+		fmt.Println("Dry run: changes to files are shown but not made; commands still run after approval.")
+	}
+
+	systemPrompt := agent.SystemPromptBuilder{
+		Instructions: cfg.SystemPrompt,
+		WorkDir:      cwd,
+		ContextFiles: cfg.ContextFiles,
+		ReadOnly:     tools.ReadOnly,
+	}.Build()
+
+	ag := agent.NewAgent(provider, llmConfig, systemPrompt, getUserMessage, registry)
+	ag.RegisterCommands(commands.Builtin()...)
+	commands.ConfiguredTemplates = cfg.Templates
+	if trusted {
+		commands.TemplateDir = templates.DefaultDir
+	}
+	tools.Subtasks = ag
+	ag.SetBudget(agent.Budget{MaxRequests: cfg.Limits.MaxRequests, MaxCost: cfg.Limits.MaxCost})
+	ag.SetMaxTurnSteps(cfg.Limits.MaxTurnSteps)
+	ag.SetRouter(newRouter(cfg.Routing))
+	ag.SetAutoVerify(*autoVerify || cfg.AutoVerify)
+	ag.SetHooks(newHooks(cfg, cwd))
+	// Tool calls are recorded in .agent/audit, for `agent replay`.
+	if trusted {
+		auditLog, err := audit.Open(audit.DefaultDir)
+		if err != nil {
+			warn("not recording tool calls: %v", err)
+		} else {
+			defer auditLog.Close()
+			ag.SetAudit(auditLog)
+		}
+		// Interactive sessions are listed by /sessions.
+		if !headless {
+			ag.SetSessionIndex(sessions.DefaultPath)
+			commands.SessionIndex = sessions.DefaultPath
+		}
+	}
+	if stream != nil {
+		ag.SetDisplay(stream)
+	} else if ui == nil && !*noMarkdown && console.Colors && term.IsTerminal(int(os.Stdout.Fd())) {
+		// The full-screen interface renders replies itself.
+		width, _, _ := term.GetSize(int(os.Stdout.Fd()))
+		if renderer, err := markdown.New(width); err == nil {
+			ag.SetDisplay(agent.MarkdownDisplay(renderer))
+		}
+	}
+	if stream == nil && ui == nil && console.Colors && term.IsTerminal(int(os.Stdout.Fd())) {
+		// A spinner shows what the agent waits on, and for how long; the
+		// full-screen interface shows it in its status line.
+		startProgress(ag)
+	}
+	if headless {
+		exit(runHeadless(ag, *prompt, *maxSteps, *reportPath, stream))
+	}
+	if !*noWatch {
+		// Files edited elsewhere are re-embedded by the next semantic search
+		// and re-read by the language servers.
+		watcher, err := watch.New(cwd, tools.IgnoredPath, func(path string) {
+			if tools.SemanticIndex != nil {
+				tools.SemanticIndex.Invalidate(path)
+			}
+			if tools.LanguageServers != nil {
+				tools.LanguageServers.FileChanged(path)
+			}
+		})
+		if err != nil {
+			warn("not watching the workspace for changes: %v", err)
+		} else {
+			defer watcher.Close()
+			ag.SetWatcher(watcher)
+		}
+	}
+	if ui != nil {
+		ag.SetDisplay(ui)
+	}
+
+	// Ctrl-C stops what the agent is doing and returns to the prompt.
+	// Pressed again, or while the agent waits for a message, it saves the
+	// conversation and quits. The interfaces read it as a key; SIGINT comes
+	// from elsewhere or when stdin is not a terminal.
+	quit := func() {
+		if ui != nil {
+			ui.Close()
+		}
+		if reader != nil {
+			reader.Close()
+		}
+		fmt.Println()
+		saveOnExit(ag)
+		ag.EndSession()
+		if stream != nil {
+			stream.Close()
+		}
+		exit(130)
+	}
+	interrupt := func() {
+		if !ag.Interrupt() {
+			quit()
+		}
+	}
+	if ui != nil {
+		ui.OnCancel = ag.Interrupt
+		ui.OnInterrupt = func() {
+			saveOnExit(ag)
+			ag.EndSession()
+			exit(130)
+		}
+	}
+	if reader != nil {
+		reader.OnInterrupt = interrupt
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			interrupt()
+		}
+	}()
+
+	err = ag.Run(context.Background())
+	if ui != nil {
+		ui.Close()
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+}
+
+// allTools lists every tool the agent offers to the model.
+func allTools() []tools.ToolDefinition {
+	return []tools.ToolDefinition{
 		tools.ReadFileDefinition,
 		tools.ListFilesDefinition,
+		tools.SearchFilesDefinition,
+		tools.CodeOutlineDefinition,
+		tools.SemanticSearchDefinition,
+		tools.FetchURLDefinition,
+		tools.WebSearchDefinition,
+		tools.GitHubIssueDefinition,
 		tools.EditFileDefinition,
+		tools.EditFilesDefinition,
+		tools.WriteFileDefinition,
+		tools.ApplyPatchDefinition,
+		tools.CopyFileDefinition,
+		tools.MoveFileDefinition,
+		tools.DeleteFileDefinition,
+		tools.RenameFilesDefinition,
+		tools.RenameSymbolDefinition,
+		tools.GotoDefinitionDefinition,
+		tools.FindReferencesDefinition,
+		tools.HoverDocsDefinition,
+		tools.DiagnosticsDefinition,
+		tools.SearchReplaceDefinition,
+		tools.UndoLastEditDefinition,
+		tools.ExecuteShellDefinition,
+		tools.RunTestsDefinition,
+		tools.CheckBuildDefinition,
+		tools.ManageDepsDefinition,
+		tools.RunLinterDefinition,
+		tools.SpawnTaskDefinition,
+		tools.RememberDefinition,
+		tools.ForgetDefinition,
+		git.GitStatusDefinition,
+		git.GitDiffDefinition,
+		git.GitCommitDefinition,
+		git.CreatePRDefinition,
+		git.GitCheckoutDefinition,
+		git.FindConflictsDefinition,
+		git.ResolveConflictsDefinition,
+		git.GitStashDefinition,
+		git.GitStashPopDefinition,
+		git.GitRebaseDefinition,
+		git.GitCherryPickDefinition,
+		git.GitContinueDefinition,
+		git.GitAbortDefinition,
+		git.GitLFSPullDefinition,
+	}
+}
+
+// newProvider connects to the model API of llmConfig, with the configured
+// rate limit and retries. Credentials are masked in everything sent to it.
+func newProvider(cfg config.Config, llmConfig *llm.Config) (llm.Provider, error) {
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := redact.AddPatterns(cfg.Redaction.Patterns); err != nil {
+		return nil, err
+	}
+	// The API keys, including those loaded from .env, are masked as well.
+	redact.AddEnv()
+	provider = llm.WithRedaction(provider, redact.String)
+	// Retries count against the rate limit like any other request.
+	provider = llm.WithRateLimit(provider, cfg.Limits.RequestsPerMinute, func(wait time.Duration) {
+		log.Info("rate limit wait", "wait_ms", wait.Milliseconds())
+		fmt.Printf("\u001b[90mRate limit: waiting %.1fs before the next request\u001b[0m\n", wait.Seconds())
+	})
+	policy := retryPolicy(cfg.Retry)
+	provider = llm.WithRetry(provider, policy, func(attempt int, wait time.Duration, err error) {
+		log.Warn("retrying request", "attempt", attempt+1, "wait_ms", wait.Milliseconds(), "error", err.Error())
+		fmt.Printf("\u001b[93mRetry\u001b[0m: %v; retrying in %.1fs (attempt %d of %d)\n",
+			err, wait.Seconds(), attempt+1, policy.MaxAttempts)
+	})
+	return provider, nil
+}
+
+// newRegistry returns the tools of allTools that can be offered with
+// provider and the configuration, including plugins.
+func newRegistry(cfg config.Config, provider llm.Provider, providerName string) *tools.Registry {
+	// Semantic search needs an embeddings endpoint, which not every
+	// provider has.
+	registry := tools.NewRegistry(allTools()...)
+	if embedder, ok := llm.EmbedderOf(provider); ok {
+		model := cfg.EmbeddingModel
+		if model == "" {
+			model = llm.DefaultEmbeddingModel(providerName)
+		}
+		tools.SemanticIndex = index.New(index.DefaultDir, embedder, model)
+	} else {
+		registry.Unregister(tools.SemanticSearchDefinition.Name)
+	}
+	if engine, err := websearch.New(cfg.WebSearch); err == nil {
+		tools.WebSearchEngine = engine
+	} else {
+		warn("web_search disabled: %v", err)
+		registry.Unregister(tools.WebSearchDefinition.Name)
+	}
+	registerPlugins(registry, cfg.Plugins)
+	applyToolSettings(registry, cfg.Tools)
+	applyApprovalPolicy(registry, cfg.Approval)
+	tools.FetchDomains = cfg.FetchDomains
+	git.PullRequests = git.PullRequestSettings(cfg.PullRequests)
+	// Tokens in the config are masked like those in the environment.
+	redact.AddValues(cfg.PullRequests.GitHubToken, cfg.PullRequests.GitLabToken)
+	tools.MaxReadFileSize = cfg.ReadFileMaxSize
+	if len(cfg.Formatters) > 0 {
+		tools.PostEditHooks = append(tools.PostEditHooks, tools.FormatHook(cfg.Formatters))
+	}
+	return registry
+}
+
+// startLanguageServers sets up the language servers for the tools that use
+// them, or removes those tools. The caller closes tools.LanguageServers.
+func startLanguageServers(registry *tools.Registry, cwd string, cfg config.Config, trusted bool) {
+	// Language servers run the project's own tooling, such as go list or
+	// build scripts, so they are only started in trusted workspaces.
+	if trusted {
+		tools.LanguageServers = lsp.NewManager(cwd, cfg.LSP.Servers)
+		tools.PostEditHooks = append(tools.PostEditHooks, func(path string) string {
+			tools.LanguageServers.FileChanged(path)
+			return ""
+		})
+	} else {
+		for _, tool := range []tools.ToolDefinition{tools.GotoDefinitionDefinition, tools.FindReferencesDefinition, tools.HoverDocsDefinition, tools.DiagnosticsDefinition} {
+			registry.Unregister(tool.Name)
+		}
 	}
+}
 
-	ag := agent.NewAgent(client, getUserMessage, toolsList)
-	err = ag.Run(context.TODO())
+// loadHistory reads the prompt history, reporting but otherwise ignoring a
+// history that cannot be read.
+func loadHistory() *input.History {
+	history, err := input.LoadHistory(input.DefaultHistoryPath())
 	if err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
+		fmt.Printf("Error loading prompt history: %v\n", err)
+	}
+	return history
+}
+
+// runHeadless works on prompt without interaction, prints the report and,
+// when reportPath is set, writes it there as JSON. It returns the exit code.
+func runHeadless(ag *agent.Agent, prompt string, maxSteps int, reportPath string, stream *events.Stream) int {
+	// Ctrl-C ends the run with a report; a second one kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	report := ag.RunPrompt(ctx, prompt, maxSteps)
+	if stream != nil {
+		// The process exits without running deferred calls.
+		defer stream.Close()
+		stream.Emit(events.Event{Type: events.TypeReport, Report: report})
+	} else {
+		fmt.Printf("\n\u001b[1mReport\u001b[0m\n%s", report)
+	}
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(reportPath, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			fmt.Printf("Error writing report: %v\n", err)
+			return 1
+		}
+	}
+	return report.ExitCode()
+}
+
+// issueMessage fetches the GitHub issue ref names and returns the message
+// that starts a session on it.
+func issueMessage(ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	issueRef, err := github.ParseRef(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	issue, err := github.NewClient().Issue(ctx, issueRef)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Working on %s: %s\n", issueRef, issue.Title)
+	return "Work on this GitHub issue: find its cause in the workspace and fix it, or make the change it asks for, then check that the project builds and its tests pass.\n\n" + issue.Markdown(), nil
+}
+
+// saveOnExit saves the conversation when the user quits with Ctrl-C, unless
+// nothing has been said yet.
+func saveOnExit(ag *agent.Agent) {
+	for _, msg := range ag.Conversation() {
+		if msg.Role == llm.RoleUser {
+			if err := commands.Save(ag, nil); err != nil {
+				fmt.Printf("Error saving the conversation: %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+// newLLMConfig returns the model settings of cfg overridden by the
+// environment.
+func newLLMConfig(cfg config.Config) llm.Config {
+	llmConfig := llm.Config{
+		Provider:       cfg.Provider,
+		Model:          cfg.Model,
+		BaseURL:        cfg.BaseURL,
+		MaxTokens:      cfg.MaxTokens,
+		Temperature:    cfg.Temperature,
+		APIVersion:     cfg.Azure.APIVersion,
+		Deployments:    cfg.Azure.Deployments,
+		SafetySettings: cfg.Gemini.SafetySettings,
+	}
+	llmConfig.ApplyEnv()
+	return llmConfig
+}
+
+// newRouter returns the model router of the settings.
+func newRouter(settings config.RoutingSettings) agent.Router {
+	return agent.Router{
+		CheapModel:     settings.CheapModel,
+		StrongModel:    settings.StrongModel,
+		MaxCheapLength: settings.MaxCheapLength,
+		StrongKeywords: settings.StrongKeywords,
+		MaxFailures:    settings.MaxFailures,
+	}
+}
+
+// retryPolicy is llm.DefaultRetryPolicy with the configured settings
+// applied.
+func retryPolicy(settings config.RetrySettings) llm.RetryPolicy {
+	policy := llm.DefaultRetryPolicy
+	if settings.MaxAttempts > 0 {
+		policy.MaxAttempts = settings.MaxAttempts
+	}
+	if settings.InitialBackoff > 0 {
+		policy.InitialBackoff = settings.InitialBackoff
+	}
+	if settings.MaxBackoff > 0 {
+		policy.MaxBackoff = settings.MaxBackoff
 	}
+	if settings.Jitter != nil {
+		policy.Jitter = *settings.Jitter
+	}
+	return policy
+}
+
+// registerPlugins adds the tools implemented by executables. A plugin may
+// not take the place of a built-in tool.
+func registerPlugins(registry *tools.Registry, plugins []config.PluginSettings) {
+	for _, plugin := range plugins {
+		if _, exists := registry.Lookup(plugin.Name); exists {
+			warn("plugin %s has the name of a built-in tool and is ignored", plugin.Name)
+			continue
+		}
+		tool, err := tools.NewExternalTool(tools.ExternalTool{
+			Name:        plugin.Name,
+			Description: plugin.Description,
+			Command:     plugin.Command,
+			Args:        plugin.Args,
+			Schema:      plugin.Schema,
+			Category:    tools.Category(plugin.Category),
+			Timeout:     plugin.Timeout,
+		})
+		if err != nil {
+			warn("plugin not loaded: %v", err)
+			continue
+		}
+		registry.Register(tool)
+	}
+}
+
+// newHooks returns the runner of the configured hooks, or nil when there
+// are none or they are invalid.
+func newHooks(cfg config.Config, cwd string) *hooks.Runner {
+	if len(cfg.Hooks) == 0 {
+		return nil
+	}
+	list := make([]hooks.Hook, len(cfg.Hooks))
+	for i, hook := range cfg.Hooks {
+		list[i] = hooks.Hook{Event: hook.Event, Tools: hook.Tools, Command: hook.Command, Timeout: hook.Timeout}
+	}
+	runner, err := hooks.New(cwd, list)
+	if err != nil {
+		warn("hooks not run: %v", err)
+		return nil
+	}
+	return runner
+}
+
+// applyToolSettings disables the tools turned off in the config, which can
+// still be enabled with /tools, and pre-approves the tools configured to run
+// without asking.
+func applyToolSettings(registry *tools.Registry, settings map[string]config.ToolSettings) {
+	for name, s := range settings {
+		if err := registry.SetEnabled(name, !s.Disabled); err != nil {
+			warn("config refers to unknown tool %q", name)
+			continue
+		}
+		if s.AutoApprove {
+			tools.ApproveAlways(name)
+		}
+	}
+}
+
+// applyApprovalPolicy makes settings the session's approval policy. The
+// tools of a category the policy allows are approved for the session, and
+// those of a category it denies are not offered to the model; calls to
+// them are refused all the same if they are turned back on with /tools.
+func applyApprovalPolicy(registry *tools.Registry, settings config.ApprovalSettings) {
+	p, err := settings.Policy()
+	if err != nil {
+		warn("approval policy not applied: %v", err)
+		return
+	}
+	tools.Policy = p
+	for _, tool := range registry.All() {
+		switch p.Category(string(tool.Category)) {
+		case policy.Allow:
+			tools.ApproveAlways(tool.Name)
+		case policy.Deny:
+			registry.SetEnabled(tool.Name, false)
+		}
+	}
+}
+
+// changeWorkdir makes dir, when set, the workspace. The tools, the config
+// and the system prompt all take the workspace to be the current directory,
+// so the agent moves there before anything looks at it.
+func changeWorkdir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("--workdir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--workdir: %s is not a directory", dir)
+	}
+	return os.Chdir(dir)
+}
+
+// trustWorkspace reports whether the user trusts dir, asking the first time
+// the agent runs there and remembering a yes in the user config. With
+// assume set, an untrusted dir is trusted for this session without asking.
+func trustWorkspace(dir string, assume bool) bool {
+	trusted, err := config.IsTrusted(dir)
+	if err != nil {
+		fmt.Printf("Error reading trusted directories: %v\n", err)
+	}
+	if trusted || assume {
+		return true
+	}
+
+	warn("%s is not a trusted workspace. Files in it may contain instructions that try to make the agent modify files or run commands.", dir)
+	if !tools.Confirm("Trust this folder and enable tools that write files and run commands?") {
+		return false
+	}
+	err = config.Trust(dir)
+	if err != nil {
+		fmt.Printf("Error saving trusted directory: %v\n", err)
+	}
+	return true
+}
+
+// exit ends the program with the code, like os.Exit, once everything
+// printed has reached the terminal.
+func exit(code int) {
+	restoreConsole()
+	os.Exit(code)
+}
+
+// warn tells the user about a problem that does not stop the agent, and
+// logs it.
+func warn(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Printf("\u001b[93mWarning\u001b[0m: %s\n", message)
+	log.Warn(message)
 }
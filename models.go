@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"code-editing-agent/internal/config"
+	"code-editing-agent/internal/llm"
+)
+
+// listModels runs `agent models`, which prints the models the configured
+// provider serves, and returns the exit code.
+func listModels(args []string) int {
+	flags := flag.NewFlagSet("models", flag.ExitOnError)
+	providerFlag := flags.String("provider", "", "LLM provider whose models to list (overrides config and LLM_PROVIDER)")
+	baseURLFlag := flags.String("base-url", "", "Base URL of the model API (overrides config)")
+	flags.Parse(args)
+	cwd, _ := os.Getwd()
+	workspace := cwd
+	if trusted, _ := config.IsTrusted(cwd); trusted {
+		godotenv.Load()
+	} else {
+		workspace = ""
+	}
+	cfg, err := config.Load(workspace)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	llmConfig := newLLMConfig(cfg)
+	if *providerFlag != "" {
+		llmConfig.Provider = *providerFlag
+	}
+	if *baseURLFlag != "" {
+		llmConfig.BaseURL = *baseURLFlag
+	}
+	provider, err := llm.New(&llmConfig)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	lister, ok := provider.(llm.ModelLister)
+	if !ok {
+		fmt.Printf("The %s provider cannot list its models.\n", llmConfig.Provider)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		fmt.Println(model)
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"code-editing-agent/internal/audit"
+	"code-editing-agent/internal/config"
+	"code-editing-agent/internal/tools"
+	"code-editing-agent/internal/tools/git"
+)
+
+// replay runs `agent replay <session>`, which makes the file changes of a
+// recorded session again, call by call, so its result can be reproduced on
+// a clean checkout, and returns the exit code.
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	dir := flags.String("dir", audit.DefaultDir, "Directory of the audit logs")
+	force := flags.Bool("force", false, "Replay even if the working tree has uncommitted changes")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Println("usage: agent replay [--dir DIR] [--force] <session or log file>")
+		if sessions, err := audit.Sessions(*dir); err == nil && len(sessions) > 0 {
+			fmt.Printf("Sessions in %s:\n  %s\n", *dir, strings.Join(sessions, "\n  "))
+		}
+		return 2
+	}
+	entries, err := audit.Load(*dir, flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+
+	// The recorded changes apply to the files as the session found them.
+	if !*force {
+		status, err := git.Run("status", "--porcelain", "--", ".", ":(exclude).agent")
+		if err != nil {
+			fmt.Printf("Error: %s\nReplay in a git checkout, or pass --force.\n", err.Error())
+			return 1
+		}
+		if strings.TrimSpace(status) != "" {
+			fmt.Printf("The working tree has uncommitted changes:\n%s\nReplay on a clean checkout, or pass --force.\n", status)
+			return 1
+		}
+	}
+
+	// Formatters ran on the session's edits, so they run on the replayed
+	// ones too. The calls were approved when recorded.
+	cwd, _ := os.Getwd()
+	workspace := cwd
+	if trusted, _ := config.IsTrusted(cwd); !trusted {
+		workspace = ""
+	}
+	cfg, err := config.Load(workspace)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	if len(cfg.Formatters) > 0 {
+		tools.PostEditHooks = append(tools.PostEditHooks, tools.FormatHook(cfg.Formatters))
+	}
+	tools.AutoApprove = true
+	registry := tools.NewRegistry(allTools()...)
+
+	replayed, differing, skipped := 0, 0, 0
+	for i, entry := range entries {
+		// Only calls that changed files are replayed; commands and git
+		// operations are reported.
+		if len(entry.Files) == 0 {
+			if entry.Success && !entry.DryRun && entry.Category != tools.CategoryRead {
+				fmt.Printf("\u001b[90m#%d %s not replayed: it changed no files through the agent's checkpoints\u001b[0m\n", i+1, entry.Tool)
+				skipped++
+			}
+			continue
+		}
+		tool, ok := registry.Lookup(entry.Tool)
+		if !ok {
+			fmt.Printf("\u001b[91m#%d %s\u001b[0m: the tool is not available; stopping\n", i+1, entry.Tool)
+			return 1
+		}
+
+		lastID := audit.LastCheckpoint(tools.Checkpoints)
+		fmt.Printf("\u001b[92m#%d %s\u001b[0m %s\n", i+1, entry.Tool, strings.Join(entry.Files, ", "))
+		if _, err := tool.Function(context.Background(), entry.Input); err != nil {
+			fmt.Printf("\u001b[91mFailed\u001b[0m: %v\nStopping: later changes build on this one.\n", err)
+			return 1
+		}
+		replayed++
+		if _, diff := audit.Changes(tools.Checkpoints, lastID); diff != entry.Diff {
+			differing++
+			fmt.Printf("\u001b[93mDiffers\u001b[0m from the recorded change:\n%s", diff)
+		}
+	}
+
+	fmt.Printf("Replayed %d of the session's file changes", replayed)
+	if differing > 0 {
+		fmt.Printf("; %d came out differently than recorded", differing)
+	}
+	if skipped > 0 {
+		fmt.Printf("; %d other call(s) were not replayed", skipped)
+	}
+	fmt.Println(".")
+	if differing > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+
+	"code-editing-agent/internal/agent"
+	"code-editing-agent/internal/audit"
+	"code-editing-agent/internal/commands"
+	"code-editing-agent/internal/config"
+	"code-editing-agent/internal/mcp"
+	"code-editing-agent/internal/server"
+	"code-editing-agent/internal/sessions"
+	"code-editing-agent/internal/shell"
+	"code-editing-agent/internal/templates"
+	"code-editing-agent/internal/tools"
+)
+
+// mcpTools are the tools offered to MCP clients: enough to read, search and
+// edit the workspace and to run commands in it.
+var mcpTools = map[string]bool{
+	tools.ReadFileDefinition.Name:     true,
+	tools.ListFilesDefinition.Name:    true,
+	tools.SearchFilesDefinition.Name:  true,
+	tools.CodeOutlineDefinition.Name:  true,
+	tools.EditFileDefinition.Name:     true,
+	tools.EditFilesDefinition.Name:    true,
+	tools.WriteFileDefinition.Name:    true,
+	tools.ApplyPatchDefinition.Name:   true,
+	tools.ExecuteShellDefinition.Name: true,
+	tools.RunTestsDefinition.Name:     true,
+	tools.CheckBuildDefinition.Name:   true,
+}
+
+// workspaceTools work on the semantic index and language servers of the
+// workspace the agent was started in.
+var workspaceTools = []tools.ToolDefinition{
+	tools.SemanticSearchDefinition,
+	tools.GotoDefinitionDefinition,
+	tools.FindReferencesDefinition,
+	tools.HoverDocsDefinition,
+	tools.DiagnosticsDefinition,
+}
+
+// serve runs `agent serve`, which offers the agent to other programs
+// instead of chatting in the terminal: its tools over MCP, or chat sessions
+// over HTTP. It returns the exit code.
+func serve(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	useMCP := flags.Bool("mcp", false, "Serve the tools over the Model Context Protocol on stdin and stdout")
+	httpAddr := flags.String("http", "", "Serve chat sessions over HTTP and WebSocket on this address, e.g. :8080")
+	token := flags.String("token", "", "Token clients of --http must send (default $AGENT_SERVER_TOKEN, or a random one)")
+	workdir := flags.String("workdir", "", "Serve the project in this directory instead of the current one")
+	flags.Parse(args)
+	if err := changeWorkdir(*workdir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if *useMCP == (*httpAddr != "") {
+		fmt.Fprintln(os.Stderr, "usage: agent serve --mcp | --http addr [--token token] [--workdir dir]")
+		return 2
+	}
+	if *httpAddr != "" {
+		return serveHTTP(*httpAddr, *token)
+	}
+
+	// Stdout carries the protocol, so whatever the tools print for people
+	// goes to stderr. The client asks its own user before calling a tool,
+	// so AskUser stays unset and the tools do not ask again.
+	protocol := os.Stdout
+	os.Stdout = os.Stderr
+	shell.Output = os.Stderr
+
+	// The workspace must have been trusted in an interactive session for
+	// tools that write or run commands to be offered.
+	cwd, _ := os.Getwd()
+	trusted, err := config.IsTrusted(cwd)
+	if err != nil {
+		fmt.Printf("Error reading trusted directories: %v\n", err)
+	}
+	workspace := cwd
+	if !trusted {
+		workspace = ""
+	}
+	cfg, err := config.Load(workspace)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+
+	registry := tools.NewRegistry()
+	for _, tool := range allTools() {
+		if mcpTools[tool.Name] {
+			registry.Register(tool)
+		}
+	}
+	applyToolSettings(registry, cfg.Tools)
+	applyApprovalPolicy(registry, cfg.Approval)
+	tools.MaxReadFileSize = cfg.ReadFileMaxSize
+	list := registry.Enabled()
+	if !trusted {
+		list = tools.ReadOnlyTools(list)
+		fmt.Printf("Workspace %s not trusted: only read-only tools are served. Run the agent there once to trust it.\n", cwd)
+	}
+
+	server := &mcp.Server{Name: "code-editing-agent", Version: "1.0.0", Tools: list}
+	err = server.Serve(context.Background(), os.Stdin, protocol)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// serveHTTP runs `agent serve --http`, which lets browser-based UIs and
+// other programs chat with the agent through the API of package server,
+// and returns the exit code.
+func serveHTTP(addr, token string) int {
+	// As with MCP, the workspace must have been trusted in an interactive
+	// session for tools that write or run commands to be offered.
+	cwd, _ := os.Getwd()
+	trusted, err := config.IsTrusted(cwd)
+	if err != nil {
+		fmt.Printf("Error reading trusted directories: %v\n", err)
+	}
+	workspace := cwd
+	if !trusted {
+		workspace = ""
+	}
+	// API keys may be kept in .env, as for the chat, which is read only in
+	// a trusted workspace since it could also point them at another server.
+	if trusted {
+		godotenv.Load()
+	}
+	cfg, err := config.Load(workspace)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	llmConfig := newLLMConfig(cfg)
+	provider, err := newProvider(cfg, &llmConfig)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	registry := newRegistry(cfg, provider, llmConfig.Provider)
+	startLanguageServers(registry, cwd, cfg, trusted)
+	if tools.LanguageServers != nil {
+		defer tools.LanguageServers.Close()
+	}
+	if !trusted {
+		fmt.Printf("Workspace %s not trusted: its sessions are offered only read-only tools. Run the agent there once to trust it.\n", cwd)
+	}
+	commands.ConfiguredTemplates = cfg.Templates
+	if trusted {
+		commands.TemplateDir = templates.DefaultDir
+		commands.SessionIndex = sessions.DefaultPath
+	}
+	// Each trusted working directory records the tool calls of its
+	// sessions in its own audit log. NewAgent is only called by the
+	// session holding the floor, so the map needs no lock.
+	auditLogs := map[string]*audit.Log{}
+	defer func() {
+		for _, auditLog := range auditLogs {
+			if auditLog != nil {
+				auditLog.Close()
+			}
+		}
+	}()
+
+	if token == "" {
+		token = os.Getenv("AGENT_SERVER_TOKEN")
+	}
+	if token == "" {
+		token, err = server.NewToken()
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
+		fmt.Printf("Token: %s\n", token)
+	}
+
+	// Every session has its own conversation, budget, working directory
+	// and tools, which /tools switches on and off for that session alone.
+	srv := &server.Server{
+		Token:   token,
+		Workdir: cwd,
+		OnClose: saveOnExit,
+		NewAgent: func(workdir string, getUserMessage func() (string, bool)) (*agent.Agent, error) {
+			sessionTrusted, err := config.IsTrusted(workdir)
+			if err != nil {
+				return nil, err
+			}
+			sessionTools := registry.Clone()
+			if !sessionTrusted {
+				for _, tool := range sessionTools.All() {
+					if tool.Category != tools.CategoryRead {
+						sessionTools.Unregister(tool.Name)
+					}
+				}
+			}
+			if workdir != cwd {
+				// The language servers and the semantic index are those of
+				// the server's workspace.
+				for _, tool := range workspaceTools {
+					sessionTools.Unregister(tool.Name)
+				}
+			}
+			systemPrompt := agent.SystemPromptBuilder{
+				Instructions: cfg.SystemPrompt,
+				WorkDir:      workdir,
+				ContextFiles: cfg.ContextFiles,
+			}.Build()
+
+			ag := agent.NewAgent(provider, llmConfig, systemPrompt, getUserMessage, sessionTools)
+			ag.RegisterCommands(commands.Builtin()...)
+			ag.SetBudget(agent.Budget{MaxRequests: cfg.Limits.MaxRequests, MaxCost: cfg.Limits.MaxCost})
+			ag.SetMaxTurnSteps(cfg.Limits.MaxTurnSteps)
+			ag.SetRouter(newRouter(cfg.Routing))
+			ag.SetAutoVerify(cfg.AutoVerify)
+			ag.SetHooks(newHooks(cfg, workdir))
+			if sessionTrusted {
+				auditLog, ok := auditLogs[workdir]
+				if !ok {
+					auditLog, err = audit.Open(filepath.Join(workdir, audit.DefaultDir))
+					if err != nil {
+						warn("not recording tool calls in %s: %v", workdir, err)
+					}
+					auditLogs[workdir] = auditLog
+				}
+				if auditLog != nil {
+					ag.SetAudit(auditLog)
+				}
+				ag.SetSessionIndex(filepath.Join(workdir, sessions.DefaultPath))
+			}
+			return ag, nil
+		},
+	}
+	// Approvals are asked of the client of the session whose tool asks.
+	tools.AskUser = srv.Ask
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := srv.ListenAndServe(ctx, addr); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}